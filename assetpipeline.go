@@ -0,0 +1,99 @@
+package pages
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// AssetTransformer transforms the content of a static asset before it is served, e.g. minifies
+// it (see MinifyCSS and MinifyJS). See Handler.AssetTransformers.
+type AssetTransformer func(content []byte) ([]byte, error)
+
+// maxContentCacheSize is the maximum total size of the processed files kept by a contentCache.
+const maxContentCacheSize = 64 << 20
+
+// contentCache keeps the processed (e.g. transformed or compressed) static files in memory by
+// the hash of their content, so the changed files are processed again. The kind distinguishes
+// the different processing of the same content, e.g. the transformers of the file extension.
+type contentCache struct {
+	files sync.Map // [sha256.Size]byte -> []byte
+	size  atomic.Int64
+}
+
+// load returns the processed data, processing it unless it is in the cache.
+func (c *contentCache) load(
+	kind string, data []byte, process func([]byte) ([]byte, error),
+) ([]byte, error) {
+	hash := sha256.New()
+	hash.Write([]byte(kind + "\x00"))
+	hash.Write(data)
+	var key [sha256.Size]byte
+	hash.Sum(key[:0])
+	if v, ok := c.files.Load(key); ok {
+		return v.([]byte), nil
+	}
+
+	res, err := process(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.size.Add(int64(len(res))) <= maxContentCacheSize {
+		c.files.Store(key, res)
+	} else {
+		c.size.Add(-int64(len(res)))
+	}
+	return res, nil
+}
+
+// serveStatic serves a static file through the asset pipeline: the AssetTransformers of its
+// extension, then the compression (see Handler.Compression). It returns false if the file is
+// left to http.FileServerFS, e.g. a directory or a file that needs no processing.
+func (h *Handler) serveStatic(w http.ResponseWriter, r *http.Request, fsys fs.FS, fsPath string) bool {
+	name := strings.TrimPrefix(path.Clean("/"+fsPath), "/")
+	fi, err := fs.Stat(fsys, name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	if len(h.AssetTransformers[strings.ToLower(path.Ext(name))]) == 0 {
+		return h.Compression && h.serveCompressedFile(w, r, fsys, name, fi)
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return false
+	}
+	h.serveContent(w, r, name, fi.ModTime(), h.transformAsset(name, data))
+	return true
+}
+
+// transformAsset returns the content of the static file transformed by the AssetTransformers of
+// its extension. If a transformer fails, the error is logged and the content is returned as is.
+func (h *Handler) transformAsset(name string, data []byte) []byte {
+	ext := strings.ToLower(path.Ext(name))
+	transformers := h.AssetTransformers[ext]
+	if len(transformers) == 0 {
+		return data
+	}
+	out, err := h.transformed.load(ext, data, func(data []byte) ([]byte, error) {
+		for i, t := range transformers {
+			var err error
+			if data, err = t(data); err != nil {
+				return nil, fmt.Errorf("transformer #%d: %w", i, err)
+			}
+		}
+		return data, nil
+	})
+	if err != nil {
+		// the asset is still usable, just not transformed
+		h.logger.Warn("Transform asset", "path", name, "error", err)
+		return data
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package pages
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPages_AssetTransformers(t *testing.T) {
+	css := "body {\n  color: red;\n}\n" + strings.Repeat("/* padding */\n", 100)
+	fsys := fstest.MapFS{
+		"style.css":  {Data: []byte(css)},
+		"app.js":     {Data: []byte("let x = 1; // one\n")},
+		"broken.txt": {Data: []byte("as is")},
+		"logo.svg":   {Data: []byte("<svg/>")},
+	}
+	fail := func([]byte) ([]byte, error) { return nil, errors.New("boom") }
+	h := &Handler{
+		FileSystem: fsys,
+		AssetTransformers: map[string][]AssetTransformer{
+			".css": {MinifyCSS},
+			".js":  {MinifyJS, func(b []byte) ([]byte, error) { return append(b, "\n// v1"...), nil }},
+			".txt": {fail},
+		},
+		Compression: true,
+	}
+
+	tests := []struct {
+		url, accept  string
+		wantType     string
+		wantEncoding string
+		wantBody     string
+	}{
+		{"/style.css", "", "text/css; charset=utf-8", "", "body{color:red}"},
+		{"/style.css", "gzip", "text/css; charset=utf-8", "", "body{color:red}"}, // too small now
+		{"/app.js", "", "text/javascript; charset=utf-8", "", "let x=1;\n// v1"},
+		{"/broken.txt", "", "text/plain; charset=utf-8", "", "as is"},
+		{"/logo.svg", "", "image/svg+xml", "", "<svg/>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != 200 {
+				t.Fatalf("status code: got %d, want 200", rr.Code)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type: got %q, want %q", got, tt.wantType)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding: got %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("body: got %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("compressed", func(t *testing.T) {
+		large := strings.Repeat(".a { color: red ; }\n", 200)
+		fsys["large.css"] = &fstest.MapFile{Data: []byte(large)}
+
+		req := httptest.NewRequest("GET", "/large.css", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding: got %q, want gzip", got)
+		}
+		zr, err := gzip.NewReader(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Repeat(".a{color:red}", 200); string(b) != want {
+			t.Errorf("body: got %q, want %q", b, want)
+		}
+	})
+}
@@ -0,0 +1,546 @@
+package pages
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// AssetDep is an external asset (a script or a stylesheet) a component depends on.
+type AssetDep struct {
+	// Href is the URL of the asset. The assets are deduplicated by Href.
+	Href string
+
+	// Integrity is an optional Subresource Integrity hash of the asset.
+	Integrity string
+
+	// Crossorigin is an optional CORS setting, e.g. "anonymous".
+	Crossorigin string
+
+	// Type is one of "script", "module" (an ES module script) or "style". If empty, it is
+	// inferred from the Href extension: ".css" files are stylesheets, everything else is a script.
+	Type string
+}
+
+// AssetDepComponent declares an external asset dependency of a component, e.g.:
+//
+//	<c:asset-dep href="https://cdn.example.com/chart.js" integrity="sha384-..."></c:asset-dep>
+//
+// The component renders nothing. Instead, the dependency is collected in a per-page registry,
+// and after the page is rendered, each asset is injected once into the page <head> (or at the
+// beginning of the output if the page has no <head>, e.g. an HTML fragment). The assets already
+// referenced by the page are not injected. This allows widget components to be self-contained
+// including their third-party scripts.
+type AssetDepComponent struct{}
+
+var _ chtml.Component = AssetDepComponent{}
+
+func (ac AssetDepComponent) Render(s chtml.Scope) (any, error) {
+	var dep AssetDep
+	if err := chtml.UnmarshalScope(s, &dep); err != nil {
+		return nil, err
+	}
+	if ac, ok := s.(AssetCollector); ok && dep.Href != "" {
+		ac.AddAsset(dep)
+	}
+	return nil, nil
+}
+
+// AssetCollector collects the asset dependencies of the rendered components. The scopes of
+// the pages rendered by the Handler implement it, so custom components can declare their assets
+// the same way as AssetDepComponent:
+//
+//	if ac, ok := s.(pages.AssetCollector); ok {
+//	    ac.AddAsset(pages.AssetDep{Href: "/widgets/chart.js"})
+//	}
+type AssetCollector interface {
+	AddAsset(dep AssetDep)
+}
+
+// NopAssetCollector is an AssetCollector discarding the dependencies, e.g. for the components
+// rendered outside of a page.
+type NopAssetCollector struct{}
+
+func (NopAssetCollector) AddAsset(AssetDep) {}
+
+// assetRegistry collects the asset dependencies declared during a render pass.
+type assetRegistry struct {
+	mu   sync.Mutex
+	deps []AssetDep
+
+	// recorders are the active recordings, see record.
+	recorders []*[]AssetDep
+
+	// rendered are the URLs of the assets rendered in place by AssetComponent.
+	rendered map[string]bool
+}
+
+func (r *assetRegistry) add(dep AssetDep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deps = appendAssetDep(r.deps, dep)
+	for _, rec := range r.recorders {
+		*rec = appendAssetDep(*rec, dep)
+	}
+}
+
+// record starts recording the dependencies added to the registry, including the ones already
+// registered. The returned function stops the recording and returns the recorded dependencies.
+func (r *assetRegistry) record() func() []AssetDep {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := new([]AssetDep)
+	r.recorders = append(r.recorders, rec)
+
+	return func() []AssetDep {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.recorders = slices.DeleteFunc(r.recorders, func(v *[]AssetDep) bool { return v == rec })
+		return *rec
+	}
+}
+
+// appendAssetDep appends the dependency unless it is already in the list.
+func appendAssetDep(deps []AssetDep, dep AssetDep) []AssetDep {
+	if slices.ContainsFunc(deps, func(d AssetDep) bool { return d.Href == dep.Href }) {
+		return deps
+	}
+	return append(deps, dep)
+}
+
+// reset clears the registry before a new render pass.
+func (r *assetRegistry) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deps = nil
+	r.rendered = nil
+}
+
+// claim reports whether the asset is not rendered in the render pass yet, and marks it rendered.
+func (r *assetRegistry) claim(href string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rendered[href] {
+		return false
+	}
+	if r.rendered == nil {
+		r.rendered = map[string]bool{}
+	}
+	r.rendered[href] = true
+	return true
+}
+
+// inject adds the collected assets to the document, skipping the ones already referenced.
+// It returns the new root if the document had to be wrapped.
+func (r *assetRegistry) inject(doc *html.Node) *html.Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.deps) == 0 {
+		return doc
+	}
+
+	existing := map[string]bool{}
+	var head *html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Head:
+				if head == nil {
+					head = n
+				}
+			case atom.Script:
+				existing[getAttr(n, "src")] = true
+			case atom.Link:
+				existing[getAttr(n, "href")] = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	parent, before := head, (*html.Node)(nil)
+	if parent == nil {
+		if doc.Type != html.DocumentNode {
+			root := &html.Node{Type: html.DocumentNode}
+			root.AppendChild(doc)
+			doc = root
+		}
+		parent, before = doc, doc.FirstChild
+	}
+
+	for _, dep := range r.deps {
+		if existing[dep.Href] {
+			continue
+		}
+		parent.InsertBefore(dep.node(), before)
+	}
+	return doc
+}
+
+// node creates the HTML element referencing the asset.
+func (d AssetDep) node() *html.Node {
+	typ := d.Type
+	if typ == "" {
+		typ = "script"
+		if strings.EqualFold(path.Ext(strings.SplitN(d.Href, "?", 2)[0]), ".css") {
+			typ = "style"
+		}
+	}
+
+	var n *html.Node
+	if typ == "style" {
+		n = &html.Node{Type: html.ElementNode, DataAtom: atom.Link, Data: "link"}
+		setAttr(n, "rel", "stylesheet")
+		setAttr(n, "href", d.Href)
+	} else {
+		n = &html.Node{Type: html.ElementNode, DataAtom: atom.Script, Data: "script"}
+		if typ == "module" {
+			setAttr(n, "type", "module")
+		}
+		setAttr(n, "src", d.Href)
+	}
+	if d.Integrity != "" {
+		setAttr(n, "integrity", d.Integrity)
+	}
+	if d.Crossorigin != "" {
+		setAttr(n, "crossorigin", d.Crossorigin)
+	}
+	return n
+}
+
+// AssetComponent references a static asset from the FileSystem with a content hash in the URL,
+// so the asset can be cached by the browsers forever, e.g.:
+//
+//	<c:asset name="js/messages.js"></c:asset>
+//
+// renders <script src="/js/messages.de.js?v=5f2b1c0d9e8a"></script> for a request with the "de"
+// locale (see Handler.LocaleSelector). The locale variants of the asset are looked up in
+// the following order: messages.de-AT.js, messages.de.js, messages.js. Each variant is hashed
+// independently.
+//
+// The following arguments are accepted:
+//   - name - the path to the asset in the FileSystem;
+//   - type - one of "script", "module", "style" (see AssetDep) or "url". The "url" type makes the
+//     component return the URL string instead of an element, e.g. for <img src="...">;
+//   - crossorigin - the CORS setting of the element, e.g. "anonymous".
+//
+// The element of an asset is rendered once per page: the components used several times on
+// a page (e.g. a widget in a loop) may reference their assets without duplicating them.
+//
+// If FileSystem is nil, the Handler's FileSystem is used. AssetComponent must be used by pointer
+// as it caches the hashes of the assets.
+type AssetComponent struct {
+	// FileSystem to look up the assets in.
+	FileSystem fs.FS
+
+	// Integrity adds the Subresource Integrity hash (integrity="sha256-...") of the asset to
+	// the elements, so the browsers refuse the asset if it is modified, e.g. by a CDN. The hash
+	// is computed from the content served by the Handler, i.e. after the AssetTransformers.
+	Integrity bool
+
+	hashes assetHashes
+}
+
+var _ chtml.Component = (*AssetComponent)(nil)
+
+// Path returns the URL of the asset with the content hash, like the "url" type of the component,
+// without the locale variants. It requires the FileSystem. It is meant to be registered as
+// a template function (see Handler.TemplateFuncs) to reference the fingerprinted images, fonts
+// and other files in the expressions:
+//
+//	handler.TemplateFuncs = map[string]any{"assetPath": assets.Path}
+//
+//	<img src="${assetPath('img/logo.png')}">
+func (ac *AssetComponent) Path(name string) (string, error) {
+	if ac.FileSystem == nil {
+		return "", fmt.Errorf("asset %s: no file system", name)
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	sum, err := ac.hashes.hash(ac.FileSystem, clean)
+	if err != nil {
+		return "", fmt.Errorf("asset %s: %w", name, err)
+	}
+	return "/" + clean + "?v=" + sum, nil
+}
+
+// AddFromFS hashes the files in the directory of the file system and its subdirectories ahead of
+// the first requests, e.g. at startup:
+//
+//	assets := &pages.AssetComponent{}
+//	if err := assets.AddFromFS(fsys, "static"); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// The files changed later are hashed again when they are referenced.
+func (ac *AssetComponent) AddFromFS(fsys fs.FS, dir string) error {
+	dir = strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if dir == "" {
+		dir = "."
+	}
+	return fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, err := ac.hashes.hash(fsys, name); err != nil {
+			return fmt.Errorf("asset %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// assetHashes caches the content hashes of the assets by path.
+type assetHashes struct {
+	mu     sync.Mutex
+	hashes map[string]assetHash
+}
+
+// assetHash is a cached content hash of an asset, invalidated when the file changes.
+type assetHash struct {
+	modTime   time.Time
+	size      int64
+	sum       string
+	integrity string // computed on demand, see assetHashes.integrity
+}
+
+type assetArgs struct {
+	Name        string
+	Type        string
+	Crossorigin string
+}
+
+func (ac *AssetComponent) Render(s chtml.Scope) (any, error) {
+	var args assetArgs
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" {
+		return nil, fmt.Errorf("asset name is required")
+	}
+
+	fsys, locale := ac.FileSystem, ""
+	var assets *assetRegistry
+	var transform func(string, []byte) []byte
+	if v, ok := s.(*scope); ok {
+		if fsys == nil {
+			fsys = v.globals.fsys
+		}
+		locale = v.globals.locale
+		assets = v.globals.assets
+		transform = v.globals.transform
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+args.Name), "/")
+	href := "/" + name
+	dep := AssetDep{Type: args.Type, Crossorigin: args.Crossorigin}
+
+	// outside of a page request (e.g. at parse time) there may be no file system to resolve
+	// the asset, the plain path is used then
+	if fsys != nil {
+		var err error
+		if name, err = resolveAssetVariant(fsys, name, locale); err != nil {
+			return nil, fmt.Errorf("asset %s: %w", args.Name, err)
+		}
+		sum, err := ac.hashes.hash(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("asset %s: %w", args.Name, err)
+		}
+		href = "/" + name + "?v=" + sum
+
+		if ac.Integrity && args.Type != "url" {
+			if dep.Integrity, err = ac.hashes.integrity(fsys, name, transform); err != nil {
+				return nil, fmt.Errorf("asset %s: %w", args.Name, err)
+			}
+		}
+	}
+
+	if args.Type == "url" {
+		return href, nil
+	}
+	if assets != nil && !assets.claim(href) {
+		return nil, nil
+	}
+	dep.Href = href
+	return dep.node(), nil
+}
+
+// versionedAssetCacheControl is the caching policy of the static files requested with the hash
+// of their content, see cacheVersionedAsset.
+var versionedAssetCacheControl = CacheControl{
+	Public:    true,
+	MaxAge:    365 * 24 * 60 * 60,
+	Immutable: true,
+}
+
+// cacheVersionedAsset lets the browsers cache the static file forever if it is requested with
+// the hash of its current content in the URL (see AssetComponent), e.g. /js/app.js?v=5f2b1c0d9e8a.
+// A stale hash gets no caching policy, as the URL may be referenced by a page of the previous
+// version of the file.
+func (h *Handler) cacheVersionedAsset(
+	w http.ResponseWriter, r *http.Request, fsys fs.FS, name string,
+) {
+	v := r.URL.Query().Get("v")
+	if v == "" {
+		return
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if sum, err := h.assetHashes.hash(fsys, name); err == nil && sum == v {
+		w.Header().Set("Cache-Control", versionedAssetCacheControl.String())
+	}
+}
+
+// assetTypes are the media types of the static files missing in the builtin table of the mime
+// package, which may be the only table available, e.g. in a container.
+var assetTypes = map[string]string{
+	".woff2":       "font/woff2",
+	".woff":        "font/woff",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".ico":         "image/x-icon",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".map":         "application/json",
+	".webmanifest": "application/manifest+json",
+}
+
+// assetType returns the media type of a static file by its extension, or an empty string if it
+// is unknown.
+func assetType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return assetTypes[ext]
+}
+
+// setAssetType sets the Content-Type header of a static file whose type is not known to the mime
+// package, so it is not sniffed from the content as application/octet-stream or text/plain.
+func setAssetType(w http.ResponseWriter, name string) {
+	ext := strings.ToLower(path.Ext(name))
+	if ct, ok := assetTypes[ext]; ok && mime.TypeByExtension(ext) == "" {
+		w.Header().Set("Content-Type", ct)
+	}
+}
+
+// resolveAssetVariant returns the path of the best locale variant of the asset.
+func resolveAssetVariant(fsys fs.FS, name, locale string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	var candidates []string
+	for _, l := range localeChain(locale) {
+		candidates = append(candidates, base+"."+l+ext)
+	}
+	candidates = append(candidates, name)
+
+	for _, c := range candidates {
+		fi, err := fs.Stat(fsys, c)
+		if err == nil && !fi.IsDir() {
+			return c, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fs.ErrNotExist
+}
+
+// contentHash returns the version of the asset content used in the asset URLs.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// hash returns the content hash of the file. The hash is recomputed when the file size or
+// modification time changes.
+func (c *assetHashes) hash(fsys fs.FS, name string) (string, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	h, ok := c.hashes[name]
+	c.mu.Unlock()
+	if ok && h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+		return h.sum, nil
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	h = assetHash{modTime: fi.ModTime(), size: fi.Size(), sum: contentHash(data)}
+
+	c.mu.Lock()
+	if c.hashes == nil {
+		c.hashes = map[string]assetHash{}
+	}
+	c.hashes[name] = h
+	c.mu.Unlock()
+
+	return h.sum, nil
+}
+
+// integrity returns the Subresource Integrity hash of the file as it is served, i.e. transformed
+// by the transform function if it is not nil. The hash is recomputed when the file size or
+// modification time changes.
+func (c *assetHashes) integrity(
+	fsys fs.FS, name string, transform func(string, []byte) []byte,
+) (string, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	h, ok := c.hashes[name]
+	c.mu.Unlock()
+	if ok && h.integrity != "" && h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+		return h.integrity, nil
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	h = assetHash{modTime: fi.ModTime(), size: fi.Size(), sum: contentHash(data)}
+	if transform != nil {
+		data = transform(name, data)
+	}
+	sum := sha256.Sum256(data)
+	h.integrity = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	if c.hashes == nil {
+		c.hashes = map[string]assetHash{}
+	}
+	c.hashes[name] = h
+	c.mu.Unlock()
+
+	return h.integrity, nil
+}
@@ -0,0 +1,286 @@
+package pages
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestAssetDepComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"chart.chtml": {Data: []byte(
+			`<c:asset-dep href="https://cdn.example.com/chart.js" integrity="sha384-abc" crossorigin="anonymous"></c:asset-dep>` +
+				`<c:asset-dep href="/css/chart.css"></c:asset-dep>` +
+				`<canvas></canvas>`)},
+		"page.chtml": {Data: []byte(
+			`<html><head><title>Page</title><script src="/app.js"></script></head>` +
+				`<body><c:chart></c:chart><c:chart></c:chart>` +
+				`<c:asset-dep href="/app.js"></c:asset-dep>` +
+				`<c:asset-dep href="/widget.mjs" type="module"></c:asset-dep></body></html>`)},
+		"fragment.chtml": {Data: []byte(`<div><c:chart></c:chart></div>`)},
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"asset-dep": AssetDepComponent{}},
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{
+			url: "/page",
+			want: `<html><head><title>Page</title><script src="/app.js"></script>` +
+				`<script src="https://cdn.example.com/chart.js" integrity="sha384-abc" crossorigin="anonymous"></script>` +
+				`<link rel="stylesheet" href="/css/chart.css"/>` +
+				`<script type="module" src="/widget.mjs"></script>` +
+				`</head><body><canvas></canvas><canvas></canvas></body></html>`,
+		},
+		{
+			url: "/fragment",
+			want: `<script src="https://cdn.example.com/chart.js" integrity="sha384-abc" crossorigin="anonymous"></script>` +
+				`<link rel="stylesheet" href="/css/chart.css"/>` +
+				`<div><canvas></canvas></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Body.String() != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAssetComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"js/messages.js":    {Data: []byte(`var messages = {hello: "Hello"}`)},
+		"js/messages.de.js": {Data: []byte(`var messages = {hello: "Hallo"}`)},
+		"css/app.css":       {Data: []byte(`body {}`)},
+		"page.chtml": {Data: []byte(
+			`<c:asset name="js/messages.js"></c:asset>` +
+				`<c:asset name="/css/app.css"></c:asset>` +
+				`<c:asset name="js/messages.js" type="url" as="u"></c:asset><a href="${u}"></a>`)},
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"asset": &AssetComponent{}},
+	}
+
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{
+			lang: "en-US,en;q=0.9",
+			want: `<script src="/js/messages.js?v=c3f23289427b"></script>` +
+				`<link rel="stylesheet" href="/css/app.css?v=62368a1a2925"/>` +
+				`<a href="/js/messages.js?v=c3f23289427b"></a>`,
+		},
+		{
+			lang: "de-AT,de;q=0.9",
+			want: `<script src="/js/messages.de.js?v=25c5a52a1e59"></script>` +
+				`<link rel="stylesheet" href="/css/app.css?v=62368a1a2925"/>` +
+				`<a href="/js/messages.de.js?v=25c5a52a1e59"></a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/page", nil)
+			req.Header.Set("Accept-Language", tt.lang)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Body.String() != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("once per page", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"js/chart.js": {Data: []byte(`chart()`)},
+			"chart.chtml": {Data: []byte(`<c:asset name="js/chart.js"></c:asset><canvas></canvas>`)},
+			"page.chtml":  {Data: []byte(`<c:chart c:for="i in [1, 2]"></c:chart>`)},
+			"other.chtml": {Data: []byte(`<p>other</p>`)},
+		}
+		h := &Handler{
+			FileSystem:        fsys,
+			BuiltinComponents: map[string]chtml.Component{"asset": &AssetComponent{}},
+		}
+
+		for _, tt := range []struct{ url, want string }{
+			{"/page", `<script src="/js/chart.js?v=b5d45f95e056"></script><canvas></canvas><canvas></canvas>`},
+			{"/page", `<script src="/js/chart.js?v=b5d45f95e056"></script><canvas></canvas><canvas></canvas>`},
+			{"/other", `<p>other</p>`},
+		} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Body.String() != tt.want {
+				t.Errorf("%s body:\ngot  %s\nwant %s", tt.url, rr.Body.String(), tt.want)
+			}
+		}
+	})
+
+	t.Run("LocaleSelector", func(t *testing.T) {
+		h := &Handler{
+			FileSystem:        fsys,
+			BuiltinComponents: map[string]chtml.Component{"asset": &AssetComponent{}},
+			LocaleSelector:    func(r *http.Request) string { return r.URL.Query().Get("lang") },
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/page?lang=de", nil))
+
+		if !strings.Contains(rr.Body.String(), `/js/messages.de.js?v=`) {
+			t.Errorf("unexpected body: %s", rr.Body.String())
+		}
+	})
+}
+
+func TestAssetComponent_AddFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/app.js":      {Data: []byte(`app()`)},
+		"static/css/app.css": {Data: []byte(`body {}`)},
+		"page.chtml":         {Data: []byte(`<p></p>`)},
+	}
+	ac := &AssetComponent{}
+	if err := ac.AddFromFS(fsys, "/static/"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"static/app.js", "static/css/app.css"}
+	if got := slices.Sorted(maps.Keys(ac.hashes.hashes)); !slices.Equal(got, want) {
+		t.Errorf("hashed files: got %v, want %v", got, want)
+	}
+
+	if err := ac.AddFromFS(fsys, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing directory: got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestPages_VersionedAssets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"js/app.js": {Data: []byte(`app()`)},
+	}
+	h := &Handler{FileSystem: fsys}
+	sum := contentHash([]byte(`app()`))
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/js/app.js?v=" + sum, "public, max-age=31536000, immutable"},
+		{"/js/app.js?v=000000000000", ""},
+		{"/js/app.js", ""},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+		if rr.Code != 200 {
+			t.Fatalf("%s: status code: got %d, want 200", tt.url, rr.Code)
+		}
+		if got := rr.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: Cache-Control: got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestAssetComponent_Integrity(t *testing.T) {
+	fsys := fstest.MapFS{
+		"js/app.js":   {Data: []byte("app( 1 ) // call\n")},
+		"css/app.css": {Data: []byte(`body {}`)},
+		"page.chtml": {Data: []byte(
+			`<c:asset name="js/app.js" crossorigin="anonymous"></c:asset>` +
+				`<c:asset name="css/app.css"></c:asset>` +
+				`<c:asset name="css/app.css" type="url" as="u"></c:asset><a href="${u}"></a>`)},
+	}
+	sri := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"asset": &AssetComponent{Integrity: true}},
+		AssetTransformers: map[string][]AssetTransformer{".js": {MinifyJS}},
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+
+	want := `<script src="/js/app.js?v=` + contentHash(fsys["js/app.js"].Data) + `" integrity="` +
+		sri("app(1)") + `" crossorigin="anonymous"></script>` +
+		`<link rel="stylesheet" href="/css/app.css?v=62368a1a2925" integrity="` + sri(`body {}`) + `"/>` +
+		`<a href="/css/app.css?v=62368a1a2925"></a>`
+	if rr.Body.String() != want {
+		t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), want)
+	}
+
+	// the served asset matches the hash
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/js/app.js", nil))
+	if got := sri(rr.Body.String()); !strings.Contains(want, got) {
+		t.Errorf("served asset hash %s is not in the page", got)
+	}
+}
+
+func TestAssetComponent_Path(t *testing.T) {
+	fsys := fstest.MapFS{
+		"img/logo.png":       {Data: []byte("\x89PNG")},
+		"fonts/inter.woff2":  {Data: []byte("wOF2")},
+		"js/app.js.map":      {Data: []byte(`{"version":3}`)},
+		"index.chtml":        {Data: []byte(`<img src="${assetPath('/img/logo.png')}">`)},
+		"missing.chtml":      {Data: []byte(`<img src="${assetPath('img/missing.png')}">`)},
+		"site.webmanifest":   {Data: []byte(`{}`)},
+		"img/icons/icon.ico": {Data: []byte("\x00\x00\x01\x00")},
+	}
+	assets := &AssetComponent{FileSystem: fsys}
+	h := &Handler{
+		FileSystem:    fsys,
+		TemplateFuncs: map[string]any{"assetPath": assets.Path},
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	want := `<img src="/img/logo.png?v=` + contentHash([]byte("\x89PNG")) + `"/>`
+	if rr.Body.String() != want {
+		t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), want)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/missing", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("missing asset: got status %d, want 500", rr.Code)
+	}
+
+	if _, err := (&AssetComponent{}).Path("img/logo.png"); err == nil {
+		t.Error("expected an error without a file system")
+	}
+
+	for url, want := range map[string]string{
+		"/fonts/inter.woff2":  "font/woff2",
+		"/js/app.js.map":      "application/json",
+		"/site.webmanifest":   "application/manifest+json",
+		"/img/logo.png":       "image/png",
+		"/img/icons/icon.ico": "image/", // image/x-icon or image/vnd.microsoft.icon
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, want) {
+			t.Errorf("%s: Content-Type: got %q, want %q", url, got, want)
+		}
+	}
+}
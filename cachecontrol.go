@@ -0,0 +1,175 @@
+package pages
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// CacheControl is the caching policy of a page, translated into the Cache-Control header.
+type CacheControl struct {
+	// Public allows shared caches (CDNs, proxies) to store the response.
+	Public bool
+
+	// Private restricts caching to the browser. It takes precedence over Public.
+	Private bool
+
+	// NoCache requires revalidation with the server before using a stored response.
+	NoCache bool
+
+	// NoStore disables caching. It takes precedence over all other directives.
+	NoStore bool
+
+	// MaxAge is the max-age directive in seconds.
+	MaxAge int
+
+	// SMaxage is the s-maxage directive (max-age for the shared caches) in seconds.
+	SMaxage int
+
+	// StaleWhileRevalidate is the number of seconds a stale response may be served while
+	// it is revalidated in the background.
+	StaleWhileRevalidate int
+
+	// StaleIfError is the number of seconds a stale response may be served if the server fails.
+	StaleIfError int
+
+	// Immutable indicates the response will not change while it is fresh.
+	Immutable bool
+}
+
+// String returns the value of the Cache-Control header.
+func (cc CacheControl) String() string {
+	if cc.NoStore {
+		return "no-store"
+	}
+
+	var dirs []string
+	switch {
+	case cc.Private:
+		dirs = append(dirs, "private")
+	case cc.Public:
+		dirs = append(dirs, "public")
+	}
+	if cc.NoCache {
+		dirs = append(dirs, "no-cache")
+	}
+	if cc.MaxAge > 0 {
+		dirs = append(dirs, "max-age="+strconv.Itoa(cc.MaxAge))
+	}
+	if cc.SMaxage > 0 && !cc.Private {
+		dirs = append(dirs, "s-maxage="+strconv.Itoa(cc.SMaxage))
+	}
+	if cc.StaleWhileRevalidate > 0 {
+		dirs = append(dirs, "stale-while-revalidate="+strconv.Itoa(cc.StaleWhileRevalidate))
+	}
+	if cc.StaleIfError > 0 {
+		dirs = append(dirs, "stale-if-error="+strconv.Itoa(cc.StaleIfError))
+	}
+	if cc.Immutable {
+		dirs = append(dirs, "immutable")
+	}
+	return strings.Join(dirs, ", ")
+}
+
+// merge combines two policies declared by the components of the same page. The most
+// restrictive directives win, so a widget rendering per-user content can opt the whole page
+// out of the shared caches.
+func (cc CacheControl) merge(other CacheControl) CacheControl {
+	minAge := func(a, b int) int {
+		if a == 0 || (b != 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	return CacheControl{
+		Public:               cc.Public || other.Public,
+		Private:              cc.Private || other.Private,
+		NoCache:              cc.NoCache || other.NoCache,
+		NoStore:              cc.NoStore || other.NoStore,
+		MaxAge:               minAge(cc.MaxAge, other.MaxAge),
+		SMaxage:              minAge(cc.SMaxage, other.SMaxage),
+		StaleWhileRevalidate: minAge(cc.StaleWhileRevalidate, other.StaleWhileRevalidate),
+		StaleIfError:         minAge(cc.StaleIfError, other.StaleIfError),
+		Immutable:            cc.Immutable && other.Immutable,
+	}
+}
+
+// CacheControlComponent declares the caching policy of the page, e.g.:
+//
+//	<c:cache-control public="true" max-age="300" stale-while-revalidate="60"></c:cache-control>
+//
+// The component renders nothing. The policies declared by all components of the page are merged
+// (the most restrictive directives win) and sent in the Cache-Control header. The header is not
+// sent with the error responses (status 4xx/5xx) and never overrides the Cache-Control header
+// set by the Handler itself, e.g. for the draft previews.
+type CacheControlComponent struct{}
+
+var _ chtml.Component = CacheControlComponent{}
+
+func (cc CacheControlComponent) Render(s chtml.Scope) (any, error) {
+	var args CacheControl
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+	if v, ok := s.(*scope); ok {
+		v.globals.cacheCtl.add(args)
+	}
+	return nil, nil
+}
+
+// cachePolicy collects the caching policies declared during a render pass.
+type cachePolicy struct {
+	mu   sync.Mutex
+	set  bool
+	cc   CacheControl
+	base *CacheControl // policy of the page directory, see Handler.CachePolicies
+}
+
+func (p *cachePolicy) add(cc CacheControl) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.set {
+		cc = p.cc.merge(cc)
+	}
+	p.cc, p.set = cc, true
+}
+
+// reset clears the policy before a new render pass.
+func (p *cachePolicy) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cc, p.set = CacheControl{}, false
+}
+
+// apply sets the Cache-Control header of a successful response.
+func (p *cachePolicy) apply(h http.Header, statusCode int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.set && p.base == nil || statusCode >= http.StatusBadRequest || h.Get("Cache-Control") != "" {
+		return
+	}
+	cc := p.cc
+	if p.base != nil {
+		cc = *p.base
+		if p.set {
+			cc = cc.merge(p.cc)
+		}
+	}
+	if v := cc.String(); v != "" {
+		h.Set("Cache-Control", v)
+	}
+}
+
+// cachePolicy returns the policy of the most specific directory of the page in CachePolicies,
+// or nil.
+func (h *Handler) cachePolicy(fsPath string) *CacheControl {
+	if cc, ok := dirValue(h.CachePolicies, fsPath); ok {
+		return &cc
+	}
+	return nil
+}
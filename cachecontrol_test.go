@@ -0,0 +1,99 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestCacheControlComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static.chtml": {Data: []byte(
+			`<c:cache-control public="true" max-age="300" stale-while-revalidate="60"></c:cache-control>static`)},
+		"widget.chtml": {Data: []byte(
+			`<c:cache-control private="true" max-age="60"></c:cache-control>hello, user`)},
+		"mixed.chtml": {Data: []byte(
+			`<c:cache-control public="true" max-age="300" s-maxage="600"></c:cache-control><c:widget></c:widget>`)},
+		"nostore.chtml": {Data: []byte(
+			`<c:cache-control public="true" max-age="300"></c:cache-control>` +
+				`<c:cache-control no-store="true"></c:cache-control>`)},
+		"missing.chtml": {Data: []byte(
+			`<c:cache-control public="true" max-age="300"></c:cache-control><c:http-response status="404"></c:http-response>`)},
+		"post.draft.chtml": {Data: []byte(
+			`<c:cache-control public="true" max-age="300"></c:cache-control>draft`)},
+		"plain.chtml": {Data: []byte(`plain`)},
+	}
+
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"cache-control": CacheControlComponent{},
+			"http-response": HttpResponseComponent{},
+		},
+		ShowDrafts: true,
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/static", "public, max-age=300, stale-while-revalidate=60"},
+		{"/mixed", "private, max-age=60"},
+		{"/nostore", "no-store"},
+		{"/missing", ""},
+		{"/post", "no-store"},
+		{"/plain", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if got := rr.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPages_CachePolicies(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":          {Data: []byte(`index`)},
+		"docs/index.chtml":     {Data: []byte(`docs`)},
+		"docs/api/index.chtml": {Data: []byte(`api`)},
+		"docs/user.chtml":      {Data: []byte(`<c:cache-control private="true" max-age="60"></c:cache-control>user`)},
+		"blog/index.chtml":     {Data: []byte(`blog`)},
+	}
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"cache-control": CacheControlComponent{}},
+		CachePolicies: map[string]CacheControl{
+			"/":         {NoCache: true},
+			"docs":      {Public: true, MaxAge: 300},
+			"/docs/api": {Public: true, MaxAge: 3600, Immutable: true},
+		},
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/", "no-cache"},
+		{"/blog/", "no-cache"},
+		{"/docs/", "public, max-age=300"},
+		{"/docs/api/", "public, max-age=3600, immutable"},
+		{"/docs/user", "private, max-age=60"},
+		{"/missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if got := rr.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package chtml
+
+import (
+	"sync"
+	"unsafe"
+
+	"golang.org/x/net/html"
+)
+
+// Approximate costs of the render-time structures, used for the allocation budget.
+const (
+	nodeCost     = int64(unsafe.Sizeof(html.Node{}))
+	envEntryCost = int64(unsafe.Sizeof("")) + int64(unsafe.Sizeof(any(nil)))
+)
+
+// envPool keeps loop environment maps released by arenas for reuse.
+var envPool = sync.Pool{
+	New: func() any { return make(map[string]any) },
+}
+
+// Arena tracks temporary structures allocated while rendering components for a single request,
+// so they can be released wholesale when the request ends. It also enforces an optional
+// allocation budget to abort runaway renders (e.g. huge or deeply nested loops).
+//
+// The budget is measured in approximate bytes of the rendered nodes, text and loop
+// environments. Once the budget is exceeded, the components stop rendering and return
+// ErrBudgetExceeded.
+//
+// An Arena is made available to the components via a Scope implementing the ArenaScope
+// interface. A nil *Arena is valid and means no pooling and no budget.
+type Arena struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	err   error
+	envs  []map[string]any
+}
+
+// ArenaScope is an optional interface for Scope implementations carrying a per-request Arena.
+type ArenaScope interface {
+	Scope
+
+	// Arena returns the arena for the current request or nil.
+	Arena() *Arena
+}
+
+// NewArena creates an Arena with the given allocation budget in bytes. Zero means no limit.
+func NewArena(limit int64) *Arena {
+	return &Arena{limit: limit}
+}
+
+// Alloc accounts size bytes against the budget. It returns false if the budget is exceeded.
+func (a *Arena) Alloc(size int64) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.err != nil {
+		return false
+	}
+	a.used += size
+	if a.limit > 0 && a.used > a.limit {
+		a.err = ErrBudgetExceeded
+		return false
+	}
+	return true
+}
+
+// Used returns the number of bytes accounted so far.
+func (a *Arena) Used() int64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.used
+}
+
+// Err returns ErrBudgetExceeded if the budget has been exceeded, nil otherwise.
+func (a *Arena) Err() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Release returns all structures allocated in the arena to the shared pool. The components
+// rendered with the arena must be disposed before calling Release.
+func (a *Arena) Release() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, m := range a.envs {
+		clear(m)
+		envPool.Put(m)
+	}
+	a.envs = nil
+}
+
+// Reset releases the structures allocated in the arena (see Release) and restores the full
+// budget, so the arena can be reused for another render, e.g. the next render of a page sent over
+// WebSocket. The components rendered with the arena may keep the structures of the previous
+// render until they are rendered again, so they must not be used in between.
+func (a *Arena) Reset() {
+	if a == nil {
+		return
+	}
+	a.Release()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.used = 0
+	a.err = nil
+}
+
+// newEnv returns an empty map for the expression environment.
+func (a *Arena) newEnv() map[string]any {
+	if a == nil {
+		return make(map[string]any)
+	}
+	m := envPool.Get().(map[string]any)
+
+	a.mu.Lock()
+	a.envs = append(a.envs, m)
+	a.mu.Unlock()
+
+	return m
+}
+
+// arenaOf returns the Arena carried by the scope or nil.
+func arenaOf(s Scope) *Arena {
+	if as, ok := s.(ArenaScope); ok {
+		return as.Arena()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package chtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type arenaScope struct {
+	*BaseScope
+	arena *Arena
+}
+
+func (s *arenaScope) Spawn(vars map[string]any) Scope {
+	return &arenaScope{BaseScope: s.BaseScope.Spawn(vars).(*BaseScope), arena: s.arena}
+}
+
+func (s *arenaScope) Arena() *Arena {
+	return s.arena
+}
+
+func TestArena_Budget(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<ul><li c:for="i in 1..1000">item ${i}</li></ul>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr error
+	}{
+		{"no limit", 0, nil},
+		{"enough", 1 << 20, nil},
+		{"exceeded", 1 << 10, ErrBudgetExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arena := NewArena(tt.limit)
+			defer arena.Release()
+
+			comp := NewComponent(doc, nil)
+			defer func() { _ = comp.(Disposable).Dispose() }()
+
+			_, err := comp.Render(&arenaScope{BaseScope: NewBaseScope(nil), arena: arena})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if arena.Used() == 0 {
+				t.Error("no allocations accounted")
+			}
+			if tt.limit > 0 && tt.wantErr != nil && arena.Used() > tt.limit+nodeCost*2 {
+				t.Errorf("rendering not aborted: used %d, limit %d", arena.Used(), tt.limit)
+			}
+		})
+	}
+}
+
+func TestArena_Release(t *testing.T) {
+	arena := NewArena(0)
+	env := arena.newEnv()
+	env["x"] = 1
+
+	arena.Release()
+
+	if len(env) != 0 {
+		t.Error("released env is not cleared")
+	}
+	if len(arena.envs) != 0 {
+		t.Error("arena still holds released envs")
+	}
+
+	var nilArena *Arena
+	if !nilArena.Alloc(1 << 30) {
+		t.Error("nil arena must not limit allocations")
+	}
+	nilArena.Release()
+}
+
+func TestArena_Reset(t *testing.T) {
+	arena := NewArena(100)
+	env := arena.newEnv()
+	env["x"] = 1
+	if arena.Alloc(200) {
+		t.Fatal("want the budget exceeded")
+	}
+
+	arena.Reset()
+
+	if len(env) != 0 || len(arena.envs) != 0 {
+		t.Error("the envs are not released")
+	}
+	if arena.Err() != nil || arena.Used() != 0 {
+		t.Errorf("the budget is not restored: used %d, err %v", arena.Used(), arena.Err())
+	}
+	if !arena.Alloc(100) {
+		t.Error("want the allocation within the restored budget")
+	}
+}
@@ -0,0 +1,91 @@
+package chtml
+
+import (
+	"io"
+	"maps"
+)
+
+// Bind returns a component rendering comp with the given default arguments bound, e.g. a theme
+// or an API base URL configured by the application. The arguments passed by the caller take
+// precedence over the bound ones.
+func Bind(comp Component, defaults map[string]any) Component {
+	return &boundComponent{comp: comp, defaults: defaults}
+}
+
+type boundComponent struct {
+	comp     Component
+	defaults map[string]any
+}
+
+var _ Component = (*boundComponent)(nil)
+var _ Disposable = (*boundComponent)(nil)
+var _ InputDeclarer = (*boundComponent)(nil)
+var _ StreamRenderer = (*boundComponent)(nil)
+
+func (b *boundComponent) Render(s Scope) (any, error) {
+	return b.comp.Render(b.scope(s))
+}
+
+// RenderTo streams the output of the bound component if it implements StreamRenderer.
+func (b *boundComponent) RenderTo(w io.Writer, s Scope) error {
+	sr, ok := b.comp.(StreamRenderer)
+	if !ok {
+		return ErrNotStreamable
+	}
+	return sr.RenderTo(w, b.scope(s))
+}
+
+// scope returns the scope with the bound arguments merged with the arguments of s.
+func (b *boundComponent) scope(s Scope) Scope {
+	vars := maps.Clone(b.defaults)
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	maps.Copy(vars, s.Vars())
+	return s.Spawn(vars)
+}
+
+func (b *boundComponent) Dispose() error {
+	if d, ok := b.comp.(Disposable); ok {
+		return d.Dispose()
+	}
+	return nil
+}
+
+// Inputs returns the arguments of the bound component, the bound values are the new defaults.
+func (b *boundComponent) Inputs() map[string]any {
+	d, ok := b.comp.(InputDeclarer)
+	if !ok {
+		return nil
+	}
+	inputs := d.Inputs()
+	for k, v := range b.defaults {
+		if _, ok := inputs[k]; ok {
+			inputs[k] = v
+		}
+	}
+	return inputs
+}
+
+// BindImporter returns an Importer binding the default arguments to the components imported by
+// imp (see Bind). The bindings are keyed by the component name, the components not listed are
+// imported as is.
+func BindImporter(imp Importer, bindings map[string]map[string]any) Importer {
+	return &bindImporter{imp: imp, bindings: bindings}
+}
+
+type bindImporter struct {
+	imp      Importer
+	bindings map[string]map[string]any
+}
+
+func (i *bindImporter) Import(name string) (Component, error) {
+	comp, err := i.imp.Import(name)
+	if err != nil {
+		return nil, err
+	}
+	if defaults, ok := i.bindings[name]; ok {
+		return Bind(comp, defaults), nil
+	}
+	return comp, nil
+}
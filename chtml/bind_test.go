@@ -0,0 +1,42 @@
+package chtml
+
+import (
+	"testing"
+)
+
+func TestBindImporter(t *testing.T) {
+	ti := &testImporter{}
+	ti.init()
+
+	imp := BindImporter(ti, map[string]map[string]any{
+		"comp2": {"text": "Bound"},
+	})
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"bound default", `<c:comp2></c:comp2>`, `<p>Bound</p>`},
+		{"caller wins", `<c:comp2 text="Own"></c:comp2>`, `<p>Own</p>`},
+		{"not bound", `<c:comp1></c:comp1>`, `<p>comp1</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(tt.text, tt.want, nil, &ComponentOptions{Importer: imp}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("inputs", func(t *testing.T) {
+		comp, err := imp.Import("comp2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs := comp.(InputDeclarer).Inputs()
+		if len(inputs) != 1 || inputs["text"] != "Bound" {
+			t.Errorf("inputs = %v", inputs)
+		}
+	})
+}
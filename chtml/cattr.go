@@ -2,6 +2,13 @@ package chtml
 
 import "fmt"
 
+// CAttr is the builtin <c:attr> component. It renders an attribute of the parent element, or
+// declares an argument of the component at the top level of the document. The name may be
+// computed by an expression and the attribute may be rendered in a loop:
+//
+//	<div><c:attr c:for="k, v in data" name="${'data-' + k}">${v}</c:attr></div>
+//
+// A nil name omits the attribute.
 type CAttr struct{}
 
 var _ Component = &CAttr{}
@@ -17,6 +24,9 @@ func (c *CAttr) Render(s Scope) (any, error) {
 	if !ok {
 		return nil, fmt.Errorf("attr component requires a name attribute")
 	}
+	if name == nil {
+		return nil, nil
+	}
 
 	sname, ok := name.(string)
 	if !ok {
@@ -29,3 +39,18 @@ func (c *CAttr) Render(s Scope) (any, error) {
 		Val:       NewExprConst(vars["_"]),
 	}, nil
 }
+
+// attrList is the result of <c:attr> rendered in a loop: the attributes of the iterations.
+type attrList []Attribute
+
+// renderedAttrs returns the attributes of the render result of <c:attr>. It returns false if
+// the result is not an attribute.
+func renderedAttrs(rr any) ([]Attribute, bool) {
+	switch v := rr.(type) {
+	case Attribute:
+		return []Attribute{v}, true
+	case attrList:
+		return v, true
+	}
+	return nil, false
+}
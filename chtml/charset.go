@@ -0,0 +1,156 @@
+package chtml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// InvalidUTF8Policy defines how the renderer handles invalid UTF-8 sequences in the rendered
+// text, attributes and comments.
+type InvalidUTF8Policy int
+
+const (
+	// ReplaceInvalidUTF8 replaces invalid UTF-8 sequences with the Unicode replacement
+	// character U+FFFD. This is the default policy.
+	ReplaceInvalidUTF8 InvalidUTF8Policy = iota
+
+	// DropInvalidUTF8 removes invalid UTF-8 sequences from the output.
+	DropInvalidUTF8
+
+	// RejectInvalidUTF8 reports ErrInvalidEncoding for the node containing invalid UTF-8
+	// sequences. The node is not rendered.
+	RejectInvalidUTF8
+)
+
+// sanitize returns s with invalid UTF-8 sequences handled according to the policy.
+func (p InvalidUTF8Policy) sanitize(s string) (string, error) {
+	if utf8.ValidString(s) {
+		return s, nil
+	}
+	switch p {
+	case DropInvalidUTF8:
+		return strings.ToValidUTF8(s, ""), nil
+	case RejectInvalidUTF8:
+		return "", ErrInvalidEncoding
+	default:
+		return strings.ToValidUTF8(s, string(utf8.RuneError)), nil
+	}
+}
+
+// prescanSize is the number of bytes to look for the <meta charset> declaration in. The value
+// is the same as in the HTML5 encoding sniffing algorithm.
+const prescanSize = 1024
+
+// metaCharsetRegex matches both <meta charset="..."> and
+// <meta http-equiv="Content-Type" content="text/html; charset=..."> declarations.
+var metaCharsetRegex = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_:.-]+)`)
+
+// windows1252 maps bytes 0x80-0x9F of the Windows-1252 encoding to Unicode code points. Other
+// bytes are mapped to the code points with the same value (as in ISO-8859-1).
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// toUTF8 reads the input and converts it into UTF-8. The encoding is detected by the byte order
+// mark or by the <meta charset> declaration. If neither is present, the input is assumed to be
+// UTF-8 already. The input in an unsupported encoding (e.g. shift_jis or koi8-r) is read as
+// UTF-8, with the invalid sequences replaced by U+FFFD.
+//
+// In strict mode, toUTF8 returns ErrInvalidEncoding instead of converting the input if it is not
+// a valid UTF-8.
+func toUTF8(r io.Reader, strict bool) (io.Reader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := detectCharset(b)
+
+	switch enc {
+	case "utf-8":
+		b = bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF"))
+		if strict && !utf8.Valid(b) {
+			return nil, ErrInvalidEncoding
+		}
+		return bytes.NewReader(b), nil
+	case "utf-16le", "utf-16be", "windows-1252":
+		if strict {
+			return nil, fmt.Errorf("%w: %s input", ErrInvalidEncoding, enc)
+		}
+	default:
+		if strict {
+			return nil, fmt.Errorf("%w: unsupported charset %q", ErrInvalidEncoding, enc)
+		}
+		return strings.NewReader(strings.ToValidUTF8(string(b), string(utf8.RuneError))), nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(b))
+
+	switch enc {
+	case "utf-16le", "utf-16be":
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == "utf-16be" {
+			order = binary.BigEndian
+		}
+		b = b[2:] // skip BOM
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u = append(u, order.Uint16(b[i:]))
+		}
+		for _, c := range utf16.Decode(u) {
+			sb.WriteRune(c)
+		}
+	case "windows-1252":
+		for _, c := range b {
+			if c >= 0x80 && c <= 0x9F {
+				sb.WriteRune(windows1252[c-0x80])
+			} else {
+				sb.WriteRune(rune(c))
+			}
+		}
+	}
+
+	return strings.NewReader(sb.String()), nil
+}
+
+// detectCharset returns the normalized name of the input encoding.
+func detectCharset(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xEF\xBB\xBF")):
+		return "utf-8"
+	case bytes.HasPrefix(b, []byte("\xFF\xFE")):
+		return "utf-16le"
+	case bytes.HasPrefix(b, []byte("\xFE\xFF")):
+		return "utf-16be"
+	}
+
+	head := b
+	if len(head) > prescanSize {
+		head = head[:prescanSize]
+	}
+	m := metaCharsetRegex.FindSubmatch(head)
+	if m == nil {
+		return "utf-8"
+	}
+
+	// Labels are normalized according to the WHATWG Encoding Standard. Note, ISO-8859-1 and
+	// US-ASCII are treated as Windows-1252.
+	switch label := strings.ToLower(string(m[1])); label {
+	case "utf-8", "utf8", "unicode-1-1-utf-8":
+		return "utf-8"
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "us-ascii", "ascii", "windows-1252", "cp1252", "x-cp1252":
+		return "windows-1252"
+	default:
+		return label
+	}
+}
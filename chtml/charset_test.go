@@ -0,0 +1,150 @@
+package chtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		strict  bool
+		want    string
+		wantErr error
+	}{
+		{
+			name: "utf-8",
+			text: "<p>Grüße</p>",
+			want: "<p>Grüße</p>",
+		},
+		{
+			name: "utf-8 with BOM",
+			text: "\xEF\xBB\xBF<p>Grüße</p>",
+			want: "<p>Grüße</p>",
+		},
+		{
+			name: "utf-16le with BOM",
+			text: "\xFF\xFE<\x00p\x00>\x00\xFC\x00<\x00/\x00p\x00>\x00",
+			want: "<p>ü</p>",
+		},
+		{
+			name: "utf-16be with BOM",
+			text: "\xFE\xFF\x00<\x00p\x00>\x00\xFC\x00<\x00/\x00p\x00>",
+			want: "<p>ü</p>",
+		},
+		{
+			name: "latin1 meta charset",
+			text: "<meta charset=\"iso-8859-1\"><p>Gr\xFC\xDFe \x80</p>",
+			want: `<meta charset="iso-8859-1"/><p>Grüße €</p>`,
+		},
+		{
+			name: "http-equiv meta charset",
+			text: "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=windows-1252\"><p>\xFC</p>",
+			want: `<meta http-equiv="Content-Type" content="text/html; charset=windows-1252"/><p>ü</p>`,
+		},
+		{
+			name: "unsupported charset",
+			text: "<meta charset=\"koi8-r\"><p>\xFC</p>",
+			want: `<meta charset="koi8-r"/><p>�</p>`,
+		},
+		{
+			name: "unsupported charset with ascii text",
+			text: "<meta charset=\"shift_jis\"><p>hello</p>",
+			want: `<meta charset="shift_jis"/><p>hello</p>`,
+		},
+		{
+			name:    "strict unsupported charset",
+			text:    "<meta charset=\"iso-8859-2\"><p>\xFC</p>",
+			strict:  true,
+			wantErr: ErrInvalidEncoding,
+		},
+		{
+			name:    "strict latin1",
+			text:    "<meta charset=\"iso-8859-1\"><p>\xFC</p>",
+			strict:  true,
+			wantErr: ErrInvalidEncoding,
+		},
+		{
+			name:    "strict invalid utf-8",
+			text:    "<p>\xFC</p>",
+			strict:  true,
+			wantErr: ErrInvalidEncoding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseWithOptions(strings.NewReader(tt.text), nil, &ParseOptions{
+				StrictEncoding: tt.strict,
+			})
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr, err := NewComponent(doc, nil).Render(NewBaseScope(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf strings.Builder
+			if err := html.Render(&buf, rr.(*html.Node)); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  InvalidUTF8Policy
+		want    any
+		wantErr error
+	}{
+		{
+			name:   "replace",
+			policy: ReplaceInvalidUTF8,
+			want:   `<p title="a�b">a�b</p>`,
+		},
+		{
+			name:   "drop",
+			policy: DropInvalidUTF8,
+			want:   `<p title="ab">ab</p>`,
+		},
+		{
+			name:    "reject",
+			policy:  RejectInvalidUTF8,
+			wantErr: ErrInvalidEncoding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testRenderCase(`<c:attr name="s"></c:attr><p title="${s}">${s}</p>`, tt.want,
+				map[string]any{"s": "a\xFFb"},
+				&ComponentOptions{InvalidUTF8: tt.policy})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package chtmltest runs the test cases declared in CHTML components with <c:test> elements.
+//
+// The body of a <c:test> element is a list of expectations, one per line:
+//
+//	expect contains "TEXT"      - the rendered output contains TEXT
+//	expect not contains "TEXT"  - the rendered output does not contain TEXT
+//	expect equals "TEXT"        - the rendered output equals TEXT (surrounding whitespace is ignored)
+//	expect error                - the rendering fails
+//
+// A typical usage is a single Go test running all component tests in a directory:
+//
+//	func TestComponents(t *testing.T) {
+//		chtmltest.RunFS(t, os.DirFS("pages"), nil)
+//	}
+package chtmltest
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"golang.org/x/net/html"
+)
+
+// Run executes the test cases declared in the parsed component doc as subtests of t.
+// The opts are used to create the component for each test case.
+func Run(t *testing.T, doc *chtml.Node, opts *chtml.ComponentOptions) {
+	t.Helper()
+
+	tests, err := chtml.Tests(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			if err := runTest(doc, opts, tc); err != nil {
+				t.Errorf("%s: %v", tc.Source.Start, err)
+			}
+		})
+	}
+}
+
+// RunFS parses all .chtml files in the file system and executes their test cases as subtests
+// of t, one subtest per file. The importer resolves the components imported by the files.
+func RunFS(t *testing.T, fsys fs.FS, imp chtml.Importer) {
+	t.Helper()
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".chtml" {
+			return err
+		}
+
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		doc, err := chtml.Parse(f, imp)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", p, err)
+		}
+
+		t.Run(p, func(t *testing.T) {
+			Run(t, doc, &chtml.ComponentOptions{Importer: imp})
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runTest(doc *chtml.Node, opts *chtml.ComponentOptions, tc chtml.TestCase) error {
+	vars := make(map[string]any, len(tc.Vars))
+	for k, v := range tc.Vars {
+		vars[k] = v
+	}
+
+	comp := chtml.NewComponent(doc, opts)
+	defer func() {
+		if d, ok := comp.(chtml.Disposable); ok {
+			_ = d.Dispose()
+		}
+	}()
+
+	rr, renderErr := comp.Render(chtml.NewBaseScope(vars))
+
+	out, err := renderOutput(rr)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range tc.Expect {
+		if err := check(line, out, renderErr); err != nil {
+			return err
+		}
+	}
+	if renderErr != nil && !hasErrorExpectation(tc.Expect) {
+		return fmt.Errorf("render: %w", renderErr)
+	}
+	return nil
+}
+
+func renderOutput(rr any) (string, error) {
+	switch v := rr.(type) {
+	case nil:
+		return "", nil
+	case *html.Node:
+		var sb strings.Builder
+		if err := html.Render(&sb, v); err != nil {
+			return "", fmt.Errorf("render HTML: %w", err)
+		}
+		return sb.String(), nil
+	case string:
+		return v, nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// check verifies a single expectation line against the rendered output.
+func check(line, out string, renderErr error) error {
+	rest, ok := strings.CutPrefix(line, "expect ")
+	if !ok {
+		return fmt.Errorf("invalid expectation %q: must start with \"expect\"", line)
+	}
+
+	if rest == "error" {
+		if renderErr == nil {
+			return fmt.Errorf("expected a render error")
+		}
+		return nil
+	}
+
+	for _, op := range []string{"not contains", "contains", "equals"} {
+		arg, ok := strings.CutPrefix(rest, op+" ")
+		if !ok {
+			continue
+		}
+		want, err := unquote(arg)
+		if err != nil {
+			return fmt.Errorf("invalid expectation %q: %w", line, err)
+		}
+
+		switch op {
+		case "contains":
+			if !strings.Contains(out, want) {
+				return fmt.Errorf("output does not contain %q:\n%s", want, out)
+			}
+		case "not contains":
+			if strings.Contains(out, want) {
+				return fmt.Errorf("output contains %q:\n%s", want, out)
+			}
+		case "equals":
+			if strings.TrimSpace(out) != want {
+				return fmt.Errorf("output is not equal to %q:\n%s", want, out)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid expectation %q: unknown operator", line)
+}
+
+// unquote strips the double quotes around the argument. The quotes inside the argument are
+// kept as is, so the HTML attributes don't need escaping.
+func unquote(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("argument must be a double-quoted string")
+	}
+	return s[1 : len(s)-1], nil
+}
+
+func hasErrorExpectation(expect []string) bool {
+	for _, line := range expect {
+		if line == "expect error" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package chtmltest
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"title.chtml": {Data: []byte(`<c:attr name="title">Default</c:attr><h1 class="title">${title}</h1>
+<c:test name="renders title" vars="${ {title: 'X'} }">
+  expect contains "<h1 class="title">X</h1>"
+  expect not contains "Default"
+</c:test>
+<c:test name="default">expect equals "<h1 class="title">Default</h1>"</c:test>
+<c:test name="nil title" vars="${ {title: nil} }">expect not contains "X"</c:test>`)},
+		"no-tests.chtml": {Data: []byte(`<p>no tests</p>`)},
+	}
+
+	RunFS(t, fsys, nil)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		line      string
+		out       string
+		renderErr error
+		wantErr   bool
+	}{
+		{`expect contains "b"`, "abc", nil, false},
+		{`expect contains "x"`, "abc", nil, true},
+		{`expect not contains "x"`, "abc", nil, false},
+		{`expect not contains "b"`, "abc", nil, true},
+		{`expect equals "abc"`, " abc\n", nil, false},
+		{`expect equals "ab"`, "abc", nil, true},
+		{`expect error`, "", errors.New("boom"), false},
+		{`expect error`, "abc", nil, true},
+		{`expect contains b`, "abc", nil, true},
+		{`expect matches "b"`, "abc", nil, true},
+		{`contains "b"`, "abc", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			err := check(tt.line, tt.out, tt.renderErr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package chtml
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// This file implements the coercion policy: how the values of the expressions are converted to
+// the rendered output and to the arguments of the components written in Go.
+//
+// Rendering:
+//   - nil renders nothing. It is skipped in the text and in the interpolated strings, and omits
+//     the attribute, including the attributes rendered with <c:attr>.
+//   - An empty string renders an empty text and an attribute with the empty value, e.g. alt="".
+//     An attribute written without a value, e.g. <input disabled>, has the empty string value.
+//   - A blank (whitespace-only) string concatenated with a value other than a string, e.g. an
+//     HTML element or a data object, is dropped, so the formatting whitespace around them does
+//     not turn the result into text. It is kept when concatenated with a string.
+//   - A boolean renders as "true" or "false", except for the boolean attributes (disabled,
+//     checked, etc.): true renders the attribute with the empty value, false omits it.
+//   - A time.Time renders in the RFC 3339 format (see formatTime for other formats).
+//   - The class attribute accepts a map of the class names to the conditions, e.g.
+//     class="${{'active': isActive, 'hidden': !visible}}", and a list of the class names, maps
+//     and nested lists. The names are joined with spaces, see classValue.
+//   - The style attribute accepts a map of the CSS properties, e.g. style="${{'color': color}}",
+//     see styleValue.
+//   - Other values render with fmt.Sprint. The maps, the slices and the structs rendered as the
+//     content of an element are encoded as JSON (see AnyToHtml).
+//
+// Arguments of the components written in Go (UnmarshalScope):
+//   - nil leaves the zero value of the field.
+//   - A string converts to a number or a time.Duration with strconv and time.ParseDuration.
+//     An empty string converts to zero.
+//   - A string converts to a bool with strconv.ParseBool. An empty string is false, other
+//     strings are true.
+//   - A string converts to a time.Time with time.Parse in the RFC 3339 format. An empty string
+//     converts to the zero time.
+//
+// The strict mode (ComponentOptions.StrictCoercion, UnmarshalScopeStrict) reports the ambiguous
+// conversions as errors instead: the maps, the slices and the structs rendered as text or as an
+// attribute value, the empty strings converted to numbers, durations and times, and the strings other
+// than the strconv.ParseBool values converted to bools.
+
+// isBlank reports whether s is empty or consists of whitespace only.
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// isCompositeValue reports whether v is a map, a slice, an array or a struct (or a pointer to one)
+// not implementing fmt.Stringer. Such values have no obvious text representation.
+func isCompositeValue(v any) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.(fmt.Stringer); ok {
+		return false
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// booleanAttrs is a set of HTML boolean attributes. The presence of such attribute on an element
+// represents the true value, and the absence of the attribute represents the false value.
+var booleanAttrs = map[string]struct{}{
+	"allowfullscreen": {}, "async": {}, "autofocus": {}, "autoplay": {}, "checked": {},
+	"controls": {}, "default": {}, "defer": {}, "disabled": {}, "formnovalidate": {},
+	"hidden": {}, "inert": {}, "ismap": {}, "itemscope": {}, "loop": {}, "multiple": {},
+	"muted": {}, "nomodule": {}, "novalidate": {}, "open": {}, "playsinline": {},
+	"readonly": {}, "required": {}, "reversed": {}, "selected": {},
+}
+
+// attrValue converts the evaluated attribute value to a string. It returns false if the attribute
+// should be omitted from the output:
+//   - a nil value always omits the attribute, e.g. aria-current="${active ? 'page' : nil}";
+//   - for boolean attributes (disabled, checked, etc.), false omits the attribute and true renders
+//     it with an empty value. For other attributes, booleans are rendered as "true" or "false".
+func attrValue(key string, v any) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	if b, ok := v.(bool); ok {
+		if _, isBool := booleanAttrs[strings.ToLower(key)]; isBool {
+			return "", b
+		}
+	}
+	return valueText(v), true
+}
+
+// valueText converts the value rendered as text to a string.
+func valueText(v any) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// renderAttr converts the evaluated value of the attribute of the node n to the output attribute.
+// It returns false if the attribute is omitted (see attrValue).
+func (c *chtmlComponent) renderAttr(n *Node, ns, key string, v any) (html.Attribute, bool, error) {
+	if ns == "" {
+		switch strings.ToLower(key) {
+		case "class":
+			if s, ok := classValue(v); ok {
+				v = s
+			}
+		case "style":
+			s, ok, err := styleValue(v)
+			if err != nil {
+				return html.Attribute{}, false, fmt.Errorf("attr %q: %w", key, err)
+			}
+			if ok {
+				v = s
+			}
+		}
+	}
+	if c.strictCoercion && isCompositeValue(v) {
+		return html.Attribute{}, false, fmt.Errorf("attr %q: %T value has no text representation", key, v)
+	}
+	sv, ok := attrValue(key, v)
+	if !ok {
+		return html.Attribute{}, false, nil
+	}
+	sv, err := c.invalidUTF8.sanitize(sv)
+	if err != nil {
+		return html.Attribute{}, false, fmt.Errorf("eval attr %q: %w", key, err)
+	}
+	a, err := outputAttr(n, ns, key, sv)
+	if err != nil {
+		return html.Attribute{}, false, err
+	}
+	return a, true, nil
+}
+
+// classValue converts the map or the list value of the class attribute to the space-separated
+// class names. The keys of a map are the names included if their values are truthy (see truthy),
+// in the order of the names. The items of a list are the names, the maps and the nested lists;
+// the empty items are skipped. A class list without names is nil, so the attribute is omitted.
+// It returns false for the other values.
+func classValue(v any) (any, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map && rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	var names []string
+	appendClassNames(&names, rv)
+	if len(names) == 0 {
+		return nil, true
+	}
+	return strings.Join(names, " "), true
+}
+
+func appendClassNames(names *[]string, rv reflect.Value) {
+	for rv.Kind() == reflect.Interface || rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		for _, name := range strings.Fields(rv.String()) {
+			if !slices.Contains(*names, name) {
+				*names = append(*names, name)
+			}
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			if truthy(rv.MapIndex(k).Interface()) {
+				keys = append(keys, k.String())
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			appendClassNames(names, reflect.ValueOf(k))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			appendClassNames(names, rv.Index(i))
+		}
+	}
+}
+
+// styleValue converts the map value of the style attribute to the CSS declarations, e.g.
+// {'color': 'red', 'margin-top': '1em'} to "color: red; margin-top: 1em". The properties are
+// declared in the order of the names, the nil, false and empty values are skipped. A map without
+// declarations is nil, so the attribute is omitted. It returns false for the other values.
+func styleValue(v any) (any, bool, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false, nil
+	}
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	slices.Sort(keys)
+
+	decls := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pv := rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()
+		if pv == nil || pv == false || pv == "" {
+			continue
+		}
+		if !validCSSProperty(k) {
+			return nil, false, fmt.Errorf("invalid CSS property %q", k)
+		}
+		s := valueText(pv)
+		if strings.ContainsAny(s, ";{}") {
+			return nil, false, fmt.Errorf("invalid value of CSS property %s: %q", k, s)
+		}
+		decls = append(decls, k+": "+s)
+	}
+	if len(decls) == 0 {
+		return nil, true, nil
+	}
+	return strings.Join(decls, "; "), true, nil
+}
+
+// validCSSProperty reports whether name is a CSS property name, including the custom properties
+// (--name), made of the ASCII letters, digits, "-" and "_".
+func validCSSProperty(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkContent reports the data objects rendered as the content of an element in the strict mode.
+func (c *chtmlComponent) checkContent(v any) error {
+	if _, ok := v.(*html.Node); ok || !c.strictCoercion || !isCompositeValue(v) {
+		return nil
+	}
+	if _, ok := asSeq(v); ok {
+		return nil // sequences render their items
+	}
+	return fmt.Errorf("%T value has no text representation", v)
+}
+
+// checkCoercion reports the ambiguous conversion of the argument value from to the type of the
+// field to in the strict mode of UnmarshalScope.
+func checkCoercion(from, to reflect.Value) error {
+	if from.Kind() != reflect.String {
+		return nil
+	}
+	s := from.String()
+	switch {
+	case to.Kind() == reflect.Bool:
+		if _, err := strconv.ParseBool(s); err != nil && s != "" {
+			return fmt.Errorf("ambiguous conversion of %q to bool", s)
+		}
+	case to.Type() == reflect.TypeOf(time.Duration(0)), to.Type() == reflect.TypeOf(time.Time{}),
+		isNumberKind(to.Kind()):
+		if s == "" {
+			return fmt.Errorf("ambiguous conversion of an empty string to %s", to.Type())
+		}
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// strToBool converts the string to a bool (see the coercion policy above).
+func strToBool(s string) bool {
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s != ""
+}
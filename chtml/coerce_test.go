@@ -0,0 +1,134 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderCoercion(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]any
+		strict  bool
+		want    string
+		wantErr string
+	}{
+		{
+			name: "nil and empty",
+			text: `<p title="${nil}" alt="${''}" hidden>a${nil}b${''}c</p>`,
+			want: `<p alt="" hidden="">abc</p>`,
+		},
+		{
+			name: "c:attr nil and boolean",
+			text: `<button><c:attr name="title">${nil}</c:attr><c:attr name="hidden">${false}</c:attr>` +
+				`<c:attr name="disabled">${true}</c:attr>ok</button>`,
+			want: `<button disabled="">ok</button>`,
+		},
+		{
+			name: "blank strings", // dropped next to the numbers, kept next to the elements
+			text: `<p>${1} ${2}<b></b> </p>`,
+			want: `<p>12<b></b> </p>`,
+		},
+		{
+			name: "lenient composite",
+			text: `<c:attr name="x"></c:attr><p data-x="${x}">${x}</p>`,
+			vars: map[string]any{"x": map[string]any{"a": 1}},
+			want: `<p data-x="map[a:1]">{&#34;a&#34;:1}</p>`,
+		},
+		{
+			name:    "strict composite attribute",
+			text:    `<c:attr name="x"></c:attr><p data-x="${x}"></p>`,
+			vars:    map[string]any{"x": []any{1, 2}},
+			strict:  true,
+			want:    `<p></p>`,
+			wantErr: `attr "data-x": []interface {} value has no text representation`,
+		},
+		{
+			name:    "strict composite content",
+			text:    `<c:attr name="x"></c:attr><p>${x}</p>`,
+			vars:    map[string]any{"x": map[string]any{"a": 1}},
+			strict:  true,
+			want:    `<p></p>`,
+			wantErr: `map[string]interface {} value has no text representation`,
+		},
+		{
+			name:   "strict scalars",
+			text:   `<c:attr name="x"></c:attr><p data-x="${x}">${x}</p>`,
+			vars:   map[string]any{"x": 1.5},
+			strict: true,
+			want:   `<p data-x="1.5">1.5</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.text), nil)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rr, err := NewComponent(doc, &ComponentOptions{StrictCoercion: tt.strict}).Render(NewBaseScope(tt.vars))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			var sb strings.Builder
+			if err := html.Render(&sb, AnyToHtml(rr)); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalScopeCoercion(t *testing.T) {
+	type args struct {
+		N     int
+		F     float64
+		B     bool
+		D     time.Duration
+		T     time.Time
+		Other string
+	}
+
+	tests := []struct {
+		name      string
+		vars      map[string]any
+		want      args
+		strictErr bool
+	}{
+		{"nil", map[string]any{"n": nil, "b": nil}, args{}, false},
+		{"empty number", map[string]any{"n": "", "f": ""}, args{}, true},
+		{"empty duration", map[string]any{"d": ""}, args{}, true},
+		{"empty time", map[string]any{"t": ""}, args{}, true},
+		{"empty bool", map[string]any{"b": ""}, args{}, false},
+		{"false", map[string]any{"b": "false"}, args{}, false},
+		{"true", map[string]any{"b": "1"}, args{B: true}, false},
+		{"other bool", map[string]any{"b": "yes"}, args{B: true}, true},
+		{"parsed", map[string]any{"n": "42", "f": "1.5", "d": "2s"}, args{N: 42, F: 1.5, D: 2 * time.Second}, false},
+		{"time", map[string]any{"t": "2024-05-01T10:00:00Z"}, args{T: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got args
+			if err := UnmarshalScope(NewBaseScope(tt.vars), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			err := UnmarshalScopeStrict(NewBaseScope(tt.vars), &args{})
+			if tt.strictErr != (err != nil) {
+				t.Errorf("strict: err = %v, want error: %v", err, tt.strictErr)
+			}
+		})
+	}
+}
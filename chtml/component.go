@@ -3,8 +3,11 @@ package chtml
 import (
 	"errors"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/expr-lang/expr/vm"
+	"golang.org/x/net/html"
 )
 
 type Component interface {
@@ -24,14 +27,86 @@ type Disposable interface {
 	Dispose() error
 }
 
+// InputDeclarer is an optional interface for components declaring the arguments they accept.
+// It allows the callers to validate the input data before rendering, e.g. the variables sent
+// by a client.
+type InputDeclarer interface {
+	// Inputs returns the default values of the arguments by name. A nil value means the type of
+	// the argument is not known.
+	Inputs() map[string]any
+}
+
+// StreamRenderer is an optional interface for components writing the rendered HTML directly to
+// a writer, instead of building the whole tree in memory first.
+type StreamRenderer interface {
+	// RenderTo renders the component with the scope and writes the HTML to w. It returns
+	// ErrNotStreamable without writing anything if the component does not render an HTML
+	// document, e.g. returns a data object.
+	RenderTo(w io.Writer, s Scope) error
+}
+
 type ComponentOptions struct {
+	// Name is the name of the component, e.g. the file path, reported by the render errors
+	// (see ComponentError.Component).
+	Name string
+
 	// Importer is the factory for components. It is invoked when a <c:NAME> element is encountered.
 	Importer Importer
 
 	// RenderComments is a flag to enable rendering of comments
 	RenderComments bool
+
+	// KeepComments is a list of prefixes for comments that are rendered even if RenderComments
+	// is false. For example, "[if " preserves conditional comments like <!--[if IE]>...<![endif]-->
+	// and "#keep" preserves comments like <!--#keep ...-->. Leading whitespace is ignored.
+	KeepComments []string
+
+	// KeepComment reports whether the comment is rendered even if RenderComments is false, in
+	// addition to KeepComments. It receives the source text of the comment, before the
+	// expressions are evaluated, e.g. DirectiveComment keeps the conditional comments and
+	// the tooling markers.
+	KeepComment func(text string) bool
+
+	// InvalidUTF8 defines how invalid UTF-8 sequences in the rendered text, attributes and
+	// comments are handled. By default, they are replaced with the U+FFFD character.
+	InvalidUTF8 InvalidUTF8Policy
+
+	// StrictCoercion makes the ambiguous conversions of the rendered values errors, e.g. a map
+	// rendered as an attribute value or as text is an error instead of its fmt.Sprint form.
+	StrictCoercion bool
+
+	// Functions are the functions available in the expressions in addition to the builtin ones.
+	// They must be the same as ParseOptions.Functions the document is parsed with.
+	Functions map[string]any
+
+	// RenderTimeout limits the time of rendering each component imported by the document
+	// (<c:NAME>). The import exceeding it renders nothing and ErrRenderTimeout is reported as
+	// a ComponentError, so a stuck component (e.g. waiting for a slow HTTP call) doesn't block
+	// the whole page. The abandoned render goes on in the background until it returns, so
+	// the components should stop when the context of the scope (see ContextOf) is canceled, and
+	// the instance is disposed then instead of being reused. The imports are not streamed (see
+	// StreamRenderer) if the timeout is set. Zero means no limit.
+	RenderTimeout time.Duration
+
+	// MaxImportDepth limits the nesting of the imported CHTML components, so a component
+	// importing itself, directly or via other components, fails with ErrImportDepthExceeded
+	// instead of overflowing the stack. The limit of the top-level component applies to all of
+	// its imports. Zero means DefaultMaxImportDepth.
+	MaxImportDepth int
+
+	// Sanitize filters the HTML produced by the expressions (e.g. ${unsafeHtml(post.body)} or
+	// a markdown function), so the untrusted content can be checked against an allowlist of the
+	// elements and attributes, see SanitizePolicy. The function receives a copy of the HTML
+	// wrapped in a document node and modifies it in place. If it returns an error, the value is
+	// not rendered and the error is reported as a ComponentError. The markup of the document
+	// itself is not sanitized.
+	Sanitize func(n *html.Node) error
 }
 
+// DefaultMaxImportDepth is the limit of the nested imports used if ComponentOptions.MaxImportDepth
+// is not set.
+const DefaultMaxImportDepth = 64
+
 // chtmlComponent is an instance of a CHTML component, ready to be rendered.
 // The Render method evaluates expressions in the CHTML document and returns either a new *html.Node
 // tree with HTML content or a data object if the result of the evaluation is not HTML.
@@ -47,9 +122,43 @@ type chtmlComponent struct {
 	// When evaluating loops, the env map is updated with the loop variables.
 	env map[string]any
 
+	// name is the name of the component reported by the errors.
+	name string
+
 	// renderComments is a flag to enable rendering of comments
 	renderComments bool
 
+	// keepComments is a list of prefixes for comments that are rendered regardless of
+	// renderComments.
+	keepComments []string
+
+	// keepComment reports whether the comment is rendered regardless of renderComments.
+	keepComment func(text string) bool
+
+	// invalidUTF8 defines how invalid UTF-8 sequences in the rendered output are handled.
+	invalidUTF8 InvalidUTF8Policy
+
+	// strictCoercion makes the ambiguous conversions of the rendered values errors.
+	strictCoercion bool
+
+	// renderTimeout limits the time of rendering the imported components, see
+	// ComponentOptions.RenderTimeout.
+	renderTimeout time.Duration
+
+	// imports is the names of the components importing this one, the top-level component
+	// first. It is set by the importing component, see enterImport.
+	imports []string
+
+	// maxImportDepth limits the length of imports, see ComponentOptions.MaxImportDepth.
+	maxImportDepth int
+
+	// callDepth is the number of the nested fragment calls rendering the component, limited by
+	// maxImportDepth.
+	callDepth int
+
+	// sanitize filters the HTML produced by the expressions, see ComponentOptions.Sanitize.
+	sanitize func(n *html.Node) error
+
 	// importer is the factory for components. It is invoked when a <c:NAME> element is encountered.
 	importer Importer
 
@@ -66,15 +175,50 @@ type chtmlComponent struct {
 
 	// vm is the expression engine used to evaluate expressions in the CHTML nodes.
 	vm vm.VM
+
+	// arena is the per-request arena from the scope. It is nil if the scope does not carry one.
+	arena *Arena
+
+	// functions are the custom functions of the expressions (see ComponentOptions.Functions).
+	functions map[string]any
+
+	// diff is the state of RenderDiff, nil until it is called. memo stores the remembered
+	// renders of the nodes (see renderTracked).
+	diff *diffState
+	memo map[*Node]*memoEntry
+
+	// loopKey is the value of c:key of the loop item rendered by the component.
+	loopKey any
+
+	// provided stores names of the variables resolved from the scope's EnvProvider during the
+	// current render. They are removed from the env before the next render.
+	provided map[string]struct{}
 }
 
 var _ Component = (*chtmlComponent)(nil)
 var _ Disposable = (*chtmlComponent)(nil)
+var _ InputDeclarer = (*chtmlComponent)(nil)
+var _ StreamRenderer = (*chtmlComponent)(nil)
 
 // Render evaluates expressions in the CHTML document and returns either a new *html.Node tree with
 // HTML content or a data object if the result of the evaluation is not HTML.
 func (c *chtmlComponent) Render(s Scope) (any, error) {
+	if err := c.prepare(s); err != nil {
+		return nil, err
+	}
+
+	// Evaluate the component's expressions
+	res := c.render(c.doc)
+
+	c.checkBudget()
+
+	return res, errors.Join(c.errs...)
+}
+
+// prepare checks the arguments passed in the scope and sets up the environment for a render.
+func (c *chtmlComponent) prepare(s Scope) error {
 	c.scope = s
+	c.arena = arenaOf(s)
 
 	// Check inputs: scope.Vars() keys should be a subset of c.doc.Attr keys.
 	attrMap := make(map[string]any, len(c.doc.Attr))
@@ -83,12 +227,12 @@ func (c *chtmlComponent) Render(s Scope) (any, error) {
 	}
 
 	for k := range s.Vars() {
-		if k == "_" {
+		if k == "_" || k == slotsVar {
 			continue
 		}
 		if _, ok := attrMap[k]; !ok {
 			// c.error(c.el, fmt.Errorf("unrecognized argument %s", k))
-			return nil, &UnrecognizedArgumentError{Name: k}
+			return &UnrecognizedArgumentError{Name: k}
 		}
 	}
 
@@ -96,10 +240,31 @@ func (c *chtmlComponent) Render(s Scope) (any, error) {
 	if c.env == nil {
 		c.env = map[string]any{"_": nil}
 	}
+	for k := range c.provided {
+		delete(c.env, k)
+	}
+	c.provided = nil
+	if _, ok := attrMap["slot"]; !ok {
+		slots, _ := s.Vars()[slotsVar].(map[string]any)
+		c.env["slot"] = slotFunc(slots)
+		c.env[slotsVar] = slots // compared instead of the function by RenderDiff
+	}
+	fp, _ := s.(FunctionProvider)
+	for name, fn := range c.functions {
+		if _, ok := attrMap[name]; ok {
+			continue
+		}
+		if fp != nil {
+			if bound, ok := fp.LookupFunction(name); ok {
+				fn = bound
+			}
+		}
+		c.env[name] = fn
+	}
 	for _, attr := range c.doc.Attr {
-		v, err := attr.Val.Value(&c.vm, env(c.env))
+		v, err := c.eval(attr.Val)
 		if err != nil {
-			return nil, fmt.Errorf("eval attr %q: %w", attr.Key, err)
+			return fmt.Errorf("eval attr %q: %w", attr.Key, err)
 		}
 
 		// Default args could be unrendered nodes, so we need to evaluate them first.
@@ -111,12 +276,106 @@ func (c *chtmlComponent) Render(s Scope) (any, error) {
 	}
 
 	// Load variables from the Scope into vars, performing type conversion if necessary
-	if err := UnmarshalScope(s, &c.env); err != nil {
-		return nil, err
+	return UnmarshalScope(s, &c.env)
+}
+
+// checkBudget reports the exceeded budget unless a child component has already reported it.
+func (c *chtmlComponent) checkBudget() {
+	if err := c.arena.Err(); err != nil && !errors.Is(errors.Join(c.errs...), err) {
+		c.errs = append(c.errs, err)
 	}
+}
 
-	// Evaluate the component's expressions
-	return c.render(c.doc), errors.Join(c.errs...)
+// spawnChild returns a component rendering doc as part of c, e.g. a loop item or a fragment,
+// with the environment env. The child shares the options, the scope and the arena of c.
+func (c *chtmlComponent) spawnChild(doc *Node, env map[string]any) *chtmlComponent {
+	return &chtmlComponent{
+		doc:            doc,
+		scope:          c.scope,
+		env:            env,
+		name:           c.name,
+		importer:       c.importer,
+		renderComments: c.renderComments,
+		keepComments:   c.keepComments,
+		keepComment:    c.keepComment,
+		invalidUTF8:    c.invalidUTF8,
+		strictCoercion: c.strictCoercion,
+		renderTimeout:  c.renderTimeout,
+		imports:        c.imports,
+		maxImportDepth: c.maxImportDepth,
+		callDepth:      c.callDepth,
+		sanitize:       c.sanitize,
+		functions:      c.functions,
+		arena:          c.arena,
+		hidden:         make(map[*Node]struct{}),
+		children:       make(map[*Node][]Component),
+	}
+}
+
+// Inputs returns the arguments declared with <c:attr> at the top level of the document and
+// their default values. The defaults containing markup are returned as *Node.
+func (c *chtmlComponent) Inputs() map[string]any {
+	var m vm.VM
+	inputs := make(map[string]any, len(c.doc.Attr))
+	for _, attr := range c.doc.Attr {
+		v, err := attr.Val.Value(&m, nil)
+		if err != nil {
+			v = nil
+		}
+		inputs[attr.Key] = v
+	}
+	return inputs
+}
+
+// InferInterface returns the interface of the parsed component for the tooling, e.g. editors and
+// documentation generators: the arguments declared with <c:attr> with their default values (see
+// InputDeclarer), and the output of the document rendered with the defaults. The values are the
+// shapes the expressions are type checked against, e.g. the parser checks ${p.title} against the
+// output of <c:post as="p">. The output of a document rendering HTML is an *html.Node. It is nil
+// if the document can't be rendered with the defaults, e.g. an import is not found. The opts
+// provide the importer and the functions, as for NewComponent.
+func InferInterface(doc *Node, opts *ComponentOptions) (inputs map[string]any, output any) {
+	c := NewComponent(doc, opts).(*chtmlComponent)
+	defer func() { _ = c.Dispose() }()
+
+	inputs = c.Inputs()
+	rr, err := c.Render(NewBaseScope(nil))
+	if err != nil {
+		return inputs, nil
+	}
+	return inputs, rr
+}
+
+// eval evaluates the expression in the component's environment. Variables missing in the
+// environment are resolved from the scope if it implements EnvProvider.
+// Panics raised by the user code (e.g. EnvProvider) are returned as *PanicError.
+func (c *chtmlComponent) eval(e Expr) (_ any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %w", e.RawString(), &PanicError{Value: r})
+		}
+	}()
+
+	if ep, ok := c.scope.(EnvProvider); ok {
+		for _, name := range e.idents {
+			if _, ok := c.env[name]; ok {
+				continue
+			}
+			v, ok, err := ep.LookupEnv(name)
+			if err != nil {
+				return nil, fmt.Errorf("lookup %q: %w", name, err)
+			}
+			if !ok {
+				continue
+			}
+			c.env[name] = v
+			if c.provided == nil {
+				c.provided = make(map[string]struct{})
+			}
+			c.provided[name] = struct{}{}
+		}
+	}
+	return e.Value(&c.vm, env(c.env))
 }
 
 func (c *chtmlComponent) Dispose() error {
@@ -130,6 +389,7 @@ func (c *chtmlComponent) Dispose() error {
 // This is used to close components in c:for loops and c:if.
 func (c *chtmlComponent) closeChildren(n *Node, idx int) {
 	if comps, ok := c.children[n]; ok {
+		idx = min(idx, len(comps)) // a loop could be interrupted before creating all children
 		for i := idx; i < len(comps); i++ {
 			if d, ok := comps[i].(Disposable); ok {
 				if err := d.Dispose(); err != nil {
@@ -146,7 +406,9 @@ func (c *chtmlComponent) closeChildren(n *Node, idx int) {
 
 // error appends a new error to the errs list.
 func (c *chtmlComponent) error(n *Node, err error) {
-	c.errs = append(c.errs, newComponentError(n, err))
+	ce := newComponentError(n, err)
+	ce.component = c.name
+	c.errs = append(c.errs, ce)
 }
 
 func NewComponent(n *Node, opts *ComponentOptions) Component {
@@ -158,8 +420,20 @@ func NewComponent(n *Node, opts *ComponentOptions) Component {
 		errs:           nil,
 	}
 	if opts != nil {
+		c.name = opts.Name
 		c.importer = opts.Importer
 		c.renderComments = opts.RenderComments
+		c.keepComments = opts.KeepComments
+		c.keepComment = opts.KeepComment
+		c.invalidUTF8 = opts.InvalidUTF8
+		c.strictCoercion = opts.StrictCoercion
+		c.functions = opts.Functions
+		c.renderTimeout = opts.RenderTimeout
+		c.maxImportDepth = opts.MaxImportDepth
+		c.sanitize = opts.Sanitize
+	}
+	if c.maxImportDepth <= 0 {
+		c.maxImportDepth = DefaultMaxImportDepth
 	}
 	return c
 }
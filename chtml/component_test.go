@@ -1,11 +1,15 @@
 package chtml
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
 )
 
 type componentLifecycleEvent struct {
@@ -35,7 +39,7 @@ func TestComponentReuse(t *testing.T) {
 	var events []componentLifecycleEvent
 	imp := &lifecycleImporter{&events}
 
-	doc, err := Parse(strings.NewReader("<c:test></c:test>"), imp)
+	doc, err := Parse(strings.NewReader("<c:lifecycle></c:lifecycle>"), imp)
 	require.NoError(t, err)
 
 	require.Equal(t, 3, len(events))
@@ -85,10 +89,338 @@ type lifecycleImporter struct {
 
 func (imp *lifecycleImporter) Import(name string) (Component, error) {
 	switch name {
-	case "test":
+	case "lifecycle":
 		*imp.events = append(*imp.events, componentLifecycleEvent{imported: true})
 		return &testComponent{imp.events}, nil
 	default:
 		return nil, fmt.Errorf("unknown component %q", name)
 	}
 }
+
+// stickyComponent renders the argument of its first render, like a component keeping the state
+// of the item it has been created for.
+type stickyComponent struct {
+	v        any
+	disposed *int
+}
+
+func (c *stickyComponent) Render(s Scope) (any, error) {
+	if c.v == nil {
+		c.v = s.Vars()["v"]
+	}
+	return c.v, nil
+}
+
+func (c *stickyComponent) Dispose() error {
+	*c.disposed++
+	return nil
+}
+
+type stickyImporter struct {
+	disposed int
+}
+
+func (imp *stickyImporter) Import(name string) (Component, error) {
+	return &stickyComponent{disposed: &imp.disposed}, nil
+}
+
+func TestComponentKeyedLoop(t *testing.T) {
+	render := func(comp Component, xs ...any) string {
+		t.Helper()
+		rr, err := comp.Render(NewBaseScope(map[string]any{"xs": xs}))
+		require.NoError(t, err)
+		var sb strings.Builder
+		require.NoError(t, html.Render(&sb, rr.(*html.Node)))
+		return sb.String()
+	}
+
+	imp := &stickyImporter{}
+	doc, err := Parse(strings.NewReader(`<c:attr name="xs"></c:attr>`+
+		`<ul><li c:for="x in xs" c:key="x">${x}=<c:sticky v="${x}"></c:sticky></li></ul>`), imp)
+	require.NoError(t, err)
+	comp := NewComponent(doc, &ComponentOptions{Importer: imp})
+
+	require.Equal(t, `<ul><li>a=a</li><li>b=b</li></ul>`, render(comp, "a", "b"))
+	imp.disposed = 0
+
+	// the components are reused by the keys, the new item gets a new component
+	require.Equal(t, `<ul><li>c=c</li><li>b=b</li><li>a=a</li></ul>`, render(comp, "c", "b", "a"))
+	require.Equal(t, 0, imp.disposed)
+
+	// the components of the removed items are disposed
+	require.Equal(t, `<ul><li>a=a</li></ul>`, render(comp, "a"))
+	require.Equal(t, 2, imp.disposed)
+
+	// the duplicates are reported and skipped
+	rr, err := comp.Render(NewBaseScope(map[string]any{"xs": []any{"a", "a"}}))
+	require.ErrorContains(t, err, "duplicate c:key a")
+	require.NotNil(t, rr)
+
+	// without c:key, the components are reused by the index
+	doc, err = Parse(strings.NewReader(`<c:attr name="xs"></c:attr>`+
+		`<ul><li c:for="x in xs">${x}=<c:sticky v="${x}"></c:sticky></li></ul>`), imp)
+	require.NoError(t, err)
+	comp = NewComponent(doc, &ComponentOptions{Importer: imp})
+	require.Equal(t, `<ul><li>a=a</li><li>b=b</li></ul>`, render(comp, "a", "b"))
+	require.Equal(t, `<ul><li>b=a</li><li>a=b</li></ul>`, render(comp, "b", "a"))
+}
+
+type providerScope struct {
+	*BaseScope
+	lookups map[string]int
+}
+
+func (s *providerScope) EnvNames() []string {
+	return []string{"user", "expensive"}
+}
+
+func (s *providerScope) LookupEnv(name string) (any, bool, error) {
+	s.lookups[name]++
+	switch name {
+	case "user":
+		return map[string]any{"name": "Joe"}, true, nil
+	case "expensive":
+		return 42, true, nil
+	}
+	return nil, false, nil
+}
+
+func TestComponentEnvProvider(t *testing.T) {
+	s := &providerScope{BaseScope: NewBaseScope(nil), lookups: map[string]int{}}
+
+	doc, err := ParseWithOptions(strings.NewReader(
+		`<c:attr name="expensive">${0}</c:attr><p>${user.name} ${user.name}</p><p>${expensive}</p>`),
+		nil, &ParseOptions{EnvProvider: s})
+	require.NoError(t, err)
+
+	comp := NewComponent(doc, nil)
+
+	for i := 1; i <= 2; i++ {
+		rr, err := comp.Render(s)
+		require.NoError(t, err)
+
+		var buf strings.Builder
+		require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+		require.Equal(t, "<p>Joe Joe</p><p>0</p>", buf.String())
+
+		// resolved once per render, declared variables take precedence
+		require.Equal(t, map[string]int{"user": i}, s.lookups)
+	}
+}
+
+// shapedScope declares the shapes of the provided variables.
+type shapedScope struct {
+	*providerScope
+}
+
+func (s shapedScope) EnvShape(name string) (any, bool) {
+	if name == "expensive" {
+		return 0, true
+	}
+	return nil, false
+}
+
+func TestComponentEnvShaper(t *testing.T) {
+	s := &providerScope{BaseScope: NewBaseScope(nil), lookups: map[string]int{}}
+	text := `<p>${expensive.foo} ${user.name}</p>`
+
+	// without the shapes, the provided variables are not type checked
+	_, err := ParseWithOptions(strings.NewReader(text), nil, &ParseOptions{EnvProvider: s})
+	require.NoError(t, err)
+
+	_, err = ParseWithOptions(strings.NewReader(text), nil, &ParseOptions{EnvProvider: shapedScope{s}})
+	require.ErrorContains(t, err, "type int[string] is undefined")
+
+	doc, err := ParseWithOptions(strings.NewReader(`<p>${expensive + 1}</p>`), nil,
+		&ParseOptions{EnvProvider: shapedScope{s}})
+	require.NoError(t, err)
+	rr, err := NewComponent(doc, nil).Render(s)
+	require.NoError(t, err)
+
+	var buf strings.Builder
+	require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+	require.Equal(t, "<p>43</p>", buf.String())
+}
+
+type funcScope struct {
+	*BaseScope
+	greeting string
+}
+
+func (s *funcScope) LookupFunction(name string) (any, bool) {
+	if name == "greet" {
+		return func(who string) string { return s.greeting + ", " + who }, true
+	}
+	return nil, false
+}
+
+func TestComponentFunctionProvider(t *testing.T) {
+	funcs := map[string]any{
+		"greet": func(who string) string { return "Hello, " + who },
+		"upper": strings.ToUpper,
+	}
+	doc, err := ParseWithOptions(strings.NewReader(`<p>${greet('Joe')} ${upper('x')}</p>`),
+		nil, &ParseOptions{Functions: funcs})
+	require.NoError(t, err)
+
+	comp := NewComponent(doc, &ComponentOptions{Functions: funcs})
+	for _, tt := range []struct {
+		scope Scope
+		want  string
+	}{
+		{NewBaseScope(nil), "<p>Hello, Joe X</p>"},
+		{&funcScope{BaseScope: NewBaseScope(nil), greeting: "Hi"}, "<p>Hi, Joe X</p>"},
+	} {
+		rr, err := comp.Render(tt.scope)
+		require.NoError(t, err)
+
+		var buf strings.Builder
+		require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+		require.Equal(t, tt.want, buf.String())
+	}
+}
+
+func TestComponentEnvProviderImportArgs(t *testing.T) {
+	s := &providerScope{BaseScope: NewBaseScope(nil), lookups: map[string]int{}}
+	imp := &testImporter{}
+	imp.init()
+
+	// the provided values are unknown at parse time, so the import is not rendered by the parser
+	doc, err := ParseWithOptions(strings.NewReader(`<c:comp2 text="${user.name}"></c:comp2>`),
+		imp, &ParseOptions{EnvProvider: s})
+	require.NoError(t, err)
+
+	rr, err := NewComponent(doc, &ComponentOptions{Importer: imp}).Render(s)
+	require.NoError(t, err)
+
+	var buf strings.Builder
+	require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+	require.Equal(t, "<p>Joe</p>", buf.String())
+}
+
+// slowComponent blocks its renders until the release channel is closed. The components imported
+// at parse time have no channel and do not block.
+type slowComponent struct {
+	release  chan struct{}
+	disposed *atomic.Int32
+}
+
+func (c *slowComponent) Render(s Scope) (any, error) {
+	if c.release != nil {
+		<-c.release
+	}
+	return "slow", nil
+}
+
+func (c *slowComponent) Dispose() error {
+	c.disposed.Add(1)
+	return nil
+}
+
+type slowImporter struct {
+	release  chan struct{}
+	imported int
+	disposed atomic.Int32
+}
+
+func (imp *slowImporter) Import(name string) (Component, error) {
+	imp.imported++
+	return &slowComponent{release: imp.release, disposed: &imp.disposed}, nil
+}
+
+func TestComponentRenderTimeout(t *testing.T) {
+	imp := &slowImporter{}
+	doc, err := Parse(strings.NewReader(`<p>before</p><c:slow></c:slow><p>after</p>`), imp)
+	require.NoError(t, err)
+	imp.release = make(chan struct{})
+	imp.imported = 0
+	imp.disposed.Store(0)
+
+	comp := NewComponent(doc, &ComponentOptions{Importer: imp, RenderTimeout: 20 * time.Millisecond})
+	for i := 1; i <= 2; i++ {
+		rr, err := comp.Render(NewBaseScope(nil))
+		require.True(t, errors.Is(err, ErrRenderTimeout), "err = %v", err)
+		var ce *ComponentError
+		require.True(t, errors.As(err, &ce))
+
+		var buf strings.Builder
+		require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+		require.Equal(t, "<p>before</p><p>after</p>", buf.String())
+
+		// the abandoned instance is not reused
+		require.Equal(t, i, imp.imported)
+	}
+
+	// the abandoned instances are disposed once their renders return
+	close(imp.release)
+	require.Eventually(t, func() bool { return imp.disposed.Load() == 2 }, time.Second, time.Millisecond)
+
+	comp = NewComponent(doc, &ComponentOptions{Importer: imp, RenderTimeout: 20 * time.Millisecond})
+	rr, err := comp.Render(NewBaseScope(nil))
+	require.NoError(t, err)
+	var buf strings.Builder
+	require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+	require.Equal(t, "<p>before</p>slow<p>after</p>", buf.String())
+}
+
+// docsImporter imports the parsed documents by name. The documents not parsed yet (e.g. at
+// parse time) render nothing.
+type docsImporter struct {
+	docs     map[string]*Node
+	maxDepth int
+}
+
+func (imp *docsImporter) Import(name string) (Component, error) {
+	doc, ok := imp.docs[name]
+	if !ok {
+		return &testComponent{events: new([]componentLifecycleEvent)}, nil
+	}
+	return NewComponent(doc, &ComponentOptions{Name: name, Importer: imp, MaxImportDepth: imp.maxDepth}), nil
+}
+
+func TestComponentImportCycle(t *testing.T) {
+	imp := &docsImporter{docs: make(map[string]*Node), maxDepth: 5}
+	// the page is parsed first, so the cycle is not rendered at parse time
+	for _, src := range []struct{ name, text string }{
+		{"page", `<main><c:a></c:a></main>`},
+		{"a", `<div><c:b></c:b></div>`},
+		{"b", `<span><c:a></c:a></span>`},
+	} {
+		doc, err := Parse(strings.NewReader(src.text), imp)
+		require.NoError(t, err)
+		imp.docs[src.name] = doc
+	}
+
+	comp, err := imp.Import("page")
+	require.NoError(t, err)
+	_, err = comp.Render(NewBaseScope(nil))
+	require.ErrorIs(t, err, ErrImportDepthExceeded)
+
+	var ce *ImportCycleError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, []string{"b", "a", "b"}, ce.Cycle)
+}
+
+func TestInferInterface(t *testing.T) {
+	parse := func(src string) *Node {
+		doc, err := Parse(strings.NewReader(src), anyImporter{})
+		require.NoError(t, err)
+		return doc
+	}
+
+	inputs, output := InferInterface(parse(`<c:attr name="title">Hello</c:attr><c:attr name="count">${0}</c:attr>`+
+		`${{'title': title, 'count': count + 1}}`), nil)
+	require.Equal(t, map[string]any{"title": "Hello", "count": 0}, inputs)
+	require.Equal(t, map[string]any{"title": "Hello", "count": 1}, output)
+
+	inputs, output = InferInterface(parse(`<c:attr name="name"></c:attr><p>${name}</p>`), nil)
+	require.Equal(t, map[string]any{"name": nil}, inputs)
+	require.IsType(t, &html.Node{}, output)
+
+	// the imports are not resolved without an importer
+	_, output = InferInterface(parse(`<div><c:post></c:post></div>`), nil)
+	require.Nil(t, output)
+
+	_, output = InferInterface(parse(`<div><c:post></c:post></div>`), &ComponentOptions{Importer: anyImporter{}})
+	require.IsType(t, &html.Node{}, output)
+}
@@ -0,0 +1,117 @@
+package chtml
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/expr-lang/expr/ast"
+)
+
+// Diagnostic is a non-fatal problem found by the parser, e.g. a suspicious expression. Unlike
+// parse errors, diagnostics do not prevent the component from being rendered, so the templates
+// can be tightened gradually.
+type Diagnostic struct {
+	// Source is the location of the problem in the source document.
+	Source Span
+
+	// Message describes the problem.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: warning: %s", d.Source.Start, d.Message)
+}
+
+// LogValue implements slog.LogValuer to log diagnostics as structured records.
+func (d Diagnostic) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("level", "warning"),
+		slog.String("pos", d.Source.Start.String()),
+		slog.String("msg", d.Message),
+	)
+}
+
+// checkCondition returns warnings for a c:if or c:else-if condition, which value is truthy
+// regardless of the data, e.g. a literal or an object.
+func checkCondition(x Expr) []string {
+	node := exprNode(x)
+	if node == nil {
+		return nil
+	}
+
+	var warns []string
+	switch node.(type) {
+	case *ast.StringNode, *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.NilNode:
+		warns = append(warns, fmt.Sprintf("condition %q is a constant", x.raw))
+	case *ast.MapNode, *ast.ArrayNode:
+		warns = append(warns, fmt.Sprintf("condition %q is a literal, it is truthy when not empty", x.raw))
+	default:
+		t := node.Type()
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t != nil && t.Kind() == reflect.Struct {
+			warns = append(warns, fmt.Sprintf("condition %q is an object of type %s, it is always truthy",
+				x.raw, node.Type()))
+		}
+	}
+	return append(warns, checkExpr(x)...)
+}
+
+// checkExpr returns warnings for comparisons which result does not depend on the data, e.g.
+// comparing a string variable to nil is always false (the empty string is not nil).
+func checkExpr(x Expr) []string {
+	node := exprNode(x)
+	if node == nil {
+		return nil
+	}
+	v := &comparisonVisitor{}
+	ast.Walk(&node, v)
+	return v.warns
+}
+
+// exprNode returns the root of the type-checked AST of the expression or nil.
+func exprNode(x Expr) ast.Node {
+	if x.expr == nil {
+		return nil
+	}
+	return x.expr.Node()
+}
+
+// comparisonVisitor collects warnings about comparisons of non-nillable values to nil.
+type comparisonVisitor struct {
+	warns []string
+}
+
+func (v *comparisonVisitor) Visit(node *ast.Node) {
+	n, ok := (*node).(*ast.BinaryNode)
+	if !ok || (n.Operator != "==" && n.Operator != "!=") {
+		return
+	}
+
+	operand := n.Left
+	if _, ok := n.Left.(*ast.NilNode); ok {
+		operand = n.Right
+	} else if _, ok := n.Right.(*ast.NilNode); !ok {
+		return
+	}
+
+	t := operand.Type()
+	if t == nil || isNillable(t.Kind()) {
+		return
+	}
+
+	result := n.Operator == "!="
+	v.warns = append(v.warns, fmt.Sprintf("%s value is never nil, the comparison is always %t", t, result))
+}
+
+// isNillable reports whether a value of the kind can be nil.
+func isNillable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan,
+		reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "no warnings",
+			text: `<c:attr name="n">${1}</c:attr><p c:if="n > 0">a</p><p c:else>b</p>`,
+			want: nil,
+		},
+		{
+			name: "constant condition",
+			text: `<p c:if="'yes'">a</p>`,
+			want: []string{`1:1: warning: condition "'yes'" is a constant`},
+		},
+		{
+			name: "map literal condition",
+			text: "\n<p c:if=\"{a: 1}\">a</p>",
+			want: []string{`2:1: warning: condition "{a: 1}" is a literal, it is truthy when not empty`},
+		},
+		{
+			name: "comparison to nil",
+			text: `<c:attr name="s">str</c:attr><a href="${s == nil ? 'x' : 'y'}">a</a>`,
+			want: []string{`1:30: warning: string value is never nil, the comparison is always false`},
+		},
+		{
+			name: "untyped variables are not reported",
+			text: `<c:attr name="x"></c:attr><p c:if="x == nil">a</p>`,
+			want: nil,
+		},
+		{
+			name: "loop variable shadows argument",
+			text: "<c:attr name=\"item\"></c:attr>\n<ul><li c:for=\"item in [1, 2]\">${item}</li></ul>",
+			want: []string{`2:5: warning: loop variable "item" shadows the variable defined at 1:1`},
+		},
+		{
+			name: "loop variable shadows outer loop",
+			text: `<ul c:for="i, x in [[1]]"><li c:for="i, y in x">${y}</li></ul>`,
+			want: []string{`1:27: warning: loop variable "i" shadows the variable defined at 1:1`},
+		},
+		{
+			name: "loop variable shadows implicit argument",
+			text: `<p c:for="_ in [1]">a</p><p c:for="x in [1]">${x}</p><p c:for="x in [1]">${x}</p>`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags, err := ParseWithDiagnostics(strings.NewReader(tt.text), &testImporter{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range diags {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseStrictShadowing(t *testing.T) {
+	text := `<c:attr name="item"></c:attr><p c:for="item in [1]">${item}</p>`
+	_, _, err := ParseWithDiagnostics(strings.NewReader(text), &testImporter{}, &ParseOptions{StrictShadowing: true})
+	if err == nil || !strings.Contains(err.Error(), `loop variable "item" shadows the variable defined at 1:1`) {
+		t.Errorf("expected a shadowing error, got %v", err)
+	}
+}
+
+func TestCheckCondition(t *testing.T) {
+	type user struct{ Name string }
+
+	x, err := NewExpr("u", map[string]any{"u": &user{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := checkCondition(x)
+	want := `condition "u" is an object of type *chtml.user, it is always truthy`
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("checkCondition() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,260 @@
+package chtml
+
+import (
+	"reflect"
+	"slices"
+
+	"golang.org/x/net/html"
+)
+
+// DiffRenderer is an optional interface for components re-rendering only the parts of the
+// document affected by the changed variables, e.g. the live pages re-rendered on each Touch or
+// WebSocket message.
+type DiffRenderer interface {
+	// RenderDiff renders the component like Render and also returns the nodes rendered
+	// differently than by the previous RenderDiff call. The first call reports no changes.
+	RenderDiff(s Scope) (any, []Change, error)
+}
+
+// Change is a node of the document rendered differently than by the previous render.
+type Change struct {
+	// Node is the source node. The changes of its descendants are not reported separately.
+	Node *Node
+
+	// Result is the new render result of the node: *html.Node, a data object, or nil if
+	// the node is hidden now, e.g. by c:if. For a c:for node, it is the concatenated result of
+	// all the items.
+	Result any
+}
+
+var _ DiffRenderer = (*chtmlComponent)(nil)
+
+// Dependency tracking: once RenderDiff is called, the component remembers the result of each node
+// along with the values of the variables the node and its descendants refer to. On the next
+// render, the node is not evaluated again if the values are equal, and the remembered result is
+// reused. The values are compared with reflect.DeepEqual, the maps and the slices decoded from
+// JSON (map[string]any, []any) are copied for that. Other values, e.g. pointers to Go structs,
+// must be replaced rather than modified in place to be seen as changed.
+//
+// A node is reported as changed if the variables of its own expressions (the text, the attributes,
+// c:if, etc.) changed, or it is shown or hidden. Its ancestors are rendered again, but not
+// reported. The c:for nodes are reported as a whole.
+//
+// The nodes importing components can't be tracked, as the imported component may render
+// differently for the same arguments, e.g. after a background update. Such nodes are rendered
+// and reported on each render, and their ancestors are rendered each time.
+
+// diffState is shared by the component and its loop items during RenderDiff.
+type diffState struct {
+	changes []Change
+
+	// suppress is greater than zero while rendering the descendants of a reported node.
+	suppress int
+}
+
+// memoEntry is the remembered render of a node.
+type memoEntry struct {
+	own     []string // variables referred by the expressions of the node itself
+	all     []string // variables referred by the node and its descendants
+	tracked bool     // whether the result can be reused (no imports in the subtree)
+	ownVals []any    // values of own at the last render
+	allVals []any    // values of all at the last render, only for the tracked nodes
+	res     any      // result of the last render, only for the tracked nodes
+	visible bool     // whether the node was rendered last time, or hidden by c:if
+}
+
+// RenderDiff renders the component and reports the changed nodes (see DiffRenderer).
+func (c *chtmlComponent) RenderDiff(s Scope) (any, []Change, error) {
+	initial := c.diff == nil
+	if initial {
+		c.diff = &diffState{}
+	}
+	c.diff.changes = nil
+	c.diff.suppress = 0
+	if initial {
+		c.diff.suppress = 1 // the whole document is new
+	}
+
+	res, err := c.Render(s)
+
+	changes := c.diff.changes
+	c.diff.changes = nil
+	return res, changes, err
+}
+
+// renderTracked renders the visible node n reusing the remembered result if the variables it
+// refers to have not changed.
+func (c *chtmlComponent) renderTracked(n *Node) any {
+	e := c.memo[n]
+	if e == nil {
+		e = &memoEntry{}
+		e.own, e.all, e.tracked = nodeDeps(n)
+		if c.memo == nil {
+			c.memo = make(map[*Node]*memoEntry)
+		}
+		c.memo[n] = e
+	}
+
+	ownVals := c.depValues(e.own)
+	ownSame := e.visible && slices.EqualFunc(e.ownVals, ownVals, valuesEqual)
+	var allVals []any
+	if e.tracked {
+		allVals = c.depValues(e.all)
+		if ownSame && slices.EqualFunc(e.allVals, allVals, valuesEqual) {
+			return cloneResult(e.res)
+		}
+	}
+
+	// the loops and the imports may render differently even if their expressions did not change
+	report := !ownSame || !n.Loop.IsEmpty() || isOutputImport(n)
+	top := report && c.diff.suppress == 0
+	if report {
+		c.diff.suppress++
+	}
+
+	nerrs := len(c.errs)
+	rr := c.renderNodeLoop(n)
+
+	if report {
+		c.diff.suppress--
+	}
+	if top {
+		c.diff.changes = append(c.diff.changes, Change{Node: n, Result: cloneResult(rr)})
+	}
+
+	e.ownVals, e.allVals, e.visible, e.res = ownVals, allVals, true, nil
+	if e.tracked {
+		if len(c.errs) > nerrs {
+			e.visible = false // render again to report the errors
+		} else {
+			e.res = cloneResult(rr)
+		}
+	}
+	return rr
+}
+
+// trackHidden reports the node n hidden by c:if or c:switch if it was rendered last time.
+func (c *chtmlComponent) trackHidden(n *Node) {
+	e := c.memo[n]
+	if e == nil || !e.visible {
+		return
+	}
+	e.visible, e.res = false, nil
+	if c.diff.suppress == 0 && n.Type != html.DocumentNode {
+		c.diff.changes = append(c.diff.changes, Change{Node: n})
+	}
+}
+
+// depValues returns the current values of the variables. The variables provided by the scope on
+// demand (see EnvProvider) are looked up if they are not resolved yet.
+func (c *chtmlComponent) depValues(deps []string) []any {
+	ep, _ := c.scope.(EnvProvider)
+	vals := make([]any, len(deps))
+	for i, name := range deps {
+		v, ok := c.env[name]
+		if !ok && ep != nil {
+			v, _, _ = ep.LookupEnv(name)
+		}
+		if _, ok := v.(func(string) any); ok && name == "slot" {
+			v = c.env[slotsVar] // a new function is made for each render
+		}
+		vals[i] = snapshotValue(v)
+	}
+	return vals
+}
+
+// nodeDeps returns the variables the node n refers to in its own expressions (including
+// the attributes rendered with <c:attr>), and along with its descendants. The node is not
+// tracked if it imports a component or has an import among the descendants. The variables bound
+// inside the subtree, e.g. the loop variables, are returned as well; they are missing at
+// the node and do not change its result.
+func nodeDeps(n *Node) (own, all []string, tracked bool) {
+	var deps []string
+	var walk func(n *Node) bool
+	walk = func(n *Node) bool {
+		for _, e := range []Expr{n.Data, n.Cond, n.Loop, n.LoopKey, n.Switch, n.Case} {
+			deps = append(deps, e.idents...)
+		}
+		for _, attr := range n.Attr {
+			deps = append(deps, attr.Val.idents...)
+		}
+		tracked := n.LoopParallel <= 1 // the items of a parallel loop are not tracked
+		if n.Type == importNode && n.Data.RawString() != "c:attr" {
+			tracked = false
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if !walk(child) {
+				tracked = false
+			}
+		}
+		return tracked
+	}
+
+	tracked = walk(n)
+	all = slices.Compact(slices.Sorted(slices.Values(deps)))
+
+	deps = deps[:0]
+	walk(&Node{Data: n.Data, Attr: n.Attr, Cond: n.Cond, Loop: n.Loop, LoopKey: n.LoopKey,
+		Switch: n.Switch, Case: n.Case})
+	if n.Type != importNode {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == importNode && child.Data.RawString() == "c:attr" {
+				walk(child)
+			}
+		}
+	}
+	own = slices.Compact(slices.Sorted(slices.Values(deps)))
+	return own, all, tracked
+}
+
+// isOutputImport reports whether n imports a component rendered into the output, as opposed to
+// <c:attr>, <c:define> and the imports bound to a variable.
+func isOutputImport(n *Node) bool {
+	if n.Type != importNode || n.As != "" {
+		return false
+	}
+	name := n.Data.RawString()
+	return name != "c:attr" && name != "c:define"
+}
+
+// snapshotValue copies the maps and the slices decoded from JSON, so their modifications in place
+// are seen as changes.
+func snapshotValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, el := range v {
+			m[k] = snapshotValue(el)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, el := range v {
+			s[i] = snapshotValue(el)
+		}
+		return s
+	}
+	return v
+}
+
+// valuesEqual reports whether the variable has the same value as at the last render. The HTML
+// trees are compared by identity, the functions by the code pointer.
+func valuesEqual(a, b any) bool {
+	if na, ok := a.(*html.Node); ok {
+		return na == b
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Func && vb.Kind() == reflect.Func {
+		return va.Type() == vb.Type() && va.Pointer() == vb.Pointer()
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// cloneResult returns a copy of the render result that is safe to reuse, as the results are
+// modified when concatenated.
+func cloneResult(rr any) any {
+	if n, ok := rr.(*html.Node); ok && n != nil {
+		return cloneHtmlTree(n)
+	}
+	return rr
+}
@@ -0,0 +1,94 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderDiff(t *testing.T) {
+	evals := 0
+	funcs := map[string]any{
+		"count": func(v any) any { evals++; return v },
+	}
+	const text = `<c:attr name="a"></c:attr><c:attr name="b"></c:attr><c:attr name="cls"></c:attr>` +
+		`<c:attr name="show"></c:attr><c:attr name="items"></c:attr>` +
+		`<div class="${cls}"><p>${count(a)}</p><p>${b}</p></div>` +
+		`<em c:if="show">on</em><em c:else>off</em>` +
+		`<ul><li c:for="it in items">${it}</li></ul>` +
+		`<c:comp1></c:comp1>`
+
+	imp := &testImporter{}
+	imp.init()
+	doc, err := ParseWithOptions(strings.NewReader(text), imp, &ParseOptions{Functions: funcs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := NewComponent(doc, &ComponentOptions{Importer: imp, Functions: funcs}).(DiffRenderer)
+
+	vars := map[string]any{"a": "A", "b": "B", "cls": "x", "show": true, "items": []any{"1", "2"}}
+	render := func(changes map[string]any) ([]Change, string) {
+		t.Helper()
+		for k, v := range changes {
+			vars[k] = v
+		}
+		rr, ch, err := comp.RenderDiff(NewBaseScope(vars))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf strings.Builder
+		if err := html.Render(&buf, AnyToHtml(rr)); err != nil {
+			t.Fatal(err)
+		}
+		return ch, buf.String()
+	}
+	// describe returns the changed nodes, the text nodes are described by their parents
+	describe := func(changes []Change) string {
+		var res []string
+		for _, c := range changes {
+			n := c.Node
+			if n.Type == html.TextNode {
+				n = n.Parent
+			}
+			res = append(res, n.Data.RawString())
+		}
+		return strings.Join(res, ",")
+	}
+
+	const want = `<div class="x"><p>A</p><p>B</p></div><em>on</em><ul><li>1</li><li>2</li></ul><p>comp1</p>`
+	if ch, got := render(nil); got != want || len(ch) != 0 {
+		t.Fatalf("first render: got %s, changes %q", got, describe(ch))
+	}
+	if evals != 1 {
+		t.Errorf("evals = %d, want 1", evals)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]any
+		changes string
+		evals   int
+	}{
+		{"same variables", nil, "c:comp1", 1},
+		{"text", map[string]any{"b": "B2"}, "p,c:comp1", 1},
+		{"text of an expensive node", map[string]any{"a": "A2"}, "p,c:comp1", 2},
+		{"attribute", map[string]any{"cls": "y"}, "div,c:comp1", 2},
+		{"condition", map[string]any{"show": false}, "em,em,c:comp1", 2},
+		{"loop", map[string]any{"items": []any{"1", "3"}}, "li,c:comp1", 2},
+	}
+	for _, tt := range tests {
+		ch, _ := render(tt.vars)
+		if got := describe(ch); got != tt.changes {
+			t.Errorf("%s: changes = %q, want %q", tt.name, got, tt.changes)
+		}
+		if evals != tt.evals {
+			t.Errorf("%s: evals = %d, want %d", tt.name, evals, tt.evals)
+		}
+	}
+
+	_, got := render(nil)
+	if want := `<div class="y"><p>A2</p><p>B2</p></div><em>off</em><ul><li>1</li><li>3</li></ul><p>comp1</p>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
@@ -19,7 +19,7 @@ func (e env) HtmlPlusAny(a *html.Node, b any) *html.Node {
 		if b == nil {
 			return a
 		}
-		return e.HtmlPlusText(a, fmt.Sprint(v))
+		return e.HtmlPlusText(a, valueText(v))
 	}
 }
 
@@ -31,7 +31,7 @@ func (e env) AnyPlusHtml(a any, b *html.Node) *html.Node {
 		if a == nil {
 			return b
 		}
-		return e.TextPlusHtml(fmt.Sprint(v), b)
+		return e.TextPlusHtml(valueText(v), b)
 	}
 }
 
@@ -110,21 +110,29 @@ func AnyPlusAny(a any, b any) any {
 		return a
 	}
 
+	// sequences are concatenated as HTML, consuming them
+	if _, ok := asSeq(a); ok {
+		return AnyPlusAny(AnyToHtml(a), b)
+	}
+	if _, ok := asSeq(b); ok {
+		return AnyPlusAny(a, AnyToHtml(b))
+	}
+
 	if sa, ok := a.(string); ok {
 		if sb, ok := b.(string); ok {
 			return sa + sb // if both are strings, concatenate them
-		} else if strings.TrimSpace(sa) == "" {
+		} else if isBlank(sa) {
 			return b // leave "b" if "a" is whitespace
 		}
 	}
 
 	if sb, ok := b.(string); ok {
-		if strings.TrimSpace(sb) == "" {
+		if isBlank(sb) {
 			return a // leave "a" if "b" is whitespace
 		}
 	}
 
-	return fmt.Sprint(a) + fmt.Sprint(b)
+	return valueText(a) + valueText(b)
 }
 
 func isEquivalentToNewAny(v any) bool {
@@ -155,6 +163,17 @@ func AnyToHtml(a any) *html.Node {
 	if v, ok := a.(*html.Node); ok {
 		return v
 	}
+	if seq, ok := asSeq(a); ok {
+		n := &html.Node{
+			Type: html.DocumentNode,
+		}
+		for el := range seq {
+			if nn := AnyToHtml(el); nn != nil {
+				appendChild(n, nn)
+			}
+		}
+		return n
+	}
 
 	var repr string
 
@@ -170,6 +189,10 @@ func AnyToHtml(a any) *html.Node {
 		}
 		return n
 	case reflect.Map, reflect.Struct:
+		if t, ok := a.(time.Time); ok {
+			repr = valueText(t)
+			break
+		}
 		// check if implements Stringer
 		if s, ok := a.(fmt.Stringer); ok {
 			repr = s.String()
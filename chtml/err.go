@@ -14,6 +14,29 @@ var (
 
 	// ErrImportNotAllowed is returned when an Importer is not set for the component.
 	ErrImportNotAllowed = errors.New("imports are not allowed")
+
+	// ErrInvalidEncoding is returned when the input or the rendered output is not a valid UTF-8
+	// and the conversion is not allowed.
+	ErrInvalidEncoding = errors.New("invalid UTF-8 encoding")
+
+	// ErrBudgetExceeded is returned when rendering exceeds the allocation budget of the Arena.
+	ErrBudgetExceeded = errors.New("render budget exceeded")
+
+	// ErrRenderTimeout is reported when an imported component is not rendered within
+	// ComponentOptions.RenderTimeout.
+	ErrRenderTimeout = errors.New("render timeout exceeded")
+
+	// ErrImportDepthExceeded is reported when the imports of the components are nested deeper
+	// than ComponentOptions.MaxImportDepth, e.g. a component importing itself.
+	ErrImportDepthExceeded = errors.New("import depth exceeded")
+
+	// ErrNotStreamable is returned by StreamRenderer implementations when the component output
+	// can't be written as a stream of HTML.
+	ErrNotStreamable = errors.New("component output is not streamable")
+
+	// ErrOutputTooLarge is returned by RenderTo when the encoded output exceeds
+	// RenderOptions.MaxSize.
+	ErrOutputTooLarge = errors.New("rendered output is too large")
 )
 
 type UnrecognizedArgumentError struct {
@@ -32,17 +55,51 @@ func (e *UnrecognizedArgumentError) Is(target error) bool {
 	return false
 }
 
+// ImportCycleError is reported when a component imports itself, directly or via other
+// components. It is returned by the Importer implementations detecting the cycles, and is
+// wrapped by the ErrImportDepthExceeded errors if the names of the components form a cycle.
+type ImportCycleError struct {
+	// Cycle is the names of the components in the order of the imports. The first and the last
+	// names are the same.
+	Cycle []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// PanicError is a panic recovered while evaluating an expression, e.g. in a function or a lazy
+// sequence passed to the component. It is reported as a component error instead of crashing
+// the render.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
 type ComponentError struct {
-	err  error
-	path string
-	html *html.Node
+	err       error
+	path      string
+	html      *html.Node
+	source    Span
+	component string
 }
 
 func newComponentError(n *Node, err error) *ComponentError {
 	return &ComponentError{
-		err:  err,
-		path: buildErrorPath(n),
-		html: buildErrorContext(n),
+		err:    err,
+		path:   buildErrorPath(n),
+		html:   buildErrorContext(n),
+		source: n.Source,
 	}
 }
 
@@ -57,6 +114,18 @@ func (e *ComponentError) Unwrap() error {
 	return e.err
 }
 
+// Source returns the location of the failed node in the component source. The span is zero if
+// the location is unknown.
+func (e *ComponentError) Source() Span {
+	return e.source
+}
+
+// Component returns the name of the component the error occurred in (see ComponentOptions.Name
+// and ParseOptions.Name), or an empty string if the name is unknown.
+func (e *ComponentError) Component() string {
+	return e.component
+}
+
 func (e *ComponentError) HTMLContext() string {
 	var buf strings.Builder
 	_ = html.Render(&buf, e.html)
@@ -112,7 +181,7 @@ func (b errorContextBuilder) addNode(src *Node, children bool) {
 			n.Attr[i] = html.Attribute{Key: a.Key, Val: a.Val.RawString()}
 		}
 	}
-	if n.Type == importNode {
+	if n.Type == importNode || n.Type == testNode {
 		n.Type = html.ElementNode
 	}
 
@@ -1,6 +1,7 @@
 package chtml
 
 import (
+	"iter"
 	"strings"
 	"testing"
 
@@ -78,3 +79,114 @@ func Test_buildErrorContext(t *testing.T) {
 		})
 	}
 }
+
+// lookupScope provides the variables (e.g. functions) on demand.
+type lookupScope struct {
+	*BaseScope
+	env map[string]func() any
+}
+
+func (s *lookupScope) EnvNames() []string {
+	var names []string
+	for k := range s.env {
+		names = append(names, k)
+	}
+	return names
+}
+
+func (s *lookupScope) LookupEnv(name string) (any, bool, error) {
+	f, ok := s.env[name]
+	if !ok {
+		return nil, false, nil
+	}
+	return f(), true, nil
+}
+
+type panicker struct{}
+
+func (panicker) Boom() string { panic("boom") }
+
+func TestExprPanic(t *testing.T) {
+	s := &lookupScope{
+		BaseScope: NewBaseScope(nil),
+		env: map[string]func() any{
+			"obj":    func() any { return panicker{} },
+			"lookup": func() any { panic("lookup failed") },
+			"items": func() any {
+				return iter.Seq[any](func(yield func(any) bool) {
+					yield(1)
+					panic("seq failed")
+				})
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+		line    int
+	}{
+		{
+			name:    "function",
+			text:    "<div>\n<p>${obj.Boom()}</p>\n</div>",
+			want:    "<div>\n<p></p>\n</div>",
+			wantErr: "boom",
+			line:    2,
+		},
+		{
+			name:    "lookup",
+			text:    "<p>${lookup}</p>",
+			want:    "<p></p>",
+			wantErr: "lookup failed",
+			line:    1,
+		},
+		{
+			name:    "sequence",
+			text:    "<ul>\n<li c:for=\"x in items\">${x}</li>\n</ul>",
+			want:    "<ul>\n<li>1</li>\n</ul>",
+			wantErr: "seq failed",
+			line:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseWithOptions(strings.NewReader(tt.text), nil, &ParseOptions{EnvProvider: s})
+			require.NoError(t, err)
+
+			var rr any
+			require.NotPanics(t, func() {
+				rr, err = NewComponent(doc, nil).Render(s)
+			})
+			require.ErrorContains(t, err, tt.wantErr)
+
+			var ce *ComponentError
+			require.ErrorAs(t, err, &ce)
+			require.Equal(t, tt.line, ce.Source().Start.Line)
+
+			var buf strings.Builder
+			require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+			require.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestComponentErrorName(t *testing.T) {
+	_, err := ParseWithOptions(strings.NewReader(`<p>${1 +}</p>`), nil, &ParseOptions{Name: "pages/index.chtml"})
+	var ce *ComponentError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "pages/index.chtml", ce.Component())
+
+	s := &lookupScope{
+		BaseScope: NewBaseScope(nil),
+		env:       map[string]func() any{"obj": func() any { return panicker{} }},
+	}
+	doc, err := ParseWithOptions(strings.NewReader("<ul>\n<li>${obj.Boom()}</li>\n</ul>"), nil,
+		&ParseOptions{EnvProvider: s})
+	require.NoError(t, err)
+	_, err = NewComponent(doc, &ComponentOptions{Name: "list.chtml"}).Render(s)
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "list.chtml", ce.Component())
+	require.Equal(t, 2, ce.Source().Start.Line)
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -14,8 +17,86 @@ import (
 	"github.com/expr-lang/expr/conf"
 	expr_parser "github.com/expr-lang/expr/parser"
 	"github.com/expr-lang/expr/vm"
+	"golang.org/x/net/html"
 )
 
+// exprFunctions are the functions available in the expressions in addition to the builtin
+// functions of expr-lang.
+var exprFunctions = []expr.Option{
+	expr.Function("unsafeHtml", func(args ...any) (any, error) {
+		return unsafeHtml(args[0])
+	}, new(func(any) *html.Node)),
+	expr.Function("range", func(args ...any) (any, error) {
+		if len(args) == 1 {
+			return intRange(0, args[0].(int))
+		}
+		return intRange(args[0].(int), args[1].(int))
+	}, new(func(int) []int), new(func(int, int) []int)),
+	expr.Function("truncate", func(args ...any) (any, error) {
+		return truncate(args[0].(string), args[1].(int)), nil
+	}, new(func(string, int) string)),
+	expr.Function("pluralize", func(args ...any) (any, error) {
+		return pluralize(args[0].(int), args[1].(string), args[2].(string)), nil
+	}, new(func(int, string, string) string)),
+	expr.Function("json", func(args ...any) (any, error) {
+		return jsonString(args[0])
+	}, new(func(any) string)),
+	expr.Function("formatTime", func(args ...any) (any, error) {
+		tz := make([]string, 0, 1)
+		for _, arg := range args[2:] {
+			tz = append(tz, arg.(string))
+		}
+		return formatTime(args[0], args[1].(string), tz...)
+	}, new(func(any, string) string), new(func(any, string, string) string)),
+	expr.Function("parseTime", func(args ...any) (any, error) {
+		layout := make([]string, 0, 1)
+		for _, arg := range args[1:] {
+			layout = append(layout, arg.(string))
+		}
+		return parseTime(args[0].(string), layout...)
+	}, new(func(string) time.Time), new(func(string, string) time.Time)),
+}
+
+// checkFunction reports the custom function of the expressions (see ParseOptions.Functions) that
+// is not a function or is shadowed by a builtin one.
+func checkFunction(name string, fn any) error {
+	if v := reflect.ValueOf(fn); v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("function %q is %T, not a function", name, fn)
+	}
+	if _, ok := builtinFunctions()[name]; ok {
+		return fmt.Errorf("function %q is already defined", name)
+	}
+	return nil
+}
+
+// builtinFunctions returns the exprFunctions by name.
+var builtinFunctions = sync.OnceValue(func() conf.FunctionsTable {
+	c := conf.CreateNew()
+	for _, opt := range exprFunctions {
+		opt(c)
+	}
+	return c.Functions
+})
+
+// maxRange is the maximum number of the items of range(), so a value coming from a request, e.g.
+// range(pages), can't exhaust the memory.
+const maxRange = 1 << 20
+
+// intRange returns the integers from start to end, excluding end, e.g. for c:for="i in range(n)".
+func intRange(start, end int) ([]int, error) {
+	if end <= start {
+		return []int{}, nil
+	}
+	if end-start > maxRange {
+		return nil, fmt.Errorf("range(%d, %d) is longer than %d items", start, end, maxRange)
+	}
+	res := make([]int, end-start)
+	for i := range res {
+		res[i] = start + i
+	}
+	return res, nil
+}
+
 const (
 	eof        rune = -1
 	leftDelim       = "${"
@@ -26,27 +107,33 @@ const (
 type Expr struct {
 	raw  string
 	expr *vm.Program
+
+	// idents is a list of identifiers referenced in the expression. It is used to resolve
+	// variables from an EnvProvider on demand.
+	idents []string
 }
 
 func NewExpr(s string, args map[string]any) (Expr, error) {
 	if s == "" {
 		return Expr{}, nil
 	}
-	x, err := expr.Compile(s, expr.Env(env(args)))
+	x, err := expr.Compile(pipeCalls(s), append([]expr.Option{expr.Env(env(args))}, exprFunctions...)...)
 	if err != nil {
 		return Expr{}, err
 	}
 	return Expr{
-		raw:  s,
-		expr: x,
+		raw:    s,
+		expr:   x,
+		idents: exprIdents(x),
 	}, nil
 }
 
 func NewExprInterpol(s string, args map[string]any) (Expr, error) {
 	expr, err := interpol(s, args)
 	return Expr{
-		raw:  s,
-		expr: expr,
+		raw:    s,
+		expr:   expr,
+		idents: exprIdents(expr),
 	}, err
 }
 
@@ -75,6 +162,18 @@ func (e Expr) Value(vm *vm.VM, env any) (any, error) {
 	return e.raw, nil
 }
 
+// Type returns the static type of the expression result, or nil if it is unknown.
+func (e Expr) Type() reflect.Type {
+	if e.expr == nil || e.expr.Node() == nil {
+		return nil
+	}
+	t := e.expr.Node().Type()
+	if t == nil || t.Kind() == reflect.Interface {
+		return nil
+	}
+	return t
+}
+
 func (e Expr) RawString() string {
 	return e.raw
 }
@@ -83,6 +182,44 @@ func (e Expr) IsEmpty() bool {
 	return e.expr == nil && e.raw == ""
 }
 
+// identVisitor collects names of the identifiers in the expression AST.
+type identVisitor struct {
+	idents  []string
+	callees []*ast.IdentifierNode
+}
+
+func (v *identVisitor) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if !slices.Contains(v.idents, n.Value) {
+			v.idents = append(v.idents, n.Value)
+		}
+	case *ast.CallNode:
+		if callee, ok := n.Callee.(*ast.IdentifierNode); ok {
+			v.callees = append(v.callees, callee)
+		}
+	}
+}
+
+// exprIdents returns a list of identifiers referenced in the compiled program.
+func exprIdents(p *vm.Program) []string {
+	if p == nil {
+		return nil
+	}
+	node := p.Node()
+	if node == nil {
+		return nil
+	}
+	v := &identVisitor{}
+	ast.Walk(&node, v)
+
+	// function names are not variables
+	for _, callee := range v.callees {
+		v.idents = slices.DeleteFunc(v.idents, func(s string) bool { return s == callee.Value })
+	}
+	return v.idents
+}
+
 // interpol converts a string with ${}-style placeholders to meta program.
 // If the string is a simple text with no interpolation, it returns (nil, nil).
 // If args is not nil, the expression engine will do type checking.
@@ -120,9 +257,10 @@ loop:
 		case itemText:
 			in = append(in, &ast.StringNode{Value: item.val})
 		case itemExpr:
-			p, err := expr.Compile(item.val,
+			p, err := expr.Compile(pipeCalls(item.val), append([]expr.Option{
 				expr.Env(env(args)),
-				expr.Operator("+", fns...))
+				expr.Operator("+", fns...),
+			}, exprFunctions...)...)
 			if err != nil {
 				return nil, err
 			}
@@ -152,6 +290,7 @@ loop:
 			return acc, nil
 		}),
 	}
+	opts = append(opts, exprFunctions...)
 
 	for _, opt := range opts {
 		opt(c)
@@ -391,6 +530,19 @@ func isSpace(r rune) bool {
 	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
 }
 
+// isIdentifier reports whether s is a valid variable name for expressions.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !isAlphaNumeric(r) || (i == 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
 // isAlphaNumeric reports whether r is an alphabetic, digit, or underscore.
 func isAlphaNumeric(r rune) bool {
 	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
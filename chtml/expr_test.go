@@ -2,9 +2,11 @@ package chtml
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/expr-lang/expr/vm"
+	"golang.org/x/net/html"
 )
 
 func TestInterpol(t *testing.T) {
@@ -85,3 +87,44 @@ func Test_parseLoopExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomFunctions(t *testing.T) {
+	funcs := map[string]any{
+		"slug":  func(s string) string { return strings.ReplaceAll(strings.ToLower(s), " ", "-") },
+		"upper": func(s string) string { return "custom " + s }, // replaces the expr-lang builtin
+	}
+	parse := func(text string, funcs map[string]any) (*Node, error) {
+		return ParseWithOptions(strings.NewReader(text), nil, &ParseOptions{Functions: funcs})
+	}
+
+	text := `<a href="/${slug('Hello World')}">${'x' | upper}</a>`
+	want := `<a href="/hello-world">custom x</a>`
+	if err := testRenderCase(text, want, nil, &ComponentOptions{Functions: funcs}); err == nil {
+		t.Error("want a parse error without ParseOptions.Functions")
+	}
+	doc, err := parse(text, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewComponent(doc, &ComponentOptions{Functions: funcs}).Render(NewBaseScope(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := html.Render(&buf, AnyToHtml(rr)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+
+	if _, err := parse(`<p>${slug(1)}</p>`, funcs); err == nil {
+		t.Error("want a type check error for the wrong argument")
+	}
+	if _, err := parse(`<p></p>`, map[string]any{"truncate": strings.ToUpper}); err == nil {
+		t.Error("want an error for a function shadowed by a builtin one")
+	}
+	if _, err := parse(`<p></p>`, map[string]any{"x": 1}); err == nil {
+		t.Error("want an error for a value that is not a function")
+	}
+}
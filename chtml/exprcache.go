@@ -0,0 +1,153 @@
+package chtml
+
+import (
+	"container/list"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ExprCache is a cache of the compiled expressions shared by the parsers. Template trees often
+// repeat the same expressions (e.g. ${title} or c:if="user != nil") across the files, and
+// compiling an expression is the most expensive part of the parsing.
+//
+// The entries are keyed by the expression source and the types of the variables it may refer
+// to, so an expression is recompiled if it is type-checked against a different environment.
+// The least recently used entries are evicted when the cache is full.
+type ExprCache struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List // of *exprCacheEntry, the most recently used first
+	items map[string]*list.Element
+	stats ExprCacheStats
+}
+
+// ExprCacheStats is a snapshot of the ExprCache counters.
+type ExprCacheStats struct {
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+type exprCacheEntry struct {
+	key  string
+	expr Expr
+}
+
+// DefaultExprCache is used by the parser if ParseOptions.ExprCache is not set.
+var DefaultExprCache = NewExprCache(4096)
+
+// NewExprCache creates an ExprCache holding up to maxEntries expressions. If maxEntries is zero
+// or negative, the expressions are not cached.
+func NewExprCache(maxEntries int) *ExprCache {
+	return &ExprCache{
+		max:   maxEntries,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Stats returns the current counters of the cache.
+func (c *ExprCache) Stats() ExprCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.stats
+	st.Entries = c.ll.Len()
+	return st
+}
+
+func (c *ExprCache) get(key string) (Expr, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.stats.Hits++
+		return el.Value.(*exprCacheEntry).expr, true
+	}
+	c.stats.Misses++
+	return Expr{}, false
+}
+
+func (c *ExprCache) put(key string, e Expr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.max <= 0 {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*exprCacheEntry).expr = e
+		return
+	}
+	c.items[key] = c.ll.PushFront(&exprCacheEntry{key: key, expr: e})
+
+	for c.ll.Len() > c.max {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*exprCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// compile returns the cached expression or compiles and caches a new one. Failed compilations
+// are not cached.
+func (c *ExprCache) compile(
+	kind string,
+	s string,
+	env map[string]any,
+	compile func(string, map[string]any) (Expr, error),
+) (Expr, error) {
+	if c == nil {
+		return compile(s, env)
+	}
+
+	key := exprCacheKey(kind, s, env)
+	if e, ok := c.get(key); ok {
+		return e, nil
+	}
+	e, err := compile(s, env)
+	if err == nil {
+		c.put(key, e)
+	}
+	return e, err
+}
+
+var identRegex = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// exprCacheKey builds the cache key from the expression source and the signature of the
+// variables it may refer to. Every identifier-like word of the source is looked up in env,
+// which over-approximates the set of the referenced variables but avoids parsing.
+func exprCacheKey(kind, s string, env map[string]any) string {
+	var sb strings.Builder
+	sb.WriteString(kind)
+	sb.WriteByte(0)
+	sb.WriteString(s)
+
+	words := identRegex.FindAllString(s, -1)
+	slices.Sort(words)
+	words = slices.Compact(words)
+
+	for _, w := range words {
+		v, ok := env[w]
+		if !ok {
+			continue
+		}
+		sb.WriteByte(0)
+		sb.WriteString(w)
+		sb.WriteByte('=')
+		if t := reflect.TypeOf(v); t != nil {
+			sb.WriteString(t.PkgPath())
+			sb.WriteByte('.')
+			sb.WriteString(t.String())
+		} else {
+			sb.WriteString("nil")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprCache(t *testing.T) {
+	parse := func(cache *ExprCache, text string) {
+		t.Helper()
+		_, err := ParseWithOptions(strings.NewReader(text), nil, &ParseOptions{ExprCache: cache})
+		require.NoError(t, err)
+	}
+
+	t.Run("reuse", func(t *testing.T) {
+		cache := NewExprCache(10)
+		doc := `<c:attr name="title">${""}</c:attr><h1 c:if="title != ''">${title}</h1>`
+
+		parse(cache, doc)
+		require.Equal(t, ExprCacheStats{Entries: 3, Misses: 3}, cache.Stats())
+
+		parse(cache, doc)
+		require.Equal(t, ExprCacheStats{Entries: 3, Hits: 3, Misses: 3}, cache.Stats())
+	})
+
+	t.Run("different types", func(t *testing.T) {
+		cache := NewExprCache(10)
+
+		parse(cache, `<c:attr name="x">${1}</c:attr><p>${x + 1}</p>`)
+
+		// the expression is type-checked again
+		_, err := ParseWithOptions(strings.NewReader(`<c:attr name="x">${"a"}</c:attr><p>${x + 1}</p>`),
+			nil, &ParseOptions{ExprCache: cache})
+		require.ErrorContains(t, err, "mismatched types")
+		require.Equal(t, uint64(0), cache.Stats().Hits)
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		cache := NewExprCache(1)
+
+		parse(cache, `<p>${1}</p><p>${2}</p>`)
+		require.Equal(t, ExprCacheStats{Entries: 1, Misses: 2, Evictions: 1}, cache.Stats())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cache := NewExprCache(0)
+
+		parse(cache, `<p>${1}</p><p>${1}</p>`)
+		require.Equal(t, ExprCacheStats{Misses: 2}, cache.Stats())
+	})
+}
+
+// BenchmarkParseExprCache parses a large component repeating the same expressions, the way
+// generated or copy-pasted templates do, with and without a shared ExprCache.
+func BenchmarkParseExprCache(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString(`<c:attr name="items">${[{"name": "", "price": 0.0, "tags": [""]}]}</c:attr>`)
+	sb.WriteString(`<c:attr name="title">${""}</c:attr>`)
+	for range 200 {
+		sb.WriteString(`<section class="${title == '' ? 'empty' : 'card'}"><h2>${title | upper}</h2>`)
+		sb.WriteString(`<ul><li c:for="it in items"><b c:if="it.price > 0">${it.name}: ${it.price * 1.2}</b>`)
+		sb.WriteString(`<span c:for="t in it.tags">#${t}</span></li></ul></section>`)
+	}
+	text := sb.String()
+
+	for _, bb := range []struct {
+		name  string
+		cache func() *ExprCache
+	}{
+		{"uncached", func() *ExprCache { return NewExprCache(0) }},
+		{"cached", func() *ExprCache { return NewExprCache(1024) }},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			opts := &ParseOptions{ExprCache: bb.cache()}
+			b.ReportAllocs()
+			for range b.N {
+				if _, err := ParseWithOptions(strings.NewReader(text), nil, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
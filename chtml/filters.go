@@ -0,0 +1,111 @@
+package chtml
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// The expressions pipe the values through the functions with the | operator, the value becomes
+// the first argument of the function: ${title | trim | upper}, ${text | truncate(80)}.
+// The parentheses of the functions without other arguments may be omitted. Along with the builtin
+// functions of expr-lang (upper, lower, trim, replace, join, toJSON, etc.), the expressions have
+// the filters below.
+
+// truncate shortens s to n characters, replacing the cut off part with an ellipsis.
+func truncate(s string, n int) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	i := 0
+	for j := range s {
+		if n == 0 {
+			i = j
+			break
+		}
+		n--
+	}
+	return strings.TrimRight(s[:i], whitespace) + "…"
+}
+
+// pluralize returns one if n is 1, and many otherwise, e.g. ${n} ${n | pluralize('item', 'items')}.
+func pluralize(n int, one, many string) string {
+	if n == 1 || n == -1 {
+		return one
+	}
+	return many
+}
+
+// jsonString returns the compact JSON encoding of v, e.g. for the data attributes.
+func jsonString(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// pipeCalls adds the parentheses to the functions piped without them, e.g. "s | upper" becomes
+// "s | upper()", as expr-lang requires a call after the | operator.
+func pipeCalls(s string) string {
+	if !strings.Contains(s, "|") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '"' || c == '\'' || c == '`':
+			j := skipStringLit(s, i)
+			b.WriteString(s[i:j])
+			i = j
+		case c == '|' && i+1 < len(s) && s[i+1] == '|':
+			b.WriteString("||")
+			i += 2
+		case c == '|':
+			b.WriteByte(c)
+			i++
+			start := i
+			for i < len(s) && strings.IndexByte(whitespace, s[i]) >= 0 {
+				i++
+			}
+			for i < len(s) && isIdentByte(s[i]) {
+				i++
+			}
+			b.WriteString(s[start:i])
+			if i == start || !isIdentByte(s[i-1]) {
+				continue // not a function name
+			}
+			next := i
+			for next < len(s) && strings.IndexByte(whitespace, s[next]) >= 0 {
+				next++
+			}
+			if next == len(s) || (s[next] != '(' && s[next] != '.') {
+				b.WriteString("()")
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// skipStringLit returns the index after the string literal starting at s[i].
+func skipStringLit(s string, i int) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1
+		}
+	}
+	return len(s)
+}
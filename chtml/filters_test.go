@@ -0,0 +1,62 @@
+package chtml
+
+import "testing"
+
+func TestRenderFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "pipe without parentheses",
+			text: `<p>${"  hi " | trim | upper}</p>`,
+			want: `<p>HI</p>`,
+		},
+		{
+			name: "pipe with arguments",
+			text: `<p title="${'a long title' | truncate(6)}">${'short' | truncate(10)}</p>`,
+			want: `<p title="a long…">short</p>`,
+		},
+		{
+			name: "pluralize",
+			text: `<p>1 ${1 | pluralize('item', 'items')}, 3 ${3 | pluralize('item', 'items')}</p>`,
+			want: `<p>1 item, 3 items</p>`,
+		},
+		{
+			name: "json",
+			text: `<div data-x="${ {'a': [1, 2]} | json }"></div>`,
+			want: `<div data-x="{&#34;a&#34;:[1,2]}"></div>`,
+		},
+		{
+			name: "pipe in a string and logical or",
+			text: `<p>${'a | upper'} ${true || false}</p>`,
+			want: `<p>a | upper true</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(tt.text, tt.want, nil, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPipeCalls(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`s | upper`, `s | upper()`},
+		{`s | trim() | upper`, `s | trim() | upper()`},
+		{`s|lower|truncate(3)`, `s|lower()|truncate(3)`},
+		{`a || b`, `a || b`},
+		{`"x | y" + s | upper`, `"x | y" + s | upper()`},
+		{`'it\'s | x'`, `'it\'s | x'`},
+	}
+	for _, tt := range tests {
+		if got := pipeCalls(tt.in); got != tt.want {
+			t.Errorf("pipeCalls(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package chtml
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Fragments are the sub-templates defined and used in the same component:
+//
+//	<c:define name="row" item="${nil}" highlight="${false}">
+//	  <tr class="${highlight ? 'hl' : ''}"><td>${item.name}</td><td>${_}</td></tr>
+//	</c:define>
+//
+//	<table><c:call c:for="u in users" name="row" item="${u}">${u.email}</c:call></table>
+//
+// The attributes of <c:define> other than the name declare the parameters with their default
+// values. The content of <c:call> is passed as the "_" parameter. A fragment sees the variables
+// of the component where it is defined, the parameters shadow them. Unlike a component in
+// a separate file, a fragment is rendered without an importer round-trip. A fragment may call
+// itself, e.g. to render a tree, the nesting of the calls is limited like the nesting of the
+// imports (see ComponentOptions.MaxImportDepth).
+
+// isDefine reports whether n is a fragment definition (<c:define>).
+func isDefine(n *Node) bool {
+	return n.Type == importNode && n.Data.RawString() == "c:define"
+}
+
+// isCall reports whether n is a fragment call (<c:call>).
+func isCall(n *Node) bool {
+	return n.Type == importNode && n.Data.RawString() == "c:call"
+}
+
+// fragmentName returns the constant name attribute of the <c:define> or <c:call> element.
+func fragmentName(n *Node) (string, error) {
+	for _, attr := range n.Attr {
+		if attr.Key != "name" {
+			continue
+		}
+		if len(attr.Val.idents) > 0 || attr.Val.RawString() == "" {
+			return "", fmt.Errorf("%s name must be a constant", n.Data.RawString())
+		}
+		return attr.Val.RawString(), nil
+	}
+	return "", fmt.Errorf("%s requires a name attribute", n.Data.RawString())
+}
+
+// defineFragment declares the parameters of the fragment definition n for its content. The
+// environment is popped by popElement.
+func (p *chtmlParser) defineFragment(n *Node) {
+	name, err := fragmentName(n)
+	if err != nil {
+		p.error(n, err)
+	} else if _, ok := p.fragments[name]; ok {
+		p.error(n, fmt.Errorf("fragment %q is already defined", name))
+	} else {
+		if p.fragments == nil {
+			p.fragments = make(map[string]*Node)
+		}
+		p.fragments[name] = n
+	}
+
+	// the parameters are type checked against their default values, like the arguments of
+	// the component declared with <c:attr>
+	params := map[string]any{"_": new(any)}
+	for _, attr := range n.Attr {
+		if attr.Key == "name" {
+			continue
+		}
+		v, err := attr.Val.Value(&p.vm, env(p.env))
+		if err != nil || v == nil {
+			v = new(any) // e.g. depends on the variables of the render
+		}
+		params[attr.Key] = v
+	}
+	p.pushEnv(params, p.span)
+}
+
+// resolveCalls links the fragment calls to the definitions once the whole document is parsed,
+// so a fragment may be called before it is defined.
+func (p *chtmlParser) resolveCalls() {
+	for _, n := range p.calls {
+		name, err := fragmentName(n)
+		if err != nil {
+			p.error(n, err)
+			continue
+		}
+		def, ok := p.fragments[name]
+		if !ok {
+			p.error(n, fmt.Errorf("fragment %q is not defined", name))
+			continue
+		}
+		for _, attr := range n.Attr {
+			if attr.Key != "name" && !hasAttr(def, attr.Key) {
+				p.error(n, fmt.Errorf("fragment %q has no parameter %q", name, attr.Key))
+			}
+		}
+		n.Fragment = def
+	}
+}
+
+func hasAttr(n *Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// renderCall renders the fragment called by n (<c:call>). The fragment is rendered by a child
+// component reused by the next renders, like a loop item.
+func (c *chtmlComponent) renderCall(n *Node) any {
+	def := n.Fragment
+	if def == nil {
+		return nil // reported by the parser
+	}
+	// the fragments calling themselves, directly or via other fragments, fail like the imports
+	if c.callDepth >= c.maxImportDepth {
+		name, _ := fragmentName(def)
+		c.error(n, fmt.Errorf("call fragment %q: %w (%d)", name, ErrImportDepthExceeded, c.maxImportDepth))
+		return nil
+	}
+
+	if !c.arena.Alloc(int64(len(c.env)+len(def.Attr)+1) * envEntryCost) {
+		return nil
+	}
+	env := c.arena.newEnv()
+	maps.Copy(env, c.env)
+	for _, attrs := range [][]Attribute{def.Attr, n.Attr} { // the defaults, then the arguments
+		for _, attr := range attrs {
+			if attr.Key == "name" {
+				continue
+			}
+			v, err := c.eval(attr.Val)
+			if err != nil {
+				c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
+				return nil
+			}
+			env[attr.Key] = v
+		}
+	}
+	env["_"] = nil
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		env["_"] = AnyPlusAny(env["_"], c.render(child))
+	}
+
+	var fc *chtmlComponent
+	if comps := c.children[n]; len(comps) == 1 {
+		fc, _ = comps[0].(*chtmlComponent)
+	}
+	if fc == nil {
+		fc = c.spawnChild(def, env)
+		fc.callDepth = c.callDepth + 1
+		c.children[n] = []Component{fc}
+	}
+	// the fragment is not tracked by RenderDiff (diff is nil), the call is reported as a whole
+	// like an import
+	fc.scope = c.scope
+	fc.env = env
+	fc.arena = c.arena
+
+	var res any
+	for child := def.FirstChild; child != nil; child = child.NextSibling {
+		res = AnyPlusAny(res, fc.render(child))
+	}
+	c.errs = append(c.errs, fc.errs...)
+	fc.errs = nil
+	return res
+}
@@ -0,0 +1,140 @@
+package chtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderFragments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+		vars map[string]any
+	}{
+		{
+			name: "parameters and defaults",
+			text: `<c:define name="item" label="${'?'}" n="${0}"><li>${label}: ${n + 1}</li></c:define>` +
+				`<ul><c:call name="item" label="${'a'}"></c:call><c:call name="item" n="${2}"></c:call></ul>`,
+			want: `<ul><li>a: 1</li><li>?: 3</li></ul>`,
+		},
+		{
+			name: "called before defined, in a loop",
+			text: `<ul><c:call c:for="x in ['a', 'b']" name="row" item="${x}"></c:call></ul>` +
+				`<c:define name="row" item=""><li>${item}</li></c:define>`,
+			want: `<ul><li>a</li><li>b</li></ul>`,
+		},
+		{
+			name: "content and component variables",
+			text: `<c:attr name="title">${"T"}</c:attr>` +
+				`<c:define name="box"><div><h1>${title}</h1>${_}</div></c:define>` +
+				`<c:call name="box"><p>body</p></c:call>`,
+			want: `<div><h1>T</h1><p>body</p></div>`,
+		},
+		{
+			name: "bound to a variable",
+			text: `<c:define name="sum" a="${0}" b="${0}">${a + b}</c:define>` +
+				`<c:call name="sum" a="${1}" b="${2}" as="res"></c:call><p>${res * 10}</p>`,
+			want: `<p>30</p>`,
+		},
+		{
+			name: "recursive",
+			text: `<c:attr name="root"></c:attr>` +
+				`<c:define name="tree" node="${nil}"><ul><li c:for="x in node.children">${x.name}` +
+				`<c:call c:if="len(x.children) > 0" name="tree" node="${x}"></c:call></li></ul></c:define>` +
+				`<c:call name="tree" node="${root}"></c:call>`,
+			vars: map[string]any{"root": map[string]any{"children": []any{
+				map[string]any{"name": "a", "children": []any{
+					map[string]any{"name": "b", "children": []any{}},
+				}},
+				map[string]any{"name": "c", "children": []any{}},
+			}}},
+			want: `<ul><li>a<ul><li>b</li></ul></li><li>c</li></ul>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(tt.text, tt.want, tt.vars, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenderFragmentCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "direct",
+			text: `<c:define name="a"><i><c:call name="a"></c:call></i></c:define><c:call name="a"></c:call>`,
+		},
+		{
+			name: "mutual",
+			text: `<c:define name="a"><c:call name="b"></c:call></c:define>` +
+				`<c:define name="b"><p><c:call name="a"></c:call></p></c:define>` +
+				`<c:call name="a"></c:call>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.text), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewComponent(doc, &ComponentOptions{MaxImportDepth: 8}).Render(NewBaseScope(nil))
+			if !errors.Is(err, ErrImportDepthExceeded) {
+				t.Errorf("got error %v, want %v", err, ErrImportDepthExceeded)
+			}
+		})
+	}
+}
+
+func TestParseFragmentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		errs []string
+	}{
+		{
+			name: "undefined fragment",
+			text: `<c:call name="row"></c:call>`,
+			errs: []string{`fragment "row" is not defined`},
+		},
+		{
+			name: "unknown parameter",
+			text: `<c:define name="row" item=""></c:define><c:call name="row" items=""></c:call>`,
+			errs: []string{`fragment "row" has no parameter "items"`},
+		},
+		{
+			name: "duplicate definition",
+			text: `<c:define name="row"></c:define><c:define name="row"></c:define>`,
+			errs: []string{`fragment "row" is already defined`},
+		},
+		{
+			name: "dynamic name",
+			text: `<c:attr name="x"></c:attr><c:define name="${x}"></c:define>`,
+			errs: []string{`c:define name must be a constant`},
+		},
+		{
+			name: "parameter typed by the default",
+			text: `<c:define name="row" n="${0}"><p>${n.foo}</p></c:define>`,
+			errs: []string{`type int[string] is undefined`},
+		},
+		{
+			name: "parameter outside of the fragment",
+			text: `<c:define name="row" item=""><p>${item}</p></c:define><p>${item}</p>`,
+			errs: []string{`unknown name item`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.text), nil)
+			if err := checkErrors(err, tt.errs); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package chtml
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// GenerateTypes generates the Go source of the package pkg with the typed interfaces of the
+// components in fsys, so the Go code rendering the components (e.g. imported by
+// a CustomImporter) gets the compile-time checks instead of map[string]any. For every .chtml
+// file, e.g. components/user-card.chtml, it declares:
+//   - ComponentsUserCardArgs, the struct of the arguments declared with <c:attr>, typed after
+//     their default values (see InferInterface), and its Vars method returning the variables of
+//     the scope;
+//   - ComponentsUserCard, the component wrapper with the RenderArgs method;
+//   - ComponentsUserCardOutput and the RenderOutput method, if the component renders a map
+//     of data rather than HTML.
+//
+// The arguments without a default value or with a markup default are typed as any. The files are
+// parsed with opts (e.g. to declare the functions of the expressions), the imports render nothing.
+func GenerateTypes(fsys fs.FS, pkg string, opts *ParseOptions) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name %q", pkg)
+	}
+
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && path.Ext(p) == ".chtml" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan components: %w", err)
+	}
+
+	g := &typesGenerator{imports: map[string]bool{"github.com/dpotapov/go-pages/chtml": true}}
+	names := make(map[string]string, len(files))
+	for _, p := range files {
+		name := goIdentifier(strings.TrimSuffix(p, ".chtml"))
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("components %s and %s have the same Go name %s", other, p, name)
+		}
+		names[name] = p
+
+		if err := g.component(fsys, p, name, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by chtml.GenerateTypes. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	// the standard library packages first, then the others
+	isStd := func(imp string) bool { return !strings.Contains(strings.Split(imp, "/")[0], ".") }
+	slices.SortFunc(imports, func(a, b string) int {
+		if isStd(a) != isStd(b) {
+			if isStd(a) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	for i, imp := range imports {
+		if i > 0 && isStd(imports[i-1]) != isStd(imp) {
+			src.WriteString("\n")
+		}
+		fmt.Fprintf(&src, "\t%q\n", imp)
+	}
+	src.WriteString(")\n")
+	src.Write(g.buf.Bytes())
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return out, nil
+}
+
+// typesGenerator accumulates the declarations of the components and the imports they need.
+type typesGenerator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+// component writes the declarations of the component in the file p.
+func (g *typesGenerator) component(fsys fs.FS, p, name string, opts *ParseOptions) error {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return fmt.Errorf("open component %s: %w", p, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var o ParseOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.Name = p
+	doc, err := ParseWithOptions(f, nilImporter{}, &o)
+	if err != nil {
+		return fmt.Errorf("parse component %s: %w", p, err)
+	}
+	inputs, output := InferInterface(doc, &ComponentOptions{
+		Name:      p,
+		Importer:  nilImporter{},
+		Functions: o.Functions,
+	})
+
+	args := make([]string, 0, len(inputs))
+	for k := range inputs {
+		args = append(args, k)
+	}
+	slices.Sort(args)
+
+	fmt.Fprintf(&g.buf, "\n// %sArgs are the arguments of the %s component.\n", name, p)
+	fmt.Fprintf(&g.buf, "type %sArgs struct {\n", name)
+	for _, k := range args {
+		fmt.Fprintf(&g.buf, "\t%s %s\n", goIdentifier(k), g.goType(reflect.ValueOf(inputs[k])))
+	}
+	g.buf.WriteString("}\n")
+
+	fmt.Fprintf(&g.buf, "\n// Vars returns the arguments as the variables of a chtml.Scope.\n")
+	fmt.Fprintf(&g.buf, "func (a %sArgs) Vars() map[string]any {\n\treturn map[string]any{\n", name)
+	for _, k := range args {
+		fmt.Fprintf(&g.buf, "\t\t%q: a.%s,\n", k, goIdentifier(k))
+	}
+	g.buf.WriteString("\t}\n}\n")
+
+	fmt.Fprintf(&g.buf, "\n// %s is the %s component with the typed arguments.\n", name, p)
+	fmt.Fprintf(&g.buf, "type %s struct {\n\tchtml.Component\n}\n", name)
+	fmt.Fprintf(&g.buf, "\n// RenderArgs renders the component with the arguments in a scope spawned from s.\n")
+	fmt.Fprintf(&g.buf, "func (c %s) RenderArgs(s chtml.Scope, args %sArgs) (any, error) {\n", name, name)
+	g.buf.WriteString("\treturn c.Render(s.Spawn(args.Vars()))\n}\n")
+
+	data, ok := output.(map[string]any)
+	if !ok {
+		return nil // HTML or an unknown output
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	fmt.Fprintf(&g.buf, "\n// %sOutput is the output of the %s component.\n", name, p)
+	fmt.Fprintf(&g.buf, "type %sOutput struct {\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(&g.buf, "\t%s %s\n", goIdentifier(k), g.goType(reflect.ValueOf(data[k])))
+	}
+	g.buf.WriteString("}\n")
+
+	g.imports["fmt"] = true
+	fmt.Fprintf(&g.buf, "\n// RenderOutput renders the component with the arguments and decodes its output.\n")
+	fmt.Fprintf(&g.buf, "func (c %s) RenderOutput(s chtml.Scope, args %sArgs) (%sOutput, error) {\n",
+		name, name, name)
+	fmt.Fprintf(&g.buf, "\tvar out %sOutput\n", name)
+	g.buf.WriteString(`	rr, err := c.RenderArgs(s, args)
+	if err != nil {
+		return out, err
+	}
+	m, ok := rr.(map[string]any)
+	if !ok {
+		return out, fmt.Errorf("unexpected output %T", rr)
+	}
+	err = chtml.UnmarshalScope(chtml.NewBaseScope(m), &out)
+	return out, err
+}
+`)
+	return nil
+}
+
+// goType returns the Go type of the value of an argument or an output. The values without
+// a Go type expressible in the generated code (nil, the markup, the named types of other
+// packages) are typed as any. The items of a list of any values are typed after the items if
+// they are of the same type, e.g. [{'id': 1}] is []map[string]any.
+func (g *typesGenerator) goType(v reflect.Value) string {
+	if !v.IsValid() {
+		return "any"
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Interface && v.Len() > 0 {
+		elem := v.Index(0).Elem()
+		for i := 1; i < v.Len() && elem.IsValid(); i++ {
+			if item := v.Index(i).Elem(); !item.IsValid() || item.Type() != elem.Type() {
+				elem = reflect.Value{}
+			}
+		}
+		if elem.IsValid() {
+			return "[]" + g.goType(elem)
+		}
+	}
+	return g.goTypeOf(v.Type())
+}
+
+func (g *typesGenerator) goTypeOf(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		g.imports["time"] = true
+		return "time.Time"
+	case t == reflect.TypeOf(time.Duration(0)):
+		g.imports["time"] = true
+		return "time.Duration"
+	case t == reflect.TypeOf((*Node)(nil)), t == reflect.TypeOf((*html.Node)(nil)):
+		return "any"
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.Kind().String()
+	case reflect.Slice, reflect.Array:
+		return "[]" + g.goTypeOf(t.Elem())
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return "map[string]" + g.goTypeOf(t.Elem())
+		}
+	}
+	return "any"
+}
+
+// goIdentifier converts the name of a component or an argument to an exported Go identifier,
+// e.g. components/user-card to ComponentsUserCard and page_size to PageSize.
+func goIdentifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+// nilImporter imports the components rendering nothing, so the documents importing other
+// components can be parsed and rendered without resolving them.
+type nilImporter struct{}
+
+func (nilImporter) Import(string) (Component, error) {
+	return nilComponent{}, nil
+}
+
+type nilComponent struct{}
+
+func (nilComponent) Render(Scope) (any, error) {
+	return nil, nil
+}
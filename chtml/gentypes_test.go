@@ -0,0 +1,47 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGenerateTypes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"components/user-card.chtml": {Data: []byte(`<c:attr name="name">Anonymous</c:attr>` +
+			`<c:attr name="age">${0}</c:attr><c:attr name="tags">${['a']}</c:attr>` +
+			`<c:attr name="footer"><p>Footer</p></c:attr>` +
+			`<div class="card">${name} <c:avatar></c:avatar></div>`)},
+		"api/stats.chtml": {Data: []byte(`<c:attr name="page_size">${10}</c:attr>` +
+			`${{'total': page_size * 2, 'updated': now(), 'items': [{'id': 1}]}}`)},
+	}
+
+	src, err := GenerateTypes(fsys, "views", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		"// Code generated by chtml.GenerateTypes. DO NOT EDIT.",
+		"package views",
+		"type ComponentsUserCardArgs struct {\n\tAge    int\n\tFooter any\n\tName   string\n\tTags   []string\n}",
+		`"name":   a.Name,`,
+		"func (c ComponentsUserCard) RenderArgs(s chtml.Scope, args ComponentsUserCardArgs) (any, error) {",
+		"type ApiStatsArgs struct {\n\tPageSize int\n}",
+		`"page_size": a.PageSize,`,
+		"type ApiStatsOutput struct {\n\tItems   []map[string]any\n\tTotal   int\n\tUpdated time.Time\n}",
+		"func (c ApiStats) RenderOutput(s chtml.Scope, args ApiStatsArgs) (ApiStatsOutput, error) {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "ComponentsUserCardOutput") {
+		t.Error("want no output type for an HTML component")
+	}
+
+	fsys["components/user_card.chtml"] = &fstest.MapFile{Data: []byte(`<p></p>`)}
+	if _, err := GenerateTypes(fsys, "views", nil); err == nil {
+		t.Error("want an error for the components with the same Go name")
+	}
+}
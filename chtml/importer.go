@@ -1,10 +1,25 @@
 package chtml
 
+import "sync"
+
 // Importer acts as a factory for components. It is invoked when a <c:NAME> element is encountered.
 type Importer interface {
 	Import(name string) (Component, error)
 }
 
+// lockedImporter serializes the imports of the components rendered concurrently, as the
+// Importer implementations are not required to be safe for concurrent use.
+type lockedImporter struct {
+	mu  sync.Mutex
+	imp Importer
+}
+
+func (i *lockedImporter) Import(name string) (Component, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.imp.Import(name)
+}
+
 type builtinImporter struct {
 	cattr CAttr
 }
@@ -9,7 +9,10 @@
 package chtml
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -43,6 +46,72 @@ type Node struct {
 
 	// LoopVar is the value variable name for c:for loops.
 	LoopVar string
+
+	// LoopParallel is the value of c:for-parallel attribute, the number of workers rendering
+	// the loop items concurrently. Zero means the items are rendered sequentially.
+	LoopParallel int
+
+	// LoopKey is the value of c:key attribute identifying the loop items. The components rendering
+	// the items are reused by the key rather than by the index.
+	LoopKey Expr
+
+	// Switch is the value of c:switch attribute. The children of the node with c:case (Case) and
+	// c:default (CaseDefault) attributes are rendered only if the value matches.
+	Switch Expr
+
+	// Case is the value of c:case attribute compared with the parent's c:switch value.
+	Case Expr
+
+	// CaseDefault is set for c:default, the case rendered if no other case matches.
+	CaseDefault bool
+
+	// Attrs is the value of c:attrs attribute, a map of the attributes spread onto the element.
+	// The c:attrs attribute itself is not included in Attr.
+	Attrs Expr
+
+	// Source is the location of the node in the source document. For elements, it covers the
+	// start tag only.
+	Source Span
+
+	// As is the variable name from the "as" attribute of an import (<c:NAME as="VAR">). When set,
+	// the result of the imported component is bound to the variable instead of being rendered.
+	As string
+
+	// Fragment is the definition (<c:define>) of the fragment called by <c:call>.
+	Fragment *Node
+}
+
+// Position is a location in the source document.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Col    int // column number (in runes), starting at 1
+}
+
+// advance returns the position after the given text.
+func (p Position) advance(text []byte) Position {
+	p.Offset += len(text)
+	if i := bytes.LastIndexByte(text, '\n'); i >= 0 {
+		p.Line += bytes.Count(text, []byte{'\n'})
+		p.Col = 1
+		text = text[i+1:]
+	}
+	p.Col += utf8.RuneCount(text)
+	return p
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Span is a range in the source document.
+type Span struct {
+	Start, End Position
+}
+
+// IsZero reports whether the span is not set.
+func (s Span) IsZero() bool {
+	return s == Span{}
 }
 
 type Attribute struct {
@@ -53,6 +122,9 @@ type Attribute struct {
 
 const importNode html.NodeType = 100
 
+// testNode is a <c:test> element declaring a test case. It is never rendered.
+const testNode html.NodeType = 101
+
 func (n *Node) IsWhitespace() bool {
 	return strings.TrimLeft(n.Data.RawString(), whitespace) == ""
 }
@@ -0,0 +1,78 @@
+package chtml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// RenderOptions configures RenderTo and WriteResult.
+type RenderOptions struct {
+	// MaxSize is the maximum size in bytes of the encoded output. If the output is larger,
+	// ErrOutputTooLarge is returned and nothing is written. Zero means no limit.
+	MaxSize int64
+}
+
+// maxPooledBuffer is the capacity of the largest buffer returned to the pool, so a few huge pages
+// don't keep the memory allocated.
+const maxPooledBuffer = 256 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// RenderTo renders the component and writes the result to w: the HTML nodes as HTML, the strings,
+// byte slices and readers as is and other values as JSON. The output is encoded into a pooled buffer first, so nothing
+// is written if the render or the encoding fails. The opts may be nil.
+//
+// Unlike StreamRenderer, the whole output is built in memory. Use it for the components which
+// output is not known to be HTML, e.g. the pages rendering data objects.
+func RenderTo(w io.Writer, comp Component, s Scope, opts *RenderOptions) error {
+	rr, err := comp.Render(s)
+	if err != nil {
+		return err
+	}
+	return WriteResult(w, rr, opts)
+}
+
+// WriteResult writes the result of a component render to w the same way as RenderTo.
+func WriteResult(w io.Writer, rr any, opts *RenderOptions) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}
+	}()
+
+	switch v := rr.(type) {
+	case *html.Node:
+		if err := html.Render(buf, v); err != nil {
+			return fmt.Errorf("render HTML: %w", err)
+		}
+	case string:
+		buf.WriteString(v)
+	case []byte:
+		buf.Write(v)
+	case io.Reader:
+		if _, err := buf.ReadFrom(v); err != nil {
+			return fmt.Errorf("read output: %w", err)
+		}
+	default:
+		if err := json.NewEncoder(buf).Encode(rr); err != nil {
+			return fmt.Errorf("render JSON: %w", err)
+		}
+	}
+
+	if opts != nil && opts.MaxSize > 0 && int64(buf.Len()) > opts.MaxSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrOutputTooLarge, buf.Len(), opts.MaxSize)
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package chtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type valueComponent struct {
+	v   any
+	err error
+}
+
+func (c valueComponent) Render(Scope) (any, error) { return c.v, c.err }
+
+func TestRenderToWriter(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<p class="a">${1 + 2}</p>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errRender := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		comp    Component
+		opts    *RenderOptions
+		want    string
+		wantErr error
+	}{
+		{"html", NewComponent(doc, nil), nil, `<p class="a">3</p>`, nil},
+		{"string", valueComponent{v: "a < b"}, nil, `a < b`, nil},
+		{"json", valueComponent{v: map[string]any{"a": 1}}, nil, "{\"a\":1}\n", nil},
+		{"nil", valueComponent{}, nil, "null\n", nil},
+		{"within limit", valueComponent{v: "abc"}, &RenderOptions{MaxSize: 3}, "abc", nil},
+		{"too large", valueComponent{v: "abcd"}, &RenderOptions{MaxSize: 3}, "", ErrOutputTooLarge},
+		{"render error", valueComponent{v: "abc", err: errRender}, nil, "", errRender},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := RenderTo(&sb, tt.comp, NewBaseScope(nil), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("write error", func(t *testing.T) {
+		errWrite := errors.New("connection closed")
+		err := RenderTo(failingWriter{errWrite}, valueComponent{v: "abc"}, NewBaseScope(nil), nil)
+		if !errors.Is(err, errWrite) {
+			t.Errorf("err = %v, want %v", err, errWrite)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package chtml
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+// countingImporter imports a component counting the concurrent renders.
+type countingImporter struct {
+	active, peak atomic.Int32
+}
+
+func (imp *countingImporter) Import(name string) (Component, error) {
+	return &countingComponent{imp}, nil
+}
+
+type countingComponent struct {
+	imp *countingImporter
+}
+
+func (c *countingComponent) Render(s Scope) (any, error) {
+	n := c.imp.active.Add(1)
+	defer c.imp.active.Add(-1)
+	for {
+		p := c.imp.peak.Load()
+		if n <= p || c.imp.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	return fmt.Sprintf("[%v]", s.Vars()["v"]), nil
+}
+
+func TestParallelFor(t *testing.T) {
+	items := make([]any, 100)
+	var want strings.Builder
+	for i := range items {
+		items[i] = i
+		fmt.Fprintf(&want, "<li>%d:[%d]</li>", i, i)
+	}
+
+	imp := &countingImporter{}
+	doc, err := Parse(strings.NewReader(
+		`<c:attr name="items"></c:attr>`+
+			`<li c:for="x, i in items" c:for-parallel="4">${i}:<c:item v="${x}"></c:item></li>`), imp)
+	require.NoError(t, err)
+
+	comp := NewComponent(doc, &ComponentOptions{Importer: imp})
+	rr, err := comp.Render(NewBaseScope(map[string]any{"items": items}))
+	require.NoError(t, err)
+
+	var buf strings.Builder
+	require.NoError(t, html.Render(&buf, rr.(*html.Node)))
+	require.Equal(t, want.String(), buf.String())
+	require.LessOrEqual(t, imp.peak.Load(), int32(4))
+}
+
+func TestParallelForInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<p c:for="x in [1]" c:for-parallel="zero">${x}</p>`), nil)
+	require.ErrorContains(t, err, "c:for-parallel must be a positive number")
+}
+
+func BenchmarkParallelFor(b *testing.B) {
+	items := make([]any, 2000)
+	for i := range items {
+		items[i] = i
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		attr := ""
+		if workers > 1 {
+			attr = fmt.Sprintf(` c:for-parallel="%d"`, workers)
+		}
+		// each item does some CPU work to make the loop body expensive enough
+		text := fmt.Sprintf(`<c:attr name="items"></c:attr>`+
+			`<ul><li c:for="x in items"%s>${join(map(1..50, { string(# * x) }), ",")}</li></ul>`, attr)
+
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			doc, err := Parse(strings.NewReader(text), nil)
+			require.NoError(b, err)
+
+			for i := 0; i < b.N; i++ {
+				comp := NewComponent(doc, nil)
+				if _, err := comp.Render(NewBaseScope(map[string]any{"items": items})); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
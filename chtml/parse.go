@@ -15,6 +15,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/expr-lang/expr/vm"
@@ -26,10 +29,14 @@ import (
 // golang.org/x/net/html package to tokenize the input. There is no goal to parse in a way like the
 // browser does, but to produce a Node tree as close to the original source as possible.
 type chtmlParser struct {
+	// name is the name of the parsed component reported by the errors.
+	name string
 	// tokenizer provides the tokens for the chtmlParser.
 	tokenizer *html.Tokenizer
 	// tok is the most recently read token.
 	tok html.Token
+	// span is the location of the most recently read token in the source.
+	span Span
 	// Self-closing tags like <hr/> are treated as start tags, except that
 	// hasSelfClosingToken is set while they are being processed.
 	hasSelfClosingToken bool
@@ -39,6 +46,13 @@ type chtmlParser struct {
 	env map[string]any
 	// shadowed is the stack of variables shadowed by the elements that introduce new scopes.
 	shadowed []map[string]any
+	// defs is the locations of the variables defined in the document. The variables provided
+	// by the environment have no location.
+	defs map[string]Span
+	// shadowedDefs is the stack of locations shadowed along with the variables in shadowed.
+	shadowedDefs []map[string]Span
+	// strictShadowing turns the loop variable shadowing warnings into errors.
+	strictShadowing bool
 	// The stack of open elements (section 12.2.4.2).
 	oe nodeStack
 	// im is the current insertion mode.
@@ -52,6 +66,32 @@ type chtmlParser struct {
 	vm vm.VM
 	// errs captures all errors encountered during parsing.
 	errs []error
+	// diags captures non-fatal warnings encountered during parsing.
+	diags []Diagnostic
+	// rawComments disables expressions in comments.
+	rawComments bool
+	// exprCache caches the compiled expressions, nil disables caching.
+	exprCache *ExprCache
+	// provided is the set of the variables declared by the EnvProvider. Their values are not
+	// known at parse time.
+	provided map[string]bool
+	// fragments are the fragment definitions (<c:define>) by name.
+	fragments map[string]*Node
+	// calls are the fragment calls (<c:call>) resolved once the document is parsed.
+	calls []*Node
+}
+
+// newExpr compiles the expression in the current environment.
+func (p *chtmlParser) newExpr(s string) (Expr, error) {
+	return p.exprCache.compile("expr", s, p.env, NewExpr)
+}
+
+// newExprInterpol compiles the interpolated string in the current environment.
+func (p *chtmlParser) newExprInterpol(s string) (Expr, error) {
+	if !strings.Contains(s, leftDelim) {
+		return NewExprInterpol(s, p.env) // plain text, nothing to compile
+	}
+	return p.exprCache.compile("interpol", s, p.env, NewExprInterpol)
 }
 
 func (p *chtmlParser) top() *Node {
@@ -204,9 +244,12 @@ loop:
 // addChild adds a child node n to the top element, and pushes n onto the stack
 // of open elements if it is an element node.
 func (p *chtmlParser) addChild(n *Node) {
+	if n.Source.IsZero() {
+		n.Source = p.span
+	}
 	p.top().AppendChild(n)
 
-	if n.Type == html.ElementNode || n.Type == importNode {
+	if n.Type == html.ElementNode || n.Type == importNode || n.Type == testNode {
 		p.oe = append(p.oe, n)
 	}
 }
@@ -220,15 +263,16 @@ func (p *chtmlParser) addText(text string) {
 
 	t := p.top()
 	if n := t.LastChild; n != nil && n.Type == html.TextNode {
-		expr, err := NewExprInterpol(n.Data.RawString()+text, p.env)
+		expr, err := p.newExprInterpol(n.Data.RawString() + text)
 		if err != nil {
 			p.error(t, err)
 		}
 		n.Data = expr
+		n.Source.End = p.span.End
 		return
 	}
 
-	expr, err := NewExprInterpol(text, p.env)
+	expr, err := p.newExprInterpol(text)
 	if err != nil {
 		p.error(t, err)
 	}
@@ -248,20 +292,74 @@ func (p *chtmlParser) addElement() {
 		Attr:     make([]Attribute, 0, len(p.tok.Attr)),
 	}
 
-	if strings.HasPrefix(strings.ToLower(p.tok.Data), "c:") {
+	if strings.EqualFold(p.tok.Data, "c:test") {
+		n.Type = testNode
+	} else if strings.HasPrefix(strings.ToLower(p.tok.Data), "c:") {
 		n.Type = importNode
 	}
 
+	attrs := make([]html.Attribute, 0, len(p.tok.Attr))
 	for _, t := range p.tok.Attr {
-		if ok := p.parseSpecialAttrs(n, &t); ok {
-			continue
+		if ok := p.parseSpecialAttrs(n, &t); !ok {
+			attrs = append(attrs, t)
 		}
+	}
 
-		expr, err := NewExprInterpol(t.Val, p.env)
+	// Handle c:for variables. The attributes are rendered for each iteration, so the variables
+	// are declared before the attributes are parsed, e.g. <li c:for="x in xs" title="${x}">.
+	if !n.Loop.IsEmpty() {
+		introducedVars := make(map[string]any)
+		if n.LoopVar != "" {
+			introducedVars[n.LoopVar] = loopVarShape(n.Loop)
+		}
+		if n.LoopIdx != "" {
+			introducedVars[n.LoopIdx] = 0 // the index of the item
+		}
+		p.checkShadowing(n, n.LoopIdx, n.LoopVar)
+		// Push the new variables into the environment
+		p.pushEnv(introducedVars, p.span)
+	}
+
+	if !n.LoopKey.IsEmpty() {
+		key, err := p.newExpr(n.LoopKey.RawString())
+		switch {
+		case n.Loop.IsEmpty():
+			p.error(n, fmt.Errorf("c:key without c:for"))
+		case err != nil:
+			p.error(n, fmt.Errorf("parse c:key: %w", err))
+		default:
+			p.warn(checkExpr(key)...)
+			n.LoopKey = key
+		}
+	}
+
+	if !n.Switch.IsEmpty() {
+		sw, err := p.newExpr(n.Switch.RawString())
+		if err != nil {
+			p.error(n, fmt.Errorf("parse c:switch: %w", err))
+		} else {
+			p.warn(checkExpr(sw)...)
+			n.Switch = sw
+		}
+	}
+
+	if !n.Attrs.IsEmpty() {
+		spread, err := p.newExprInterpol(n.Attrs.RawString())
+		if err != nil {
+			p.error(n, fmt.Errorf("parse c:attrs: %w", err))
+		} else {
+			p.warn(checkExpr(spread)...)
+			n.Attrs = spread
+		}
+	}
+
+	for _, t := range attrs {
+		expr, err := p.newExprInterpol(t.Val)
 		if err != nil {
 			p.error(n, err)
 			continue
 		}
+		p.warn(checkExpr(expr)...)
 
 		n.Attr = append(n.Attr, Attribute{
 			Namespace: t.Namespace,
@@ -270,17 +368,11 @@ func (p *chtmlParser) addElement() {
 		})
 	}
 
-	// Handle c:for variables
-	if !n.Loop.IsEmpty() {
-		introducedVars := make(map[string]any)
-		if n.LoopVar != "" {
-			introducedVars[n.LoopVar] = new(any) // TODO: infer type
-		}
-		if n.LoopIdx != "" {
-			introducedVars[n.LoopIdx] = new(any) // TODO: infer type
-		}
-		// Push the new variables into the environment
-		p.pushEnv(introducedVars)
+	switch {
+	case isDefine(n):
+		p.defineFragment(n)
+	case isCall(n):
+		p.calls = append(p.calls, n)
 	}
 
 	p.addChild(n)
@@ -289,13 +381,26 @@ func (p *chtmlParser) addElement() {
 // popElement will panic if the stack is empty.
 func (p *chtmlParser) popElement() *Node {
 	n := p.oe.pop()
+	switch {
+	case isDefine(n):
+		p.popEnv() // the fragment parameters
+	case isSlotFill(n):
+		p.checkSlotFill(n)
+	case isCall(n):
+		if n.As != "" {
+			p.env[n.As] = new(any) // the fragments are not rendered at parse time
+			p.defs[n.As] = n.Source
+		}
+	case n.Type == importNode:
+		p.parseImportElement(n)
+	}
+	if !n.Switch.IsEmpty() {
+		p.checkSwitch(n)
+	}
 	// If the element introduced variables, pop the environment
-	if n.Type == html.ElementNode && !n.Loop.IsEmpty() {
+	if !n.Loop.IsEmpty() {
 		p.popEnv()
 	}
-	if n.Type == importNode {
-		p.parseImportElement(n)
-	}
 	return n
 }
 
@@ -305,6 +410,24 @@ func (p *chtmlParser) parseImportElement(n *Node) {
 		return
 	}
 
+	if compName == "attr" && n.Parent != p.doc {
+		// renders an attribute of the parent element, the name may depend on the render-time
+		// values, e.g. <c:attr c:for="k, v in data" name="${'data-' + k}">${v}</c:attr>
+		return
+	}
+	if compName == "attr" && (!n.Loop.IsEmpty() || slices.ContainsFunc(n.Attr, isDynamicName)) {
+		p.error(n, fmt.Errorf("the argument declared with <c:attr> must have a constant name"))
+		return
+	}
+
+	// Declare the variable bound by the "as" attribute. If the component renders at parse time,
+	// the variable takes the shape of its result, so the expressions referring to the variable
+	// are type checked against it.
+	if n.As != "" {
+		p.env[n.As] = new(any)
+		p.defs[n.As] = n.Source
+	}
+
 	imp := p.importer
 
 	if compName == "attr" {
@@ -334,6 +457,11 @@ func (p *chtmlParser) parseImportElement(n *Node) {
 	for _, attr := range n.Attr {
 		v, err := attr.Val.Value(&p.vm, env(p.env))
 		if err != nil {
+			if slices.ContainsFunc(attr.Val.idents, func(name string) bool {
+				return p.provided[name] || name == n.LoopVar || name == n.LoopIdx
+			}) {
+				return // depends on the values provided at render time, the result stays untyped
+			}
 			p.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
 			return
 		}
@@ -350,6 +478,7 @@ func (p *chtmlParser) parseImportElement(n *Node) {
 				Attr:       n.Attr,
 			},
 			env:            p.env,
+			name:           p.name,
 			renderComments: true,
 			importer:       p.importer,
 			hidden:         make(map[*Node]struct{}),
@@ -369,6 +498,9 @@ func (p *chtmlParser) parseImportElement(n *Node) {
 		p.error(n, fmt.Errorf("eval import %s: %w", compName, err))
 		return
 	}
+	if n.As != "" && rr != nil {
+		p.env[n.As] = rr
+	}
 	if attr, ok := rr.(Attribute); ok && n.Parent != nil {
 		if n.Parent == p.doc {
 			v, err := attr.Val.Value(&p.vm, env(p.env))
@@ -382,10 +514,16 @@ func (p *chtmlParser) parseImportElement(n *Node) {
 				Val:       NewExprConst(v),
 			})
 			p.env[attr.Key] = v
+			p.defs[attr.Key] = n.Source
 		}
 	}
 }
 
+// isDynamicName reports whether the attribute is the name of <c:attr> computed by an expression.
+func isDynamicName(attr Attribute) bool {
+	return attr.Key == "name" && len(attr.Val.idents) > 0
+}
+
 func (p *chtmlParser) parseSpecialAttrs(n *Node, t *html.Attribute) bool {
 	switch fk := strings.ToLower(t.Key); fk {
 	case "c:if", "c:else", "c:else-if":
@@ -393,7 +531,7 @@ func (p *chtmlParser) parseSpecialAttrs(n *Node, t *html.Attribute) bool {
 		if fk == "c:else" {
 			scond = "true"
 		}
-		cond, err := NewExpr(scond, p.env)
+		cond, err := p.newExpr(scond)
 		if err != nil {
 			p.error(n, fmt.Errorf("parse condition: %w", err))
 			return true
@@ -407,6 +545,9 @@ func (p *chtmlParser) parseSpecialAttrs(n *Node, t *html.Attribute) bool {
 				return true
 			}
 		}
+		if fk != "c:else" {
+			p.warn(checkCondition(cond)...)
+		}
 		n.Cond = cond
 		return true
 	case "c:for":
@@ -415,20 +556,119 @@ func (p *chtmlParser) parseSpecialAttrs(n *Node, t *html.Attribute) bool {
 			p.error(n, fmt.Errorf("parse loop expression: %w", err))
 			return true
 		}
-		loop, err := NewExpr(expr, p.env)
+		loop, err := p.newExpr(expr)
 		if err != nil {
 			p.error(n, fmt.Errorf("parse loop expression: %w", err))
 			return true
 		}
+		p.warn(checkExpr(loop)...)
 		n.Loop = loop
 		n.LoopIdx = k
 		n.LoopVar = v
 		return true
+	case "c:switch":
+		if n.Type != html.ElementNode {
+			p.error(n, fmt.Errorf("c:switch is supported on HTML elements only"))
+			return true
+		}
+		if strings.TrimSpace(t.Val) == "" {
+			p.error(n, fmt.Errorf("c:switch requires an expression"))
+			return true
+		}
+		n.Switch = NewExprRaw(t.Val) // compiled with the c:for variables declared, see addElement
+		return true
+	case "c:case", "c:default":
+		parent := p.top()
+		if parent.Switch.IsEmpty() {
+			p.error(n, fmt.Errorf("%s outside of c:switch", fk))
+			return true
+		}
+		for prev := parent.LastChild; prev != nil; prev = prev.PrevSibling {
+			if prev.CaseDefault {
+				p.error(n, fmt.Errorf("%s after c:default", fk))
+				break
+			}
+		}
+		if fk == "c:default" {
+			n.CaseDefault = true
+			return true
+		}
+		cv, err := p.newExpr(t.Val)
+		if err != nil {
+			p.error(n, fmt.Errorf("parse c:case: %w", err))
+			return true
+		}
+		p.warn(checkExpr(cv)...)
+		n.Case = cv
+		return true
+	case "c:attrs":
+		if n.Type != html.ElementNode {
+			p.error(n, fmt.Errorf("c:attrs is supported on HTML elements only"))
+			return true
+		}
+		n.Attrs = NewExprRaw(t.Val) // compiled with the c:for variables declared, see addElement
+		return true
+	case "c:key":
+		if strings.TrimSpace(t.Val) == "" {
+			p.error(n, fmt.Errorf("c:key requires an expression"))
+			return true
+		}
+		n.LoopKey = NewExprRaw(t.Val) // compiled with the c:for variables declared, see addElement
+		return true
+	case "c:for-parallel":
+		workers, err := strconv.Atoi(t.Val)
+		if err != nil || workers < 1 {
+			p.error(n, fmt.Errorf("c:for-parallel must be a positive number of workers, got %q", t.Val))
+			return true
+		}
+		n.LoopParallel = workers
+		return true
+	case "as", "c:var":
+		if n.Type != importNode {
+			return false
+		}
+		if !isIdentifier(t.Val) {
+			p.error(n, fmt.Errorf("invalid variable name in %q attribute: %q", t.Key, t.Val))
+			return true
+		}
+		n.As = t.Val
+		return true
 	default:
 		return false
 	}
 }
 
+// loopVarShape returns the value the loop variable is type checked against. The numbers
+// iterated over, e.g. c:for="i in 1..10", c:for="i in range(n)" or c:for="i in n", are typed;
+// other values are not inferred yet.
+func loopVarShape(loop Expr) any {
+	t := loop.Type()
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || !isNumberKind(t.Kind()) {
+		return new(any) // TODO: infer type
+	}
+	if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+		return reflect.Zero(t).Interface() // e.g. c:for="x in [0.5, 1.5]"
+	}
+	return 0 // the integers are iterated as int
+}
+
+// checkSwitch reports the content of the c:switch element n other than the cases and
+// the whitespace.
+func (p *chtmlParser) checkSwitch(n *Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case !child.Case.IsEmpty() || child.CaseDefault, child.Type == html.CommentNode:
+		case child.Type == html.TextNode && isBlank(child.Data.RawString()):
+		default:
+			p.error(child, fmt.Errorf("c:switch may contain only c:case and c:default elements"))
+			return
+		}
+	}
+}
+
 func (p *chtmlParser) findPrevCond(n *Node) *Node {
 	for ; n != nil; n = n.PrevSibling {
 		if !n.Cond.IsEmpty() {
@@ -681,7 +921,13 @@ func inBodyIM(p *chtmlParser) bool {
 			p.inBodyEndTagOther(p.tok.DataAtom, p.tok.Data)
 		}
 	case html.CommentToken:
-		expr, err := NewExprInterpol(p.tok.Data, p.env)
+		var expr Expr
+		var err error
+		if p.rawComments {
+			expr = NewExprRaw(p.tok.Data)
+		} else {
+			expr, err = p.newExprInterpol(p.tok.Data)
+		}
 		n := &Node{
 			Type: html.CommentNode,
 			Data: expr,
@@ -786,35 +1032,82 @@ func (p *chtmlParser) parseCurrentToken() {
 }
 
 func (p *chtmlParser) error(n *Node, err error) {
-	p.errs = append(p.errs, newComponentError(n, err))
+	ce := newComponentError(n, err)
+	ce.component = p.name
+	p.errs = append(p.errs, ce)
 }
 
-// pushEnv adds variables to the parsing env while preserving the previous values in the shadowed
-// stack.
-func (p *chtmlParser) pushEnv(vars map[string]any) {
+// warn records diagnostic messages for the current token.
+func (p *chtmlParser) warn(msgs ...string) {
+	for _, msg := range msgs {
+		p.diags = append(p.diags, Diagnostic{Source: p.span, Message: msg})
+	}
+}
+
+// pushEnv adds variables defined at src to the parsing env while preserving the previous values
+// in the shadowed stack.
+func (p *chtmlParser) pushEnv(vars map[string]any, src Span) {
 	m := make(map[string]any)
+	d := make(map[string]Span)
 	p.shadowed = append(p.shadowed, m)
+	p.shadowedDefs = append(p.shadowedDefs, d)
 	for k, v := range vars {
 		if oldV, ok := p.env[k]; ok {
 			m[k] = oldV
 		} else {
 			m[k] = envNoValue
 		}
+		if oldSrc, ok := p.defs[k]; ok {
+			d[k] = oldSrc
+		}
 
 		p.env[k] = v
+		p.defs[k] = src
 	}
 }
 
 // popEnv applies the shadowed variables from the top of the stack to the env.
 func (p *chtmlParser) popEnv() {
+	d := p.shadowedDefs[len(p.shadowedDefs)-1]
 	for k, v := range p.shadowed[len(p.shadowed)-1] {
 		if v == envNoValue {
 			delete(p.env, k)
 		} else {
 			p.env[k] = v
 		}
+		if src, ok := d[k]; ok {
+			p.defs[k] = src
+		} else {
+			delete(p.defs, k)
+		}
 	}
 	p.shadowed = p.shadowed[:len(p.shadowed)-1]
+	p.shadowedDefs = p.shadowedDefs[:len(p.shadowedDefs)-1]
+}
+
+// checkShadowing reports the loop variables of n hiding the variables already in scope, which is
+// usually a mistake, e.g. <li c:for="item in item.children"> in a component with the "item"
+// argument. It is a warning, or an error if ParseOptions.StrictShadowing is set.
+func (p *chtmlParser) checkShadowing(n *Node, names ...string) {
+	for _, name := range names {
+		if name == "" || name == "_" {
+			continue
+		}
+		if _, ok := p.env[name]; !ok {
+			continue
+		}
+
+		what := "a variable provided by the environment"
+		if src, ok := p.defs[name]; ok {
+			what = fmt.Sprintf("the variable defined at %s", src.Start)
+		}
+		msg := fmt.Sprintf("loop variable %q shadows %s", name, what)
+		if p.strictShadowing {
+			p.error(n, errors.New(msg))
+		} else {
+			p.warn(msg)
+		}
+	}
 }
 
 func (p *chtmlParser) parse() error {
@@ -826,6 +1119,7 @@ func (p *chtmlParser) parse() error {
 		p.tokenizer.AllowCDATA(n != nil && n.Namespace != "")
 		// Read and parse the next token.
 		p.tokenizer.Next()
+		p.span = Span{Start: p.span.End, End: p.span.End.advance(p.tokenizer.Raw())}
 		p.tok = p.tokenizer.Token()
 		if p.tok.Type == html.ErrorToken {
 			err = p.tokenizer.Err()
@@ -839,21 +1133,115 @@ func (p *chtmlParser) parse() error {
 	return nil
 }
 
+// ParseOptions configures the parser.
+type ParseOptions struct {
+	// Name is the name of the parsed component, e.g. the file path, reported by the parse errors
+	// (see ComponentError.Component).
+	Name string
+
+	// StrictEncoding disables the conversion of non-UTF-8 input. If set, Parse returns
+	// ErrInvalidEncoding when the input is not a valid UTF-8.
+	StrictEncoding bool
+
+	// EnvProvider declares the variables provided on demand at render time (see EnvProvider).
+	// Only the names and the shapes (see EnvShaper) are used by the parser.
+	EnvProvider EnvProvider
+
+	// RawComments disables the expression interpolation in comments. The comments are kept as is,
+	// and the ${...} placeholders in them are never evaluated.
+	RawComments bool
+
+	// StrictShadowing makes the loop variables hiding the variables already in scope (component
+	// arguments, variables of the outer loops, etc.) a parse error instead of a warning.
+	StrictShadowing bool
+
+	// ExprCache is the cache of the compiled expressions. If not set, DefaultExprCache is used.
+	// Use NewExprCache(0) to disable caching.
+	ExprCache *ExprCache
+
+	// Functions are the functions available in the expressions in addition to the builtin ones,
+	// e.g. {"money": formatMoney} for ${money(price, 'EUR')}. The calls are type checked against
+	// the Go signatures. The components rendering the parsed document need the same functions
+	// in ComponentOptions.Functions. The arguments of the component shadow them.
+	Functions map[string]any
+}
+
 // Parse returns the parsed *Node tree for the HTML from the given Reader.
-// The input is assumed to be UTF-8 encoded.
+// The input encoding is detected by the byte order mark or the <meta charset> declaration and
+// converted to UTF-8. If neither is present, the input is assumed to be UTF-8 encoded. The input
+// in an unsupported encoding is read as UTF-8 with the invalid sequences replaced by U+FFFD.
 func Parse(r io.Reader, imp Importer) (*Node, error) {
+	return ParseWithOptions(r, imp, nil)
+}
+
+// ParseWithOptions is like Parse, but allows to configure the parser.
+func ParseWithOptions(r io.Reader, imp Importer, opts *ParseOptions) (*Node, error) {
+	doc, _, err := ParseWithDiagnostics(r, imp, opts)
+	return doc, err
+}
+
+// ParseWithDiagnostics is like ParseWithOptions, but also returns the warnings found in the
+// template, such as constant conditions or comparisons of strings to numbers. The warnings
+// are returned even if the parsing fails.
+func ParseWithDiagnostics(r io.Reader, imp Importer, opts *ParseOptions) (*Node, []Diagnostic, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+
+	r, err := toUTF8(r, opts.StrictEncoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	p := &chtmlParser{
 		tokenizer: html.NewTokenizer(r),
+		span:      Span{End: Position{Line: 1, Col: 1}},
 		doc: &Node{
 			Type: html.DocumentNode,
 		},
-		env:      map[string]any{"_": new(any)},
-		im:       inBodyIM,
-		importer: imp,
+		env:             map[string]any{"_": new(any), "slot": slotFunc(nil)},
+		defs:            make(map[string]Span),
+		im:              inBodyIM,
+		importer:        imp,
+		rawComments:     opts.RawComments,
+		strictShadowing: opts.StrictShadowing,
+		exprCache:       opts.ExprCache,
+		name:            opts.Name,
+	}
+	if p.exprCache == nil {
+		p.exprCache = DefaultExprCache
+	}
+
+	for name, fn := range opts.Functions {
+		if err := checkFunction(name, fn); err != nil {
+			return nil, nil, err
+		}
+		p.env[name] = fn
+	}
+
+	if opts.EnvProvider != nil {
+		shaper, _ := opts.EnvProvider.(EnvShaper)
+		for _, name := range opts.EnvProvider.EnvNames() {
+			if _, ok := p.env[name]; !ok {
+				var shape any = new(any) // unknown type
+				if shaper != nil {
+					if v, ok := shaper.EnvShape(name); ok && v != nil {
+						shape = v
+					}
+				}
+				p.env[name] = shape
+				if p.provided == nil {
+					p.provided = make(map[string]bool)
+				}
+				p.provided[name] = true
+			}
+		}
 	}
 
 	if err := p.parse(); err != nil {
-		return nil, err
+		return nil, p.diags, err
 	}
-	return p.doc, errors.Join(p.errs...)
+	p.resolveCalls()
+	p.scopeStyles()
+	return p.doc, p.diags, errors.Join(p.errs...)
 }
@@ -80,6 +80,11 @@ func dumpLevel(w io.Writer, n *Node, level int) error {
 			}
 			_, _ = fmt.Fprintf(w, `c:for="%s in %s"`, strings.Join(loopVars, ", "), n.Loop.RawString())
 		}
+		if n.As != "" {
+			_, _ = io.WriteString(w, "\n")
+			dumpIndent(w, level)
+			_, _ = fmt.Fprintf(w, `as="%s"`, n.As)
+		}
 		attr := sortedAttributes(n.Attr)
 		sort.Sort(attr)
 		for _, a := range attr {
@@ -396,6 +401,59 @@ func TestParserCHTML(t *testing.T) {
 			|   "ipsum"
 			`,
 		},
+		{
+			name: "loop variable outside the import",
+			text: `<c:subcomp1 c:for="n in [1, 2]" arg="${n}"></c:subcomp1><p>${n}</p>`,
+			errs: []string{"unknown name n"},
+			want: `
+			| <c:subcomp1>
+			|   c:for="n, _ in [1, 2]"
+			|   arg="${n}"
+			| <p>
+			|   "${n}"
+			`,
+		},
+		{
+			name: "argument with dynamic name",
+			text: `<c:attr name="${'a' + 'b'}"></c:attr><c:attr name="k"></c:attr><c:attr name="${k}"></c:attr>`,
+			errs: []string{"the argument declared with <c:attr> must have a constant name"},
+			want: `
+			| <c:attr>
+			|   name="${'a' + 'b'}"
+			| <c:attr>
+			|   name="k"
+			| <c:attr>
+			|   name="${k}"
+			`,
+		},
+		{
+			name: "component bound to variable",
+			text: `<c:subcomp1 as="res"></c:subcomp1><p>${res}</p>`,
+			want: `
+			| <c:subcomp1>
+			|   as="res"
+			| <p>
+			|   "${res}"
+			`,
+		},
+		{
+			name: "component bound with c:var",
+			text: `<c:subcomp1 c:var="res"></c:subcomp1><p>${res}</p>`,
+			want: `
+			| <c:subcomp1>
+			|   as="res"
+			| <p>
+			|   "${res}"
+			`,
+		},
+		{
+			name: "component bound to invalid variable",
+			text: `<c:subcomp1 as="1res"></c:subcomp1>`,
+			errs: []string{`invalid variable name in "as" attribute: "1res"`},
+			want: `
+			| <c:subcomp1>
+			`,
+		},
 
 		/*
 			#data
@@ -480,6 +538,9 @@ func testParseCase(text, want string, expectedErrs []string) (err error) {
 		if !n.Loop.IsEmpty() {
 			attrCount++
 		}
+		if n.As != "" {
+			attrCount++
+		}
 		if attrCount > 0 {
 			nn.Attr = make([]html.Attribute, attrCount)
 			j := 0
@@ -515,6 +576,13 @@ func testParseCase(text, want string, expectedErrs []string) (err error) {
 				}
 				j++
 			}
+			if n.As != "" {
+				nn.Attr[j] = html.Attribute{
+					Key: "as",
+					Val: n.As,
+				}
+				j++
+			}
 			for i, a := range n.Attr {
 				nn.Attr[i+j] = html.Attribute{
 					Namespace: a.Namespace,
@@ -584,6 +652,57 @@ func checkErrors(err error, expected []string) error {
 	return nil
 }
 
+func TestParseSource(t *testing.T) {
+	doc, err := Parse(strings.NewReader("<div>\n  <p class=\"x\">Grüße</p>\n</div>"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	div := doc.FirstChild
+	p := div.FirstChild.NextSibling
+	text := p.FirstChild
+
+	tests := []struct {
+		name string
+		n    *Node
+		want Span
+	}{
+		{"div", div, Span{Position{0, 1, 1}, Position{5, 1, 6}}},
+		{"p", p, Span{Position{8, 2, 3}, Position{21, 2, 16}}},
+		{"text", text, Span{Position{21, 2, 16}, Position{28, 2, 21}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.n.Source != tt.want {
+				t.Errorf("Source = %v, want %v", tt.n.Source, tt.want)
+			}
+		})
+	}
+}
+
+type shapeImporter struct{}
+
+func (shapeImporter) Import(name string) (Component, error) {
+	return shapeComponent{}, nil
+}
+
+type shapeComponent struct{}
+
+func (shapeComponent) Render(s Scope) (any, error) {
+	return struct{ Title string }{Title: "Hello"}, nil
+}
+
+func TestParseImportShape(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`<c:post c:var="p"></c:post>${p.Title}`), shapeImporter{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err := Parse(strings.NewReader(`<c:post c:var="p"></c:post>${p.Body}`), shapeImporter{})
+	if err == nil || !strings.Contains(err.Error(), "Body") {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+}
+
 func TestParseForeignContentTemplates(t *testing.T) {
 	srcs := []string{
 		"<math><html><template><mn><template></template></template>",
@@ -623,3 +742,60 @@ type cnil struct{}
 func (cnil) Render(s Scope) (any, error) {
 	return nil, nil
 }
+
+func TestParseLoopVarShape(t *testing.T) {
+	for _, text := range []string{
+		`<p c:for="i in 1..3">${i.name}</p>`,
+		`<p c:for="i in range(3)">${i.name}</p>`,
+		`<p c:for="x, i in ['a']">${i.name}</p>`,
+	} {
+		if _, err := Parse(strings.NewReader(text), nil); err == nil {
+			t.Errorf("%s: want the type error of the number loop variable", text)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader(`<p c:for="x in [{'name': 'a'}]">${x.name}</p>`), nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseSwitch(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		errs []string
+	}{
+		{
+			name: "cases",
+			text: `<div c:switch="1"> <p c:case="1">one</p> <!-- other --> <p c:default>other</p> </div>`,
+		},
+		{
+			name: "case outside of switch",
+			text: `<div><p c:case="1">one</p></div>`,
+			errs: []string{"p: c:case outside of c:switch"},
+		},
+		{
+			name: "case after default",
+			text: `<div c:switch="1"><p c:default>other</p><p c:case="1">one</p></div>`,
+			errs: []string{"p: c:case after c:default"},
+		},
+		{
+			name: "content other than cases",
+			text: `<div c:switch="1"><p c:case="1">one</p>text</div>`,
+			errs: []string{"div: c:switch may contain only c:case and c:default elements"},
+		},
+		{
+			name: "switch on import",
+			text: `<c:subcomp1 c:switch="1"></c:subcomp1>`,
+			errs: []string{"c:switch is supported on HTML elements only"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.text), anyImporter{})
+			if err := checkErrors(err, tt.errs); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
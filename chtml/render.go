@@ -4,7 +4,13 @@ import (
 	"fmt"
 	"iter"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/expr-lang/expr/vm/runtime"
 	"golang.org/x/net/html"
 )
 
@@ -18,61 +24,218 @@ import (
 //  3. Render the node and its children, calling the appropriate function based on a node type, and
 //     appending the result to the destination node.
 func (c *chtmlComponent) render(n *Node) any {
-	if c.evalIf(n) {
-		var res, rr any
-
-		for c := range c.evalFor(n) {
-			switch n.Type {
-			case html.ElementNode:
-				rr = c.renderElement(n)
-			case html.TextNode:
-				rr = c.renderText(n)
-			case html.CommentNode:
-				rr = c.renderComment(n)
-			case html.DocumentNode:
-				rr = c.renderDocument(n)
-			case importNode:
-				rr = c.renderImport(n)
-			default:
-				c.error(n, fmt.Errorf("unexpected node type: %v", n.Type))
-			}
+	if !c.arena.Alloc(nodeCost) {
+		return nil // budget exceeded, abort rendering
+	}
 
-			res = AnyPlusAny(res, rr)
+	if c.evalIf(n) {
+		if c.diff != nil {
+			return c.renderTracked(n)
 		}
-
-		return res
+		return c.renderNodeLoop(n)
+	}
+	if c.diff != nil {
+		c.trackHidden(n)
 	}
 
 	return nil
 }
 
+// renderNodeLoop renders the visible node once, or for each item of the c:for loop.
+func (c *chtmlComponent) renderNodeLoop(n *Node) any {
+	if n.LoopParallel > 1 && !n.Loop.IsEmpty() {
+		return c.renderParallel(n)
+	}
+
+	var res any
+	var attrs attrList // of <c:attr> rendered in a loop
+	for c := range c.evalFor(n) {
+		rr := c.renderNode(n)
+		if attr, ok := rr.(Attribute); ok && !n.Loop.IsEmpty() {
+			attrs = append(attrs, attr)
+			continue
+		}
+		res = AnyPlusAny(res, rr)
+	}
+	if attrs != nil {
+		return attrs
+	}
+	return res
+}
+
 // renderText evaluates the interpolated expression for the given text node and stores the result in
 // the destination node.
 // If the text node is not an expression, the value is copied as is.
 func (c *chtmlComponent) renderText(n *Node) any {
-	res, err := n.Data.Value(&c.vm, c.env)
+	res, err := c.eval(n.Data)
 	if err != nil {
 		c.error(n, fmt.Errorf("eval text: %w", err))
 		return nil
 	}
+	if s, ok := res.(string); ok {
+		if res, err = c.invalidUTF8.sanitize(s); err != nil {
+			c.error(n, fmt.Errorf("eval text: %w", err))
+			return nil
+		}
+		if !c.arena.Alloc(int64(len(s))) {
+			return nil
+		}
+	}
+	if hn, ok := res.(*html.Node); ok && hn != nil && c.sanitize != nil {
+		sn, err := c.sanitizeHTML(hn)
+		if err != nil {
+			c.error(n, fmt.Errorf("sanitize: %w", err))
+			return nil
+		}
+		if sn == nil {
+			return nil
+		}
+		res = sn
+	}
 	return res
 }
 
 func (c *chtmlComponent) renderComment(n *Node) *html.Node {
-	if c.renderComments {
-		data, err := n.Data.Value(&c.vm, c.env)
+	if c.shouldRenderComment(n) {
+		data, err := c.eval(n.Data)
+		if err != nil {
+			c.error(n, fmt.Errorf("eval comment: %w", err))
+			return nil
+		}
+		s, err := c.invalidUTF8.sanitize(fmt.Sprint(data))
 		if err != nil {
 			c.error(n, fmt.Errorf("eval comment: %w", err))
 			return nil
 		}
 		return &html.Node{
 			Type: html.CommentNode,
-			Data: fmt.Sprint(data),
+			Data: s,
 		}
 	}
 	return nil
 }
 
+// shouldRenderComment reports whether the comment node should be rendered according to the
+// renderComments flag, keepComments prefixes and keepComment predicate.
+func (c *chtmlComponent) shouldRenderComment(n *Node) bool {
+	if c.renderComments {
+		return true
+	}
+	raw := strings.TrimLeft(n.Data.RawString(), whitespace)
+	for _, prefix := range c.keepComments {
+		if strings.HasPrefix(raw, prefix) {
+			return true
+		}
+	}
+	return c.keepComment != nil && c.keepComment(n.Data.RawString())
+}
+
+// DirectiveComment is a ComponentOptions.KeepComment predicate keeping the comments read by
+// the browsers and the tooling: the conditional comments (<!--[if IE]>...<![endif]--> and
+// <!--<![endif]-->), the server side includes (<!--#include ...-->) and the comments starting
+// with "!" (e.g. the license notes <!--! ... -->).
+func DirectiveComment(text string) bool {
+	text = strings.TrimLeft(text, whitespace)
+	for _, prefix := range []string{"[if ", "<![endif]", "#", "!"} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderNode renders the node once, calling the appropriate function based on the node type.
+func (c *chtmlComponent) renderNode(n *Node) any {
+	switch n.Type {
+	case html.ElementNode:
+		return c.renderElement(n)
+	case html.TextNode:
+		return c.renderText(n)
+	case html.CommentNode:
+		return c.renderComment(n)
+	case html.DocumentNode:
+		return c.renderDocument(n)
+	case importNode:
+		return c.renderImport(n)
+	case testNode:
+		return nil // test cases are not rendered
+	default:
+		c.error(n, fmt.Errorf("unexpected node type: %v", n.Type))
+		return nil
+	}
+}
+
+// renderParallel renders the loop items concurrently by n.LoopParallel workers (c:for-parallel)
+// and concatenates the results in the original order. The items are split into chunks, so
+// the workers render large collections with little coordination overhead.
+//
+// The loop items are rendered by independent component instances, but the components imported
+// in the loop body must be safe for concurrent use of the shared scope.
+func (c *chtmlComponent) renderParallel(n *Node) any {
+	var comps []*chtmlComponent
+	for lc := range c.evalFor(n) {
+		comps = append(comps, lc)
+	}
+	if len(comps) == 0 {
+		return nil
+	}
+
+	// the importers are not required to be safe for concurrent use
+	imp := c.importer
+	if imp != nil {
+		if _, ok := imp.(*lockedImporter); !ok {
+			imp = &lockedImporter{imp: imp}
+		}
+	}
+
+	workers := min(n.LoopParallel, len(comps))
+	chunk := max(1, len(comps)/(workers*4))
+
+	results := make([]any, len(comps))
+	chunks := make(chan int)
+	panics := make(chan any, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					panics <- r
+					for range chunks {
+						// drain the queue to unblock the producer
+					}
+				}
+			}()
+			for start := range chunks {
+				for i := start; i < min(start+chunk, len(comps)); i++ {
+					lc := comps[i]
+					lc.importer = imp
+					results[i] = lc.renderNode(n)
+				}
+			}
+		}()
+	}
+	for start := 0; start < len(comps); start += chunk {
+		chunks <- start
+	}
+	close(chunks)
+	wg.Wait()
+
+	select {
+	case r := <-panics:
+		panic(r) // propagate to the caller's goroutine
+	default:
+	}
+
+	var res any
+	for _, rr := range results {
+		res = AnyPlusAny(res, rr)
+	}
+	return res
+}
+
 func (c *chtmlComponent) renderDocument(n *Node) any {
 	var res any
 
@@ -81,8 +244,11 @@ func (c *chtmlComponent) renderDocument(n *Node) any {
 		if rr == nil {
 			continue
 		}
+		if _, ok := rr.(slotContent); ok {
+			continue // the named slots are passed to the import by importComponent
+		}
 		if attr, ok := rr.(Attribute); ok {
-			v, err := attr.Val.Value(&c.vm, env(c.env))
+			v, err := c.eval(attr.Val)
 			if err != nil {
 				c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
 				continue
@@ -112,23 +278,34 @@ func (c *chtmlComponent) renderElement(n *Node) any {
 		return nil
 	}
 
+	c.evalSwitch(n)
+
 	for child := n.FirstChild; child != nil; child = child.NextSibling {
 		rr := c.render(child)
 		if rr == nil {
 			continue
 		}
-		if attr, ok := rr.(Attribute); ok {
-			v, err := attr.Val.Value(&c.vm, env(c.env))
-			if err != nil {
-				c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
-				continue
+		if attrs, ok := renderedAttrs(rr); ok {
+			for _, attr := range attrs {
+				v, err := c.eval(attr.Val)
+				if err != nil {
+					c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
+					continue
+				}
+				a, ok, err := c.renderAttr(n, attr.Namespace, attr.Key, v)
+				if err != nil {
+					c.error(child, err)
+					continue
+				}
+				if ok {
+					clone.Attr = append(clone.Attr, a)
+				}
 			}
-			clone.Attr = append(clone.Attr, html.Attribute{
-				Namespace: attr.Namespace,
-				Key:       attr.Key,
-				Val:       fmt.Sprintf("%v", v),
-			})
 		} else {
+			if err := c.checkContent(rr); err != nil {
+				c.error(child, err)
+				continue
+			}
 			if c := AnyToHtml(rr); c != nil {
 				clone.AppendChild(cloneHtmlTree(c))
 			}
@@ -140,32 +317,131 @@ func (c *chtmlComponent) renderElement(n *Node) any {
 
 // renderImport renders the imported component (<c:NAME>) and appends the result to the destination.
 func (c *chtmlComponent) renderImport(n *Node) any {
+	if isDefine(n) {
+		return nil // rendered by <c:call>
+	}
+	if isCall(n) {
+		rr := c.renderCall(n)
+		if n.As != "" {
+			c.env[n.As] = rr
+			return nil
+		}
+		return rr
+	}
+	if isSlotFill(n) {
+		return c.renderSlotFill(n)
+	}
+
+	comp, s, ok := c.importComponent(n)
+	if !ok {
+		return nil
+	}
+
+	rr, err := c.renderImported(n, comp, s)
+	if err != nil {
+		c.error(n, fmt.Errorf("render import: %w", err))
+		return nil
+	}
+
+	// bind the result to a variable instead of rendering it (<c:NAME as="VAR">)
+	if n.As != "" {
+		c.env[n.As] = rr
+		return nil
+	}
+	return rr
+}
+
+// renderImported renders the component imported by the node. If the render takes longer than
+// the RenderTimeout, the instance of the component is abandoned: it is not reused by the next
+// renders and is disposed once its render returns.
+func (c *chtmlComponent) renderImported(n *Node, comp Component, s Scope) (any, error) {
+	if c.renderTimeout <= 0 {
+		return comp.Render(s)
+	}
+
+	type result struct {
+		rr    any
+		err   error
+		panic any
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{panic: r}
+			}
+		}()
+		rr, err := comp.Render(s)
+		done <- result{rr: rr, err: err}
+	}()
+
+	timer := time.NewTimer(c.renderTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		if res.panic != nil {
+			panic(res.panic) // propagate to the caller's goroutine
+		}
+		return res.rr, res.err
+	case <-timer.C:
+	}
+
+	// the instance is the last child of the node, see importComponent
+	if comps := c.children[n]; len(comps) > 1 {
+		c.children[n] = comps[:len(comps)-1]
+	} else {
+		delete(c.children, n)
+	}
+	if d, ok := comp.(Disposable); ok {
+		go func() {
+			<-done
+			_ = d.Dispose()
+		}()
+	}
+	return nil, fmt.Errorf("%w (%v)", ErrRenderTimeout, c.renderTimeout)
+}
+
+// importComponent returns the imported component (<c:NAME>) and the scope to render it with.
+// The children of the import are rendered into the "_" variable. It returns false if the errors
+// have been reported.
+func (c *chtmlComponent) importComponent(n *Node) (Component, Scope, bool) {
 	// Build variables for the imported component
 	vars := make(map[string]any)
 	for _, attr := range n.Attr {
-		res, err := attr.Val.Value(&c.vm, env(c.env))
+		res, err := c.eval(attr.Val)
 		if err != nil {
 			c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
-			return nil
+			return nil, nil, false
 		}
 		vars[attr.Key] = res
 	}
 
 	if n.FirstChild != nil {
 		vars["_"] = nil
+		var slots map[string]any
 		for child := n.FirstChild; child != nil; child = child.NextSibling {
 			rr := c.render(child)
-			if attr, ok := rr.(Attribute); ok {
-				v, err := attr.Val.Value(&c.vm, env(c.env))
-				if err != nil {
-					c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
-					return nil
+			if sc, ok := rr.(slotContent); ok {
+				if slots == nil {
+					slots = make(map[string]any)
+				}
+				slots[sc.name] = AnyPlusAny(slots[sc.name], sc.content)
+			} else if attrs, ok := renderedAttrs(rr); ok {
+				for _, attr := range attrs {
+					v, err := c.eval(attr.Val)
+					if err != nil {
+						c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
+						return nil, nil, false
+					}
+					vars[attr.Key] = v
 				}
-				vars[attr.Key] = v
 			} else {
 				vars["_"] = AnyPlusAny(vars["_"], rr)
 			}
 		}
+		if slots != nil {
+			vars[slotsVar] = slots
+		}
 	}
 
 	// Create a new Scope for the imported component
@@ -176,15 +452,15 @@ func (c *chtmlComponent) renderImport(n *Node) any {
 	if len(c.children[n]) == 1 {
 		comp = c.children[n][0]
 	} else {
-		impName, err := n.Data.Value(&c.vm, env(c.env))
+		impName, err := c.eval(n.Data)
 		if err != nil {
 			c.error(n, fmt.Errorf("eval import name: %w", err))
-			return nil
+			return nil, nil, false
 		}
 		impNameStr, ok := impName.(string)
 		if !ok {
 			c.error(n, fmt.Errorf("import name must be a string"))
-			return nil
+			return nil, nil, false
 		}
 		imp := c.importer
 		if impNameStr == "c:attr" {
@@ -192,22 +468,53 @@ func (c *chtmlComponent) renderImport(n *Node) any {
 		}
 		if imp == nil {
 			c.error(n, ErrImportNotAllowed)
-			return nil
+			return nil, nil, false
 		}
 		comp, err = imp.Import(impNameStr[2:])
 		if err != nil {
 			c.error(n, fmt.Errorf("import %q: %w", impNameStr, err))
-			return nil
+			return nil, nil, false
 		}
 		c.children[n] = append(c.children[n], comp)
 	}
 
-	rr, err := comp.Render(s)
-	if err != nil {
-		c.error(n, fmt.Errorf("render import: %w", err))
+	if err := c.enterImport(comp); err != nil {
+		c.error(n, err)
+		return nil, nil, false
+	}
+
+	return comp, s, true
+}
+
+// enterImport passes the chain of the imports to the imported CHTML component, so the recursive
+// imports fail once the chain exceeds the max import depth instead of overflowing the stack.
+func (c *chtmlComponent) enterImport(comp Component) error {
+	for {
+		b, ok := comp.(*boundComponent)
+		if !ok {
+			break
+		}
+		comp = b.comp
+	}
+	ic, ok := comp.(*chtmlComponent)
+	if !ok {
 		return nil
 	}
-	return rr
+
+	imports := append(slices.Clip(c.imports), c.name)
+	if len(imports) > c.maxImportDepth {
+		chain := append(imports, ic.name)
+		for i := len(chain) - 2; i >= 0; i-- {
+			if ic.name != "" && chain[i] == ic.name {
+				return fmt.Errorf("%w (%d): %w", ErrImportDepthExceeded, c.maxImportDepth,
+					&ImportCycleError{Cycle: chain[i:]})
+			}
+		}
+		return fmt.Errorf("%w (%d)", ErrImportDepthExceeded, c.maxImportDepth)
+	}
+	ic.imports = imports
+	ic.maxImportDepth = c.maxImportDepth
+	return nil
 }
 
 // renderAttrs loops over the attributes of the source node and evaluates the expressions for them.
@@ -216,7 +523,7 @@ func (c *chtmlComponent) renderImport(n *Node) any {
 func (c *chtmlComponent) renderAttrs(dst *html.Node, n *Node) error {
 	attrs := make([]html.Attribute, 0, len(n.Attr))
 	for _, attr := range n.Attr {
-		v, err := attr.Val.Value(&c.vm, c.env)
+		v, err := c.eval(attr.Val)
 		if err != nil {
 			c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
 			continue
@@ -226,12 +533,21 @@ func (c *chtmlComponent) renderAttrs(dst *html.Node, n *Node) error {
 			continue // skip HTML nodes
 		}
 
-		sv := fmt.Sprint(v)
-		if sv == "<nil>" {
-			sv = ""
+		if v == nil && attr.Val.RawString() == "" {
+			v = "" // attribute without a value, e.g. <input disabled>
 		}
 
-		attrs = append(attrs, html.Attribute{Key: attr.Key, Val: sv})
+		a, ok, err := c.renderAttr(n, attr.Namespace, attr.Key, v)
+		if err != nil {
+			c.error(n, err)
+			continue
+		}
+		if ok {
+			attrs = append(attrs, a)
+		}
+	}
+	if !n.Attrs.IsEmpty() {
+		attrs = c.spreadAttrs(n, attrs)
 	}
 	dst.Attr = nil
 	if len(attrs) > 0 {
@@ -240,11 +556,125 @@ func (c *chtmlComponent) renderAttrs(dst *html.Node, n *Node) error {
 	return nil
 }
 
+// spreadAttrs merges the attributes of the c:attrs map into the rendered attributes of the
+// element n. The map values are converted like the values of the attributes (see attrValue) and
+// override the attributes of the same name, e.g. {disabled: false} removes the attribute.
+// The new attributes are added in the order of the names.
+func (c *chtmlComponent) spreadAttrs(n *Node, attrs []html.Attribute) []html.Attribute {
+	v, err := c.eval(n.Attrs)
+	if err != nil {
+		c.error(n, fmt.Errorf("eval c:attrs: %w", err))
+		return attrs
+	}
+	if v == nil {
+		return attrs
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		c.error(n, fmt.Errorf("c:attrs: expected a map with string keys, got %T", v))
+		return attrs
+	}
+
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		mv := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface()
+		a, ok, err := c.renderAttr(n, "", key, mv)
+		if err != nil {
+			c.error(n, fmt.Errorf("c:attrs: %w", err))
+			continue
+		}
+		i := slices.IndexFunc(attrs, func(da html.Attribute) bool {
+			name := da.Key
+			if da.Namespace != "" {
+				name = da.Namespace + ":" + da.Key
+			}
+			return strings.EqualFold(name, key)
+		})
+		switch {
+		case !ok && i >= 0:
+			attrs = slices.Delete(attrs, i, i+1)
+		case !ok:
+		case i >= 0:
+			attrs[i].Val = a.Val // the name is kept as written in the element
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// foreignAttrPrefixes are the namespace prefixes of the attributes of the foreign (SVG, MathML)
+// elements, e.g. xlink:href. Such names are split into the namespace and the local name.
+var foreignAttrPrefixes = map[string]bool{"xlink": true, "xml": true, "xmlns": true}
+
+// outputAttr builds the attribute of the rendered element n. The names are validated, as they
+// may be computed by the expressions (e.g. <c:attr name="${key}">) and corrupt the markup.
+func outputAttr(n *Node, ns, key, val string) (html.Attribute, error) {
+	if ns == "" && n.Namespace != "" {
+		if prefix, local, ok := strings.Cut(key, ":"); ok && foreignAttrPrefixes[prefix] {
+			ns, key = prefix, local
+		}
+	}
+	name := key
+	if ns != "" {
+		name = ns + ":" + key
+	}
+	if !validAttrName(key) || ns != "" && !validAttrName(ns) {
+		return html.Attribute{}, fmt.Errorf("invalid attribute name %q", name)
+	}
+	return html.Attribute{Namespace: ns, Key: key, Val: val}, nil
+}
+
+// validAttrName reports whether name is a valid HTML attribute name: a non-empty string without
+// the control characters, spaces, quotes, ">", "/", "=" and noncharacters. The "<" character is
+// rejected too, as it is a parse error in the attribute names.
+func validAttrName(name string) bool {
+	if name == "" || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r <= ' ', r >= 0x7f && r <= 0x9f:
+			return false
+		case r == '"', r == '\'', r == '>', r == '/', r == '=', r == '<':
+			return false
+		case r >= 0xfdd0 && r <= 0xfdef, r&0xfffe == 0xfffe:
+			return false
+		}
+	}
+	return true
+}
+
+// truthy reports whether the value is a true condition: nil, false, zero numbers, empty strings,
+// slices and maps are false, the other values are true.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v != 0
+	case float32, float64:
+		return v != 0.0
+	case nil:
+		return false
+	default:
+		rv := reflect.ValueOf(v)
+		return (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Map) || rv.Len() > 0
+	}
+}
+
 // evalIf evaluates the conditional expression (c:if, c:else-if, c:else) for the given node and
 // marks it as hidden if the condition is false.
 // Returns true if the node should be rendered, false otherwise.
 func (c *chtmlComponent) evalIf(n *Node) bool {
-	if n.Cond.IsEmpty() {
+	if n.Cond.IsEmpty() && n.Case.IsEmpty() && !n.CaseDefault {
 		return true // no condition, render by default
 	}
 
@@ -253,35 +683,18 @@ func (c *chtmlComponent) evalIf(n *Node) bool {
 		return false
 	}
 
+	if n.Cond.IsEmpty() {
+		return true // the matching case of c:switch (see evalSwitch)
+	}
+
 	render := true
 
-	res, err := n.Cond.Value(&c.vm, c.env)
+	res, err := c.eval(n.Cond)
 	if err != nil {
 		c.error(n, fmt.Errorf("eval c:if: %w", err))
 		render = false
 	} else {
-		switch v := res.(type) {
-		case bool:
-			render = v
-		case string:
-			render = v != ""
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			render = v != 0
-		case float32, float64:
-			render = v != 0.0
-		case nil:
-			render = false
-		default:
-			// check if the value is a non-empty slice
-			rv := reflect.ValueOf(res)
-			if rv.Kind() == reflect.Slice && rv.Len() == 0 {
-				render = false
-			}
-			// check if the value is a non-empty map
-			if rv.Kind() == reflect.Map && rv.Len() == 0 {
-				render = false
-			}
-		}
+		render = truthy(res)
 	}
 
 	if render {
@@ -296,6 +709,41 @@ func (c *chtmlComponent) evalIf(n *Node) bool {
 	return render
 }
 
+// evalSwitch evaluates the c:switch expression of the node n once and marks the children with
+// the cases other than the first matching one as hidden. The c:case values are compared with
+// the same rules as the == operator of the expressions. The c:default case matches if no other
+// case does.
+func (c *chtmlComponent) evalSwitch(n *Node) {
+	if n.Switch.IsEmpty() {
+		return
+	}
+	v, err := c.eval(n.Switch)
+	if err != nil {
+		c.error(n, fmt.Errorf("eval c:switch: %w", err))
+	}
+	matched := err != nil // no case is rendered if the value is unknown
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Case.IsEmpty() && !child.CaseDefault {
+			continue
+		}
+		if !matched {
+			if child.CaseDefault {
+				matched = true
+				continue
+			}
+			cv, err := c.eval(child.Case)
+			if err != nil {
+				c.error(child, fmt.Errorf("eval c:case: %w", err))
+			} else if runtime.Equal(v, cv) {
+				matched = true
+				continue
+			}
+		}
+		c.hidden[child] = struct{}{}
+		c.closeChildren(child, 0)
+	}
+}
+
 // evalFor evaluates the loop expression (c:for) for the given node and updates the environment
 // with the loop variables.
 // If no loop expression is present, the function return true only once (assuming that the node
@@ -307,66 +755,170 @@ func (c *chtmlComponent) evalFor(n *Node) iter.Seq[*chtmlComponent] {
 		}
 	}
 
-	res, err := n.Loop.Value(&c.vm, c.env)
+	res, err := c.eval(n.Loop)
 	if err != nil {
 		c.error(n, fmt.Errorf("eval c:for: %w", err))
 		c.closeChildren(n, 0)
 		return func(yield func(*chtmlComponent) bool) {}
 	}
-	v := reflect.ValueOf(res)
-	// TODO: add support for maps, structs, arrays
-	if v.Kind() != reflect.Slice {
-		c.error(n, fmt.Errorf("c:for expression must return slice"))
+	items, ok := loopItems(res)
+	if !ok {
+		c.error(n, fmt.Errorf("c:for expression must return slice or sequence"))
 		c.closeChildren(n, 0)
 		return func(yield func(*chtmlComponent) bool) {}
 	}
 
+	items = recoverSeq(items, func(err error) {
+		c.error(n, fmt.Errorf("eval c:for: %w", err))
+	})
+
 	return func(yield func(*chtmlComponent) bool) {
+		// the components of a keyed loop are reused by the item keys: the components of
+		// the previous render are taken out of the children and put back in the order of the items
+		var byKey map[any]*chtmlComponent
+		var seen map[any]struct{}
+		if !n.LoopKey.IsEmpty() {
+			byKey = make(map[any]*chtmlComponent, len(c.children[n]))
+			for _, comp := range c.children[n] {
+				if lc, ok := comp.(*chtmlComponent); ok {
+					byKey[lc.loopKey] = lc
+				}
+			}
+			delete(c.children, n)
+			seen = make(map[any]struct{})
+		}
+
+		count := 0
 		defer func() {
-			c.closeChildren(n, v.Len()) // close remaining children
+			if byKey == nil {
+				c.closeChildren(n, count) // close remaining children
+				return
+			}
+			for _, lc := range byKey {
+				if err := lc.Dispose(); err != nil {
+					c.error(n, fmt.Errorf("dispose child %v: %w", lc.loopKey, err))
+				}
+			}
 		}()
 
-		for i := 0; i < v.Len(); i++ {
-			el := v.Index(i)
+		for el := range items {
+			i := count
+			count++
 
 			// make a copy of the current environment with the loop variable
-			loopEnv := make(map[string]any)
+			if !c.arena.Alloc(int64(len(c.env)+2) * envEntryCost) {
+				return
+			}
+			loopEnv := c.arena.newEnv()
 			for k, v := range c.env {
 				loopEnv[k] = v
 			}
-			loopEnv[n.LoopVar] = el.Interface()
+			loopEnv[n.LoopVar] = el
 
 			if n.LoopIdx != "" {
 				loopEnv[n.LoopIdx] = i
 			}
 
+			var key any
+			if byKey != nil {
+				var ok bool
+				if key, ok = c.evalKey(n, loopEnv); !ok {
+					continue
+				}
+				if _, dup := seen[key]; dup {
+					c.error(n, fmt.Errorf("duplicate c:key %v", key))
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+
 			var loopComp *chtmlComponent
-			if i < len(c.children[n]) {
-				if c, ok := c.children[n][i].(*chtmlComponent); ok {
-					loopComp = c
+			if byKey != nil && byKey[key] != nil {
+				loopComp = byKey[key]
+				delete(byKey, key)
+				c.children[n] = append(c.children[n], loopComp)
+			} else if byKey == nil && i < len(c.children[n]) {
+				if lc, ok := c.children[n][i].(*chtmlComponent); ok {
+					loopComp = lc
 				} else {
 					c.error(n, fmt.Errorf("unexpected node type: %T", c.children[n][i]))
 					continue
 				}
+			}
+			if loopComp != nil {
+				loopComp.scope = c.scope
+				loopComp.env = loopEnv
+				loopComp.arena = c.arena
 			} else {
-				loopComp = &chtmlComponent{
-					doc:            n,
-					scope:          c.scope,
-					env:            loopEnv,
-					importer:       c.importer,
-					renderComments: true,
-					hidden:         c.hidden,
-					children:       make(map[*Node][]Component),
-					errs:           nil,
+				// the items of a parallel loop are rendered concurrently, they can't share the state
+				hidden := c.hidden
+				if n.LoopParallel > 1 {
+					hidden = make(map[*Node]struct{})
 				}
+				loopComp = c.spawnChild(n, loopEnv)
+				loopComp.hidden = hidden
+				loopComp.loopKey = key
 				c.children[n] = append(c.children[n], loopComp)
 			}
+			if n.LoopParallel <= 1 {
+				loopComp.diff = c.diff // the items of a parallel loop are not tracked
+			}
 
-			yield(loopComp)
+			if !yield(loopComp) {
+				return
+			}
 		}
 	}
 }
 
+// evalKey evaluates the c:key expression of the loop node n for the item with the environment
+// loopEnv. It returns false if the key can't be evaluated or is not comparable.
+func (c *chtmlComponent) evalKey(n *Node, loopEnv map[string]any) (any, bool) {
+	saved := c.env
+	c.env = loopEnv
+	key, err := c.eval(n.LoopKey)
+	c.env = saved
+	if err != nil {
+		c.error(n, fmt.Errorf("eval c:key: %w", err))
+		return nil, false
+	}
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		c.error(n, fmt.Errorf("c:key must be comparable, got %T", key))
+		return nil, false
+	}
+	return key, true
+}
+
+// loopItems returns the elements of a slice or a sequence for c:for. The sequences are consumed
+// lazily, one element per loop iteration.
+func loopItems(v any) (iter.Seq[any], bool) {
+	if seq, ok := asSeq(v); ok {
+		return seq, true
+	}
+	// TODO: add support for maps, structs, arrays
+	rv := reflect.ValueOf(v)
+	if rv.CanInt() {
+		// c:for="i in n" repeats the element n times, i is from 0 to n-1
+		return func(yield func(any) bool) {
+			for i := 0; i < int(rv.Int()); i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		}, true
+	}
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	return func(yield func(any) bool) {
+		for i := 0; i < rv.Len(); i++ {
+			if !yield(rv.Index(i).Interface()) {
+				return
+			}
+		}
+	}, true
+}
+
 func (c *chtmlComponent) scopeHasVar(v string) bool {
 	_, ok := c.scope.Vars()[v]
 	return ok
@@ -191,6 +191,45 @@ func TestRenderCHTML(t *testing.T) {
 			text: `<c:attr name="numbers">${[1,2,3]}</c:attr><p c:for="i in numbers">${i}</p>`,
 			want: `<p>1</p><p>2</p><p>3</p>`,
 		},
+		{
+			name: "render c:for with loop var in attrs",
+			text: `<ul><li c:for="w, i in ['a', 'b']" title="${w}" data-i="${i}">${w}</li></ul>`,
+			want: `<ul><li title="a" data-i="0">a</li><li title="b" data-i="1">b</li></ul>`,
+		},
+		{
+			name: "render c:attr with dynamic name",
+			text: `<c:attr name="k">${"x"}</c:attr><p><c:attr name="${'data-' + k}">v</c:attr>` +
+				`<c:attr name="${nil}">omitted</c:attr>a</p>`,
+			want: `<p data-x="v">a</p>`,
+		},
+		{
+			name: "render c:attr in c:for",
+			text: `<p><c:attr c:for="k, i in ['a', 'b']" name="${'data-' + k}">${i}</c:attr>a</p>`,
+			want: `<p data-a="0" data-b="1">a</p>`,
+		},
+		{
+			name: "render c:switch",
+			text: `<c:attr name="role">${"editor"}</c:attr><div c:switch="role">` +
+				`<p c:case="'admin'">admin</p> <p c:case="'editor'">editor</p> <p c:default>guest</p></div>`,
+			want: `<div> <p>editor</p> </div>`,
+		},
+		{
+			name: "render c:switch default",
+			text: `<ul><li c:for="n in [1, 2, 3]" c:switch="n % 3">` +
+				`<b c:case="1">one</b><b c:case="2">two</b><i c:default>${n}</i></li></ul>`,
+			want: `<ul><li><b>one</b></li><li><b>two</b></li><li><i>3</i></li></ul>`,
+		},
+		{
+			name: "render c:switch without match",
+			text: `<p c:switch="1 + 1"><b c:case="1">one</b><b c:case="3">three</b></p>`,
+			want: `<p></p>`,
+		},
+		{
+			name: "render c:for over a range",
+			text: `<c:attr name="n">${3}</c:attr><p c:for="i in 1..3">${i * 2}</p>` +
+				`<b c:for="i in range(n)">${i}</b><i c:for="i in range(2, 4)">${i}</i><u c:for="i in n">${i}</u>`,
+			want: `<p>2</p><p>4</p><p>6</p><b>0</b><b>1</b><b>2</b><i>2</i><i>3</i><u>0</u><u>1</u><u>2</u>`,
+		},
 		{
 			name: "render nested c:for",
 			text: `<ul c:for="i in [1, 2]"><li c:for="j in [3, 4]">${ i }-${ j }</li></ul>`,
@@ -274,6 +313,28 @@ func TestRenderCHTMLImports(t *testing.T) {
 			text: `<c:attr name="content"><p>Lorem ipsum</p></c:attr>${content}${content}`,
 			want: `<p>Lorem ipsum</p><p>Lorem ipsum</p>`,
 		},
+		{
+			name: "import bound to variable",
+			text: `<c:form as="f" />${len(f.errors)}: ${f.errors[0]}`,
+			want: `1: required`,
+		},
+		{
+			name: "import bound with c:var",
+			text: `<c:form c:var="f"></c:form><p c:if="!f.valid">${f.errors[0]}</p>`,
+			want: `<p>required</p>`,
+		},
+		{
+			name: "named slots",
+			text: `<c:card><c:slot name="header"><h1>Title</h1></c:slot><p>body</p>` +
+				`<c:slot name="footer">end</c:slot></c:card>`,
+			want: `<div><header><h1>Title</h1></header><p>body</p><footer>end</footer></div>`,
+		},
+		{
+			name: "unfilled and concatenated slots",
+			text: `<c:card><c:slot name="header">a</c:slot><c:slot name="header">b</c:slot>` +
+				`<c:slot c:if="false" name="footer">end</c:slot></c:card>`,
+			want: `<div><header>ab</header><footer>none</footer></div>`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -294,6 +355,90 @@ func TestRenderCHTMLImports(t *testing.T) {
 	}
 }
 
+func TestRenderComments(t *testing.T) {
+	text := `<!--[if IE]><p>IE</p><![endif]--><!-- #keep ${1+1} --><!-- note -->` +
+		`<p c:for="x in [1]"><!--#keep ${x}--><!-- x=${x} --></p>`
+
+	tests := []struct {
+		name string
+		opts *ComponentOptions
+		want any
+	}{
+		{
+			name: "keep all",
+			opts: &ComponentOptions{RenderComments: true},
+			want: `<!--[if IE]><p>IE</p><![endif]--><!-- #keep 2 --><!-- note --><p><!--#keep 1--><!-- x=1 --></p>`,
+		},
+		{
+			name: "strip all",
+			opts: &ComponentOptions{RenderComments: false},
+			want: `<p></p>`,
+		},
+		{
+			name: "keep by prefix",
+			opts: &ComponentOptions{KeepComments: []string{"[if ", "#keep"}},
+			want: `<!--[if IE]><p>IE</p><![endif]--><!-- #keep 2 --><p><!--#keep 1--></p>`,
+		},
+		{
+			name: "keep by predicate",
+			opts: &ComponentOptions{KeepComment: func(text string) bool {
+				return strings.Contains(text, "x=")
+			}},
+			want: `<p><!-- x=1 --></p>`,
+		},
+		{
+			name: "keep directives",
+			opts: &ComponentOptions{KeepComment: DirectiveComment},
+			want: `<!--[if IE]><p>IE</p><![endif]--><!-- #keep 2 --><p><!--#keep 1--></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(text, tt.want, nil, tt.opts); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDirectiveComment(t *testing.T) {
+	for text, want := range map[string]bool{
+		"[if IE]><p>IE</p><![endif]": true,
+		"<![endif]":                  true,
+		" #include virtual=\"/x\" ":  true,
+		"! license":                  true,
+		" note ":                     false,
+		"":                           false,
+	} {
+		if got := DirectiveComment(text); got != want {
+			t.Errorf("DirectiveComment(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestRenderRawComments(t *testing.T) {
+	doc, err := ParseWithOptions(strings.NewReader(`<!-- ${secret} --><p>${1+1}</p>`), nil, &ParseOptions{
+		RawComments: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewComponent(doc, &ComponentOptions{RenderComments: true}).Render(NewBaseScope(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := html.Render(&buf, rr.(*html.Node)); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<!-- ${secret} --><p>2</p>`; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
 func testRenderCase(text string, want any, vars map[string]any, opts *ComponentOptions) (err error) {
 	var imp Importer
 	if opts != nil {
@@ -348,6 +493,8 @@ func (t *testImporter) init() {
 		"comp2": `<c:attr name="text">Hello</c:attr><p>${text}</p>`,
 		"simple-page": `<c:attr name="title">Website</c:attr>` +
 			`<html><head><title>${title}</title></head><body>${_}</body></html>`,
+		"form": `${ {"valid": false, "errors": ["required"]} }`,
+		"card": `<div><header>${slot('header')}</header>${_}<footer>${slot('footer') ?? 'none'}</footer></div>`,
 	}
 
 	t.parsedComps = make(map[string]*Node)
@@ -368,3 +515,292 @@ func (t *testImporter) Import(name string) (Component, error) {
 
 	return nil, ErrComponentNotFound
 }
+
+func TestRenderConditionalAttrs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want any
+		vars map[string]any
+	}{
+		{
+			name: "nil omits the attribute",
+			text: `<c:attr name="page"></c:attr><a aria-current="${page == 'home' ? 'page' : nil}">Home</a>`,
+			want: `<a>Home</a>`,
+			vars: map[string]any{"page": "about"},
+		},
+		{
+			name: "non-nil keeps the attribute",
+			text: `<c:attr name="page"></c:attr><a aria-current="${page == 'home' ? 'page' : nil}">Home</a>`,
+			want: `<a aria-current="page">Home</a>`,
+			vars: map[string]any{"page": "home"},
+		},
+		{
+			name: "empty static attributes are kept",
+			text: `<input disabled class="">`,
+			want: `<input disabled="" class=""/>`,
+		},
+		{
+			name: "boolean attribute false",
+			text: `<input disabled="${false}" required="${1 > 2}">`,
+			want: `<input/>`,
+		},
+		{
+			name: "boolean attribute true",
+			text: `<input disabled="${true}" CHECKED="${true}">`,
+			want: `<input disabled="" checked=""/>`,
+		},
+		{
+			name: "booleans in regular attributes",
+			text: `<div aria-hidden="${true}" data-flag="${false}"></div>`,
+			want: `<div aria-hidden="true" data-flag="false"></div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(tt.text, tt.want, tt.vars, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenderSpreadAttrs(t *testing.T) {
+	const text = `<c:attr name="attrs"></c:attr><button type="button" class="btn" c:attrs="${attrs}">OK</button>`
+
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "added in the order of the names",
+			vars: map[string]any{"attrs": map[string]any{"title": `say "hi"`, "data-id": 1}},
+			want: `<button type="button" class="btn" data-id="1" title="say &#34;hi&#34;">OK</button>`,
+		},
+		{
+			name: "override",
+			vars: map[string]any{"attrs": map[string]string{"Type": "submit", "class": "btn btn-primary"}},
+			want: `<button type="submit" class="btn btn-primary">OK</button>`,
+		},
+		{
+			name: "boolean attributes",
+			vars: map[string]any{"attrs": map[string]any{"disabled": true, "autofocus": false, "aria-pressed": false}},
+			want: `<button type="button" class="btn" aria-pressed="false" disabled="">OK</button>`,
+		},
+		{
+			name: "nil removes the attribute",
+			vars: map[string]any{"attrs": map[string]any{"type": nil, "class": nil}},
+			want: `<button>OK</button>`,
+		},
+		{
+			name: "nil map",
+			vars: map[string]any{"attrs": nil},
+			want: `<button type="button" class="btn">OK</button>`,
+		},
+		{
+			name: "loop variable",
+			text: `<c:attr name="items"></c:attr><ul><li c:for="item in items" c:attrs="${item}">x</li></ul>`,
+			vars: map[string]any{"items": []any{map[string]any{"id": "a"}, map[string]any{"hidden": true}}},
+			want: `<ul><li id="a">x</li><li hidden="">x</li></ul>`,
+		},
+		{
+			name:    "invalid name",
+			vars:    map[string]any{"attrs": map[string]any{"x onclick": "alert(1)", "id": "b"}},
+			want:    `<button type="button" class="btn" id="b">OK</button>`,
+			wantErr: `invalid attribute name "x onclick"`,
+		},
+		{
+			name:    "not a map",
+			vars:    map[string]any{"attrs": "id=b"},
+			want:    `<button type="button" class="btn">OK</button>`,
+			wantErr: `c:attrs: expected a map with string keys, got string`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.text
+			if src == "" {
+				src = text
+			}
+			doc, err := Parse(strings.NewReader(src), nil)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rr, err := NewComponent(doc, nil).Render(NewBaseScope(tt.vars))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			var sb strings.Builder
+			if err := html.Render(&sb, AnyToHtml(rr)); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse(strings.NewReader(`<c:foo c:attrs="${{}}"></c:foo>`), nil); err == nil {
+		t.Error("want an error for c:attrs on an import")
+	}
+}
+
+func TestRenderClassStyle(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "class map",
+			text: `<c:attr name="active">${false}</c:attr><li class="${{'item': true, 'active': active, 'hidden': !active}}"></li>`,
+			vars: map[string]any{"active": true},
+			want: `<li class="active item"></li>`,
+		},
+		{
+			name: "class list",
+			text: `<c:attr name="extra"></c:attr><li class="${['item', extra, {'first': true}, ['a b', nil, 'item']]}"></li>`,
+			vars: map[string]any{"extra": ""},
+			want: `<li class="item first a b"></li>`,
+		},
+		{
+			name: "empty class list omits the attribute",
+			text: `<li class="${{'active': false}}"></li>`,
+			want: `<li></li>`,
+		},
+		{
+			name: "style map",
+			text: `<c:attr name="color"></c:attr><p style="${{'color': color, 'margin-top': '1em', 'display': nil, '--gap': 2}}"></p>`,
+			vars: map[string]any{"color": "red"},
+			want: `<p style="--gap: 2; color: red; margin-top: 1em"></p>`,
+		},
+		{
+			name: "empty style map omits the attribute",
+			text: `<p style="${{'color': ''}}"></p>`,
+			want: `<p></p>`,
+		},
+		{
+			name: "strings are kept",
+			text: `<p class="${'a  b'}" style="${'color: red'}"></p>`,
+			want: `<p class="a  b" style="color: red"></p>`,
+		},
+		{
+			name:    "invalid style value",
+			text:    `<c:attr name="color"></c:attr><p style="${{'color': color}}"></p>`,
+			vars:    map[string]any{"color": "red; background: url(x)"},
+			want:    `<p></p>`,
+			wantErr: `invalid value of CSS property color`,
+		},
+		{
+			name:    "invalid style property",
+			text:    `<p style="${{'color:red;x': 1}}"></p>`,
+			want:    `<p></p>`,
+			wantErr: `invalid CSS property`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.text), nil)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rr, err := NewComponent(doc, &ComponentOptions{StrictCoercion: true}).Render(NewBaseScope(tt.vars))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			var sb strings.Builder
+			if err := html.Render(&sb, AnyToHtml(rr)); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderAttrNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "computed name",
+			text: `<c:attr name="key">x</c:attr><div><c:attr name="${key}">1</c:attr></div>`,
+			vars: map[string]any{"key": "data-id"},
+			want: `<div data-id="1"></div>`,
+		},
+		{
+			name:    "name with space",
+			text:    `<c:attr name="key">x</c:attr><div><c:attr name="${key}">1</c:attr></div>`,
+			vars:    map[string]any{"key": `x onclick`},
+			want:    `<div></div>`,
+			wantErr: `invalid attribute name "x onclick"`,
+		},
+		{
+			name:    "name with quote",
+			text:    `<c:attr name="key">x</c:attr><div><c:attr name="${key}">1</c:attr></div>`,
+			vars:    map[string]any{"key": `a"b`},
+			want:    `<div></div>`,
+			wantErr: `invalid attribute name "a\"b"`,
+		},
+		{
+			name:    "empty name",
+			text:    `<c:attr name="key">x</c:attr><div><c:attr name="${key}">1</c:attr></div>`,
+			vars:    map[string]any{"key": ""},
+			want:    `<div></div>`,
+			wantErr: `invalid attribute name ""`,
+		},
+		{
+			name: "namespaced in SVG",
+			text: `<svg><use xlink:href="#a"><c:attr name="xml:lang">en</c:attr></use></svg>`,
+			want: `<svg><use xlink:href="#a" xml:lang="en"></use></svg>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.text), nil)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rr, err := NewComponent(doc, nil).Render(NewBaseScope(tt.vars))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if tt.wantErr != "" {
+				var ce *ComponentError
+				if !errors.As(err, &ce) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want a component error %q", err, tt.wantErr)
+				}
+				if ce.HTMLContext() == "" {
+					t.Errorf("error has no template context")
+				}
+			}
+			var sb strings.Builder
+			if err := html.Render(&sb, AnyToHtml(rr)); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package chtml
+
+import "sync"
+
+// RenderContext defines the lifecycle contract between the host (e.g. an HTTP handler) and the
+// components running background updaters - goroutines calling Scope.Touch after Render returns.
+//
+// The contract is as follows:
+//   - the callbacks registered with AfterRender run once, after the output of the current render
+//     pass has been written to the client. Starting updaters from there guarantees that the
+//     re-render triggered by Touch is not lost or merged into the pass being written;
+//   - the goroutines started with Go must return when the Done channel is closed;
+//   - the host calls Close when the page is not going to be rendered anymore. Close closes
+//     the Done channel and waits for the goroutines started with Go, and only then the
+//     components are disposed. Touch calls after Close are ignored by the host.
+//
+// A RenderContext is made available to the components via a Scope implementing the
+// RenderContextScope interface. A nil *RenderContext is valid: AfterRender callbacks are called
+// immediately, Go starts an untracked goroutine and Done never closes.
+type RenderContext struct {
+	mu     sync.Mutex
+	after  []func()
+	done   chan struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// RenderContextScope is an optional interface for Scope implementations carrying
+// a RenderContext.
+type RenderContextScope interface {
+	Scope
+
+	// RenderContext returns the render context of the page or nil.
+	RenderContext() *RenderContext
+}
+
+// NewRenderContext creates a RenderContext.
+func NewRenderContext() *RenderContext {
+	return &RenderContext{done: make(chan struct{})}
+}
+
+// RenderContextOf returns the RenderContext carried by the scope or nil.
+func RenderContextOf(s Scope) *RenderContext {
+	if rs, ok := s.(RenderContextScope); ok {
+		return rs.RenderContext()
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the page is not going to be rendered anymore.
+func (rc *RenderContext) Done() <-chan struct{} {
+	if rc == nil {
+		return nil
+	}
+	return rc.done
+}
+
+// AfterRender registers fn to be called once after the output of the current render pass has
+// been written. The callbacks registered after Close are ignored.
+func (rc *RenderContext) AfterRender(fn func()) {
+	if rc == nil {
+		fn()
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if !rc.closed {
+		rc.after = append(rc.after, fn)
+	}
+}
+
+// Go runs fn in a new goroutine tracked by the context. The function must return when the Done
+// channel is closed. Go does nothing after Close.
+func (rc *RenderContext) Go(fn func()) {
+	if rc == nil {
+		go fn()
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return
+	}
+	rc.wg.Add(1)
+	go func() {
+		defer rc.wg.Done()
+		fn()
+	}()
+}
+
+// Flush runs the AfterRender callbacks registered so far. It is called by the host after the
+// output of a render pass has been written.
+func (rc *RenderContext) Flush() {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	after := rc.after
+	rc.after = nil
+	rc.mu.Unlock()
+
+	for _, fn := range after {
+		fn()
+	}
+}
+
+// Close closes the Done channel, drops the pending AfterRender callbacks and waits for the
+// goroutines started with Go to return. It is called by the host before disposing the components.
+func (rc *RenderContext) Close() {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	if !rc.closed {
+		rc.closed = true
+		rc.after = nil
+		close(rc.done)
+	}
+	rc.mu.Unlock()
+
+	rc.wg.Wait()
+}
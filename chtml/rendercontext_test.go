@@ -0,0 +1,77 @@
+package chtml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderContext(t *testing.T) {
+	rc := NewRenderContext()
+	s := NewBaseScope(nil)
+
+	started := make(chan struct{})
+	stopped := false
+
+	rc.AfterRender(func() {
+		rc.Go(func() {
+			close(started)
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.Touch()
+				case <-rc.Done():
+					stopped = true
+					return
+				}
+			}
+		})
+	})
+
+	select {
+	case <-started:
+		t.Fatal("AfterRender callback is called before Flush")
+	default:
+	}
+
+	rc.Flush()
+	<-started
+	<-s.Touched()
+
+	rc.Flush() // callbacks run only once
+
+	rc.Close()
+	if !stopped {
+		t.Error("Close returned before the goroutine stopped")
+	}
+
+	// no-ops after Close
+	called := false
+	rc.AfterRender(func() { called = true })
+	rc.Go(func() { called = true })
+	rc.Flush()
+	rc.Close()
+	if called {
+		t.Error("callbacks must not be called after Close")
+	}
+}
+
+func TestRenderContextNil(t *testing.T) {
+	var rc *RenderContext
+
+	if RenderContextOf(NewBaseScope(nil)) != nil {
+		t.Error("BaseScope has no render context")
+	}
+
+	called := false
+	rc.AfterRender(func() { called = true })
+	if !called {
+		t.Error("AfterRender on nil context must call the callback immediately")
+	}
+	if rc.Done() != nil {
+		t.Error("Done on nil context must never close")
+	}
+	rc.Flush()
+	rc.Close()
+}
@@ -0,0 +1,149 @@
+package chtml
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizePolicy is an allowlist of the elements and attributes of the HTML produced by the
+// expressions, e.g. the untrusted content passed to unsafeHtml. Its Sanitize method is meant to
+// be used as ComponentOptions.Sanitize:
+//
+//	policy := &chtml.SanitizePolicy{
+//		Elements:   []string{"p", "a", "b", "i", "ul", "ol", "li", "code", "pre"},
+//		Attributes: map[string][]string{"a": {"href", "title"}, "*": {"class"}},
+//	}
+//	comp := chtml.NewComponent(doc, &chtml.ComponentOptions{Sanitize: policy.Sanitize})
+//
+// The elements not in the allowlist are replaced with their content, except for the elements
+// whose content is not text (e.g. <script> and <style>), which are removed entirely.
+type SanitizePolicy struct {
+	// Elements are the names of the allowed elements.
+	Elements []string
+
+	// Attributes are the names of the allowed attributes by element name. The attributes listed
+	// under "*" are allowed for all the allowed elements.
+	Attributes map[string][]string
+
+	// URLSchemes are the allowed schemes of the URL attributes (e.g. href and src). The relative
+	// URLs are always allowed. Defaults to http, https and mailto.
+	URLSchemes []string
+
+	// AllowComments keeps the comments, they are removed by default.
+	AllowComments bool
+}
+
+// droppedElements are the elements removed with their content if they are not allowed.
+var droppedElements = []string{
+	"script", "style", "template", "iframe", "object", "embed", "noscript", "noembed",
+	"noframes", "textarea", "title", "xmp", "svg", "math",
+}
+
+// urlAttributes are the attributes holding a URL, their schemes are checked.
+var urlAttributes = []string{
+	"href", "src", "action", "formaction", "cite", "poster", "background", "longdesc", "xlink:href",
+}
+
+var defaultURLSchemes = []string{"http", "https", "mailto"}
+
+// Sanitize removes the elements, attributes and comments not allowed by the policy from the
+// children of n. It never fails, the error is returned to match ComponentOptions.Sanitize.
+func (p *SanitizePolicy) Sanitize(n *html.Node) error {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch child.Type {
+		case html.ElementNode:
+			next = p.sanitizeElement(child)
+		case html.CommentNode:
+			if !p.AllowComments {
+				n.RemoveChild(child)
+			}
+		case html.DoctypeNode:
+			n.RemoveChild(child)
+		}
+		child = next
+	}
+	return nil
+}
+
+// sanitizeElement sanitizes the element and returns the node to continue with: the first
+// child of the unwrapped element or its next sibling.
+func (p *SanitizePolicy) sanitizeElement(n *html.Node) *html.Node {
+	parent, next := n.Parent, n.NextSibling
+	if !slices.Contains(p.Elements, n.Data) {
+		if slices.Contains(droppedElements, n.Data) {
+			parent.RemoveChild(n)
+			return next
+		}
+		// unwrap the element, its children are sanitized in place of it
+		first := n.FirstChild
+		for child := n.FirstChild; child != nil; child = n.FirstChild {
+			n.RemoveChild(child)
+			parent.InsertBefore(child, n)
+		}
+		parent.RemoveChild(n)
+		if first != nil {
+			return first
+		}
+		return next
+	}
+
+	n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+		return !p.allowAttr(n.Data, a)
+	})
+	_ = p.Sanitize(n)
+	return next
+}
+
+// allowAttr reports whether the attribute of the element is allowed.
+func (p *SanitizePolicy) allowAttr(elem string, a html.Attribute) bool {
+	key := a.Key
+	if a.Namespace != "" {
+		key = a.Namespace + ":" + a.Key
+	}
+	if !slices.Contains(p.Attributes[elem], key) && !slices.Contains(p.Attributes["*"], key) {
+		return false
+	}
+	if slices.Contains(urlAttributes, key) {
+		return p.allowURL(a.Val)
+	}
+	return true
+}
+
+// allowURL reports whether the URL is relative or has one of the allowed schemes.
+func (p *SanitizePolicy) allowURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		return true
+	}
+	schemes := p.URLSchemes
+	if schemes == nil {
+		schemes = defaultURLSchemes
+	}
+	return slices.Contains(schemes, strings.ToLower(u.Scheme))
+}
+
+// sanitizeHTML passes a copy of the HTML produced by an expression to the Sanitize hook, so the
+// values shared between the renders (e.g. the data of the scope) are not modified. The copy is
+// wrapped in a document node, so the hook can remove any of the top-level nodes.
+func (c *chtmlComponent) sanitizeHTML(n *html.Node) (*html.Node, error) {
+	doc := cloneHtmlTree(n)
+	if doc.Type != html.DocumentNode {
+		wrapped := &html.Node{Type: html.DocumentNode}
+		wrapped.AppendChild(doc)
+		doc = wrapped
+	}
+	if err := c.sanitize(doc); err != nil {
+		return nil, err
+	}
+	if doc.FirstChild == nil {
+		return nil, nil
+	}
+	return doc, nil
+}
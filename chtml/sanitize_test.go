@@ -0,0 +1,96 @@
+package chtml
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSanitizePolicy(t *testing.T) {
+	policy := &SanitizePolicy{
+		Elements:   []string{"p", "a", "b"},
+		Attributes: map[string][]string{"a": {"href"}, "*": {"class"}},
+	}
+	opts := &ComponentOptions{Sanitize: policy.Sanitize}
+	const text = `<c:attr name="s"></c:attr><div onclick="f()">${unsafeHtml(s)}</div>`
+
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "allowed",
+			s:    `<p class="x"><b>bold</b> <a href="/about">about</a></p>`,
+			want: `<div onclick="f()"><p class="x"><b>bold</b> <a href="/about">about</a></p></div>`,
+		},
+		{
+			name: "unwrapped elements",
+			s:    `<p><span><i>x</i> y</span></p>`,
+			want: `<div onclick="f()"><p>x y</p></div>`,
+		},
+		{
+			name: "dropped elements",
+			s:    `<b>x</b><script>alert(1)</script><style>p{}</style><!-- c -->`,
+			want: `<div onclick="f()"><b>x</b></div>`,
+		},
+		{
+			name: "attributes",
+			s:    `<a href="https://example.com" onclick="f()" id="a" class="c">x</a>`,
+			want: `<div onclick="f()"><a href="https://example.com" class="c">x</a></div>`,
+		},
+		{
+			name: "url schemes",
+			s:    `<a href="javascript:alert(1)">x</a><a href=" JavaScript:alert(1)">y</a>`,
+			want: `<div onclick="f()"><a>x</a><a>y</a></div>`,
+		},
+		{
+			name: "nothing allowed",
+			s:    `<script>alert(1)</script>`,
+			want: `<div onclick="f()"></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(text, tt.want, map[string]any{"s": tt.s}, opts); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestComponentSanitize(t *testing.T) {
+	const text = `<c:attr name="v"></c:attr><p>${v}</p>`
+	node := &html.Node{Type: html.ElementNode, Data: "i"}
+	node.AppendChild(&html.Node{Type: html.TextNode, Data: "x"})
+
+	// the hook receives a copy of the shared value
+	var got *html.Node
+	opts := &ComponentOptions{Sanitize: func(n *html.Node) error {
+		got = n
+		n.FirstChild.Data = "b"
+		return nil
+	}}
+	if err := testRenderCase(text, `<p><b>x</b></p>`, map[string]any{"v": node}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Type != html.DocumentNode {
+		t.Errorf("want a document node passed to the hook, got %v", got)
+	}
+	if node.Data != "i" {
+		t.Errorf("the value is modified: %q", node.Data)
+	}
+
+	// the text is not sanitized
+	if err := testRenderCase(text, `<p>&lt;i&gt;</p>`, map[string]any{"v": "<i>"}, opts); err != nil {
+		t.Error(err)
+	}
+
+	errRejected := errors.New("rejected")
+	opts = &ComponentOptions{Sanitize: func(*html.Node) error { return errRejected }}
+	err := testRenderCase(text, nil, map[string]any{"v": node}, opts)
+	if !errors.Is(err, errRejected) {
+		t.Errorf("want the error of the hook, got %v", err)
+	}
+}
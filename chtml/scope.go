@@ -1,6 +1,8 @@
 package chtml
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -35,10 +37,66 @@ type Scope interface {
 	Vars() map[string]any
 
 	// Touch marks the component as changed. The implementation should re-render the page
-	// when this method is called.
+	// when this method is called. Background goroutines calling Touch after Render returns
+	// should follow the RenderContext contract.
 	Touch()
 }
 
+// EnvProvider is an optional interface for Scope implementations to provide variables on
+// demand. It is useful for large scopes and lazily computed variables (e.g. expensive session
+// lookups): a variable is resolved only when an expression refers to it, at most once per
+// component render.
+//
+// The variables defined in the component (<c:attr>) or passed as arguments take precedence over
+// the provided ones.
+type EnvProvider interface {
+	// EnvNames returns the names of the provided variables. The parser declares them to
+	// type-check expressions, so the variables don't need to be declared with <c:attr>.
+	EnvNames() []string
+
+	// LookupEnv returns the value of the variable and true, or false if the variable is not
+	// provided.
+	LookupEnv(name string) (any, bool, error)
+}
+
+// EnvShaper is an optional interface for EnvProvider implementations declaring the shapes of the
+// provided variables to the parser: the example values the expressions are type checked
+// against, e.g. map[string]any{} for a map of any keys. The variables without a shape are of
+// unknown type and are not type checked.
+type EnvShaper interface {
+	// EnvShape returns the shape of the provided variable, or false if it is unknown.
+	EnvShape(name string) (any, bool)
+}
+
+// FunctionProvider is an optional interface for Scope implementations binding the functions of
+// the expressions to the scope, e.g. to change the response of the request the component is
+// rendered for. The functions are declared in ParseOptions.Functions and
+// ComponentOptions.Functions to type-check the expressions, and the bound ones replace them at
+// render time, so they must have the same signatures.
+type FunctionProvider interface {
+	// LookupFunction returns the function bound to the scope, or false to use the declared one.
+	LookupFunction(name string) (any, bool)
+}
+
+// ScopeWithContext is an optional interface for Scope implementations carrying the context of
+// the request the component is rendered for. The components making network calls or running
+// long computations should stop when the context is canceled, e.g. when the client disconnects.
+type ScopeWithContext interface {
+	Scope
+
+	// Context returns the context of the request. It is never nil.
+	Context() context.Context
+}
+
+// ContextOf returns the context carried by the scope, or context.Background() if the scope does
+// not implement ScopeWithContext.
+func ContextOf(s Scope) context.Context {
+	if cs, ok := s.(ScopeWithContext); ok {
+		return cs.Context()
+	}
+	return context.Background()
+}
+
 // BaseScope is a base implementation of the Scope interface. For extra functionality, this type
 // can be wrapped (embedded) in a custom scope implementation.
 type BaseScope struct {
@@ -81,7 +139,21 @@ func (s *BaseScope) Touched() <-chan struct{} {
 // UnmarshalScope reads the variables from the scope and converts them to a provided target.
 // The target must be a pointer to a struct or a map. The function returns an error if
 // the target is not a pointer or if the scope variables cannot be converted to the target.
+//
+// The strings are converted to the numbers, the bools and the durations leniently, e.g. an empty
+// string converts to zero, and a string other than "false", "0", etc. converts to true.
 func UnmarshalScope(s Scope, target any) error {
+	return unmarshalScope(s, target, false)
+}
+
+// UnmarshalScopeStrict is like UnmarshalScope, but returns an error on the ambiguous
+// conversions: an empty string to a number or a duration, and a string other than
+// the strconv.ParseBool values to a bool.
+func UnmarshalScopeStrict(s Scope, target any) error {
+	return unmarshalScope(s, target, true)
+}
+
+func unmarshalScope(s Scope, target any, strict bool) error {
 	targetValue := reflect.ValueOf(target)
 	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
 		return errors.New("target must be a non-nil pointer")
@@ -115,6 +187,11 @@ func UnmarshalScope(s Scope, target any) error {
 					val = reflect.Zero(fieldValue.Type())
 				}
 
+				if strict {
+					if err := checkCoercion(val, fieldValue); err != nil {
+						return fmt.Errorf("cannot decode value of field %s: %w", field.Name, err)
+					}
+				}
 				if d, err := decodeHook(val, fieldValue); err != nil {
 					return fmt.Errorf("cannot decode value of field %s: %w", field.Name, err)
 				} else {
@@ -153,6 +230,11 @@ func UnmarshalScope(s Scope, target any) error {
 				if mapValue.Kind() == reflect.Interface && !mapValue.IsNil() {
 					mapValue = mapValue.Elem()
 				}
+				if strict && mapValue.IsValid() {
+					if err := checkCoercion(val, mapValue); err != nil {
+						return fmt.Errorf("cannot decode value for map entry %q: %w", k, err)
+					}
+				}
 				decodedVal, err := decodeHook(val, mapValue)
 				if err != nil {
 					return fmt.Errorf("cannot decode value for map entry %q: %w", k, err)
@@ -224,6 +306,7 @@ var decodeHook = composeDecodeHookFunc(
 	decodeStrToReader,
 	decodeStrToBool,
 	decodeStrToDuration,
+	decodeStrToTime,
 	decodeStrToNum, // order matters, basic types should be decoded last
 )
 
@@ -253,6 +336,9 @@ func decodeStrToNum(from reflect.Value, to reflect.Value) (any, error) {
 		return from.Interface(), nil
 	}
 	str := from.String()
+	if str == "" && isNumberKind(to.Kind()) {
+		return reflect.Zero(to.Type()).Interface(), nil
+	}
 	var num any
 	var err error
 	switch to.Kind() {
@@ -275,21 +361,40 @@ func decodeStrToBool(from reflect.Value, to reflect.Value) (any, error) {
 	if from.Kind() != reflect.String || to.Kind() != reflect.Bool {
 		return from.Interface(), nil
 	}
-	return from.String() != "", nil
+	return strToBool(from.String()), nil
 }
 
 func decodeStrToDuration(from reflect.Value, to reflect.Value) (any, error) {
 	if from.Kind() != reflect.String || to.Type() != reflect.TypeOf(time.Duration(0)) {
 		return from.Interface(), nil
 	}
+	if from.String() == "" {
+		return time.Duration(0), nil
+	}
 	return time.ParseDuration(from.String())
 }
 
+func decodeStrToTime(from reflect.Value, to reflect.Value) (any, error) {
+	if from.Kind() != reflect.String || to.Type() != reflect.TypeOf(time.Time{}) {
+		return from.Interface(), nil
+	}
+	if from.String() == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, from.String())
+}
+
 func decodeStrToReader(from reflect.Value, to reflect.Value) (any, error) {
-	if from.Kind() != reflect.String || to.Type() != reflect.TypeOf((*io.Reader)(nil)).Elem() {
+	if to.Type() != reflect.TypeOf((*io.Reader)(nil)).Elem() {
 		return from.Interface(), nil
 	}
-	return strings.NewReader(from.String()), nil
+	if from.Kind() == reflect.String {
+		return strings.NewReader(from.String()), nil
+	}
+	if b, ok := from.Interface().([]byte); ok {
+		return bytes.NewReader(b), nil
+	}
+	return from.Interface(), nil
 }
 
 func composeDecodeHookFunc(fns ...decodeHookFunc) decodeHookFunc {
@@ -1,6 +1,7 @@
 package chtml
 
 import (
+	"context"
 	"io"
 	"strings"
 	"testing"
@@ -72,6 +73,12 @@ func TestBaseScope_Touch(t *testing.T) {
 	}
 }
 
+func TestContextOf(t *testing.T) {
+	if ctx := ContextOf(NewBaseScope(nil)); ctx != context.Background() {
+		t.Errorf("ContextOf(BaseScope) = %v, want context.Background()", ctx)
+	}
+}
+
 func TestUnmarshalScope(t *testing.T) {
 	tests := []struct {
 		name      string
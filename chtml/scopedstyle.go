@@ -0,0 +1,315 @@
+package chtml
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"golang.org/x/net/html"
+	a "golang.org/x/net/html/atom"
+)
+
+// Scoped styles apply to the elements of the component declaring them only:
+//
+//	<style scoped>
+//	  .title { color: red }
+//	</style>
+//	<h1 class="title">${title}</h1>
+//
+// The elements of the component (including the content passed to the imported components, but
+// not the elements rendered by them) get an attribute unique to the component, e.g.
+// data-c-5f2b1c0d, and the selectors of the scoped stylesheets are restricted to it:
+// .title[data-c-5f2b1c0d]. The attribute is added to the last compound selector, so
+// ".list li" matches the li elements of the component inside a .list element anywhere
+// on the page. The rules of @media, @supports, @container and @layer blocks are scoped too,
+// the @keyframes, @font-face and other at-rules are kept as is.
+//
+// A scoped stylesheet must be static, i.e. contain no ${...} expressions.
+
+// scopedStyleAttrPrefix is the prefix of the attributes marking the elements of a component with
+// scoped styles.
+const scopedStyleAttrPrefix = "data-c-"
+
+// errDynamicScopedStyle is reported for the scoped stylesheets with expressions.
+var errDynamicScopedStyle = errors.New("scoped <style> must not contain expressions")
+
+// scopeStyles rewrites the scoped stylesheets (<style scoped>) of the parsed document and marks
+// the elements of the component with the scope attribute.
+func (p *chtmlParser) scopeStyles() {
+	var styles []*Node
+	walkNodes(p.doc, func(n *Node) {
+		if n.Type == html.ElementNode && n.DataAtom == a.Style && hasAttr(n, "scoped") {
+			styles = append(styles, n)
+		}
+	})
+	if len(styles) == 0 {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(p.name))
+	for _, n := range styles {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			h.Write([]byte(c.Data.RawString()))
+		}
+	}
+	attr := fmt.Sprintf("%s%08x", scopedStyleAttrPrefix, h.Sum32())
+
+	for _, n := range styles {
+		n.Attr = removeAttr(n.Attr, "scoped")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.TextNode {
+				continue
+			}
+			if strings.Contains(c.Data.RawString(), leftDelim) {
+				p.error(n, errDynamicScopedStyle)
+				continue
+			}
+			c.Data = NewExprRaw(scopeCSS(c.Data.RawString(), "["+attr+"]"))
+		}
+	}
+
+	walkNodes(p.doc, func(n *Node) {
+		if n.Type == html.ElementNode && n.DataAtom != a.Style && !hasAttr(n, attr) {
+			n.Attr = append(n.Attr, Attribute{Key: attr})
+		}
+	})
+}
+
+// walkNodes calls fn for n and its descendants in depth-first order.
+func walkNodes(n *Node, fn func(*Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkNodes(c, fn)
+	}
+}
+
+func removeAttr(attrs []Attribute, key string) []Attribute {
+	res := attrs[:0]
+	for _, attr := range attrs {
+		if attr.Key != key {
+			res = append(res, attr)
+		}
+	}
+	return res
+}
+
+// scopeCSS restricts the selectors of the stylesheet with the attribute selector. The comments
+// are removed.
+func scopeCSS(css, attrSel string) string {
+	var b strings.Builder
+	scopeRules(&b, stripCSSComments(css), attrSel)
+	return b.String()
+}
+
+// scopeRules writes the rules of a stylesheet or of an at-rule block with the scoped selectors.
+func scopeRules(b *strings.Builder, css, attrSel string) {
+	for css != "" {
+		i := indexCSS(css, "{;}")
+		if i < 0 {
+			b.WriteString(css)
+			return
+		}
+		prelude := css[:i]
+		if css[i] != '{' {
+			// a statement at-rule (@import, @charset) or a stray character
+			b.WriteString(css[:i+1])
+			css = css[i+1:]
+			continue
+		}
+
+		end := matchingBrace(css, i)
+		closed := end < len(css)
+		block, rest := css[i+1:end], ""
+		if closed {
+			rest = css[end+1:]
+		}
+
+		name := strings.TrimSpace(prelude)
+		switch {
+		case !strings.HasPrefix(name, "@"):
+			b.WriteString(scopeSelectors(prelude, attrSel))
+			b.WriteString("{")
+			b.WriteString(block)
+		case hasAtRule(name, "@media", "@supports", "@container", "@layer", "@document"):
+			b.WriteString(prelude)
+			b.WriteString("{")
+			scopeRules(b, block, attrSel)
+		default: // @keyframes, @font-face, @page, etc.
+			b.WriteString(prelude)
+			b.WriteString("{")
+			b.WriteString(block)
+		}
+		if closed {
+			b.WriteString("}")
+		}
+		css = rest
+	}
+}
+
+// hasAtRule reports whether the at-rule prelude starts with one of the names.
+func hasAtRule(prelude string, names ...string) bool {
+	name, _, _ := strings.Cut(prelude, " ")
+	name, _, _ = strings.Cut(name, "(")
+	for _, n := range names {
+		if strings.EqualFold(strings.TrimSpace(name), n) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeSelectors adds the attribute selector to each selector of the comma-separated list.
+func scopeSelectors(list, attrSel string) string {
+	var b strings.Builder
+	for list != "" {
+		i := indexCSS(list, ",")
+		sel := list
+		if i >= 0 {
+			sel, list = list[:i], list[i+1:]
+		} else {
+			list = ""
+		}
+		b.WriteString(scopeSelector(sel, attrSel))
+		if i >= 0 {
+			b.WriteString(",")
+		}
+	}
+	return b.String()
+}
+
+// legacyPseudoElements are the pseudo-elements allowed with a single colon.
+var legacyPseudoElements = []string{":before", ":after", ":first-line", ":first-letter"}
+
+// scopeSelector adds the attribute selector to the last compound selector, before its
+// pseudo-element if any, e.g. "ul > li::marker" becomes "ul > li[data-c-1]::marker".
+func scopeSelector(sel, attrSel string) string {
+	trimmed := strings.TrimRight(sel, " \t\r\n\f")
+	if strings.TrimSpace(trimmed) == "" {
+		return sel
+	}
+	trailing := sel[len(trimmed):]
+
+	// the last compound selector starts after the last top-level combinator or whitespace
+	start := 0
+	for i := 0; i < len(trimmed); {
+		j := indexCSS(trimmed[i:], " \t\r\n\f>+~")
+		if j < 0 {
+			break
+		}
+		start = i + j + 1
+		i = start
+	}
+	compound := trimmed[start:]
+	if compound == "" {
+		return sel // a dangling combinator
+	}
+
+	at := len(compound)
+	for k := 0; k < len(compound); k++ {
+		j := indexCSS(compound[k:], ":")
+		if j < 0 {
+			break
+		}
+		k += j
+		if rest := strings.ToLower(compound[k:]); strings.HasPrefix(rest, "::") ||
+			hasAnyPrefix(rest, legacyPseudoElements) {
+			at = k
+			break
+		}
+	}
+	return trimmed[:start] + compound[:at] + attrSel + compound[at:] + trailing
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexCSS returns the index of the first of the chars in the CSS text outside of the strings,
+// the parentheses and the brackets, or -1.
+func indexCSS(css, chars string) int {
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '"' || c == '\'':
+			i = skipCSSString(css, i)
+		case c == '\\':
+			i++
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(chars, c) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// matchingBrace returns the index of the brace closing the one at i, or len(css) if there is
+// none.
+func matchingBrace(css string, i int) int {
+	depth := 0
+	for ; i < len(css); i++ {
+		switch css[i] {
+		case '"', '\'':
+			i = skipCSSString(css, i)
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+// skipCSSString returns the index of the quote closing the string starting at i.
+func skipCSSString(css string, i int) int {
+	quote := css[i]
+	for i++; i < len(css); i++ {
+		switch css[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return len(css)
+}
+
+// stripCSSComments removes the comments from the CSS text.
+func stripCSSComments(css string) string {
+	if !strings.Contains(css, "/*") {
+		return css
+	}
+	var b strings.Builder
+	for i := 0; i < len(css); i++ {
+		switch {
+		case css[i] == '"' || css[i] == '\'':
+			end := min(skipCSSString(css, i), len(css)-1)
+			b.WriteString(css[i : end+1])
+			i = end
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+		default:
+			b.WriteByte(css[i])
+		}
+	}
+	return b.String()
+}
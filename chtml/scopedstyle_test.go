@@ -0,0 +1,88 @@
+package chtml
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestScopeCSS(t *testing.T) {
+	const attr = "[data-c-1]"
+	tests := []struct {
+		name, css, want string
+	}{
+		{"simple", ".a { color: red }", ".a[data-c-1] { color: red }"},
+		{"list", "h1, h2 , .a > li{}", "h1[data-c-1], h2[data-c-1] , .a > li[data-c-1]{}"},
+		{"descendant", ".list li:hover {}", ".list li:hover[data-c-1] {}"},
+		{"pseudo-element", "a::before, p:first-line, li:not(.x)::marker {}",
+			"a[data-c-1]::before, p[data-c-1]:first-line, li:not(.x)[data-c-1]::marker {}"},
+		{"only pseudo-element", "::selection {}", "[data-c-1]::selection {}"},
+		{"functional pseudo-class", "li:nth-child(2n + 1) a:is(.x, .y) {}",
+			"li:nth-child(2n + 1) a:is(.x, .y)[data-c-1] {}"},
+		{"attributes and strings", `a[title="a, b{}"] { content: "}{" }`,
+			`a[title="a, b{}"][data-c-1] { content: "}{" }`},
+		{"media", "@media (max-width: 600px) { .a { b: c } .d, .e { f: g } }",
+			"@media (max-width: 600px) { .a[data-c-1] { b: c } .d[data-c-1], .e[data-c-1] { f: g } }"},
+		{"keyframes", "@keyframes spin { from { x: 0 } to { x: 1 } } .a { animation: spin }",
+			"@keyframes spin { from { x: 0 } to { x: 1 } } .a[data-c-1] { animation: spin }"},
+		{"statement at-rules", "@import url(x.css); .a {}", "@import url(x.css); .a[data-c-1] {}"},
+		{"comments", "/* a, b { } */ .a /* x */ {}", " .a[data-c-1]  {}"},
+		{"unclosed", ".a { b: c", ".a[data-c-1] { b: c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeCSS(tt.css, attr); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderScopedStyle(t *testing.T) {
+	text := `<style scoped>.title { color: red }</style><style>.global {}</style>` +
+		`<div><h1 class="title" c:for="x in [1, 2]">${x}</h1></div>`
+
+	doc, err := Parse(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	rr, err := NewComponent(doc, nil).Render(NewBaseScope(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteResult(&buf, rr, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	attr := regexp.MustCompile(`data-c-[0-9a-f]{8}`).FindString(buf.String())
+	if attr == "" {
+		t.Fatalf("no scope attribute in %s", buf.String())
+	}
+	want := `<style>.title[` + attr + `] { color: red }</style><style>.global {}</style>` +
+		`<div ` + attr + `=""><h1 class="title" ` + attr + `="">1</h1><h1 class="title" ` + attr +
+		`="">2</h1></div>`
+	if buf.String() != want {
+		t.Errorf("got  %s\nwant %s", buf.String(), want)
+	}
+
+	// the scope is unique to the component
+	other, err := ParseWithOptions(strings.NewReader(text), nil, &ParseOptions{Name: "other.chtml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasAttr(other.LastChild, attr) {
+		t.Errorf("the components have the same scope %s", attr)
+	}
+}
+
+func TestParseScopedStyleErrors(t *testing.T) {
+	text := `<c:attr name="c"></c:attr><style scoped>.a { color: ${c} }</style>`
+	_, err := Parse(strings.NewReader(text), nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := checkErrors(err, []string{"style: scoped <style> must not contain expressions"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,67 @@
+package chtml
+
+import (
+	"iter"
+	"reflect"
+)
+
+// Components may return lazy sequences (iter.Seq[T]) instead of slices to stream large result
+// sets through the rendering without materializing them. The sequences are understood by c:for
+// and are rendered as a list of their elements otherwise.
+
+// asSeq returns the value as a sequence if it is an iterator function (iter.Seq[T] or an
+// equivalent unnamed function type).
+func asSeq(v any) (iter.Seq[any], bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case iter.Seq[any]:
+		return v, true
+	case func(yield func(any) bool):
+		return v, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if !isSeqType(rv.Type()) || rv.IsNil() {
+		return nil, false
+	}
+	return func(yield func(any) bool) {
+		for el := range rv.Seq() {
+			if !yield(el.Interface()) {
+				return
+			}
+		}
+	}, true
+}
+
+// isSeqType reports whether t is a func(yield func(T) bool) type.
+func isSeqType(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	y := t.In(0)
+	return y.Kind() == reflect.Func && y.NumIn() == 1 && y.NumOut() == 1 && y.Out(0).Kind() == reflect.Bool
+}
+
+// recoverSeq wraps the sequence to recover from the panics raised by the sequence itself and
+// report them as *PanicError to onErr. The panics raised by the loop body are propagated.
+func recoverSeq(seq iter.Seq[any], onErr func(error)) iter.Seq[any] {
+	return func(yield func(any) bool) {
+		inBody := false
+		defer func() {
+			if r := recover(); r != nil {
+				if inBody {
+					panic(r)
+				}
+				onErr(&PanicError{Value: r})
+			}
+		}()
+
+		seq(func(el any) bool {
+			inBody = true
+			ok := yield(el)
+			inBody = false
+			return ok
+		})
+	}
+}
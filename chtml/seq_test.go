@@ -0,0 +1,93 @@
+package chtml
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderSeq(t *testing.T) {
+	countTo := func(n int) iter.Seq[int] {
+		return func(yield func(int) bool) {
+			for i := 1; i <= n; i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want any
+		vars map[string]any
+	}{
+		{
+			name: "c:for over iter.Seq[any]",
+			text: `<c:attr name="items"></c:attr><ul><li c:for="x, i in items">${i}:${x}</li></ul>`,
+			want: "<ul><li>0:a</li><li>1:b</li></ul>",
+			vars: map[string]any{"items": iter.Seq[any](slices.Values([]any{"a", "b"}))},
+		},
+		{
+			name: "c:for over typed sequence",
+			text: `<c:attr name="items"></c:attr><ul><li c:for="x in items">${x * 2}</li></ul>`,
+			want: "<ul><li>2</li><li>4</li><li>6</li></ul>",
+			vars: map[string]any{"items": countTo(3)},
+		},
+		{
+			name: "sequence as content",
+			text: `<c:attr name="items"></c:attr><p>${items}</p>`,
+			want: "<p>123</p>",
+			vars: map[string]any{"items": countTo(3)},
+		},
+		{
+			name: "sequence concatenation",
+			text: `<c:attr name="items"></c:attr><p>n=${items}!</p>`,
+			want: "<p>n=12!</p>",
+			vars: map[string]any{"items": countTo(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(tt.text, tt.want, tt.vars, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenderSeqLazy(t *testing.T) {
+	// an infinite sequence is consumed only until the render budget is exhausted
+	pulled := 0
+	infinite := func(yield func(any) bool) {
+		for {
+			pulled++
+			if !yield(pulled) {
+				return
+			}
+		}
+	}
+
+	doc, err := Parse(strings.NewReader(`<c:attr name="items"></c:attr><p c:for="x in items">${x}</p>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arena := NewArena(1 << 12)
+	defer arena.Release()
+
+	comp := NewComponent(doc, nil)
+	defer func() { _ = comp.(Disposable).Dispose() }()
+
+	s := &arenaScope{BaseScope: NewBaseScope(map[string]any{"items": infinite}), arena: arena}
+	if _, err := comp.Render(s); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("got error %v, want %v", err, ErrBudgetExceeded)
+	}
+	if pulled == 0 || pulled > 1000 {
+		t.Errorf("pulled %d elements", pulled)
+	}
+}
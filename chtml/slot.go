@@ -0,0 +1,103 @@
+package chtml
+
+import "fmt"
+
+// Named slots let a component accept several pieces of markup besides the implicit "_" slot.
+// The component renders the slots with the slot function:
+//
+//	<div class="card">
+//	  <header>${slot('header')}</header>
+//	  ${_}
+//	  <footer>${slot('footer') ?? 'no footer'}</footer>
+//	</div>
+//
+// The caller fills them with the <c:slot> children of the import, the rest of the content goes
+// to "_":
+//
+//	<c:card>
+//	  <c:slot name="header"><h2>${title}</h2></c:slot>
+//	  <p>${text}</p>
+//	</c:card>
+//
+// The content of the slots with the same name is concatenated, a slot that is not filled is nil.
+// Only the direct children of an import fill its slots, <c:slot> elsewhere is imported as any
+// other component.
+
+// slotsVar is the variable passing the named slots to the imported component. It is not
+// a valid identifier, so it does not clash with the arguments.
+const slotsVar = "c:slots"
+
+// slotContent is the render result of <c:slot> filling a slot of the parent import.
+type slotContent struct {
+	name    string
+	content any
+}
+
+// isSlotFill reports whether n is a <c:slot> element filling a named slot of the parent import.
+func isSlotFill(n *Node) bool {
+	if n.Type != importNode || n.Data.RawString() != "c:slot" {
+		return false
+	}
+	p := n.Parent
+	if p == nil || p.Type != importNode {
+		return false
+	}
+	switch p.Data.RawString() {
+	case "c:attr", "c:define", "c:call", "c:slot":
+		return false
+	}
+	return true
+}
+
+// checkSlotFill reports the errors of the <c:slot> element n filling a slot of the parent import.
+func (p *chtmlParser) checkSlotFill(n *Node) {
+	if !n.Loop.IsEmpty() {
+		p.error(n, fmt.Errorf("c:for is not allowed on <c:slot>, loop over its content instead"))
+	}
+	if !hasAttr(n, "name") {
+		p.error(n, fmt.Errorf("<c:slot> requires a name attribute"))
+	}
+	for _, attr := range n.Attr {
+		if attr.Key != "name" {
+			p.error(n, fmt.Errorf("unexpected attribute %q of <c:slot>", attr.Key))
+		}
+	}
+}
+
+// renderSlotFill renders the content of the <c:slot> element n for the parent import.
+func (c *chtmlComponent) renderSlotFill(n *Node) any {
+	var name any
+	for _, attr := range n.Attr {
+		if attr.Key != "name" {
+			continue
+		}
+		v, err := c.eval(attr.Val)
+		if err != nil {
+			c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
+			return nil
+		}
+		name = v
+	}
+	if !hasAttr(n, "name") {
+		return nil // reported by the parser
+	}
+	sname, ok := name.(string)
+	if !ok || sname == "" || sname == "_" {
+		c.error(n, fmt.Errorf("invalid slot name %v", name))
+		return nil
+	}
+
+	sc := slotContent{name: sname}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sc.content = AnyPlusAny(sc.content, c.render(child))
+	}
+	return sc
+}
+
+// slotFunc returns the slot function of the expressions for the named slots passed to
+// the component.
+func slotFunc(slots map[string]any) func(string) any {
+	return func(name string) any {
+		return slots[name]
+	}
+}
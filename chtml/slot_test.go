@@ -0,0 +1,42 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSlotErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		errs []string
+	}{
+		{
+			name: "missing name",
+			text: `<c:card><c:slot>x</c:slot></c:card>`,
+			errs: []string{`<c:slot> requires a name attribute`},
+		},
+		{
+			name: "unexpected attribute",
+			text: `<c:card><c:slot name="header" title="x"></c:slot></c:card>`,
+			errs: []string{`unexpected attribute "title" of <c:slot>`},
+		},
+		{
+			name: "loop",
+			text: `<c:card><c:slot c:for="x in [1, 2]" name="header">${x}</c:slot></c:card>`,
+			errs: []string{`c:for is not allowed on <c:slot>, loop over its content instead`},
+		},
+		{
+			name: "slot outside of an import",
+			text: `<div><c:slot name="header"></c:slot></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.text), anyImporter{})
+			if err := checkErrors(err, tt.errs); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
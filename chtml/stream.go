@@ -0,0 +1,372 @@
+package chtml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RenderTo evaluates expressions in the CHTML document and writes the resulting HTML to w as
+// the nodes are rendered, so the beginning of a large page is sent before the rest is evaluated.
+// The elements are streamed from the start tag to the end tag; the elements with raw text
+// content (e.g. <script>, <style>, <textarea>), the foreign elements (SVG, MathML), the items of
+// the parallel loops and the imported components not implementing StreamRenderer are rendered as
+// a whole and then written. The content passed to an import (the "_" variable) is rendered before
+// the imported component.
+//
+// The document must have an element at the top level or import a component with such a document,
+// otherwise ErrNotStreamable is returned before anything is written. The attributes rendered by
+// the imports (e.g. <c:attr>) after the content of the element has been written are reported as
+// errors. The rendering errors do not stop the stream, they are joined with the write error and
+// returned at the end.
+func (c *chtmlComponent) RenderTo(w io.Writer, s Scope) error {
+	if !c.isHTMLDocument() {
+		return ErrNotStreamable
+	}
+	if err := c.prepare(s); err != nil {
+		return err
+	}
+
+	sw := &streamWriter{w: w}
+	c.streamDocument(sw, c.doc)
+
+	c.checkBudget()
+
+	return errors.Join(append(c.errs, sw.err)...)
+}
+
+// isHTMLDocument reports whether the output of the document is HTML regardless of the values
+// rendered by the expressions, i.e. it has an element at the top level or imports a CHTML
+// component with such a document (e.g. a layout).
+func (c *chtmlComponent) isHTMLDocument() bool {
+	for n := c.doc.FirstChild; n != nil; n = n.NextSibling {
+		switch n.Type {
+		case html.ElementNode:
+			return true
+		case importNode:
+			if ic, ok := c.probeImport(n).(*chtmlComponent); ok && ic.isHTMLDocument() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// probeImport returns the component imported by the top-level node n without rendering it.
+// The component is kept for the render, so it is imported once. It returns nil if the name of
+// the component is not static or the import fails; the errors are reported by the render.
+func (c *chtmlComponent) probeImport(n *Node) Component {
+	if !n.Loop.IsEmpty() || n.As != "" {
+		return nil
+	}
+	if len(c.children[n]) == 1 {
+		return c.children[n][0]
+	}
+	name := n.Data.RawString()
+	if c.importer == nil || len(c.children[n]) > 0 || !strings.HasPrefix(name, "c:") || name == "c:attr" ||
+		isDefine(n) || isCall(n) {
+		return nil
+	}
+	comp, err := c.importer.Import(name[2:])
+	if err != nil {
+		return nil
+	}
+	c.children[n] = append(c.children[n], comp)
+	return comp
+}
+
+// rawTextElements are the elements whose content is not escaped or is written with special rules
+// by html.Render, so they can't be streamed child by child.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"listing":   true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"pre":       true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// voidElements are the elements without the end tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"keygen": true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// isStreamable reports whether the element n can be written from the start tag to the end tag
+// while its children are rendered.
+func isStreamable(n *Node) bool {
+	if n.Type != html.ElementNode || n.Namespace != "" {
+		return false
+	}
+	name := n.Data.RawString()
+	return !rawTextElements[name] && !voidElements[name]
+}
+
+// streamWriter writes the rendered nodes and keeps the first write error. Nothing is written
+// after an error.
+type streamWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (sw *streamWriter) node(n *html.Node) {
+	if n == nil || sw.err != nil {
+		return
+	}
+	if err := html.Render(sw.w, n); err != nil {
+		sw.err = fmt.Errorf("render HTML: %w", err)
+	}
+}
+
+func (sw *streamWriter) text(s string) {
+	sw.node(&html.Node{Type: html.TextNode, Data: s})
+}
+
+// startTag writes the start tag of the element n, which must have no children.
+func (sw *streamWriter) startTag(n *html.Node) {
+	if sw.err != nil {
+		return
+	}
+	var sb strings.Builder
+	if err := html.Render(&sb, n); err != nil {
+		sw.err = fmt.Errorf("render HTML: %w", err)
+		return
+	}
+	sw.write(strings.TrimSuffix(sb.String(), "</"+n.Data+">"))
+}
+
+func (sw *streamWriter) endTag(n *html.Node) {
+	sw.write("</" + n.Data + ">")
+}
+
+func (sw *streamWriter) write(s string) {
+	if sw.err != nil {
+		return
+	}
+	if _, err := io.WriteString(sw.w, s); err != nil {
+		sw.err = fmt.Errorf("write HTML: %w", err)
+	}
+}
+
+// Write implements io.Writer for the imported components streaming their output.
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(b)
+	if err != nil {
+		sw.err = fmt.Errorf("write HTML: %w", err)
+	}
+	return n, err
+}
+
+// startWriter calls start before the first write, so the start tag of the parent element is not
+// written if the imported component turns out to be not streamable.
+type startWriter struct {
+	sw    *streamWriter
+	start func()
+}
+
+func (w *startWriter) Write(b []byte) (int, error) {
+	if w.start != nil {
+		w.start()
+		w.start = nil
+	}
+	return w.sw.Write(b)
+}
+
+// streamChildren writes the children of the node n. The start function is called before
+// a child is streamed, emit receives the results of the children rendered as a whole.
+func (c *chtmlComponent) streamChildren(sw *streamWriter, n *Node, start func(), emit func(any)) {
+	for child := n.FirstChild; child != nil && sw.err == nil; child = child.NextSibling {
+		switch {
+		case isStreamable(child):
+			start()
+			c.stream(sw, child, start, emit)
+		case child.Type == importNode && child.As == "":
+			c.stream(sw, child, start, emit)
+		default:
+			emit(c.render(child))
+		}
+	}
+}
+
+// stream is the streaming counterpart of render for the streamable elements and the imports.
+func (c *chtmlComponent) stream(sw *streamWriter, n *Node, start func(), emit func(any)) {
+	if !c.arena.Alloc(nodeCost) {
+		return // budget exceeded, abort rendering
+	}
+
+	if !c.evalIf(n) {
+		return
+	}
+	if n.LoopParallel > 1 && !n.Loop.IsEmpty() {
+		emit(c.renderParallel(n))
+		return
+	}
+	for lc := range c.evalFor(n) {
+		if n.Type == importNode {
+			lc.streamImport(sw, n, start, emit)
+		} else {
+			lc.streamElement(sw, n)
+		}
+		if sw.err != nil {
+			return
+		}
+	}
+}
+
+// streamImport writes the output of the imported component if it implements StreamRenderer.
+// Otherwise, the component is rendered as a whole and the result is passed to emit.
+func (c *chtmlComponent) streamImport(sw *streamWriter, n *Node, start func(), emit func(any)) {
+	if isDefine(n) || isCall(n) {
+		emit(c.renderImport(n))
+		return
+	}
+
+	comp, s, ok := c.importComponent(n)
+	if !ok {
+		return
+	}
+
+	if sr, ok := comp.(StreamRenderer); ok && c.renderTimeout <= 0 {
+		err := sr.RenderTo(&startWriter{sw: sw, start: start}, s)
+		if !errors.Is(err, ErrNotStreamable) {
+			if err != nil && sw.err == nil {
+				c.error(n, fmt.Errorf("render import: %w", err))
+			}
+			return
+		}
+	}
+
+	rr, err := c.renderImported(n, comp, s)
+	if err != nil {
+		c.error(n, fmt.Errorf("render import: %w", err))
+		return
+	}
+	emit(rr)
+}
+
+// streamDocument writes the top-level nodes of the document. The values are concatenated the same
+// way as by renderDocument.
+func (c *chtmlComponent) streamDocument(sw *streamWriter, n *Node) {
+	emit := func(rr any) {
+		switch v := rr.(type) {
+		case nil:
+		case Attribute:
+			val, err := c.eval(v.Val)
+			if err != nil {
+				c.error(n, fmt.Errorf("eval attr %q: %w", v.Key, err))
+				return
+			}
+			if !c.scopeHasVar(v.Key) {
+				c.env[v.Key] = val
+			}
+		case *html.Node:
+			sw.node(v)
+		default:
+			if _, ok := asSeq(v); ok {
+				sw.node(AnyToHtml(v))
+			} else {
+				sw.text(fmt.Sprint(v))
+			}
+		}
+	}
+	c.streamChildren(sw, n, func() {}, emit)
+}
+
+// streamElement is the streaming counterpart of renderElement. The start tag is written before
+// the first child with content, so the attributes rendered by the leading imports are included.
+func (c *chtmlComponent) streamElement(sw *streamWriter, n *Node) {
+	clone := &html.Node{
+		Type:     html.ElementNode,
+		DataAtom: n.DataAtom,
+		Data:     n.Data.RawString(),
+	}
+
+	// eval attributes into values for the cloned node
+	if err := c.renderAttrs(clone, n); err != nil {
+		c.error(n, fmt.Errorf("eval attributes: %w", err))
+		return
+	}
+
+	c.evalSwitch(n)
+
+	started := false
+	space := "" // whitespace between the start tag and the leading attributes
+	start := func() {
+		if !started {
+			sw.startTag(clone)
+			started = true
+		}
+		if space != "" {
+			sw.text(space)
+			space = ""
+		}
+	}
+
+	emit := func(rr any) {
+		if rr == nil {
+			return
+		}
+		if attrs, ok := renderedAttrs(rr); ok {
+			for _, attr := range attrs {
+				v, err := c.eval(attr.Val)
+				if err != nil {
+					c.error(n, fmt.Errorf("eval attr %q: %w", attr.Key, err))
+					continue
+				}
+				if started {
+					c.error(n, fmt.Errorf("attribute %q is rendered after the element content", attr.Key))
+					continue
+				}
+				a, ok, err := c.renderAttr(n, attr.Namespace, attr.Key, v)
+				if err != nil {
+					c.error(n, err)
+					continue
+				}
+				if ok {
+					clone.Attr = append(clone.Attr, a)
+				}
+			}
+			return
+		}
+		if s, ok := rr.(string); ok && !started && isBlank(s) {
+			space += s
+			return
+		}
+		if err := c.checkContent(rr); err != nil {
+			c.error(n, err)
+			return
+		}
+		start()
+		sw.node(AnyToHtml(rr))
+	}
+
+	c.streamChildren(sw, n, start, emit)
+
+	start()
+	sw.endTag(clone)
+}
@@ -0,0 +1,117 @@
+package chtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderTo(t *testing.T) {
+	ti := &testImporter{}
+	ti.init()
+
+	tests := []struct {
+		name string
+		text string
+		vars map[string]any
+	}{
+		{"element", `<c:attr name="name"></c:attr><p class="a">Hello, ${name}!</p>`, map[string]any{"name": "<World>"}},
+		{"nested", `<div><ul><li>one</li><li>two</li></ul><hr><br></div>`, nil},
+		{"conditions", `<div><p c:if="false">a</p><p c:else-if="true">b</p><p c:else>c</p></div>`, nil},
+		{"switch", `<div c:switch="2"><p c:case="1">a</p><p c:case="2">b</p><p c:default>c</p></div>`, nil},
+		{"fragments", `<c:define name="li" x=""><li>${x}</li></c:define><ul><c:call c:for="x in [1, 2]" name="li" x="${x}"></c:call></ul>`, nil},
+		{"loop", `<ul><li c:for="x, i in ['a', 'b']" class="item">${i}: ${x}</li></ul>`, nil},
+		{"parallel loop", `<ul><li c:for="x in [1, 2, 3]" c:for-parallel="2">${x}</li></ul>`, nil},
+		{"raw text", `<div><script>if (a < b) {}</script><style>a > b {}</style></div>`, nil},
+		{"svg", `<div><svg><circle r="1"/></svg></div>`, nil},
+		{"imports", `<div><c:comp1></c:comp1><c:comp2 text="Hi"></c:comp2></div>`, nil},
+		{"import attribute", "<div>\n  <c:attr name=\"id\">x</c:attr>\n  <p>a</p></div>", nil},
+		{"page", `<c:simple-page title="Home"><p>body</p></c:simple-page>`, nil},
+		{"document", "<!-- c -->\n<html><head><title>T</title></head><body><h1>${1 + 2}</h1></body></html>\n", nil},
+		{"data in element", `<p>${ {"a": 1} } ${ [1, 2] }</p>`, nil},
+		{"text around", `before <b>bold</b> after`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.text), ti)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			opts := &ComponentOptions{Importer: ti}
+
+			rr, err := NewComponent(doc, opts).Render(NewBaseScope(tt.vars))
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			var want strings.Builder
+			if err := html.Render(&want, AnyToHtml(rr)); err != nil {
+				t.Fatal(err)
+			}
+
+			var got strings.Builder
+			comp := NewComponent(doc, opts).(StreamRenderer)
+			if err := comp.RenderTo(&got, NewBaseScope(tt.vars)); err != nil {
+				t.Fatalf("render to: %v", err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("got:\n%s\nwant:\n%s", got.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestRenderToErrors(t *testing.T) {
+	ti := &testImporter{}
+	ti.init()
+
+	renderTo := func(text string, w *strings.Builder) error {
+		doc, err := Parse(strings.NewReader(text), ti)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		comp := NewComponent(doc, &ComponentOptions{Importer: ti}).(StreamRenderer)
+		return comp.RenderTo(w, NewBaseScope(nil))
+	}
+
+	t.Run("not streamable", func(t *testing.T) {
+		for _, text := range []string{`${ 1 }`, `text`, `<c:form></c:form>`} {
+			var sb strings.Builder
+			if err := renderTo(text, &sb); !errors.Is(err, ErrNotStreamable) {
+				t.Errorf("%s: err = %v, want ErrNotStreamable", text, err)
+			}
+			if sb.Len() != 0 {
+				t.Errorf("%s: written %q", text, sb.String())
+			}
+		}
+	})
+
+	t.Run("late attribute", func(t *testing.T) {
+		var sb strings.Builder
+		err := renderTo(`<div><p>a</p><c:attr name="id">x</c:attr></div>`, &sb)
+		if err == nil || !strings.Contains(err.Error(), `attribute "id" is rendered after the element content`) {
+			t.Errorf("err = %v", err)
+		}
+		if got, want := sb.String(), `<div><p>a</p></div>`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		doc, err := Parse(strings.NewReader(`<div><p>a</p><p>b</p></div>`), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errWrite := errors.New("connection closed")
+		comp := NewComponent(doc, nil).(StreamRenderer)
+		if err := comp.RenderTo(failingWriter{errWrite}, NewBaseScope(nil)); !errors.Is(err, errWrite) {
+			t.Errorf("err = %v, want %v", err, errWrite)
+		}
+	})
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
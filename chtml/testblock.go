@@ -0,0 +1,126 @@
+package chtml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr/vm"
+	"golang.org/x/net/html"
+)
+
+// TestCase is a test declared next to the component markup with the <c:test> element:
+//
+//	<c:test name="renders title" vars="${ {title: 'X'} }">
+//	  expect contains "<h1>X</h1>"
+//	</c:test>
+//
+// The body of the element is a list of expectations, one per line. The test cases are not
+// rendered, they are executed by the chtmltest runner.
+type TestCase struct {
+	// Name is the value of the name attribute.
+	Name string
+
+	// Vars is the value of the vars attribute, the variables to render the component with.
+	Vars map[string]any
+
+	// Expect is a list of the expectation lines with the whitespace trimmed.
+	Expect []string
+
+	// Source is the location of the <c:test> element in the component source.
+	Source Span
+}
+
+// Tests returns the test cases declared in the parsed component with <c:test> elements.
+func Tests(doc *Node) ([]TestCase, error) {
+	var tests []TestCase
+	var errs []error
+
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != testNode {
+				walk(c)
+				continue
+			}
+			tc, err := newTestCase(c)
+			if err != nil {
+				errs = append(errs, newComponentError(c, err))
+				continue
+			}
+			tests = append(tests, tc)
+		}
+	}
+	walk(doc)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return tests, nil
+}
+
+func newTestCase(n *Node) (TestCase, error) {
+	tc := TestCase{
+		Name:   fmt.Sprintf("line %d", n.Source.Start.Line),
+		Source: n.Source,
+	}
+
+	var vm vm.VM
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "name":
+			tc.Name = attr.Val.RawString()
+		case "vars":
+			v, err := attr.Val.Value(&vm, env{})
+			if err != nil {
+				return tc, fmt.Errorf("eval vars: %w", err)
+			}
+			if v == nil {
+				continue
+			}
+			vars, ok := v.(map[string]any)
+			if !ok {
+				return tc, fmt.Errorf("vars must be a map, got %T", v)
+			}
+			tc.Vars = vars
+		}
+	}
+
+	// the expectations may contain HTML markup, so the body is serialized back to the source form
+	var body strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&body, rawHTML(c)); err != nil {
+			return tc, err
+		}
+	}
+	for _, line := range strings.Split(body.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			tc.Expect = append(tc.Expect, line)
+		}
+	}
+	return tc, nil
+}
+
+// rawHTML converts the node to html.Node keeping the raw (not evaluated) text and attributes.
+func rawHTML(src *Node) *html.Node {
+	n := &html.Node{
+		Type:      src.Type,
+		DataAtom:  src.DataAtom,
+		Data:      src.Data.RawString(),
+		Namespace: src.Namespace,
+	}
+	if n.Type == importNode || n.Type == testNode {
+		n.Type = html.ElementNode
+	}
+	if n.Type == html.TextNode {
+		// render text as is, the expectations are not HTML-escaped
+		n.Type = html.RawNode
+	}
+	for _, a := range src.Attr {
+		n.Attr = append(n.Attr, html.Attribute{Namespace: a.Namespace, Key: a.Key, Val: a.Val.RawString()})
+	}
+	for c := src.FirstChild; c != nil; c = c.NextSibling {
+		n.AppendChild(rawHTML(c))
+	}
+	return n
+}
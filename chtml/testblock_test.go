@@ -0,0 +1,50 @@
+package chtml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTests(t *testing.T) {
+	text := `<c:attr name="title">Default</c:attr><h1>${title}</h1>
+<c:test name="renders title" vars="${ {title: 'X'} }">
+  expect contains "<h1>X</h1>"
+  expect not contains "Default"
+</c:test>
+<c:test>expect equals "<h1>Default</h1>"</c:test>`
+
+	doc, err := Parse(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests, err := Tests(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range tests {
+		tests[i].Source = Span{}
+	}
+
+	want := []TestCase{
+		{
+			Name:   "renders title",
+			Vars:   map[string]any{"title": "X"},
+			Expect: []string{`expect contains "<h1>X</h1>"`, `expect not contains "Default"`},
+		},
+		{
+			Name:   "line 6",
+			Expect: []string{`expect equals "<h1>Default</h1>"`},
+		},
+	}
+	if diff := cmp.Diff(want, tests); diff != "" {
+		t.Errorf("Tests() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the test cases are not rendered
+	if err := testRenderCase(text, "<h1>Default</h1>\n\n", nil, nil); err != nil {
+		t.Error(err)
+	}
+}
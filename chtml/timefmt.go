@@ -0,0 +1,98 @@
+package chtml
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The time values (time.Time) render in the RFC 3339 format, e.g. for <time datetime="${t}">.
+// The expressions format them with formatTime and parse the strings with parseTime:
+//
+//	<time datetime="${post.date}">${formatTime(post.date, 'Jan 2, 2006')}</time>
+//	<p>${formatTime(event.start, 'Kitchen', 'Europe/Berlin')}</p>
+//	<p c:if="parseTime(deadline, 'DateOnly') < now()">Overdue</p>
+//
+// The layouts are the Go reference time layouts or the names of the layout constants of package
+// time (RFC3339, DateTime, DateOnly, TimeOnly, Kitchen, RFC1123, etc.). Besides time.Time,
+// formatTime accepts the RFC 3339 strings and the Unix timestamps in seconds. The builtin now()
+// and date() functions of expr-lang return time.Time as well. An argument expected to be a time
+// is declared with a time default, e.g. <c:attr name="since">${now()}</c:attr>, so the
+// comparisons and the method calls like ${since.Year()} are type checked.
+
+// timeLayouts are the layouts by the names of the constants of package time.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// timeLayout resolves the name of the layout constant, other layouts are returned as is.
+func timeLayout(layout string) string {
+	if l, ok := timeLayouts[layout]; ok {
+		return l
+	}
+	return layout
+}
+
+// formatTime formats the time value t with the layout, in the time zone tz if given.
+// A nil t formats to an empty string.
+func formatTime(t any, layout string, tz ...string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	tt, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	if len(tz) > 0 && tz[0] != "" {
+		loc, err := time.LoadLocation(tz[0])
+		if err != nil {
+			return "", err
+		}
+		tt = tt.In(loc)
+	}
+	return tt.Format(timeLayout(layout)), nil
+}
+
+// parseTime parses s with the layout, RFC 3339 by default.
+func parseTime(s string, layout ...string) (time.Time, error) {
+	l := time.RFC3339
+	if len(layout) > 0 {
+		l = timeLayout(layout[0])
+	}
+	return time.Parse(l, strings.TrimSpace(s))
+}
+
+// toTime converts the time values accepted by formatTime to time.Time.
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	case string:
+		return parseTime(t)
+	case int:
+		return time.Unix(int64(t), 0), nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case float64:
+		return time.Unix(int64(t), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%T value is not a time", v)
+}
@@ -0,0 +1,53 @@
+package chtml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderTime(t *testing.T) {
+	vars := map[string]any{"t": time.Date(2024, 5, 1, 18, 4, 5, 0, time.UTC)}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "text and attribute",
+			text: `<time datetime="${t}">${t}</time>`,
+			want: `<time datetime="2024-05-01T18:04:05Z">2024-05-01T18:04:05Z</time>`,
+		},
+		{
+			name: "layouts",
+			text: `<p>${formatTime(t, 'Jan 2, 2006')}|${formatTime(t, 'DateOnly')}|${formatTime(t, 'Kitchen')}</p>`,
+			want: `<p>May 1, 2024|2024-05-01|6:04PM</p>`,
+		},
+		{
+			name: "time zone",
+			text: `<p>${formatTime(t, 'DateTime', 'Asia/Tokyo')}</p>`,
+			want: `<p>2024-05-02 03:04:05</p>`,
+		},
+		{
+			name: "strings and timestamps",
+			text: `<p>${formatTime('2024-05-01T18:04:05Z', 'DateOnly')} ${formatTime(0, 'RFC3339', 'UTC')}</p>`,
+			want: `<p>2024-05-01 1970-01-01T00:00:00Z</p>`,
+		},
+		{
+			name: "parse",
+			text: `<p c:if="parseTime('2024-04-30', 'DateOnly') < t">${parseTime('2024-04-30', 'DateOnly').Day()}</p>`,
+			want: `<p>30</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := `<c:attr name="t">${now()}</c:attr>` + tt.text // typed as time.Time
+			if err := testRenderCase(text, tt.want, vars, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if err := testRenderCase(`<p>${formatTime('yesterday', 'DateOnly')}</p>`, nil, nil, nil); err == nil {
+		t.Error("want an error for an invalid time string")
+	}
+}
@@ -0,0 +1,127 @@
+package chtml
+
+// CloneWithSource returns a deep copy of the node n and its descendants. All fields including
+// the Source spans, parsed expressions and loop settings are preserved. The condition chains
+// (PrevCond/NextCond) are re-linked within the cloned subtree, links to nodes outside of the
+// subtree are dropped. The fragment calls are linked to the cloned definitions if they are in
+// the subtree, or to the original ones otherwise. The returned node has no parent and no
+// siblings.
+func CloneWithSource(n *Node) *Node {
+	clones := make(map[*Node]*Node)
+	clone := cloneTree(n, clones)
+
+	for src, dst := range clones {
+		dst.PrevCond = clones[src.PrevCond]
+		dst.NextCond = clones[src.NextCond]
+		if def, ok := clones[src.Fragment]; ok {
+			dst.Fragment = def
+		}
+	}
+
+	return clone
+}
+
+// cloneTree copies the subtree and records the mapping between the source nodes and their clones.
+func cloneTree(n *Node, clones map[*Node]*Node) *Node {
+	clone := &Node{
+		Type:         n.Type,
+		DataAtom:     n.DataAtom,
+		Data:         n.Data,
+		Namespace:    n.Namespace,
+		Cond:         n.Cond,
+		Loop:         n.Loop,
+		LoopIdx:      n.LoopIdx,
+		LoopVar:      n.LoopVar,
+		LoopParallel: n.LoopParallel,
+		LoopKey:      n.LoopKey,
+		Switch:       n.Switch,
+		Case:         n.Case,
+		CaseDefault:  n.CaseDefault,
+		Attrs:        n.Attrs,
+		Source:       n.Source,
+		As:           n.As,
+		Fragment:     n.Fragment,
+	}
+	if n.Attr != nil {
+		clone.Attr = make([]Attribute, len(n.Attr))
+		copy(clone.Attr, n.Attr)
+	}
+	clones[n] = clone
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneTree(c, clones))
+	}
+	return clone
+}
+
+// TransformFunc is called by Transform for every node in the tree. It returns a list of nodes
+// to put in place of n:
+//   - []*Node{n} keeps the node as is (it may still be modified in place);
+//   - a list of new nodes replaces n with these nodes;
+//   - an empty list removes n from the tree.
+//
+// The replacement nodes must be detached (have no parent or siblings).
+type TransformFunc func(n *Node) ([]*Node, error)
+
+// Transform walks the tree rooted at n in depth-first order and calls fn for every descendant of
+// n (but not n itself). The children of a node are visited after fn is called for the node, so
+// the replacement nodes returned by fn are visited as well, but not the replaced node's children.
+//
+// The replacement nodes with no Source inherit the Source span of the replaced node, so the
+// transformed tree keeps pointing to the original document for error reporting.
+func Transform(n *Node, fn TransformFunc) error {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		repl, err := fn(c)
+		if err != nil {
+			return err
+		}
+
+		if len(repl) != 1 || repl[0] != c {
+			for _, r := range repl {
+				if r.Source.IsZero() {
+					r.Source = c.Source
+				}
+			}
+			Splice(c, repl...)
+		}
+
+		for _, r := range repl {
+			if err := Transform(r, fn); err != nil {
+				return err
+			}
+		}
+
+		c = next
+	}
+	return nil
+}
+
+// ReplaceChild replaces the child oldChild of n with newChild. Afterwards, oldChild will have
+// no parent and no siblings.
+//
+// It will panic if oldChild's parent is not n or if newChild already has a parent or siblings.
+func (n *Node) ReplaceChild(newChild, oldChild *Node) {
+	if oldChild.Parent != n {
+		panic("chtml: ReplaceChild called for a non-child Node")
+	}
+	n.InsertBefore(newChild, oldChild)
+	n.RemoveChild(oldChild)
+}
+
+// Splice replaces the node old with the given nodes, keeping the parent and sibling links
+// consistent. If no nodes are given, old is removed from the tree. Afterwards, old will have
+// no parent and no siblings.
+//
+// It will panic if old has no parent or if any of the nodes already has a parent or siblings.
+func Splice(old *Node, nodes ...*Node) {
+	parent := old.Parent
+	if parent == nil {
+		panic("chtml: Splice called for a detached Node")
+	}
+	for _, nn := range nodes {
+		parent.InsertBefore(nn, old)
+	}
+	parent.RemoveChild(old)
+}
@@ -0,0 +1,149 @@
+package chtml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCloneWithSource(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<div><p c:if="false">a</p><p c:else>b</p></div>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	div := doc.FirstChild
+	clone := CloneWithSource(div)
+
+	if err := checkTreeConsistency(clone); err != nil {
+		t.Fatal(err)
+	}
+	if clone.Parent != nil || clone == div {
+		t.Fatal("clone must be a detached copy")
+	}
+
+	p1, p2 := clone.FirstChild, clone.LastChild
+	if p1 == div.FirstChild || p1.Source != div.FirstChild.Source {
+		t.Errorf("Source not preserved: %v, want %v", p1.Source, div.FirstChild.Source)
+	}
+	if p1.NextCond != p2 || p2.PrevCond != p1 {
+		t.Error("condition chain is not re-linked within the clone")
+	}
+
+	// a clone of a node in a chain does not point to the original tree
+	p2clone := CloneWithSource(div.LastChild)
+	if p2clone.PrevCond != nil {
+		t.Error("condition chain must not point outside the clone")
+	}
+}
+
+func TestCloneWithSource_AllFields(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<c:attr name="attrs"></c:attr>`+
+		`<c:define name="item"><li>item</li></c:define>`+
+		`<ul><li c:for="x, i in [1]" c:key="x" c:for-parallel="2" c:attrs="${attrs}">${x}</li></ul>`+
+		`<div c:switch="1"><p c:case="1">one</p><p c:default>other</p></div>`+
+		`<p c:if="false">a</p><p c:else>b</p>`+
+		`<c:call name="item" as="res"></c:call><svg><circle></circle></svg>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := CloneWithSource(doc)
+
+	// clones maps the nodes of the original tree to their clones
+	clones := map[*Node]*Node{}
+	var pair func(n, c *Node)
+	pair = func(n, c *Node) {
+		clones[n] = c
+		for n, c = n.FirstChild, c.FirstChild; n != nil && c != nil; n, c = n.NextSibling, c.NextSibling {
+			pair(n, c)
+		}
+		if n != nil || c != nil {
+			t.Fatal("the clone has a different number of children")
+		}
+	}
+	pair(doc, clone)
+
+	nodeType := reflect.TypeOf(Node{})
+	set := make([]bool, nodeType.NumField()) // the fields set in the document
+	for n, c := range clones {
+		nv, cv := reflect.ValueOf(n).Elem(), reflect.ValueOf(c).Elem()
+		for i := range nodeType.NumField() {
+			f := nodeType.Field(i)
+			set[i] = set[i] || !nv.Field(i).IsZero()
+
+			if f.Type == reflect.TypeOf((*Node)(nil)) {
+				// the links point to the clones, the links outside of the tree are dropped
+				want := clones[nv.Field(i).Interface().(*Node)]
+				if got := cv.Field(i).Interface().(*Node); got != want {
+					t.Errorf("%s of %q: got %p, want %p", f.Name, n.Data.RawString(), got, want)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(nv.Field(i).Interface(), cv.Field(i).Interface()) {
+				t.Errorf("%s of %q is not copied", f.Name, n.Data.RawString())
+			}
+		}
+	}
+	for i, ok := range set {
+		if !ok {
+			t.Errorf("the document doesn't set %s, extend it", nodeType.Field(i).Name)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<div><b>bold</b><i>italic</i><script>x</script></div>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSource := doc.FirstChild.FirstChild.Source
+
+	err = Transform(doc, func(n *Node) ([]*Node, error) {
+		switch n.Data.RawString() {
+		case "b":
+			// replace <b> with <strong>, keeping the children
+			strong := &Node{Type: html.ElementNode, Data: NewExprRaw("strong")}
+			for c := n.FirstChild; c != nil; c = n.FirstChild {
+				n.RemoveChild(c)
+				strong.AppendChild(c)
+			}
+			return []*Node{strong}, nil
+		case "i":
+			// duplicate <i>
+			return []*Node{CloneWithSource(n), CloneWithSource(n)}, nil
+		case "script":
+			return nil, nil // remove
+		}
+		return []*Node{n}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkTreeConsistency(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dump(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := removeIndent(`
+		| <div>
+		|   <strong>
+		|     "bold"
+		|   <i>
+		|     "italic"
+		|   <i>
+		|     "italic"
+		`)
+	if got != want {
+		t.Errorf("got vs want:\n----\n%s----\n%s----", got, want)
+	}
+
+	if s := doc.FirstChild.FirstChild.Source; s != bSource {
+		t.Errorf("Source of the replacement = %v, want %v", s, bSource)
+	}
+}
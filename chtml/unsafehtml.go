@@ -0,0 +1,45 @@
+package chtml
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// unsafeHtml parses the string into the HTML nodes, so the markup is rendered as is instead of
+// being escaped, e.g. ${unsafeHtml(post.body)} for the HTML produced by a CMS or a markdown
+// converter. The string is parsed as the content of <body>, so an unbalanced markup can't
+// affect the rest of the page: the unclosed elements are closed and the stray end tags are
+// dropped. The content is not sanitized, it must come from a trusted source.
+//
+// A nil value renders nothing.
+func unsafeHtml(v any) (*html.Node, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsafeHtml: expected a string, got %T", v)
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{
+		Type:     html.ElementNode,
+		DataAtom: atom.Body,
+		Data:     "body",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unsafeHtml: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	doc := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		doc.AppendChild(n)
+	}
+	return doc, nil
+}
@@ -0,0 +1,40 @@
+package chtml
+
+import "testing"
+
+func TestUnsafeHtml(t *testing.T) {
+	const text = `<c:attr name="s"></c:attr><div>${unsafeHtml(s)} tail</div><p>${"a " + unsafeHtml(s)}</p>`
+
+	tests := []struct {
+		name string
+		s    any
+		want string
+	}{
+		{
+			name: "markup",
+			s:    "<b>bold</b> text",
+			want: `<div><b>bold</b> text tail</div><p>a <b>bold</b> text</p>`,
+		},
+		{
+			name: "unbalanced markup",
+			s:    "<b>x</i></div> y",
+			want: `<div><b>x y</b> tail</div><p>a <b>x y</b></p>`,
+		},
+		{
+			name: "nil",
+			s:    nil,
+			want: `<div> tail</div><p>a </p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testRenderCase(text, tt.want, map[string]any{"s": tt.s}, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if err := testRenderCase(`<p>${unsafeHtml(1)}</p>`, nil, nil, nil); err == nil {
+		t.Error("want an error for a non-string value")
+	}
+}
@@ -0,0 +1,44 @@
+// Command chtmlgen generates the Go types of the arguments and the outputs of the chtml
+// components in a directory, see chtml.GenerateTypes. It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/dpotapov/go-pages/cmd/chtmlgen -pkg views -o views_gen.go ./templates
+//
+// Usage:
+//
+//	chtmlgen [-pkg views] [-o file.go] [dir]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func main() {
+	pkg := flag.String("pkg", "views", "name of the generated package")
+	out := flag.String("o", "", "file to write the generated code to, stdout by default")
+	flag.Parse()
+
+	dir := flag.Arg(0)
+	if dir == "" {
+		dir = "."
+	}
+
+	src, err := chtml.GenerateTypes(os.DirFS(dir), *pkg, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "chtmlgen:", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "chtmlgen:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,75 @@
+// Command pages-dev serves a directory of chtml pages with live reload for local development.
+// With -export, it renders the static routes of the directory into another one instead, see
+// pages.Handler.Export.
+//
+// Usage:
+//
+//	pages-dev [-addr localhost:8080] [-backend http://localhost:9000] [-api /api/] [dir]
+//	pages-dev -export out [dir]
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/dpotapov/go-pages"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	backend := flag.String("backend", "", "URL of a backend server to proxy API requests to")
+	api := flag.String("api", "/api/", "URL path prefix of the API requests")
+	export := flag.String("export", "", "directory to export the static site to")
+	flag.Parse()
+
+	dir := flag.Arg(0)
+	if dir == "" {
+		dir = "."
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	if *export != "" {
+		h := &pages.Handler{FileSystem: os.DirFS(dir), Logger: logger}
+		if err := h.Export(*export, nil); err != nil {
+			logger.Error("Export error", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ds := &pages.DevServer{
+		Handler: &pages.Handler{
+			FileSystem:   os.DirFS(dir),
+			Logger:       logger,
+			ShowDrafts:   true,
+			Watch:        true,
+			ErrorOverlay: true,
+		},
+		Addr:          *addr,
+		BackendPrefix: *api,
+	}
+
+	if *backend != "" {
+		u, err := url.Parse(*backend)
+		if err != nil {
+			logger.Error("Invalid backend URL", "error", err)
+			os.Exit(2)
+		}
+		ds.Backend = u
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := ds.ListenAndServe(ctx); err != nil {
+		logger.Error("Dev server error", "error", err)
+		os.Exit(1)
+	}
+}
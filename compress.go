@@ -0,0 +1,267 @@
+package pages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compressMinSize is the minimum size of a response worth compressing.
+const compressMinSize = 1024
+
+// precompressed are the encodings of the precompressed file variants looked up next to the
+// static files, in the order of preference, e.g. app.js.br and app.js.gz for app.js.
+var precompressed = []struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// compressible reports whether the responses of the content type are worth compressing.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml",
+		"application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the request allows
+// the encoding, i.e. lists it (or "*") with a non-zero quality.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	accepted := false
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		if s, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				q = f
+			}
+		}
+		if name == encoding {
+			return q > 0 // an explicit quality takes precedence over "*"
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// gzipResponseWriter compresses the response with gzip if the client accepts it and
+// the response is worth compressing: the content type is compressible, the response is not
+// encoded already and it is at least compressMinSize bytes long. The beginning of the response
+// is buffered to decide.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	accepts bool // whether the client accepts gzip
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func newGzipResponseWriter(w http.ResponseWriter, r *http.Request) *gzipResponseWriter {
+	return &gzipResponseWriter{ResponseWriter: w, accepts: acceptsEncoding(r, "gzip")}
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < compressMinSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// gzipETagSuffix is appended to the strong ETags of the responses compressed by
+// gzipResponseWriter, see etagMatch.
+const gzipETagSuffix = "-gzip"
+
+// decide sends the headers and the buffered beginning of the response, compressed or not.
+func (w *gzipResponseWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+
+	ct := h.Get("Content-Type")
+	if ct == "" && len(w.buf) > 0 && h.Get("Content-Encoding") == "" {
+		ct = http.DetectContentType(w.buf) // as net/http would, but before the compression
+		h.Set("Content-Type", ct)
+	}
+	encoded := h.Get("Content-Encoding") != "" || h.Get("Content-Range") != ""
+	if compressible(ct) && !encoded {
+		h.Add("Vary", "Accept-Encoding")
+		switch w.status {
+		case 0, http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNonAuthoritativeInfo:
+			if w.accepts && len(w.buf) >= compressMinSize {
+				h.Set("Content-Encoding", "gzip")
+				h.Del("Content-Length")
+				if etag := h.Get("ETag"); strings.HasSuffix(etag, `"`) && !strings.HasPrefix(etag, "W/") {
+					// a strong ETag is of the identity representation only
+					h.Set("ETag", strings.TrimSuffix(etag, `"`)+gzipETagSuffix+`"`)
+				}
+				w.gz = gzip.NewWriter(w.ResponseWriter)
+			}
+		}
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends the buffered response to the client.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide()
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the response. It must be called after the handler has written the response.
+func (w *gzipResponseWriter) Close() error {
+	if !w.decided && (w.status != 0 || len(w.buf) > 0) {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// gzipContent compresses the content with gzip.
+func gzipContent(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// serveCompressedFile serves a compressible static file in an encoding accepted by the client:
+// a precompressed variant from the file system (e.g. app.js.br) or the file compressed with gzip
+// and cached in memory. It returns false if the file is not served compressed.
+func (h *Handler) serveCompressedFile(
+	w http.ResponseWriter, r *http.Request, fsys fs.FS, name string, fi fs.FileInfo,
+) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || r.Header.Get("Range") != "" {
+		return false
+	}
+	ct := assetType(name)
+	if !compressible(ct) {
+		return false
+	}
+
+	for _, pc := range precompressed {
+		if !acceptsEncoding(r, pc.encoding) {
+			continue
+		}
+		if data, err := fs.ReadFile(fsys, name+pc.ext); err == nil {
+			serveEncoded(w, r, name, fi.ModTime(), pc.encoding, data)
+			return true
+		}
+	}
+
+	if !acceptsEncoding(r, "gzip") || fi.Size() < compressMinSize {
+		return false
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return false
+	}
+	h.serveContent(w, r, name, fi.ModTime(), data)
+	return true
+}
+
+// serveContent serves the content of a static file, compressed with gzip if Compression is set
+// and the client accepts it.
+func (h *Handler) serveContent(
+	w http.ResponseWriter, r *http.Request, name string, modTime time.Time, data []byte,
+) {
+	ct := assetType(name)
+	if h.Compression && compressible(ct) && len(data) >= compressMinSize &&
+		r.Header.Get("Range") == "" && acceptsEncoding(r, "gzip") {
+		gz, err := h.compressed.load("gzip", data, gzipContent)
+		if err == nil {
+			serveEncoded(w, r, name, modTime, "gzip", gz)
+			return
+		}
+		h.logger.Warn("Compress file", "path", name, "error", err)
+	}
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+}
+
+// serveEncoded serves the content of a static file in the encoding.
+func serveEncoded(
+	w http.ResponseWriter, r *http.Request, name string, modTime time.Time, encoding string, data []byte,
+) {
+	w.Header().Set("Content-Type", assetType(name))
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+}
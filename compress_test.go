@@ -0,0 +1,105 @@
+package pages
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"", "gzip", false},
+		{"gzip, deflate, br", "gzip", true},
+		{"gzip, deflate, br", "br", true},
+		{"deflate", "gzip", false},
+		{"GZIP;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"*", "br", true},
+		{"*, gzip;q=0", "gzip", false},
+		{"br;q=0, *", "gzip", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsEncoding(r, tt.encoding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestPages_Compression(t *testing.T) {
+	large := strings.Repeat("<p>Lorem ipsum dolor sit amet</p>", 100)
+	script := strings.Repeat("console.log('hello');\n", 100)
+	fsys := fstest.MapFS{
+		"index.chtml":  {Data: []byte(large)},
+		"small.chtml":  {Data: []byte(`<p>small</p>`)},
+		"app.js":       {Data: []byte(script)},
+		"lib.js":       {Data: []byte(script)},
+		"lib.js.br":    {Data: []byte("brotli")},
+		"logo.png":     {Data: []byte(strings.Repeat("\x89PNG", 1000))},
+		"robots.txt":   {Data: []byte("User-agent: *")},
+		"data/a.json":  {Data: []byte(`{}`)},
+		"data/b.chtml": {Data: []byte(`${ {"items": [` + strings.Repeat(`"item",`, 300) + `"item"]} }`)},
+	}
+	h := &Handler{FileSystem: fsys, Compression: true}
+
+	tests := []struct {
+		url, accept  string
+		wantEncoding string
+		wantVary     string
+		wantBody     string
+	}{
+		{"/", "gzip, br", "gzip", "Accept-Encoding", large},
+		{"/", "", "", "Accept-Encoding", large},
+		{"/small", "gzip", "", "Accept-Encoding", "<p>small</p>"},
+		{"/data/b", "gzip", "gzip", "Accept, Accept-Encoding", ""},
+		{"/app.js", "gzip", "gzip", "Accept-Encoding", script},
+		{"/lib.js", "gzip, br", "br", "Accept-Encoding", "brotli"},
+		{"/lib.js", "gzip", "gzip", "Accept-Encoding", script},
+		{"/logo.png", "gzip", "", "", strings.Repeat("\x89PNG", 1000)},
+		{"/robots.txt", "gzip", "", "Accept-Encoding", "User-agent: *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != 200 {
+				t.Fatalf("status code: got %d, want 200", rr.Code)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding: got %q, want %q", got, tt.wantEncoding)
+			}
+			if got := strings.Join(rr.Header().Values("Vary"), ", "); got != tt.wantVary {
+				t.Errorf("Vary: got %q, want %q", got, tt.wantVary)
+			}
+
+			body := rr.Body.String()
+			if tt.wantEncoding == "gzip" {
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body: got %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
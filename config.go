@@ -0,0 +1,107 @@
+package pages
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// Config is a set of Handler options that can be changed at runtime with Handler.UpdateConfig.
+// The fields have the same meaning as the Handler fields with the same names.
+type Config struct {
+	ComponentSearchPath []string
+	StaticPaths         []string
+	OnErrorComponent    string
+	RenderArena         bool
+	RenderBudget        int64
+	RenderTimeout       time.Duration
+	ShadowRate          float64
+}
+
+// handlerConfig is an immutable snapshot of the runtime configuration.
+type handlerConfig struct {
+	Config
+
+	// errComp is an imported error component instance if OnErrorComponent is set.
+	errComp chtml.Component
+
+	// parsed keeps the parsed trees of the prewarmed pages (see Handler.Prewarm). The trees depend
+	// on the ComponentSearchPath, so the cache is replaced when the search path is changed.
+	parsed *parseCache
+}
+
+// Config returns a copy of the current runtime configuration.
+func (h *Handler) Config() Config {
+	h.init.Do(h.setup)
+	return h.cfg().clone()
+}
+
+// UpdateConfig changes the runtime configuration. The update function is called with a copy of
+// the current configuration, and the result replaces the configuration atomically: requests
+// in flight and WebSocket sessions complete with the configuration they started with, new
+// requests see the updated one. Concurrent updates are serialized.
+//
+// If the error component can not be imported, UpdateConfig returns an error and the current
+// configuration is kept.
+//
+// The Handler fields are used as the initial configuration only, they are not changed by
+// UpdateConfig.
+func (h *Handler) UpdateConfig(update func(*Config)) error {
+	h.init.Do(h.setup)
+
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+
+	old := h.cfg()
+	cfg := &handlerConfig{Config: old.clone(), errComp: old.errComp, parsed: old.parsed}
+	update(&cfg.Config)
+
+	if !slices.Equal(cfg.ComponentSearchPath, old.ComponentSearchPath) && old.parsed != nil {
+		cfg.parsed = newParseCache()
+	}
+
+	if cfg.OnErrorComponent != old.OnErrorComponent || !slices.Equal(cfg.ComponentSearchPath, old.ComponentSearchPath) {
+		if err := h.importErrorComponent(cfg); err != nil {
+			return err
+		}
+	}
+
+	if h.shadow != nil {
+		err := h.shadow.UpdateConfig(shadowConfig(&cfg.Config))
+		if err != nil {
+			return fmt.Errorf("shadow handler: %w", err)
+		}
+	}
+
+	h.config.Store(cfg)
+	h.logger.Info("Configuration updated")
+	return nil
+}
+
+// cfg returns the current runtime configuration. The handler must be initialized.
+func (h *Handler) cfg() *handlerConfig {
+	return h.config.Load()
+}
+
+// importErrorComponent imports the OnErrorComponent for the configuration.
+func (h *Handler) importErrorComponent(cfg *handlerConfig) error {
+	cfg.errComp = nil
+	if cfg.OnErrorComponent == "" {
+		return nil
+	}
+	ec, err := h.importerWithSearchPath(".", cfg.ComponentSearchPath).Import(cfg.OnErrorComponent)
+	if err != nil {
+		return fmt.Errorf("import error component: %w", err)
+	}
+	cfg.errComp = ec
+	return nil
+}
+
+func (c *handlerConfig) clone() Config {
+	cfg := c.Config
+	cfg.ComponentSearchPath = slices.Clone(cfg.ComponentSearchPath)
+	cfg.StaticPaths = slices.Clone(cfg.StaticPaths)
+	return cfg
+}
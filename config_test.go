@@ -0,0 +1,79 @@
+package pages
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandler_UpdateConfig(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":      {Data: []byte(`<c:widget></c:widget>`)},
+		"v1/widget.chtml":  {Data: []byte(`widget v1`)},
+		"v2/widget.chtml":  {Data: []byte(`widget v2`)},
+		"errors/err.chtml": {Data: []byte(`error page`)},
+	}
+
+	h := &Handler{
+		FileSystem:          fsys,
+		ComponentSearchPath: []string{".", "/v1"},
+		StaticFileSystems:   []fs.FS{fstest.MapFS{"other.txt": {Data: []byte(`other`)}}},
+	}
+
+	get := func(url string) string {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		return rr.Body.String()
+	}
+
+	if got := get("/"); got != "widget v1" {
+		t.Fatalf("got %q, want %q", got, "widget v1")
+	}
+	if got := get("/other.txt"); got != "Not Found\n" {
+		t.Fatalf("got %q, want %q", got, "Not Found\n")
+	}
+
+	err := h.UpdateConfig(func(c *Config) {
+		c.ComponentSearchPath = []string{".", "/v2"}
+		c.StaticPaths = []string{"/other.txt"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := get("/"); got != "widget v2" {
+		t.Errorf("got %q, want %q", got, "widget v2")
+	}
+	if got := get("/other.txt"); got != "other" {
+		t.Errorf("got %q, want %q", got, "other")
+	}
+
+	// the Handler fields are not changed
+	if h.ComponentSearchPath[1] != "/v1" {
+		t.Errorf("ComponentSearchPath field is changed: %v", h.ComponentSearchPath)
+	}
+
+	// a missing error component keeps the current configuration
+	err = h.UpdateConfig(func(c *Config) {
+		c.ComponentSearchPath = []string{".", "/v1"}
+		c.OnErrorComponent = "missing"
+	})
+	if err == nil {
+		t.Fatal("expected an error for a missing error component")
+	}
+	if cfg := h.Config(); cfg.ComponentSearchPath[1] != "/v2" || cfg.OnErrorComponent != "" {
+		t.Errorf("configuration is changed on error: %+v", cfg)
+	}
+
+	err = h.UpdateConfig(func(c *Config) {
+		c.ComponentSearchPath = []string{".", "/v2", "/errors"}
+		c.OnErrorComponent = "err"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.cfg().errComp == nil {
+		t.Error("error component is not imported")
+	}
+}
@@ -0,0 +1,575 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/html"
+)
+
+// liveReloadPath is the URL path of the Server-Sent Events endpoint notifying the browser
+// about file changes.
+const liveReloadPath = "/_pages/livereload"
+
+// liveReloadScriptPath is the URL path of the live reload client script.
+const liveReloadScriptPath = "/_pages/livereload.js"
+
+// liveReloadScript is the live reload client added to HTML pages served by the DevServer.
+// Besides reloading the page, it handles the "css" events by swapping the versions of
+// the changed stylesheets in place.
+const liveReloadScript = `(function() {
+  var es = new EventSource("` + liveReloadPath + `");
+  es.addEventListener("reload", function() { location.reload(); });
+  es.addEventListener("css", function(e) {
+    var changed = JSON.parse(e.data);
+    document.querySelectorAll('link[rel="stylesheet"]').forEach(function(link) {
+      var u = new URL(link.href, location.href);
+      if (u.origin === location.origin && changed[u.pathname]) {
+        u.searchParams.set("v", changed[u.pathname]);
+        link.href = u.pathname + u.search;
+      }
+    });
+  });
+})();
+`
+
+// liveReloadAsset is the dependency on the live reload client registered for every page rendered
+// by the Handler of the DevServer. The script is injected like the other assets (see AssetDep),
+// with its Subresource Integrity hash, and is allowed by a "script-src 'self'" policy unlike an
+// inline script.
+var liveReloadAsset = AssetDep{
+	Href:      liveReloadScriptPath,
+	Integrity: scriptIntegrity(liveReloadScript),
+	Type:      "script",
+}
+
+// liveReloadTag is the element of liveReloadAsset.
+var liveReloadTag = renderAssetTag(liveReloadAsset)
+
+func scriptIntegrity(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func renderAssetTag(dep AssetDep) string {
+	var sb strings.Builder
+	_ = html.Render(&sb, dep.node())
+	return sb.String()
+}
+
+// liveEvent is a Server-Sent Event sent to the browsers.
+type liveEvent struct {
+	name string
+	data string
+}
+
+// DevServer wraps Handler with a batteries-included local development workflow:
+//   - the FileSystem is watched for changes and the browser is reloaded automatically;
+//   - requests to BackendPrefix are proxied to an optional Backend server;
+//   - the routes and file changes are logged.
+//
+// DevServer is not meant to be used in production.
+type DevServer struct {
+	// Handler serves the pages. Its FileSystem is watched for changes.
+	Handler *Handler
+
+	// Addr is the TCP address to listen on, ":8080" if empty. If the host is "localhost",
+	// the server listens on both IPv4 and IPv6 loopback addresses.
+	Addr string
+
+	// Backend is an optional URL of a backend server. Requests with the BackendPrefix path are
+	// proxied to it.
+	Backend *url.URL
+
+	// BackendPrefix is the URL path prefix for requests proxied to the Backend, "/api/" if empty.
+	BackendPrefix string
+
+	// PollInterval is the interval between the FileSystem scans, 500ms if zero.
+	PollInterval time.Duration
+
+	// Logger configures logging for the diagnostics. If not set, the Handler's Logger is used.
+	Logger *slog.Logger
+
+	init   sync.Once
+	logger *slog.Logger
+	proxy  http.Handler
+
+	mu      sync.Mutex
+	clients map[chan liveEvent]struct{}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (d *DevServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.init.Do(d.setup)
+
+	switch {
+	case r.URL.Path == liveReloadPath:
+		d.serveLiveReload(w, r)
+	case r.URL.Path == liveReloadScriptPath:
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = io.WriteString(w, liveReloadScript)
+	case d.proxy != nil && strings.HasPrefix(r.URL.Path, d.backendPrefix()):
+		d.proxy.ServeHTTP(w, r)
+	case websocket.IsWebSocketUpgrade(r), isEventStreamRequest(r):
+		d.Handler.ServeHTTP(w, r)
+	default:
+		d.serveWithLiveReload(w, r)
+	}
+}
+
+// ListenAndServe watches the FileSystem for changes and serves HTTP requests until the context
+// is canceled.
+func (d *DevServer) ListenAndServe(ctx context.Context) error {
+	d.init.Do(d.setup)
+
+	listeners, err := d.listen()
+	if err != nil {
+		return err
+	}
+
+	d.logRoutes()
+
+	srv := &http.Server{Handler: d}
+
+	errC := make(chan error, len(listeners))
+	for _, l := range listeners {
+		d.logger.Info("Starting dev server", "address", "http://"+l.Addr().String())
+		go func() { errC <- srv.Serve(l) }()
+	}
+
+	go d.watch(ctx)
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errC:
+		_ = srv.Close()
+		return err
+	}
+}
+
+func (d *DevServer) setup() {
+	d.logger = d.Logger
+	if d.logger == nil {
+		d.logger = d.Handler.Logger
+	}
+	if d.logger == nil {
+		d.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	if d.Backend != nil {
+		d.proxy = httputil.NewSingleHostReverseProxy(d.Backend)
+	}
+
+	d.clients = make(map[chan liveEvent]struct{})
+
+	if !slices.Contains(d.Handler.pageAssets, liveReloadAsset) {
+		d.Handler.pageAssets = append(d.Handler.pageAssets, liveReloadAsset)
+	}
+}
+
+func (d *DevServer) backendPrefix() string {
+	if d.BackendPrefix == "" {
+		return "/api/"
+	}
+	return d.BackendPrefix
+}
+
+// listen creates listeners for the Addr. The "localhost" host is resolved to both IPv4 and IPv6
+// loopback addresses (dual-stack), the IPv6 listener is optional.
+func (d *DevServer) listen() ([]net.Listener, error) {
+	addr := d.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse address %s: %w", addr, err)
+	}
+
+	if host != "localhost" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	l4, err := net.Listen("tcp4", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		return nil, err
+	}
+	if port == "0" {
+		// use the same port for both listeners
+		port = fmt.Sprint(l4.Addr().(*net.TCPAddr).Port)
+	}
+	l6, err := net.Listen("tcp6", net.JoinHostPort("::1", port))
+	if err != nil {
+		d.logger.Warn("IPv6 loopback is not available", "error", err)
+		return []net.Listener{l4}, nil
+	}
+	return []net.Listener{l4, l6}, nil
+}
+
+// serveWithLiveReload serves the request with the Handler. The live reload client is added to
+// the rendered pages through their asset registry (see liveReloadAsset). The HTML responses
+// bypassing the registry, i.e. the streamed pages (see Handler.StreamPages) and the static HTML
+// files, get the same script element injected into the response. The responses are passed
+// through as they are written, so the streamed pages are not delayed.
+func (d *DevServer) serveWithLiveReload(w http.ResponseWriter, r *http.Request) {
+	lw := &liveReloadWriter{ResponseWriter: w}
+	d.Handler.ServeHTTP(lw, r)
+	lw.finish()
+}
+
+// closingBody is the tag the live reload script is inserted before.
+const closingBody = "</body>"
+
+// liveReloadWriter is an http.ResponseWriter injecting the live reload script element before
+// the closing </body> tag of the uncompressed HTML responses, or at the end of the response if
+// there is no such tag. The responses already referencing the script (the rendered pages) and
+// the other responses are passed through as is.
+type liveReloadWriter struct {
+	http.ResponseWriter
+	code     int  // status code of the pending header, see WriteHeader
+	started  bool // the header is sent
+	inject   bool // the script is to be injected into the response
+	injected bool
+	tail     []byte // the end of the written data which may be the start of a searched tag
+}
+
+// WriteHeader sends the header. If the Content-Type is not set, the header is sent with the first
+// write, so the type can be detected from the data.
+func (w *liveReloadWriter) WriteHeader(code int) {
+	if w.started || w.code != 0 {
+		return
+	}
+	w.code = code
+	if w.Header().Get("Content-Type") != "" {
+		w.start()
+	}
+}
+
+// start sends the pending header and decides whether the script is injected.
+func (w *liveReloadWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	h := w.Header()
+	w.inject = strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Encoding") == ""
+	if w.inject {
+		h.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+func (w *liveReloadWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.start()
+	}
+	if !w.inject || w.injected {
+		return w.ResponseWriter.Write(b)
+	}
+
+	data := append(w.tail, b...)
+	i := indexFold(data, closingBody)
+	if j := bytes.Index(data, []byte(liveReloadTag)); j >= 0 && (i < 0 || j < i) {
+		// injected by the asset registry
+		w.injected = true
+		w.tail = nil
+		_, err := w.ResponseWriter.Write(data)
+		return len(b), err
+	}
+	if i >= 0 {
+		w.injected = true
+		w.tail = nil
+		_, err := w.ResponseWriter.Write(slices.Concat(data[:i], []byte(liveReloadTag), data[i:]))
+		return len(b), err
+	}
+
+	// the tags may be split between the writes
+	keep := min(len(data), len(liveReloadTag)-1)
+	w.tail = slices.Clone(data[len(data)-keep:])
+	_, err := w.ResponseWriter.Write(data[:len(data)-keep])
+	return len(b), err
+}
+
+// Flush sends the pending header and the data written so far, except for the possible start of
+// a searched tag.
+func (w *liveReloadWriter) Flush() {
+	w.start()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *liveReloadWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the rest of the response: the script if there was no </body> tag.
+func (w *liveReloadWriter) finish() {
+	if !w.started && w.code == 0 {
+		return // nothing written, e.g. a hijacked connection
+	}
+	w.start()
+	if w.inject && !w.injected {
+		_, _ = w.ResponseWriter.Write(append(w.tail, liveReloadTag...))
+	}
+}
+
+// indexFold returns the index of the first ASCII case-insensitive occurrence of tag in data,
+// or -1.
+func indexFold(data []byte, tag string) int {
+	for i := 0; i+len(tag) <= len(data); i++ {
+		if bytes.EqualFold(data[i:i+len(tag)], []byte(tag)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// serveLiveReload streams "reload" and "css" events to the browser whenever the FileSystem
+// changes.
+func (d *DevServer) serveLiveReload(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := make(chan liveEvent, 1)
+	d.mu.Lock()
+	d.clients[c] = struct{}{}
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, c)
+		d.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case ev := <-c:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// reload notifies all connected browsers to reload the page.
+func (d *DevServer) reload() {
+	d.send(liveEvent{name: "reload", data: "{}"})
+}
+
+// send sends the event to all connected browsers. A pending event is replaced with a full page
+// reload, so the browsers which are slow to receive the events don't miss a change.
+func (d *DevServer) send(ev liveEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for c := range d.clients {
+		select {
+		case c <- ev:
+		default:
+			select {
+			case <-c:
+				c <- liveEvent{name: "reload", data: "{}"}
+			default:
+			}
+		}
+	}
+}
+
+// notify sends the changes to the browsers. If only stylesheets have been modified, their new
+// versions are sent in a "css" event to swap them without reloading the page. The versions are
+// the same content hashes as used by AssetComponent.
+func (d *DevServer) notify(changed []string) {
+	versions := make(map[string]string, len(changed))
+	for _, p := range changed {
+		if path.Ext(p) != ".css" {
+			d.reload()
+			return
+		}
+		data, err := fs.ReadFile(d.Handler.FileSystem, p)
+		if err != nil {
+			d.reload() // removed
+			return
+		}
+		versions["/"+p] = contentHash(data)
+	}
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		d.reload()
+		return
+	}
+	d.send(liveEvent{name: "css", data: string(data)})
+}
+
+// watch polls the FileSystem for changes until the context is canceled.
+func (d *DevServer) watch(ctx context.Context) {
+	interval := d.PollInterval
+	if interval == 0 {
+		interval = 500 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := d.snapshot()
+	for {
+		select {
+		case <-ticker.C:
+			cur := d.snapshot()
+			changed := diffSnapshots(prev, cur)
+			if len(changed) > 0 {
+				d.logger.Info("Files changed", "time", time.Now().Format(time.TimeOnly), "files", changed)
+				if slices.ContainsFunc(changed, func(p string) bool { return path.Ext(p) == chtmlExt }) {
+					d.logRoutes()
+				}
+				d.notify(changed)
+			}
+			prev = cur
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the stamps of all files in the FileSystem.
+func (d *DevServer) snapshot() map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	err := fs.WalkDir(d.Handler.FileSystem, ".", func(p string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err
+		}
+		files[p] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		d.logger.Warn("Scan file system", "error", err)
+	}
+	return files
+}
+
+// diffSnapshots returns a sorted list of files added, removed or modified between snapshots.
+func diffSnapshots(prev, cur map[string]fileStamp) []string {
+	var changed []string
+	for p, s := range cur {
+		if ps, ok := prev[p]; !ok || ps != s {
+			changed = append(changed, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// logRoutes prints the URL patterns for all page components in the FileSystem.
+func (d *DevServer) logRoutes() {
+	var routes []string
+	_ = fs.WalkDir(d.Handler.FileSystem, ".", func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p != "." && strings.HasPrefix(de.Name(), ".") {
+			if de.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !de.IsDir() && path.Ext(p) == chtmlExt && de.Name() != layoutFile {
+			r := routePattern(p) + " -> " + p
+			if m := pageMethod(de.Name()); m != "" {
+				r = m + " " + r
+			}
+			if _, draft := pageName(de.Name()); draft {
+				if !d.Handler.ShowDrafts {
+					return nil
+				}
+				r += " (draft)"
+			}
+			routes = append(routes, r)
+		}
+		return nil
+	})
+	slices.Sort(routes)
+	for _, r := range routes {
+		d.logger.Info("Route", "route", r)
+	}
+}
+
+// routePattern converts the path of a page component into the URL pattern in the net/http
+// ServeMux syntax, e.g. "posts/_slug/edit.chtml" -> "/posts/{slug}/edit".
+func routePattern(fsPath string) string {
+	segs := strings.Split(strings.TrimSuffix(fsPath, chtmlExt), "/")
+	segs[len(segs)-1], _ = pageName(segs[len(segs)-1])
+	for i, seg := range segs {
+		switch {
+		case strings.HasPrefix(seg, "__"):
+			segs[i] = "{" + seg[2:] + "...}"
+		case strings.HasPrefix(seg, "_"):
+			param, _, _ := strings.Cut(seg[1:], "[") // drop the type annotation
+			segs[i] = "{" + param + "}"
+		case seg == "index" && i == len(segs)-1:
+			segs[i] = ""
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
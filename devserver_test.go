@@ -0,0 +1,256 @@
+package pages
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestDevServer(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("backend " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := &DevServer{
+		Handler: &Handler{
+			FileSystem: fstest.MapFS{
+				"index.chtml": {Data: []byte("<html><body><h1>Index</h1></body></html>")},
+				"style.css":   {Data: []byte("body {}")},
+				"page.html":   {Data: []byte("<html><body><p>static</p></body></html>")},
+			},
+		},
+		Backend: backendURL,
+	}
+
+	tests := []struct {
+		url      string
+		wantBody string
+	}{
+		{"/", liveReloadTag + "<html><body><h1>Index</h1></body></html>"},
+		{"/page.html", "<html><body><p>static</p>" + liveReloadTag + "</body></html>"},
+		{"/style.css", "body {}"},
+		{liveReloadScriptPath, liveReloadScript},
+		{"/api/todos", "backend /api/todos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ds.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status code: got %v, want %v", rr.Code, http.StatusOK)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDevServer_Passthrough(t *testing.T) {
+	large := "<html><body>" + strings.Repeat("<p>Lorem ipsum dolor sit amet</p>", 100) + "</body></html>"
+	ds := &DevServer{
+		Handler: &Handler{
+			FileSystem: fstest.MapFS{
+				"index.chtml": {Data: []byte(large)},
+				"live.chtml":  {Data: []byte("<p><c:touching></c:touching></p>")},
+			},
+			BuiltinComponents: map[string]chtml.Component{
+				"touching": touchingComponent{n: new(atomic.Int32)},
+			},
+			Compression: true,
+		},
+	}
+	srv := httptest.NewServer(ds)
+	t.Cleanup(srv.Close)
+
+	t.Run("compressed", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", ce)
+		}
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the script is added by the asset registry before the compression
+		if want := liveReloadTag + large; string(body) != want {
+			t.Errorf("body = %q, want %q", body, want)
+		}
+	})
+
+	t.Run("event stream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/live", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		sc := bufio.NewScanner(resp.Body)
+		var event []string
+		for sc.Scan() && sc.Text() != "" {
+			event = append(event, sc.Text())
+		}
+		if want := []string{"event: message", "data: <p>1</p>"}; !slices.Equal(event, want) {
+			t.Errorf("event = %q, want %q (%v)", event, want, sc.Err())
+		}
+	})
+}
+
+func TestLiveReloadWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		writes []string
+		want   string
+	}{
+		{"split tag", nil, []string{"<body>a</bo", "DY></html>"}, "<body>a" + liveReloadTag + "</boDY></html>"},
+		{"no tag", nil, []string{"<p>a</p>", "<p>b</p>"}, "<p>a</p><p>b</p>" + liveReloadTag},
+		{"registered", nil, []string{"<head>" + liveReloadTag[:10], liveReloadTag[10:] + "</head><body></body>"}, "<head>" + liveReloadTag + "</head><body></body>"},
+		{"not html", http.Header{"Content-Type": {"text/plain"}}, []string{"</body>"}, "</body>"},
+		{"encoded", http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"br"}}, []string{"</body>"}, "</body>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			w := &liveReloadWriter{ResponseWriter: rr}
+			for k, v := range tt.header {
+				w.Header()[k] = v
+			}
+			for _, s := range tt.writes {
+				_, _ = w.Write([]byte(s))
+			}
+			w.finish()
+
+			if got := rr.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevServer_Watch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte("v1"), ModTime: time.Unix(1, 0)},
+	}
+	ds := &DevServer{Handler: &Handler{FileSystem: fsys}}
+	ds.init.Do(ds.setup)
+
+	prev := ds.snapshot()
+	fsys["index.chtml"] = &fstest.MapFile{Data: []byte("v2"), ModTime: time.Unix(2, 0)}
+	fsys["new.chtml"] = &fstest.MapFile{Data: []byte("new")}
+
+	got := diffSnapshots(prev, ds.snapshot())
+	if want := []string{"index.chtml", "new.chtml"}; !slices.Equal(got, want) {
+		t.Errorf("diffSnapshots() = %v, want %v", got, want)
+	}
+
+	srv := httptest.NewServer(ds)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + liveReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// wait for the client to subscribe
+	for i := 0; ; i++ {
+		ds.mu.Lock()
+		n := len(ds.clients)
+		ds.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("live reload client is not subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ds.reload()
+
+	buf := make([]byte, 64)
+	n, err := resp.Body.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "event: reload\n") {
+		t.Errorf("got event %q", buf[:n])
+	}
+
+	// stylesheet changes are swapped in place
+	fsys["css/app.css"] = &fstest.MapFile{Data: []byte("body {}")}
+	ds.notify([]string{"css/app.css"})
+
+	n, err = resp.Body.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "event: css\ndata: {\"/css/app.css\":\"" + contentHash([]byte("body {}")) + "\"}\n\n"
+	if string(buf[:n]) != want {
+		t.Errorf("got event %q, want %q", buf[:n], want)
+	}
+
+	// other changes reload the page
+	ds.notify([]string{"css/app.css", "index.chtml"})
+
+	n, err = resp.Body.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "event: reload\n") {
+		t.Errorf("got event %q", buf[:n])
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	tests := map[string]string{
+		"index.chtml":            "/",
+		"about.chtml":            "/about",
+		"posts/index.chtml":      "/posts/",
+		"posts/_slug/edit.chtml": "/posts/{slug}/edit",
+		"docs/__path.chtml":      "/docs/{path...}",
+		"users/_id[int].chtml":   "/users/{id}",
+		"blog/post.draft.chtml":  "/blog/post",
+	}
+	for in, want := range tests {
+		if got := routePattern(in); got != want {
+			t.Errorf("routePattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
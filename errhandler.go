@@ -2,11 +2,18 @@ package pages
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
 
 	"github.com/dpotapov/go-pages/chtml"
 )
 
 type errorHandlerComponent struct {
+	// name is the name of the imported component.
+	name string
+
 	// comp is the component to render in Render. It could be nil if the Importer failed.
 	comp chtml.Component
 
@@ -21,11 +28,14 @@ type errorHandlerComponent struct {
 }
 
 var _ chtml.Component = &errorHandlerComponent{}
+var _ chtml.InputDeclarer = &errorHandlerComponent{}
+var _ chtml.StreamRenderer = &errorHandlerComponent{}
 
 func NewErrorHandlerComponent(name string, imp chtml.Importer, fallback chtml.Component) *errorHandlerComponent {
 	comp, err := imp.Import(name)
 
 	return &errorHandlerComponent{
+		name:      name,
 		comp:      comp,
 		importErr: err,
 		fallback:  fallback,
@@ -41,6 +51,8 @@ func (eh *errorHandlerComponent) Render(s chtml.Scope) (any, error) {
 			return rr, err
 		}
 		errs[0] = err
+	} else if eh.fallback == nil {
+		return nil, eh.importErr
 	}
 
 	if multierr, ok := errs[0].(interface{ Unwrap() []error }); ok {
@@ -54,6 +66,10 @@ func (eh *errorHandlerComponent) Render(s chtml.Scope) (any, error) {
 		}
 	}
 
+	if v, ok := s.(*scope); ok {
+		v.globals.errCtx = newErrorContext(eh.name, v, eh.compErrs)
+	}
+
 	ss := s.Spawn(map[string]any{
 		"errors": eh.compErrs,
 	})
@@ -61,6 +77,17 @@ func (eh *errorHandlerComponent) Render(s chtml.Scope) (any, error) {
 	return eh.fallback.Render(ss)
 }
 
+// RenderTo streams the output of the wrapped component if it implements chtml.StreamRenderer.
+// The output written before an error can't be replaced, so the fallback component is not
+// rendered and the errors are returned.
+func (eh *errorHandlerComponent) RenderTo(w io.Writer, s chtml.Scope) error {
+	sr, ok := eh.comp.(chtml.StreamRenderer)
+	if eh.importErr != nil || !ok {
+		return chtml.ErrNotStreamable
+	}
+	return sr.RenderTo(w, s)
+}
+
 func (eh *errorHandlerComponent) Dispose() error {
 	var errs []error
 	if d, ok := eh.comp.(chtml.Disposable); ok {
@@ -71,3 +98,120 @@ func (eh *errorHandlerComponent) Dispose() error {
 	}
 	return errors.Join(errs...)
 }
+
+// Inputs returns the arguments declared by the wrapped component, or nil if it does not declare
+// them.
+func (eh *errorHandlerComponent) Inputs() map[string]any {
+	if d, ok := eh.comp.(chtml.InputDeclarer); ok {
+		return d.Inputs()
+	}
+	return nil
+}
+
+// ErrorContext describes the page that failed to render. It is available to the error component
+// (see Handler.OnErrorComponent) via the ErrorContextComponent.
+type ErrorContext struct {
+	// Component is the name of the failed page component.
+	Component string `expr:"component"`
+
+	// Route is the parameters of the matched route.
+	Route map[string]any `expr:"route"`
+
+	// Vars is a snapshot of the page variables. The values of the variables that look like
+	// secrets (e.g. "password" or "token") are redacted, long strings are truncated and
+	// the values other than scalars, maps and slices are replaced with their type names.
+	Vars map[string]any `expr:"vars"`
+
+	// RequestID is the value of the X-Request-ID header to correlate the error page with
+	// the logs.
+	RequestID string `expr:"request_id"`
+
+	// Errors is the list of the component errors, the same as the errors argument.
+	Errors []*chtml.ComponentError `expr:"errors"`
+}
+
+// ErrorContextComponent returns the ErrorContext of the failed page in the error component, e.g.:
+//
+//	<c:error-context as="ctx"></c:error-context>
+//	<p>Failed to render ${ctx.component}. Request ID: ${ctx.request_id}</p>
+//
+// Outside of the error component, the context is empty.
+type ErrorContextComponent struct{}
+
+var _ chtml.Component = ErrorContextComponent{}
+
+func (ec ErrorContextComponent) Render(s chtml.Scope) (any, error) {
+	if v, ok := s.(*scope); ok && v.globals.errCtx != nil {
+		return v.globals.errCtx, nil
+	}
+	return &ErrorContext{}, nil
+}
+
+// redactedKeyRegex matches the names of the variables which values are not exposed to the error
+// component.
+var redactedKeyRegex = regexp.MustCompile(`(?i)pass|secret|token|key|auth|cookie|session|credential`)
+
+const (
+	redacted          = "[REDACTED]"
+	maxSnapshotString = 256
+	maxSnapshotDepth  = 4
+)
+
+func newErrorContext(name string, s *scope, errs []*chtml.ComponentError) *ErrorContext {
+	ec := &ErrorContext{
+		Component: name,
+		Route:     s.globals.route,
+		Vars:      map[string]any{},
+		Errors:    errs,
+	}
+	if s.globals.req != nil {
+		ec.RequestID = s.globals.req.Header.Get("X-Request-ID")
+	}
+	for k, v := range s.Vars() {
+		ec.Vars[k] = snapshotValue(k, v, 0)
+	}
+	return ec
+}
+
+// snapshotValue returns a redacted copy of the variable value for the ErrorContext.
+func snapshotValue(key string, v any, depth int) any {
+	if redactedKeyRegex.MatchString(key) {
+		return redacted
+	}
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v
+	case reflect.String:
+		if s := rv.String(); len(s) > maxSnapshotString {
+			return s[:maxSnapshotString] + "..."
+		}
+		return rv.String()
+	case reflect.Map:
+		if depth >= maxSnapshotDepth || rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			k := it.Key().String()
+			m[k] = snapshotValue(k, it.Value().Interface(), depth+1)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if depth >= maxSnapshotDepth {
+			break
+		}
+		l := make([]any, rv.Len())
+		for i := range l {
+			l[i] = snapshotValue("", rv.Index(i).Interface(), depth+1)
+		}
+		return l
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,100 @@
+package pages
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+type failingComponent struct{}
+
+func (failingComponent) Render(s chtml.Scope) (any, error) {
+	return nil, errors.New("backend is down")
+}
+
+func TestErrorContextComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users/_id[int].chtml": {Data: []byte(`<div><c:fail></c:fail></div>`)},
+		"error.chtml": {Data: []byte(`<c:attr name="errors"></c:attr>` +
+			`<c:error-context as="ctx"></c:error-context>` +
+			`${ctx.component}:${ctx.route.id}:${ctx.request_id}:${len(ctx.errors)}`)},
+	}
+
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"fail":          failingComponent{},
+			"error-context": ErrorContextComponent{},
+		},
+		OnErrorComponent: "error",
+	}
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if want := "_id[int]:42:req-1:1"; rr.Body.String() != want {
+		t.Errorf("body: got %q, want %q", rr.Body.String(), want)
+	}
+}
+
+func TestSnapshotValue(t *testing.T) {
+	got := snapshotValue("", map[string]any{
+		"user":     map[string]any{"name": "joe", "password": "secret"},
+		"api_key":  "k",
+		"ids":      []int{1, 2},
+		"long":     strings.Repeat("x", maxSnapshotString+1),
+		"callback": func() {},
+	}, 0)
+
+	want := map[string]any{
+		"user":     map[string]any{"name": "joe", "password": redacted},
+		"api_key":  redacted,
+		"ids":      []any{1, 2},
+		"long":     strings.Repeat("x", maxSnapshotString) + "...",
+		"callback": "func()",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestErrorComponent_Watch(t *testing.T) {
+	for _, watch := range []bool{false, true} {
+		fsys := fstest.MapFS{
+			"index.chtml": {Data: []byte(`<c:fail></c:fail>`)},
+			"error.chtml": {Data: []byte(`<c:attr name="errors"></c:attr>v1`)},
+		}
+		h := &Handler{
+			FileSystem:        fsys,
+			BuiltinComponents: map[string]chtml.Component{"fail": failingComponent{}},
+			OnErrorComponent:  "error",
+			Watch:             watch,
+		}
+
+		get := func() string {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			return rr.Body.String()
+		}
+
+		if got := get(); got != "v1" {
+			t.Fatalf("watch=%v: got %q, want v1", watch, got)
+		}
+		fsys["error.chtml"] = &fstest.MapFile{Data: []byte(`<c:attr name="errors"></c:attr>v2`)}
+
+		want := "v1"
+		if watch {
+			want = "v2"
+		}
+		if got := get(); got != want {
+			t.Errorf("watch=%v: got %q after the change, want %q", watch, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package pages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// VersionCollector is implemented by the scopes of the page requests to collect the versions of
+// the data the components render, e.g. the ETag of an API response or the version of a database
+// row. The Handler combines the versions into the ETag of the page, so a client revalidating
+// the page (e.g. an HTMX fragment polled every few seconds) receives 304 Not Modified when
+// the data has not changed:
+//
+//	if vc, ok := s.(pages.VersionCollector); ok {
+//		vc.AddVersion("order/" + id + "@" + strconv.Itoa(order.Version))
+//	}
+//
+// The ETag is sent only if all the components rendering the changing data report the versions.
+type VersionCollector interface {
+	// AddVersion adds the version of the data rendered by the component. The version should
+	// identify the data too, e.g. "orders@42" rather than "42".
+	AddVersion(version string)
+}
+
+// dataVersions collects the data versions reported during a render pass.
+type dataVersions struct {
+	// seed is mixed into the ETag, so the ETags change with the locale of the request and when
+	// the application is restarted, e.g. with the changed pages.
+	seed string
+
+	mu       sync.Mutex
+	versions []string
+}
+
+func (dv *dataVersions) add(version string) {
+	if dv == nil {
+		return
+	}
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	dv.versions = append(dv.versions, version)
+}
+
+// reset clears the versions before a new render pass.
+func (dv *dataVersions) reset() {
+	if dv == nil {
+		return
+	}
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	dv.versions = nil
+}
+
+// etag returns the weak ETag of the collected versions, or an empty string if no version has been
+// reported.
+func (dv *dataVersions) etag() string {
+	if dv == nil {
+		return ""
+	}
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	if len(dv.versions) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(dv.seed))
+	for _, v := range dv.versions {
+		h.Write([]byte{0})
+		h.Write([]byte(v))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// apply sets the ETag header of a successful GET or HEAD response. It returns true if the request
+// has the matching If-None-Match header, i.e. the response must be 304 Not Modified.
+func (dv *dataVersions) apply(h http.Header, r *http.Request, statusCode int) bool {
+	return applyETag(h, r, statusCode, dv.etag())
+}
+
+// applyETag sets the ETag header of a successful GET or HEAD response unless it is set already.
+// It returns true if the request has the matching If-None-Match header.
+func applyETag(h http.Header, r *http.Request, statusCode int, etag string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if statusCode != 0 && statusCode != http.StatusOK || h.Get("ETag") != "" || etag == "" {
+		return false
+	}
+	h.Set("ETag", etag)
+	return etagMatch(r.Header.Get("If-None-Match"), etag)
+}
+
+// outputETag returns the strong ETag of the rendered output of a page, see Handler.OutputETags.
+func outputETag(output []byte) string {
+	sum := sha256.Sum256(output)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// etagMatch reports whether the If-None-Match header value matches the etag. The comparison is
+// weak, as required for If-None-Match, and the ETags of the compressed responses match the etag
+// of the identity response (see gzipETagSuffix).
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == strings.TrimSuffix(etag, `"`)+gzipETagSuffix+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// AddVersion adds the version of the data rendered by the page (see VersionCollector).
+func (s *scope) AddVersion(version string) {
+	s.globals.versions.add(version)
+}
+
+// DataVersionComponent reports the version of the data rendered by the page (see
+// VersionCollector), e.g.:
+//
+//	<c:data-version value="${'orders@' + string(orders.version)}"></c:data-version>
+//
+// The component renders nothing and is opt-in:
+//
+//	handler.BuiltinComponents["data-version"] = pages.DataVersionComponent{}
+type DataVersionComponent struct{}
+
+var _ chtml.Component = DataVersionComponent{}
+
+func (DataVersionComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		Value any
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+	if vc, ok := s.(VersionCollector); ok && args.Value != nil {
+		vc.AddVersion(fmt.Sprint(args.Value))
+	}
+	return nil, nil
+}
@@ -0,0 +1,144 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPages_DataVersionETag(t *testing.T) {
+	version := "1"
+	api := http.NewServeMux()
+	api.HandleFunc("/api/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"orders-`+version+`"`)
+		_, _ = w.Write([]byte("orders " + version))
+	})
+
+	fsys := fstest.MapFS{
+		"orders.chtml":   {Data: []byte(`<c:http-call url="/api/orders" as="res"></c:http-call><p>${res.body}</p>`)},
+		"count/_n.chtml": {Data: []byte(`<c:route as="r" /><c:data-version value="count@${r.n}"></c:data-version><p>${r.n}</p>`)},
+		"plain.chtml":    {Data: []byte(`<p>plain</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"http-call":    NewHttpCallComponent(api),
+			"data-version": DataVersionComponent{},
+			"route":        RouteComponent{},
+		},
+	}
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/orders", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.String() != "<p>orders 1</p>" {
+		t.Fatalf("status = %d, etag = %q, body = %q", rec.Code, etag, rec.Body.String())
+	}
+
+	rec = get("/orders", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+		t.Errorf("unchanged: status = %d, etag = %q, body = %q", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+
+	version = "2"
+	rec = get("/orders", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || rec.Body.String() != "<p>orders 2</p>" {
+		t.Errorf("changed: status = %d, etag = %q, body = %q", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+
+	etag1 := get("/count/1", "").Header().Get("ETag")
+	if etag1 == "" || etag1 == get("/count/2", "").Header().Get("ETag") {
+		t.Errorf("count: etag = %q", etag1)
+	}
+	if rec := get("/count/1", `"other", `+etag1); rec.Code != http.StatusNotModified {
+		t.Errorf("count: status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	if rec := get("/plain", "*"); rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+		t.Errorf("plain: status = %d, etag = %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestPages_OutputETag(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<c:attr name="n">${1}</c:attr><p>${n}</p>`)},
+	}
+	h := &Handler{FileSystem: fsys, OutputETags: true}
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || rr.Body.String() != "<p>1</p>" {
+		t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+	}
+	if etag != outputETag([]byte("<p>1</p>")) || etag[0] != '"' {
+		t.Fatalf("ETag = %q", etag)
+	}
+
+	rr = get(etag)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("revalidation: got %d %q, want 304", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("ETag"); got != etag {
+		t.Errorf("revalidation ETag = %q, want %q", got, etag)
+	}
+
+	if rr := get(`"stale"`); rr.Code != http.StatusOK {
+		t.Errorf("stale ETag: got %d, want 200", rr.Code)
+	}
+}
+
+func TestPages_OutputETagCompressed(t *testing.T) {
+	page := strings.Repeat("<p>Lorem ipsum dolor sit amet</p>", 100)
+	fsys := fstest.MapFS{"index.chtml": {Data: []byte(page)}}
+	h := &Handler{FileSystem: fsys, OutputETags: true, Compression: true}
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	identity := get("", "").Header().Get("ETag")
+	rr := get("gzip", "")
+	gzipped := rr.Header().Get("ETag")
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("the response is not compressed: %v", rr.Header())
+	}
+	if identity != outputETag([]byte(page)) || gzipped == identity {
+		t.Fatalf("ETags of the identity and gzip responses: %q, %q", identity, gzipped)
+	}
+
+	for _, etag := range []string{identity, gzipped} {
+		if rr := get("gzip", etag); rr.Code != http.StatusNotModified {
+			t.Errorf("revalidation with %s: got %d, want 304", etag, rr.Code)
+		}
+	}
+}
@@ -41,11 +41,22 @@ func (t *todos) Render(s chtml.Scope) (any, error) {
 
 	if t.sub == nil {
 		t.sub = t.db.Subscribe()
-		go func() {
-			for range t.sub {
-				s.Touch()
-			}
-		}()
+
+		// start the updater once the page is sent to the client, stop it before Dispose
+		rc := chtml.RenderContextOf(s)
+		sub := t.sub
+		rc.AfterRender(func() {
+			rc.Go(func() {
+				for {
+					select {
+					case <-sub:
+						s.Touch()
+					case <-rc.Done():
+						return
+					}
+				}
+			})
+		})
 	}
 
 	todos := t.db.Todos()
@@ -0,0 +1,204 @@
+package pages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ExportOptions configures Handler.Export.
+type ExportOptions struct {
+	// Params returns the parameters of the dynamic route to export it with, one map per page,
+	// e.g. [{"slug": "hello"}, {"slug": "world"}] for "posts/_slug.chtml". The route is the path
+	// to the page in the FileSystem. The catch-all parameters may contain slashes. The dynamic
+	// routes are skipped if Params is nil or returns no parameters.
+	Params func(route string) ([]map[string]string, error)
+
+	// Paths are the URL paths of the additional pages to export, e.g. the pages of a catch-all
+	// route.
+	Paths []string
+}
+
+// Export renders the pages of the FileSystem and writes them to the directory together with
+// the static files, so the site can be deployed to a static file hosting without a Go server.
+// The static routes are exported as is, the dynamic ones with the parameters returned by
+// opts.Params. The pages are written as NAME.html (index.html for the directory indexes), or
+// with the extension of their media type for the data pages, e.g. NAME.json. The static files
+// are written as served, i.e. after the AssetTransformers. The hidden files and directories
+// (e.g. .lib with the components, but not .well-known), the layouts, the drafts (unless
+// ShowDrafts is set) and the pages specific to the methods other than GET are not exported.
+//
+// The pages are rendered with GET requests, so the components must not depend on the request
+// headers, the cookies or the sessions. The pages responding with a status other than 200 OK are
+// not written. The errors of all the pages are returned joined.
+func (h *Handler) Export(dir string, opts *ExportOptions) error {
+	h.init.Do(h.setup)
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+
+	pages, files, err := h.pageFiles()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	urls := slices.Clone(opts.Paths)
+	for _, p := range pages {
+		if m := pageMethod(path.Base(p)); m != "" && m != http.MethodGet {
+			continue // the pages are exported with GET requests
+		}
+		if !isDynamicRoute(p) {
+			urls = append(urls, routeURL(p, nil))
+			continue
+		}
+		if opts.Params == nil {
+			continue
+		}
+		params, err := opts.Params(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", p, err))
+			continue
+		}
+		for _, pp := range params {
+			if err := checkRouteParams(p, pp); err != nil {
+				errs = append(errs, fmt.Errorf("export %s: %w", p, err))
+				continue
+			}
+			urls = append(urls, routeURL(p, pp))
+		}
+	}
+
+	for _, u := range urls {
+		if err := h.exportPage(dir, u); err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", u, err))
+		}
+	}
+	for _, f := range files {
+		if isDynamicRoute(path.Dir(f)) {
+			continue // served for each value of the parameter
+		}
+		if err := h.exportFile(dir, f); err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", f, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pageFiles returns the paths of the routable pages and of the static files in the FileSystem,
+// sorted. The hidden files and directories (except .well-known), the layouts and the drafts
+// (unless ShowDrafts is set) are skipped.
+func (h *Handler) pageFiles() (pages, files []string, err error) {
+	err = fs.WalkDir(h.FileSystem, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if p != "." && name[0] == '.' && p != ".well-known" {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if path.Ext(name) != chtmlExt {
+			files = append(files, p)
+			return nil
+		}
+		if _, draft := pageName(name); name == layoutFile || draft && !h.ShowDrafts {
+			return nil
+		}
+		pages = append(pages, p)
+		return nil
+	})
+	return pages, files, err
+}
+
+// exportWriter is an http.ResponseWriter buffering the exported page.
+type exportWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *exportWriter) Header() http.Header { return w.header }
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+func (w *exportWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+// exportedTypes are the extensions of the exported data pages by media type.
+var exportedTypes = map[string]string{
+	"text/html":        ".html",
+	"application/json": ".json",
+	"application/xml":  ".xml",
+	"text/plain":       ".txt",
+}
+
+// exportPage renders the page at the URL path and writes it to the directory.
+func (h *Handler) exportPage(dir, urlPath string) error {
+	r, err := http.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return err
+	}
+	w := &exportWriter{header: make(http.Header)}
+	h.ServeHTTP(w, r)
+	if w.status != http.StatusOK && w.status != 0 {
+		return fmt.Errorf("status %d %s", w.status, http.StatusText(w.status))
+	}
+
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index"
+	}
+	if name, err = url.PathUnescape(name); err != nil {
+		return err
+	}
+	ext := ".html"
+	if mt, _, err := mime.ParseMediaType(w.header.Get("Content-Type")); err == nil {
+		if e, ok := exportedTypes[mt]; ok {
+			ext = e
+		}
+	}
+	return writeExportFile(dir, name+ext, w.buf.Bytes())
+}
+
+// exportFile writes the static file to the directory as it is served.
+func (h *Handler) exportFile(dir, name string) error {
+	data, err := fs.ReadFile(h.FileSystem, name)
+	if err != nil {
+		return err
+	}
+	return writeExportFile(dir, name, h.transformAsset(name, data))
+}
+
+func writeExportFile(dir, name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
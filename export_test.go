@@ -0,0 +1,123 @@
+package pages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPages_Export(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":               {Data: []byte(`<h1>Home</h1>`)},
+		"about.chtml":               {Data: []byte(`<p>About</p>`)},
+		"wip.draft.chtml":           {Data: []byte(`<p>WIP</p>`)},
+		"posts/_layout.chtml":       {Data: []byte(`<main>${_}</main>`)},
+		"posts/index.chtml":         {Data: []byte(`<ul></ul>`)},
+		"posts/_slug.chtml":         {Data: []byte(`<c:route as="r"></c:route><h1>${r.slug}</h1>`)},
+		"users/_id[int]/card.chtml": {Data: []byte(`<c:route as="r"></c:route><p>${r.id + 1}</p>`)},
+		"users/_id[int]/photo.png":  {Data: []byte("png")},
+		"docs/__path.chtml":         {Data: []byte(`<c:route as="r"></c:route><p>${r.path}</p>`)},
+		"api/stats.chtml":           {Data: []byte(`${ {"pages": 3} }`)},
+		"broken.chtml":              {Data: []byte(`<c:http-response status="${500}"></c:http-response>`)},
+		"css/app.css":               {Data: []byte("body {\n  color: red;\n}\n")},
+		".lib/card.chtml":           {Data: []byte(`<div></div>`)},
+		".well-known/security.txt":  {Data: []byte("Contact: me")},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"route":         RouteComponent{},
+			"http-response": HttpResponseComponent{},
+		},
+		AssetTransformers: map[string][]AssetTransformer{".css": {MinifyCSS}},
+	}
+
+	dir := t.TempDir()
+	err := h.Export(dir, &ExportOptions{
+		Params: func(route string) ([]map[string]string, error) {
+			switch route {
+			case "posts/_slug.chtml":
+				return []map[string]string{{"slug": "hello"}, {"slug": "a b"}}, nil
+			case "users/_id[int]/card.chtml":
+				return []map[string]string{{"id": "41"}, {"id": "x"}}, nil
+			case "docs/__path.chtml":
+				return []map[string]string{{"path": "guide/intro"}}, nil
+			}
+			return nil, errors.New("unexpected route " + route)
+		},
+	})
+	wantErrs := []string{
+		`export users/_id[int]/card.chtml: invalid value "x" of route parameter id`,
+		`export /broken: status 500 Internal Server Error`,
+	}
+	for _, want := range wantErrs {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error: got %v, want %q", err, want)
+		}
+	}
+
+	want := map[string]string{
+		"index.html":               `<h1>Home</h1>`,
+		"about.html":               `<p>About</p>`,
+		"posts/index.html":         `<main><ul></ul></main>`,
+		"posts/hello.html":         `<main><h1>hello</h1></main>`,
+		"posts/a b.html":           `<main><h1>a b</h1></main>`,
+		"users/41/card.html":       `<p>42</p>`,
+		"docs/guide/intro.html":    `<p>/guide/intro</p>`,
+		"api/stats.json":           `{"pages":3}` + "\n",
+		"css/app.css":              `body{color:red}`,
+		".well-known/security.txt": "Contact: me",
+	}
+	var got []string
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("%s: got %q, want %q", name, data, content)
+		}
+	}
+	if len(got) != len(want) {
+		slices.Sort(got)
+		t.Errorf("exported files: %v", got)
+	}
+}
+
+func TestRouteURL(t *testing.T) {
+	tests := []struct {
+		route  string
+		params map[string]string
+		want   string
+	}{
+		{"index.chtml", nil, "/"},
+		{"about.draft.chtml", nil, "/about"},
+		{"blog/index.chtml", nil, "/blog/"},
+		{"_user/index.chtml", map[string]string{"user": "joe"}, "/joe/"},
+		{"posts/_id[int].chtml", map[string]string{"id": "5"}, "/posts/5"},
+		{"__path.chtml", map[string]string{"path": "a b/c"}, "/a%20b/c"},
+	}
+	for _, tt := range tests {
+		if got := routeURL(tt.route, tt.params); got != tt.want {
+			t.Errorf("routeURL(%q, %v) = %q, want %q", tt.route, tt.params, got, tt.want)
+		}
+	}
+}
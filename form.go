@@ -0,0 +1,610 @@
+package pages
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// FormComponent re-renders a posted form fragment (e.g. an HTMX form) with the submitted values
+// and validation errors bound automatically, so the form templates don't need to repopulate
+// every field by hand. It also decodes and validates the submitted values.
+//
+// The body of the component is the form markup. The following arguments are accepted:
+//   - values - a map of field values, the request body (JSON or form data) by default, or the
+//     query parameters for GET and HEAD requests;
+//   - errors - a map of validation errors by field name. A message can be a string, a list
+//     of strings or an error. These errors take precedence over the errors of the rules;
+//   - fields - the shape of the values: a map of the default values by field name. The submitted
+//     values are converted to the types of the defaults (strings, numbers, booleans and lists),
+//     the missing ones are set to the defaults, the undeclared ones are dropped;
+//   - rules - a map of the validation rules by field name, e.g. {"age": {"required": true,
+//     "min": 18}}. The rules are: required, min and max (numbers), minlength and maxlength
+//     (the number of characters), pattern (a regular expression the whole value must match) and
+//     validate (the name or a list of names of the Validators).
+//
+// The rules are checked when the form is submitted: for a request other than GET or HEAD, when
+// the values argument is set or any of the fields is present in the values.
+//
+// The fields are matched by the name attribute:
+//   - <input> gets the value attribute (checkboxes and radio buttons get the checked attribute
+//     instead, the checkboxes missing in the values are unchecked). Password and file inputs are
+//     never repopulated;
+//   - <textarea> gets the text content;
+//   - <select> gets the selected attribute on the matching options.
+//
+// The fields with errors get the aria-invalid="true" attribute, and the elements with the
+// data-error-for="NAME" attribute get the error message of the NAME field as the text content.
+//
+// Without a body, the component returns the decoded form as a map with the values, errors (a map
+// of messages by field name) and valid (true if there are no errors) keys instead.
+//
+// Example:
+//
+//	<c:form as="form" fields="${ {'email': '', 'age': 0} }"
+//	        rules="${ {'email': {'required': true, 'maxlength': 254}, 'age': {'min': 18}} }"></c:form>
+//	<c:form values="${form.values}" errors="${form.errors}">
+//	  <form hx-post="/signup">
+//	    <input name="email">
+//	    <span data-error-for="email"></span>
+//	  </form>
+//	</c:form>
+type FormComponent struct {
+	// Validators are the custom validators referenced by the validate rule, by name. A validator
+	// gets the decoded value of the field and returns an error with the message for the user.
+	Validators map[string]FormValidator
+}
+
+// FormValidator validates the decoded value of a form field.
+type FormValidator func(v any) error
+
+var _ chtml.Component = FormComponent{}
+
+func (fc FormComponent) Render(s chtml.Scope) (any, error) {
+	vars := s.Vars()
+
+	n, ok := vars["_"].(*html.Node)
+	if !ok && vars["_"] != nil {
+		return vars["_"], nil
+	}
+
+	values, ok := vars["values"].(map[string]any)
+	submitted := ok
+	if !ok {
+		if v, ok := s.(*scope); ok && v.globals.req != nil {
+			ra := v.requestArg()
+			switch ra.Method {
+			case "GET", "HEAD":
+				if len(ra.Query) > 0 {
+					values = map[string]any{}
+					for k, v := range ra.Query {
+						values[k] = v
+					}
+				}
+			default:
+				values = ra.Body
+				submitted = true
+			}
+		}
+	}
+
+	fields, _ := vars["fields"].(map[string]any)
+	rules, err := formRules(vars["rules"])
+	if err != nil {
+		return nil, err
+	}
+	for k := range values {
+		if _, ok := fields[k]; ok {
+			submitted = true
+		} else if _, ok := rules[k]; ok {
+			submitted = true
+		}
+	}
+
+	decoded, errs := decodeForm(values, fields)
+	if submitted {
+		for name, r := range rules {
+			if _, ok := errs[name]; ok {
+				continue
+			}
+			msg, err := fc.validate(decoded[name], r)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			if msg != "" {
+				errs[name] = msg
+			}
+		}
+	} else {
+		clear(errs)
+	}
+
+	explicit, err := formErrors(vars["errors"])
+	if err != nil {
+		return nil, err
+	}
+	for k, msg := range explicit {
+		errs[k] = msg
+	}
+
+	if n == nil {
+		errsAny := make(map[string]any, len(errs))
+		for k, msg := range errs {
+			errsAny[k] = msg
+		}
+		return map[string]any{
+			"values": decoded,
+			"errors": errsAny,
+			"valid":  len(errs) == 0,
+		}, nil
+	}
+
+	n = cloneNode(n)
+	bindForm(n, values, errs)
+	return n, nil
+}
+
+// formRules converts the rules argument to the rules by field name.
+func formRules(v any) (map[string]map[string]any, error) {
+	rules := map[string]map[string]any{}
+	switch v := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, r := range v {
+			m, ok := r.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("rules of %s must be a map, got %T", k, r)
+			}
+			rules[k] = m
+		}
+	default:
+		return nil, fmt.Errorf("rules must be a map, got %T", v)
+	}
+	return rules, nil
+}
+
+// decodeForm converts the submitted values to the types of the fields defaults. Without the
+// fields, the values are returned as is. The values that can't be converted are reported as
+// errors and set to the defaults.
+func decodeForm(values, fields map[string]any) (map[string]any, map[string]string) {
+	errs := map[string]string{}
+	if fields == nil {
+		decoded := make(map[string]any, len(values))
+		for k, v := range values {
+			decoded[k] = v
+		}
+		return decoded, errs
+	}
+
+	decoded := make(map[string]any, len(fields))
+	for k, def := range fields {
+		v, ok := values[k]
+		if !ok {
+			if _, isBool := def.(bool); isBool && values != nil {
+				decoded[k] = false // unchecked boxes are not submitted
+			} else {
+				decoded[k] = def
+			}
+			continue
+		}
+		dv, err := decodeField(v, def)
+		if err != nil {
+			errs[k] = err.Error()
+			dv = def
+		}
+		decoded[k] = dv
+	}
+	return decoded, errs
+}
+
+// decodeField converts the submitted value of a field to the type of its default value. The
+// value is a string or a list of strings of a form, or a value of a JSON body.
+func decodeField(v any, def any) (any, error) {
+	switch def.(type) {
+	case int, int64, float64:
+		if f, ok := jsonNumber(v); ok {
+			return decodeNumber(f, def)
+		}
+	}
+
+	vv := formValues(v)
+	first := ""
+	if len(vv) > 0 {
+		first = strings.TrimSpace(vv[0])
+	}
+	switch def.(type) {
+	case string:
+		if len(vv) == 0 {
+			return "", nil
+		}
+		return vv[0], nil
+	case bool:
+		switch strings.ToLower(first) {
+		case "", "false", "off", "0", "no":
+			return false, nil
+		}
+		return true, nil
+	case int, int64:
+		if first == "" {
+			return def, nil
+		}
+		i, err := strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if _, ok := def.(int); ok {
+			return int(i), nil
+		}
+		return i, nil
+	case float64:
+		if first == "" {
+			return def, nil
+		}
+		f, err := strconv.ParseFloat(first, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case []any, []string:
+		list := make([]any, len(vv))
+		for i, v := range vv {
+			list[i] = v
+		}
+		return list, nil
+	}
+	if len(vv) == 1 {
+		return vv[0], nil
+	}
+	return vv, nil
+}
+
+// jsonNumber returns the number of a JSON body, decoded as float64 or json.Number.
+func jsonNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// decodeNumber converts the number f to the type of the default value def, int, int64 or
+// float64.
+func decodeNumber(f float64, def any) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("must be a number")
+	}
+	if _, ok := def.(float64); ok {
+		return f, nil
+	}
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, fmt.Errorf("must be an integer")
+	}
+	if _, ok := def.(int); ok {
+		return int(f), nil
+	}
+	return int64(f), nil
+}
+
+// validate checks the decoded value of a field against its rules. It returns the message of the
+// first failed rule, or an error if the rules are invalid.
+func (fc FormComponent) validate(v any, rules map[string]any) (string, error) {
+	if isEmptyValue(v) {
+		if truthy, _ := rules["required"].(bool); truthy {
+			return "required", nil
+		}
+		return "", nil // the optional fields are validated only if set
+	}
+
+	for _, key := range []string{"min", "max"} {
+		limit, ok := rules[key]
+		if !ok {
+			continue
+		}
+		lf, ok := formNumber(limit)
+		if !ok {
+			return "", fmt.Errorf("%s must be a number, got %T", key, limit)
+		}
+		f, ok := formNumber(v)
+		if !ok {
+			return "must be a number", nil
+		}
+		if key == "min" && f < lf {
+			return fmt.Sprintf("must be at least %v", limit), nil
+		}
+		if key == "max" && f > lf {
+			return fmt.Sprintf("must be at most %v", limit), nil
+		}
+	}
+
+	text := strings.Join(formValues(v), "")
+	for _, key := range []string{"minlength", "maxlength"} {
+		limit, ok := rules[key]
+		if !ok {
+			continue
+		}
+		lf, ok := formNumber(limit)
+		if !ok {
+			return "", fmt.Errorf("%s must be a number, got %T", key, limit)
+		}
+		n := float64(utf8.RuneCountInString(text))
+		if key == "minlength" && n < lf {
+			return fmt.Sprintf("must be at least %v characters", limit), nil
+		}
+		if key == "maxlength" && n > lf {
+			return fmt.Sprintf("must be at most %v characters", limit), nil
+		}
+	}
+
+	if pattern, ok := rules["pattern"]; ok {
+		ps, ok := pattern.(string)
+		if !ok {
+			return "", fmt.Errorf("pattern must be a string, got %T", pattern)
+		}
+		re, err := regexp.Compile("^(?:" + ps + ")$")
+		if err != nil {
+			return "", fmt.Errorf("pattern: %w", err)
+		}
+		if !re.MatchString(text) {
+			return "invalid format", nil
+		}
+	}
+
+	for _, name := range formValues(rules["validate"]) {
+		validator, ok := fc.Validators[name]
+		if !ok {
+			return "", fmt.Errorf("unknown validator %q", name)
+		}
+		if err := validator(v); err != nil {
+			return err.Error(), nil
+		}
+	}
+	return "", nil
+}
+
+// isEmptyValue reports whether the decoded value of a field is not set: nil, an empty or
+// blank string, false or an empty list.
+func isEmptyValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case bool:
+		return !v
+	case []any:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	}
+	return false
+}
+
+// formNumber converts a number or a numeric string to float64. NaN and infinities are not
+// numbers, they would pass any min and max rules.
+func formNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	case []string:
+		if len(v) == 1 {
+			return formNumber(v[0])
+		}
+	case []any:
+		if len(v) == 1 {
+			return formNumber(v[0])
+		}
+	}
+	return 0, false
+}
+
+// formErrors converts the errors argument to a map of messages by field name.
+func formErrors(v any) (map[string]string, error) {
+	errs := map[string]string{}
+
+	switch v := v.(type) {
+	case nil:
+	case map[string]string:
+		return v, nil
+	case map[string]any:
+		for k, msg := range v {
+			if s := formValues(msg); len(s) > 0 {
+				errs[k] = strings.Join(s, "; ")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("errors must be a map, got %T", v)
+	}
+	return errs, nil
+}
+
+// formValues converts a submitted value to a list of strings: form data is decoded as lists of
+// strings, JSON data as scalars or lists.
+func formValues(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		var ss []string
+		for _, e := range v {
+			ss = append(ss, formValues(e)...)
+		}
+		return ss
+	case error:
+		return []string{v.Error()}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// bindForm sets the values and errors to the form fields in the tree rooted at n.
+func bindForm(n *html.Node, values map[string]any, errs map[string]string) {
+	if n.Type == html.ElementNode {
+		name := getAttr(n, "name")
+
+		if _, ok := errs[name]; ok && name != "" && isFormField(n) {
+			setAttr(n, "aria-invalid", "true")
+		}
+
+		if errFor := getAttr(n, "data-error-for"); errFor != "" {
+			if msg, ok := errs[errFor]; ok {
+				setText(n, msg)
+			}
+		}
+
+		if v, ok := values[name]; ok && name != "" {
+			bindField(n, formValues(v))
+		} else if values != nil && name != "" && isCheckbox(n) {
+			delAttr(n, "checked") // unchecked boxes are not submitted
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		bindForm(c, values, errs)
+	}
+}
+
+// bindField sets the submitted values to the form field.
+func bindField(n *html.Node, vv []string) {
+	switch n.DataAtom {
+	case atom.Input:
+		switch strings.ToLower(getAttr(n, "type")) {
+		case "password", "file", "submit", "button", "reset", "image":
+		case "checkbox", "radio":
+			value := getAttr(n, "value")
+			if value == "" {
+				value = "on"
+			}
+			if slices.Contains(vv, value) {
+				setAttr(n, "checked", "")
+			} else {
+				delAttr(n, "checked")
+			}
+		default:
+			if len(vv) > 0 {
+				setAttr(n, "value", vv[0])
+			}
+		}
+	case atom.Textarea:
+		if len(vv) > 0 {
+			setText(n, vv[0])
+		}
+	case atom.Select:
+		var walk func(*html.Node)
+		walk = func(c *html.Node) {
+			for ; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && c.DataAtom == atom.Option {
+					value, ok := lookupAttr(c, "value")
+					if !ok {
+						value = textContent(c)
+					}
+					if slices.Contains(vv, value) {
+						setAttr(c, "selected", "")
+					} else {
+						delAttr(c, "selected")
+					}
+				}
+				walk(c.FirstChild)
+			}
+		}
+		walk(n.FirstChild)
+	}
+}
+
+func isCheckbox(n *html.Node) bool {
+	return n.DataAtom == atom.Input && strings.EqualFold(getAttr(n, "type"), "checkbox")
+}
+
+func isFormField(n *html.Node) bool {
+	return n.DataAtom == atom.Input || n.DataAtom == atom.Textarea || n.DataAtom == atom.Select
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func getAttr(n *html.Node, key string) string {
+	v, _ := lookupAttr(n, key)
+	return v
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && strings.EqualFold(a.Key, key) {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func delAttr(n *html.Node, key string) {
+	n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+		return a.Namespace == "" && strings.EqualFold(a.Key, key)
+	})
+}
+
+// setText replaces the children of n with a text node.
+func setText(n *html.Node, text string) {
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		n.RemoveChild(c)
+	}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(sb.String())
+}
+
+// cloneNode returns a deep copy of the HTML tree.
+func cloneNode(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      slices.Clone(n.Attr),
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneNode(c))
+	}
+	return clone
+}
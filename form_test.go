@@ -0,0 +1,201 @@
+package pages
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestFormComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"signup.chtml": {Data: []byte(
+			`<c:attr name="errs">${ {"email": "invalid email", "terms": ["required"]} }</c:attr>` +
+				`<c:form errors="${errs}"><form>` +
+				`<input name="email" value="default">` +
+				`<span data-error-for="email">hint</span>` +
+				`<input name="password" type="password">` +
+				`<input name="terms" type="checkbox" checked>` +
+				`<input name="tags" type="checkbox" value="a"><input name="tags" type="checkbox" value="b">` +
+				`<textarea name="bio"></textarea>` +
+				`<select name="plan"><option>free</option><option value="pro">Pro</option></select>` +
+				`</form></c:form>`)},
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"form": FormComponent{}},
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "form data",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "email=foo%40&password=secret&tags=b&bio=hello&plan=pro",
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"email": "foo@", "password": "secret", "tags": ["b"], "bio": "hello", "plan": "pro"}`,
+		},
+	}
+
+	want := `<form>` +
+		`<input name="email" value="foo@" aria-invalid="true"/>` +
+		`<span data-error-for="email">invalid email</span>` +
+		`<input name="password" type="password"/>` +
+		`<input name="terms" type="checkbox" aria-invalid="true"/>` +
+		`<input name="tags" type="checkbox" value="a"/><input name="tags" type="checkbox" value="b" checked=""/>` +
+		`<textarea name="bio">hello</textarea>` +
+		`<select name="plan"><option>free</option><option value="pro" selected="">Pro</option></select>` +
+		`</form>`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/signup", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status code: got %v, want %v", rr.Code, http.StatusOK)
+			}
+			if rr.Body.String() != want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), want)
+			}
+		})
+	}
+}
+
+func TestFormComponent_Validate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"signup.chtml": {Data: []byte(
+			`<c:form as="form" ` +
+				`fields="${ {'email': '', 'age': 0, 'terms': false, 'tags': []} }" ` +
+				`rules="${ {'email': {'required': true, 'pattern': '.+@.+', 'validate': 'unique'}, ` +
+				`'age': {'min': 18, 'max': 120}, 'terms': {'required': true}, 'tags': {'maxlength': 5}} }">` +
+				`</c:form>` +
+				`<p>${form.valid}</p><p>${form.values}</p><p>${form.errors}</p>` +
+				`<c:form values="${form.values}" errors="${form.errors}"><form>` +
+				`<input name="email"><span data-error-for="email"></span>` +
+				`</form></c:form>`)},
+	}
+
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{"form": FormComponent{
+			Validators: map[string]FormValidator{
+				"unique": func(v any) error {
+					if v == "taken@example.com" {
+						return errors.New("already registered")
+					}
+					return nil
+				},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   string
+	}{
+		{
+			name:   "not submitted",
+			method: "GET",
+			want: `<p>true</p><p>{&#34;age&#34;:0,&#34;email&#34;:&#34;&#34;,&#34;tags&#34;:[],&#34;terms&#34;:false}</p><p>{}</p>` +
+				`<form><input name="email" value=""/><span data-error-for="email"></span></form>`,
+		},
+		{
+			name:   "valid",
+			method: "POST",
+			body:   "email=foo%40example.com&age=30&terms=on&tags=a&tags=b",
+			want: `<p>true</p><p>{&#34;age&#34;:30,&#34;email&#34;:&#34;foo@example.com&#34;,&#34;tags&#34;:[&#34;a&#34;,&#34;b&#34;],&#34;terms&#34;:true}</p><p>{}</p>` +
+				`<form><input name="email" value="foo@example.com"/><span data-error-for="email"></span></form>`,
+		},
+		{
+			name:   "invalid",
+			method: "POST",
+			body:   "email=foo&age=x&tags=abc&tags=def",
+			want: `<p>false</p><p>{&#34;age&#34;:0,&#34;email&#34;:&#34;foo&#34;,&#34;tags&#34;:[&#34;abc&#34;,&#34;def&#34;],&#34;terms&#34;:false}</p>` +
+				`<p>{&#34;age&#34;:&#34;must be an integer&#34;,&#34;email&#34;:&#34;invalid format&#34;,&#34;tags&#34;:&#34;must be at most 5 characters&#34;,&#34;terms&#34;:&#34;required&#34;}</p>` +
+				`<form><input name="email" aria-invalid="true" value="foo"/><span data-error-for="email">invalid format</span></form>`,
+		},
+		{
+			name:   "custom validator",
+			method: "POST",
+			body:   "email=taken%40example.com&age=17&terms=on",
+			want: `<p>false</p><p>{&#34;age&#34;:17,&#34;email&#34;:&#34;taken@example.com&#34;,&#34;tags&#34;:[],&#34;terms&#34;:true}</p>` +
+				`<p>{&#34;age&#34;:&#34;must be at least 18&#34;,&#34;email&#34;:&#34;already registered&#34;}</p>` +
+				`<form><input name="email" aria-invalid="true" value="taken@example.com"/><span data-error-for="email">already registered</span></form>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/signup", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status code: got %v, want %v: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+			if rr.Body.String() != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFormComponent_Numbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		def     any
+		rules   map[string]any
+		want    any
+		wantErr string
+	}{
+		{name: "float", value: "1.5", def: 0.0, want: 1.5},
+		{name: "NaN", value: "NaN", def: 0.0, wantErr: "must be a number"},
+		{name: "infinity", value: "-Inf", def: 0.0, wantErr: "must be a number"},
+		{name: "NaN in range", value: "NaN", def: "", rules: map[string]any{"min": 18, "max": 99}, wantErr: "must be a number"},
+		{name: "JSON integer", value: 1000000.0, def: 0, want: 1000000},
+		{name: "JSON int64", value: json.Number("1000000"), def: int64(0), want: int64(1000000)},
+		{name: "JSON fraction", value: 1.5, def: 0, wantErr: "must be an integer"},
+		{name: "JSON out of range", value: 1e300, def: 0, wantErr: "must be an integer"},
+		{name: "JSON float", value: json.Number("2.5"), def: 0.0, want: 2.5},
+		{name: "infinity in range", value: "+Inf", def: "", rules: map[string]any{"min": 18}, wantErr: "must be a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, errs := decodeForm(map[string]any{"n": tt.value}, map[string]any{"n": tt.def})
+			msg := errs["n"]
+			if msg == "" && tt.rules != nil {
+				var err error
+				if msg, err = (FormComponent{}).validate(values["n"], tt.rules); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if msg != tt.wantErr {
+				t.Fatalf("error = %q, want %q", msg, tt.wantErr)
+			}
+			if tt.wantErr == "" && values["n"] != tt.want {
+				t.Errorf("value = %#v, want %#v", values["n"], tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ go 1.23
 
 require (
 	github.com/expr-lang/expr v1.16.2
+	github.com/fatih/camelcase v1.0.0
 	github.com/google/go-cmp v0.6.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/stretchr/testify v1.8.4
@@ -12,7 +13,6 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fatih/camelcase v1.0.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
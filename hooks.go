@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// RenderHook is a function called around the page renders, see Handler.BeforeRender and
+// Handler.AfterRender. The scope is the scope the page is rendered with, comp is the page
+// component.
+type RenderHook func(r *http.Request, scope chtml.Scope, comp chtml.Component) error
+
+// StatusError is an error with the status code of the response, e.g. returned by a BeforeRender
+// hook to deny the access to a page with 403 Forbidden. The client gets the status text only.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return fmt.Sprintf("%d %s: %v", e.Code, http.StatusText(e.Code), e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// beforeRender calls the BeforeRender hooks, stopping at the first error.
+func (h *Handler) beforeRender(scope *scope, comp chtml.Component) error {
+	for _, hook := range h.BeforeRender {
+		if err := hook(scope.globals.req, scope, comp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterRender calls the AfterRender hooks. The output has been sent already, so the errors are
+// only logged and reported to OnError.
+func (h *Handler) afterRender(scope *scope, comp chtml.Component) {
+	r := scope.globals.req
+	for _, hook := range h.AfterRender {
+		if err := hook(r, scope, comp); err != nil {
+			err = fmt.Errorf("after render hook: %w", err)
+			h.logger.Error("Serve HTTP request", "url", r.URL.Redacted(), "error", err)
+			if h.OnError != nil {
+				h.OnError(r, err)
+			}
+		}
+	}
+}
+
+// hookStatus returns the status code of the response to the BeforeRender hook error, logging
+// the errors other than StatusError.
+func (h *Handler) hookStatus(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	h.logger.Error("Before render hook", "error", err)
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,128 @@
+package pages
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"github.com/gorilla/websocket"
+)
+
+func TestPages_RenderHooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<c:attr name="user">${"anonymous"}</c:attr><p>${user}</p>`)},
+	}
+
+	var calls []string
+	var onError []error
+	h := &Handler{
+		FileSystem: fsys,
+		BeforeRender: []RenderHook{
+			func(r *http.Request, s chtml.Scope, comp chtml.Component) error {
+				calls = append(calls, "before")
+				switch r.URL.Query().Get("user") {
+				case "":
+					return &StatusError{Code: http.StatusForbidden}
+				case "error":
+					return errors.New("auth backend is down")
+				}
+				s.Vars()["user"] = r.URL.Query().Get("user")
+				return nil
+			},
+		},
+		AfterRender: []RenderHook{
+			func(r *http.Request, s chtml.Scope, comp chtml.Component) error {
+				calls = append(calls, "after")
+				return errors.New("metrics are not recorded")
+			},
+		},
+		OnError: func(r *http.Request, err error) { onError = append(onError, err) },
+	}
+
+	tests := []struct {
+		url        string
+		wantStatus int
+		wantBody   string
+		wantCalls  []string
+		wantErr    string
+	}{
+		{"/?user=alice", http.StatusOK, "<p>alice</p>", []string{"before", "after"},
+			"after render hook: metrics are not recorded"},
+		{"/", http.StatusForbidden, "Forbidden\n", []string{"before"}, ""},
+		{"/?user=error", http.StatusInternalServerError, "Internal Server Error\n", []string{"before"},
+			"before render hook: auth backend is down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			calls, onError = nil, nil
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantStatus)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+			if strings.Join(calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("calls: got %v, want %v", calls, tt.wantCalls)
+			}
+			var gotErr string
+			if len(onError) > 0 {
+				gotErr = onError[0].Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("OnError: got %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPages_RenderHooksWebSocket(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<c:attr name="n">${0}</c:attr><p>${n}</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BeforeRender: []RenderHook{
+			func(r *http.Request, s chtml.Scope, comp chtml.Component) error {
+				if s.Vars()["n"] == 0 {
+					return &StatusError{Code: http.StatusForbidden}
+				}
+				return nil
+			},
+		},
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, tt := range []struct {
+		n    int
+		want string
+	}{
+		{0, `{"error":{"status":403,"message":"Forbidden"}}`},
+		{1, `<p>1</p>`},
+	} {
+		if err := ws.WriteJSON(map[string]any{"n": tt.n}); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(msg)); got != tt.want {
+			t.Errorf("n=%d: got %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package pages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlPatchProtocol is the WebSocket subprotocol for receiving the HTML pages as the patches to
+// the previously sent HTML.
+const htmlPatchProtocol = "html-patch"
+
+// htmlPatchOp is an operation of an HTML patch. The path is the list of the child node indexes
+// (the elements, the text and the comment nodes, as in Node.childNodes) from the root, e.g.
+// "/1/0" is the first child of the second top-level node. The root is the element the page is
+// rendered into, or the document for the pages rendering the whole <html> document. The empty
+// path is the root itself.
+//
+// The operations are:
+//   - replace: the node at the path is replaced with the HTML, the root's content for the empty
+//     path;
+//   - text: the text (or the comment) at the path is set to the text;
+//   - attrs: the attributes of the element at the path are set and removed;
+//   - append: the HTML is appended to the children of the node at the path;
+//   - remove: the node at the path is removed.
+//
+// The operations are applied in order. Only the last children are appended or removed, so
+// the paths of the other nodes stay valid.
+type htmlPatchOp struct {
+	Op     string            `json:"op"`
+	Path   string            `json:"path"`
+	HTML   string            `json:"html,omitempty"`
+	Text   *string           `json:"text,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// htmlPatchState is the last HTML sent to a WebSocket client receiving the HTML patches.
+type htmlPatchState struct {
+	prev *html.Node
+	sent bool
+}
+
+// write sends the rendered HTML as a patch to the previously sent HTML. The first patch replaces
+// the whole content. No message is sent if the HTML has not changed.
+func (p *htmlPatchState) write(ws *websocket.Conn, rendered []byte) error {
+	// the trees are compared as the client parses them, e.g. with the merged text nodes
+	root, err := parsePatchRoot(rendered)
+	if err != nil {
+		return fmt.Errorf("parse rendered HTML: %w", err)
+	}
+
+	var ops []htmlPatchOp
+	if p.sent && isFullDocument(p.prev) == isFullDocument(root) {
+		ops, err = diffHTML(p.prev, root)
+		if err != nil {
+			return fmt.Errorf("diff HTML: %w", err)
+		}
+	} else {
+		ops = []htmlPatchOp{{Op: "replace", Path: "", HTML: string(rendered)}}
+	}
+	p.prev, p.sent = root, true
+
+	if len(ops) == 0 {
+		return nil
+	}
+	msg, err := marshalHTMLPatch(ops)
+	if err != nil {
+		return fmt.Errorf("render HTML patch: %w", err)
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("write websocket message: %w", err)
+	}
+	return nil
+}
+
+// marshalHTMLPatch encodes the operations as JSON, leaving the markup unescaped.
+func marshalHTMLPatch(ops []htmlPatchOp) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(ops); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// parsePatchRoot parses the rendered HTML into a document, or into the children of a document
+// node for a fragment parsed in the <body> context.
+func parsePatchRoot(rendered []byte) (*html.Node, error) {
+	s := strings.ToLower(strings.TrimSpace(string(rendered)))
+	if strings.HasPrefix(s, "<!doctype") || strings.HasPrefix(s, "<html") {
+		return html.Parse(bytes.NewReader(rendered))
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(rendered), body)
+	if err != nil {
+		return nil, err
+	}
+	root := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	return root, nil
+}
+
+// isFullDocument reports whether the root is parsed from a whole <html> document.
+func isFullDocument(root *html.Node) bool {
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Html {
+			return true
+		}
+	}
+	return false
+}
+
+// diffHTML returns the patch transforming the tree a into b.
+func diffHTML(a, b *html.Node) ([]htmlPatchOp, error) {
+	var d htmlDiff
+	if err := d.children("", a, b); err != nil {
+		return nil, err
+	}
+	return d.ops, nil
+}
+
+type htmlDiff struct {
+	ops []htmlPatchOp
+}
+
+func (d *htmlDiff) node(path string, a, b *html.Node) error {
+	if a.Type != b.Type || a.Data != b.Data || a.Namespace != b.Namespace {
+		s, err := renderHTMLNode(b)
+		if err != nil {
+			return err
+		}
+		d.ops = append(d.ops, htmlPatchOp{Op: "replace", Path: path, HTML: s})
+		return nil
+	}
+
+	switch a.Type {
+	case html.TextNode, html.CommentNode, html.DoctypeNode:
+		return nil // the data is equal
+	case html.ElementNode:
+		d.attrs(path, a, b)
+	}
+	return d.children(path, a, b)
+}
+
+func (d *htmlDiff) attrs(path string, a, b *html.Node) {
+	set := make(map[string]string)
+	var remove []string
+	old := make(map[string]string, len(a.Attr))
+	for _, attr := range a.Attr {
+		old[attrName(attr)] = attr.Val
+	}
+	for _, attr := range b.Attr {
+		name := attrName(attr)
+		if v, ok := old[name]; !ok || v != attr.Val {
+			set[name] = attr.Val
+		}
+		delete(old, name)
+	}
+	for name := range old {
+		remove = append(remove, name)
+	}
+	slices.Sort(remove)
+	if len(set) > 0 || len(remove) > 0 {
+		if len(set) == 0 {
+			set = nil
+		}
+		d.ops = append(d.ops, htmlPatchOp{Op: "attrs", Path: path, Set: set, Remove: remove})
+	}
+}
+
+// children compares the common children by index, then appends the new children or removes
+// the extra ones from the end. The changed text is sent as a text operation.
+func (d *htmlDiff) children(path string, a, b *html.Node) error {
+	ac, bc := childNodes(a), childNodes(b)
+	n := min(len(ac), len(bc))
+	for i := 0; i < n; i++ {
+		p := path + "/" + strconv.Itoa(i)
+		x, y := ac[i], bc[i]
+		if x.Type == y.Type && (x.Type == html.TextNode || x.Type == html.CommentNode) && x.Data != y.Data {
+			text := y.Data
+			d.ops = append(d.ops, htmlPatchOp{Op: "text", Path: p, Text: &text})
+			continue
+		}
+		if err := d.node(p, x, y); err != nil {
+			return err
+		}
+	}
+	for _, child := range bc[n:] {
+		s, err := renderHTMLNode(child)
+		if err != nil {
+			return err
+		}
+		d.ops = append(d.ops, htmlPatchOp{Op: "append", Path: path, HTML: s})
+	}
+	for i := len(ac) - 1; i >= n; i-- {
+		d.ops = append(d.ops, htmlPatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+	}
+	return nil
+}
+
+func childNodes(n *html.Node) []*html.Node {
+	var res []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		res = append(res, c)
+	}
+	return res
+}
+
+func attrName(a html.Attribute) string {
+	if a.Namespace != "" {
+		return a.Namespace + ":" + a.Key
+	}
+	return a.Key
+}
+
+func renderHTMLNode(n *html.Node) (string, error) {
+	var buf strings.Builder
+	if err := html.Render(&buf, n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
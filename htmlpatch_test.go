@@ -0,0 +1,108 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDiffHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", `<p class="x">a<b>b</b></p>`, `<p class="x">a<b>b</b></p>`, `null`},
+		{"text", `<p>a</p>`, `<p>b</p>`, `[{"op":"text","path":"/0/0","text":"b"}]`},
+		{"empty text", `<p>a<b></b></p>`, `<p><b></b></p>`, `[{"op":"replace","path":"/0/0","html":"<b></b>"},{"op":"remove","path":"/0/1"}]`},
+		{"attrs", `<p class="x" id="a">a</p>`, `<p class="y" title="t">a</p>`,
+			`[{"op":"attrs","path":"/0","set":{"class":"y","title":"t"},"remove":["id"]}]`},
+		{"append", `<ul><li>1</li></ul>`, `<ul><li>1</li><li>2</li></ul>`,
+			`[{"op":"append","path":"/0","html":"<li>2</li>"}]`},
+		{"remove", `<ul><li>1</li><li>2</li><li>3</li></ul>`, `<ul><li>0</li></ul>`,
+			`[{"op":"text","path":"/0/0/0","text":"0"},{"op":"remove","path":"/0/2"},{"op":"remove","path":"/0/1"}]`},
+		{"replace tag", `<p>a</p><i>b</i>`, `<p>a</p><b>b</b>`,
+			`[{"op":"replace","path":"/1","html":"<b>b</b>"}]`},
+		{"top-level", `a`, `a<p>b</p>`, `[{"op":"append","path":"","html":"<p>b</p>"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parsePatchRoot([]byte(tt.a))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := parsePatchRoot([]byte(tt.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops, err := diffHTML(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := marshalHTMLPatch(ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPages_WebSocketHTMLPatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.chtml": {Data: []byte(`<c:attr name="n">${0}</c:attr><h1>Counter</h1><p class="n${n}">${n}</p>`)},
+		"doc.chtml":  {Data: []byte(`<c:attr name="n">${0}</c:attr><html><body><p>${n}</p></body></html>`)},
+	}
+
+	srv := httptest.NewServer(&Handler{FileSystem: fsys})
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"html-patch"}}
+	dial := func(path string) *websocket.Conn {
+		ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ws.Subprotocol() != "html-patch" {
+			t.Fatalf("subprotocol = %q", ws.Subprotocol())
+		}
+		return ws
+	}
+	exchange := func(ws *websocket.Conn, vars map[string]any) string {
+		t.Helper()
+		if err := ws.WriteJSON(vars); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(msg))
+	}
+
+	ws := dial("/page")
+	defer ws.Close()
+
+	if got, want := exchange(ws, map[string]any{"n": 1}),
+		`[{"op":"replace","path":"","html":"<h1>Counter</h1><p class=\"n1\">1</p>"}]`; got != want {
+		t.Errorf("first message:\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := exchange(ws, map[string]any{"n": 2}),
+		`[{"op":"attrs","path":"/1","set":{"class":"n2"}},{"op":"text","path":"/1/0","text":"2"}]`; got != want {
+		t.Errorf("second message:\ngot  %s\nwant %s", got, want)
+	}
+
+	ws2 := dial("/doc")
+	defer ws2.Close()
+
+	exchange(ws2, map[string]any{"n": 1})
+	if got, want := exchange(ws2, map[string]any{"n": 2}),
+		`[{"op":"text","path":"/0/1/0/0","text":"2"}]`; got != want {
+		t.Errorf("document message:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -1,20 +1,69 @@
 package pages
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/dpotapov/go-pages/chtml"
 )
 
+// DefaultPropagateHeaders is the default list of headers copied from the page request to the
+// HTTP calls: credentials, distributed tracing and request correlation headers.
+var DefaultPropagateHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Accept-Language",
+	"Traceparent",
+	"Tracestate",
+	"Baggage",
+	"X-Request-Id",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+}
+
 // HttpCallComponent implements a CHTML component for making HTTP requests and storing
 // returned data in the scope.
+//
+// The request body can be a string, a byte slice or an io.Reader, sent as is with the
+// content-type argument as the Content-Type header. The response body is available as text
+// (body), raw bytes (bytes) and, for the JSON media types, decoded (json). The raw bytes can be
+// rendered as the output of a page, e.g. to proxy a file download:
+//
+//	<c:http-call as="file" url="/api/files/${id}"></c:http-call>
+//	<c:http-response content-type="${file.content_type}"></c:http-response>${file.bytes}
+//
+// When rendered as part of a page, the calls behave like requests proxied from the page request:
+// the headers listed in PropagateHeaders are copied from the page request, and the request
+// context is inherited, so the calls are canceled together with the page request and share its
+// deadline.
 type HttpCallComponent struct {
+	// PropagateHeaders is an allowlist of headers copied from the page request to the HTTP calls.
+	// Headers set explicitly in the component arguments take precedence.
+	// If nil, DefaultPropagateHeaders is used. Set to an empty slice to disable the propagation.
+	PropagateHeaders []string
+
+	// CircuitBreaker is an optional circuit breaker of the calls, shared per target host. It
+	// can be shared by several components.
+	CircuitBreaker *CircuitBreaker
+
+	// Cache stores the responses of the calls with the cache argument, e.g. cache="30s". The
+	// responses are keyed by the method, the URL, the body and the headers of the call, including
+	// the propagated credentials (but not the tracing and correlation headers), so the responses
+	// are not shared between the users.
+	// If nil, the responses are cached in memory by the component.
+	Cache HttpCallCache
+
 	// router is the HTTP router used to make requests
 	router http.Handler
 
@@ -32,6 +81,14 @@ type HttpCallComponent struct {
 
 	// lastResponse is the last response received
 	lastResponse *HttpCallResponse
+
+	// cacheOnce initializes the default cache, see Cache
+	cacheOnce    sync.Once
+	defaultCache HttpCallCache
+
+	// refreshMu protects refreshing, the keys of the stale responses refreshed in the background
+	refreshMu  sync.Mutex
+	refreshing map[string]bool
 }
 
 var _ chtml.Component = &HttpCallComponent{}
@@ -46,13 +103,47 @@ type HttpCallArgs struct {
 	Cookies           []*http.Cookie
 	Header            http.Header
 	Body              io.Reader
+	ContentType       string
+
+	// Cache is the time the successful responses are cached for, see HttpCallComponent.Cache.
+	Cache time.Duration
+
+	// StaleWhileRevalidate is the time the expired responses are still used for while they are
+	// refreshed in the background.
+	StaleWhileRevalidate time.Duration
+
+	// Retries is the number of times a failed call is retried: the calls failing with an error,
+	// 429 Too Many Requests or a 5xx status code. Only the calls with the idempotent methods (GET,
+	// HEAD, OPTIONS, PUT and DELETE) or the Idempotency-Key header are retried, unless RetryUnsafe
+	// is set.
+	Retries int
+
+	// RetryUnsafe allows retrying the calls with the non-idempotent methods, e.g. POST.
+	RetryUnsafe bool
+
+	// Backoff is the delay before the first retry, doubled before each next one. Default is
+	// DefaultHttpCallBackoff.
+	Backoff time.Duration
+
+	// Timeout limits the time of each attempt of the call. Zero means no limit other than
+	// the page request context.
+	Timeout time.Duration
 }
 
 type HttpCallResponse struct {
-	Code  int    `expr:"code"`
-	Body  string `expr:"body"`
-	Json  any    `expr:"json"`
-	Error string `expr:"error"`
+	Code        int                 `expr:"code"`
+	Body        string              `expr:"body"`
+	Bytes       []byte              `expr:"bytes"`
+	Json        any                 `expr:"json"`
+	Error       string              `expr:"error"`
+	ETag        string              `expr:"etag"`
+	ContentType string              `expr:"content_type"`
+	Headers     map[string][]string `expr:"headers"`
+}
+
+// Reader returns a reader of the response body. Each call returns a new reader.
+func (r *HttpCallResponse) Reader() io.Reader {
+	return bytes.NewReader(r.Bytes)
 }
 
 func NewHttpCallComponent(router http.Handler) *HttpCallComponent {
@@ -97,7 +188,17 @@ func (c *HttpCallComponent) Render(s chtml.Scope) (any, error) {
 		go c.startPolling(s, c.pollingStop)
 	}
 
-	return c.render(&args), nil
+	var resp *HttpCallResponse
+	if args.Cache > 0 {
+		resp = c.cached(s, &args)
+	} else {
+		resp = c.render(s, &args)
+	}
+	if vc, ok := s.(VersionCollector); ok && resp.ETag != "" {
+		// the response ETag versions the data of the page (see Handler conditional GET)
+		vc.AddVersion(args.Method + " " + args.URL + " " + resp.ETag)
+	}
+	return resp, nil
 }
 
 func (c *HttpCallComponent) Dispose() error {
@@ -120,7 +221,7 @@ func (c *HttpCallComponent) startPolling(s chtml.Scope, stopChan chan struct{})
 		select {
 		case <-ticker.C:
 			c.mu.Lock()
-			newResponse := c.render(c.lastArgs)
+			newResponse := c.render(s, c.lastArgs)
 			if c.hasResponseChanged(newResponse) {
 				c.lastResponse = newResponse
 				s.Touch()
@@ -142,33 +243,89 @@ func (c *HttpCallComponent) hasResponseChanged(newResponse *HttpCallResponse) bo
 }
 
 // render makes an HTTP call
-func (c *HttpCallComponent) render(args *HttpCallArgs) *HttpCallResponse {
+func (c *HttpCallComponent) render(s chtml.Scope, args *HttpCallArgs) *HttpCallResponse {
+	return c.call(chtml.ContextOf(s), pageRequest(s), args)
+}
+
+// do makes an HTTP call with the context as a request proxied from the parent page request,
+// which may be nil.
+func (c *HttpCallComponent) do(ctx context.Context, parent *http.Request, args *HttpCallArgs) *HttpCallResponse {
 	if args.Method == "" {
 		args.Method = "GET"
 	}
 
-	req, err := http.NewRequest(args.Method, args.URL, args.Body)
+	req, err := http.NewRequestWithContext(ctx, args.Method, args.URL, args.Body)
 	if err != nil {
 		return c.makeResponse(nil, fmt.Errorf("create request: %w", err))
 	}
 	req.RequestURI = args.URL
 
-	if args.BasicAuthUsername != "" || args.BasicAuthPassword != "" {
-		req.SetBasicAuth(args.BasicAuthUsername, args.BasicAuthPassword)
+	if parent != nil {
+		c.propagateHeaders(req.Header, parent.Header)
+	}
+
+	if args.ContentType != "" {
+		req.Header.Set("Content-Type", args.ContentType)
 	}
 
-	if len(args.Header) > 0 {
-		req.Header = args.Header
+	for k, vv := range args.Header {
+		req.Header[http.CanonicalHeaderKey(k)] = vv
+	}
+
+	if args.BasicAuthUsername != "" || args.BasicAuthPassword != "" {
+		req.SetBasicAuth(args.BasicAuthUsername, args.BasicAuthPassword)
 	}
 
 	for _, cookie := range args.Cookies {
 		req.AddCookie(cookie)
 	}
 
+	if err := req.Context().Err(); err != nil {
+		return c.makeResponse(nil, fmt.Errorf("make request: %w", err))
+	}
+
 	rr := httptest.NewRecorder()
-	c.router.ServeHTTP(rr, req)
+	if args.Timeout <= 0 {
+		c.router.ServeHTTP(rr, req)
+		return c.makeResponse(rr.Result(), nil)
+	}
 
-	return c.makeResponse(rr.Result(), nil)
+	// the router may not stop on the context cancellation, so it is abandoned on timeout
+	ctx, cancel := context.WithTimeout(ctx, args.Timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.router.ServeHTTP(rr, req.WithContext(ctx))
+	}()
+	select {
+	case <-done:
+		return c.makeResponse(rr.Result(), nil)
+	case <-ctx.Done():
+		return c.makeResponse(nil, fmt.Errorf("make request: %w", ctx.Err()))
+	}
+}
+
+// propagateHeaders copies the allowlisted headers from the page request.
+func (c *HttpCallComponent) propagateHeaders(dst, src http.Header) {
+	names := c.PropagateHeaders
+	if names == nil {
+		names = DefaultPropagateHeaders
+	}
+	for _, name := range names {
+		if vv := src.Values(name); len(vv) > 0 {
+			dst[http.CanonicalHeaderKey(name)] = slices.Clone(vv)
+		}
+	}
+}
+
+// pageRequest returns the HTTP request of the page being rendered or nil if the scope is not
+// created by the Handler.
+func pageRequest(s chtml.Scope) *http.Request {
+	if v, ok := s.(*scope); ok {
+		return v.globals.req
+	}
+	return nil
 }
 
 func (c *HttpCallComponent) makeResponse(res *http.Response, err error) *HttpCallResponse {
@@ -176,17 +333,21 @@ func (c *HttpCallComponent) makeResponse(res *http.Response, err error) *HttpCal
 
 	if res != nil {
 		r.Code = res.StatusCode
+		r.ETag = res.Header.Get("ETag")
+		r.ContentType = res.Header.Get("Content-Type")
+		r.Headers = res.Header
 		body, err2 := io.ReadAll(res.Body)
-		if err2 != nil && err != nil {
+		if err2 != nil && err == nil {
 			err = fmt.Errorf("read body: %v", err2)
 		} else if err2 == nil {
 			r.Body = string(body)
+			r.Bytes = body
 		}
 
-		if res.Header.Get("Content-Type") == "application/json" && r.Body != "" {
-			err2 := json.Unmarshal([]byte(r.Body), &r.Json)
-			if err2 != nil && err != nil {
-				err = fmt.Errorf("unmarshal json: %w", err)
+		if isJSONMediaType(r.ContentType) && len(r.Bytes) > 0 {
+			err2 := json.Unmarshal(r.Bytes, &r.Json)
+			if err2 != nil && err == nil {
+				err = fmt.Errorf("unmarshal json: %w", err2)
 			}
 		}
 	}
@@ -197,3 +358,13 @@ func (c *HttpCallComponent) makeResponse(res *http.Response, err error) *HttpCal
 
 	return &r
 }
+
+// isJSONMediaType reports whether the Content-Type is JSON, e.g. application/json or
+// application/problem+json.
+func isJSONMediaType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
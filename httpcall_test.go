@@ -1,11 +1,17 @@
 package pages
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sync"
 	"testing"
+	"testing/fstest"
 
 	"github.com/dpotapov/go-pages/chtml"
 )
@@ -143,3 +149,171 @@ func TestHttpCallComponent_WithInterval(t *testing.T) {
 	// wait for the poller to update 3 times
 	wg.Wait()
 }
+
+func TestHttpCallComponent_Propagation(t *testing.T) {
+	var got *http.Request
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/data", func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	})
+
+	type ctxKey struct{}
+
+	page := httptest.NewRequest("GET", "/page", nil)
+	page.Header.Set("Authorization", "Bearer token")
+	page.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	page.Header.Set("X-Secret", "not propagated")
+	page = page.WithContext(context.WithValue(page.Context(), ctxKey{}, "page"))
+
+	tests := []struct {
+		name       string
+		propagate  []string
+		header     http.Header
+		wantHeader http.Header
+	}{
+		{
+			name: "default allowlist",
+			wantHeader: http.Header{
+				"Authorization": {"Bearer token"},
+				"Traceparent":   {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			},
+		},
+		{
+			name:      "custom allowlist",
+			propagate: []string{"x-secret"},
+			wantHeader: http.Header{
+				"X-Secret": {"not propagated"},
+			},
+		},
+		{
+			name:       "disabled",
+			propagate:  []string{},
+			wantHeader: http.Header{},
+		},
+		{
+			name:   "explicit header wins",
+			header: http.Header{"authorization": {"Basic xyz"}},
+			wantHeader: http.Header{
+				"Authorization": {"Basic xyz"},
+				"Traceparent":   {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]any{"url": "/api/data"}
+			if tt.header != nil {
+				vars["header"] = tt.header
+			}
+			s := newScope(vars, page, nil)
+
+			comp := NewHttpCallComponent(mux)
+			comp.PropagateHeaders = tt.propagate
+
+			if _, err := comp.Render(s); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Header, tt.wantHeader) {
+				t.Errorf("header = %v, want %v", got.Header, tt.wantHeader)
+			}
+			if got.Context().Value(ctxKey{}) != "page" {
+				t.Error("page request context is not inherited")
+			}
+		})
+	}
+
+	t.Run("canceled page request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		got = nil
+		s := newScope(map[string]any{"url": "/api/data"}, page.WithContext(ctx), nil)
+
+		rr, err := NewHttpCallComponent(mux).Render(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Error("request is made for a canceled page request")
+		}
+		if res := rr.(*HttpCallResponse); res.Error != "make request: context canceled" {
+			t.Errorf("Error = %q", res.Error)
+		}
+	})
+}
+
+func TestHttpCallComponent_RawBodies(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\xff\xfe")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("/api/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", `attachment; filename="a.png"`)
+		_, _ = w.Write(png)
+	})
+
+	tests := []struct {
+		name     string
+		body     any
+		ct       string
+		wantJson any
+	}{
+		{"string", `<a>x</a>`, "application/xml", nil},
+		{"bytes", png, "application/octet-stream", nil},
+		{"reader", bytes.NewReader(png), "application/octet-stream", nil},
+		{"json media type", `{"x": 1}`, "application/problem+json; charset=utf-8", map[string]any{"x": 1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comp := NewHttpCallComponent(mux)
+			defer func() { _ = comp.Dispose() }()
+
+			rr, err := comp.Render(chtml.NewBaseScope(map[string]any{
+				"url": "/api/echo", "method": "POST", "body": tt.body, "content-type": tt.ct,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rr.(*HttpCallResponse)
+
+			want := []byte(fmt.Sprint(tt.body))
+			if b, ok := tt.body.([]byte); ok {
+				want = b
+			} else if _, ok := tt.body.(io.Reader); ok {
+				want = png
+			}
+			if !bytes.Equal(got.Bytes, want) || got.ContentType != tt.ct || got.Error != "" {
+				t.Errorf("got %q (%s, %q), want %q (%s)", got.Bytes, got.ContentType, got.Error, want, tt.ct)
+			}
+			if !reflect.DeepEqual(got.Json, tt.wantJson) {
+				t.Errorf("json: got %v, want %v", got.Json, tt.wantJson)
+			}
+		})
+	}
+
+	t.Run("proxy download", func(t *testing.T) {
+		h := &Handler{
+			FileSystem: fstest.MapFS{"download.chtml": {Data: []byte(
+				`<c:http-call as="file" url="/api/file"></c:http-call>` +
+					`<c:http-response content-type="${file.content_type}"></c:http-response>${file.bytes}`)}},
+			BuiltinComponents: map[string]chtml.Component{
+				"http-call":     NewHttpCallComponent(mux),
+				"http-response": HttpResponseComponent{},
+			},
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/download", nil))
+
+		if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("content type: got %q", ct)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), png) {
+			t.Errorf("body: got %q, want %q", rr.Body.Bytes(), png)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// HttpCallCache stores the responses of HttpCallComponent, see HttpCallComponent.Cache.
+// The implementations must be safe for concurrent use.
+type HttpCallCache interface {
+	// Get returns the cached response and the time it was received, or false if there is none.
+	Get(key string) (resp *HttpCallResponse, stored time.Time, ok bool)
+
+	// Set stores the response received at the given time. The response must be kept for at least
+	// maxAge, it can be dropped afterward.
+	Set(key string, resp *HttpCallResponse, stored time.Time, maxAge time.Duration)
+}
+
+// MemoryHttpCallCache is an in-memory HttpCallCache.
+type MemoryHttpCallCache struct {
+	// MaxEntries is the maximum number of the cached responses. When the cache is full, the
+	// expired responses are removed, and then the oldest ones. Default is 1000.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*httpCallCacheEntry
+}
+
+var _ HttpCallCache = (*MemoryHttpCallCache)(nil)
+
+type httpCallCacheEntry struct {
+	resp    *HttpCallResponse
+	stored  time.Time
+	expires time.Time
+}
+
+func (c *MemoryHttpCallCache) Get(key string) (*HttpCallResponse, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, time.Time{}, false
+	}
+	return e.resp, e.stored, true
+}
+
+func (c *MemoryHttpCallCache) Set(key string, resp *HttpCallResponse, stored time.Time, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*httpCallCacheEntry)
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for len(c.entries) >= maxEntries {
+			var oldest string
+			for k, e := range c.entries {
+				if oldest == "" || e.stored.Before(c.entries[oldest].stored) {
+					oldest = k
+				}
+			}
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = &httpCallCacheEntry{resp: resp, stored: stored, expires: stored.Add(maxAge)}
+}
+
+// cached returns the response of the call from the cache, making the call on a miss. The stale
+// responses (older than the Cache argument, but within StaleWhileRevalidate) are returned as is
+// and refreshed in the background. Only the successful responses are cached.
+func (c *HttpCallComponent) cached(s chtml.Scope, args *HttpCallArgs) *HttpCallResponse {
+	if args.Method == "" {
+		args.Method = "GET"
+	}
+
+	var body []byte
+	if args.Body != nil {
+		var err error
+		if body, err = io.ReadAll(args.Body); err != nil {
+			return c.makeResponse(nil, err)
+		}
+	}
+	ctx, parent := chtml.ContextOf(s), pageRequest(s)
+
+	// the responses are per credentials: the key includes the headers sent with the call
+	h := sha256.New()
+	h.Write([]byte(args.Method + " " + args.URL + "\x00"))
+	_ = c.keyHeader(parent, args).Write(h)
+	h.Write([]byte("\x00"))
+	h.Write(body)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	cache := c.cache()
+	call := func(ctx context.Context) *HttpCallResponse {
+		a := *args
+		if body != nil {
+			a.Body = bytes.NewReader(body)
+		}
+		resp := c.call(ctx, parent, &a)
+		if resp.Error == "" && resp.Code >= 200 && resp.Code < 300 {
+			cache.Set(key, resp, time.Now(), args.Cache+args.StaleWhileRevalidate)
+		}
+		return resp
+	}
+
+	resp, stored, ok := cache.Get(key)
+	switch age := time.Since(stored); {
+	case !ok || age >= args.Cache+args.StaleWhileRevalidate:
+		return call(ctx)
+	case age >= args.Cache:
+		if c.startRefresh(key) {
+			go func() {
+				defer c.endRefresh(key)
+				call(context.WithoutCancel(ctx)) // the page may be sent before the call returns
+			}()
+		}
+	}
+	return resp
+}
+
+// uncachedHeaders are the propagated headers unique to every page request, they are not part
+// of the cache key.
+var uncachedHeaders = []string{"Traceparent", "Tracestate", "Baggage", "X-Request-Id", "X-Forwarded-For"}
+
+// keyHeader returns the headers of the call which the response may depend on: the propagated
+// headers (except the tracing and correlation ones), the explicit headers, the credentials and
+// the cookies of the arguments.
+func (c *HttpCallComponent) keyHeader(parent *http.Request, args *HttpCallArgs) http.Header {
+	hdr := http.Header{}
+	if parent != nil {
+		c.propagateHeaders(hdr, parent.Header)
+	}
+	for _, name := range uncachedHeaders {
+		hdr.Del(name)
+	}
+	for k, vv := range args.Header {
+		hdr[http.CanonicalHeaderKey(k)] = vv
+	}
+	if args.BasicAuthUsername != "" || args.BasicAuthPassword != "" {
+		hdr.Set("Authorization", "Basic "+args.BasicAuthUsername+":"+args.BasicAuthPassword)
+	}
+	for _, cookie := range args.Cookies {
+		hdr.Add("Cookie", cookie.String())
+	}
+	return hdr
+}
+
+func (c *HttpCallComponent) cache() HttpCallCache {
+	if c.Cache != nil {
+		return c.Cache
+	}
+	c.cacheOnce.Do(func() { c.defaultCache = &MemoryHttpCallCache{} })
+	return c.defaultCache
+}
+
+// startRefresh reports whether the refresh of the stale response should be started, so only one
+// refresh of a response runs at a time.
+func (c *HttpCallComponent) startRefresh(key string) bool {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if c.refreshing[key] {
+		return false
+	}
+	if c.refreshing == nil {
+		c.refreshing = make(map[string]bool)
+	}
+	c.refreshing[key] = true
+	return true
+}
+
+func (c *HttpCallComponent) endRefresh(key string) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	delete(c.refreshing, key)
+}
@@ -0,0 +1,121 @@
+package pages
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestHttpCallComponent_Cache(t *testing.T) {
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/data", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_, _ = fmt.Fprintf(w, "%d %s", n, body)
+	})
+
+	cache := &MemoryHttpCallCache{}
+	comp := NewHttpCallComponent(mux)
+	comp.Cache = cache
+	defer func() { _ = comp.Dispose() }()
+
+	render := func(body string) string {
+		t.Helper()
+		rr, err := comp.Render(chtml.NewBaseScope(map[string]any{
+			"url": "/api/data", "method": "POST", "body": body,
+			"cache": "1m", "stale-while-revalidate": "1h",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr.(*HttpCallResponse).Body
+	}
+	// age moves the stored time of the cached responses back
+	age := func(d time.Duration) {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		for _, e := range cache.entries {
+			e.stored = e.stored.Add(-d)
+			e.expires = e.expires.Add(-d)
+		}
+	}
+
+	if got := render("a"); got != "1 a" {
+		t.Fatalf("first call: got %q", got)
+	}
+	if got := render("a"); got != "1 a" {
+		t.Errorf("cached call: got %q", got)
+	}
+	if got := render("b"); got != "2 b" {
+		t.Errorf("call with another body: got %q", got)
+	}
+
+	// stale: the cached response is returned and refreshed in the background
+	age(2 * time.Minute)
+	if got := render("a"); got != "1 a" {
+		t.Errorf("stale call: got %q", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for render("a") == "1 a" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := render("a"); got != "3 a" {
+		t.Errorf("refreshed call: got %q", got)
+	}
+
+	// expired: the call is made right away
+	age(2 * time.Hour)
+	if got := render("a"); got != "4 a" {
+		t.Errorf("expired call: got %q", got)
+	}
+
+	// errors are not cached
+	render("fail")
+	if got := render("fail"); got != "6 fail" {
+		t.Errorf("failed call: got %q", got)
+	}
+}
+
+func TestHttpCallComponent_CachePerCredentials(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", r.Header.Get("Authorization"), r.Header.Get("X-Request-Id"))
+	})
+
+	comp := NewHttpCallComponent(mux)
+	defer func() { _ = comp.Dispose() }()
+
+	render := func(auth, requestID string) string {
+		t.Helper()
+		page := httptest.NewRequest("GET", "/page", nil)
+		page.Header.Set("Authorization", auth)
+		page.Header.Set("X-Request-Id", requestID)
+
+		rr, err := comp.Render(newScope(map[string]any{"url": "/api/me", "cache": "1m"}, page, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr.(*HttpCallResponse).Body
+	}
+
+	if got := render("Bearer alice", "1"); got != "Bearer alice 1" {
+		t.Fatalf("alice: got %q", got)
+	}
+	if got := render("Bearer bob", "2"); got != "Bearer bob 2" {
+		t.Errorf("bob: got %q", got)
+	}
+	// the request ID is not part of the key
+	if got := render("Bearer alice", "3"); got != "Bearer alice 1" {
+		t.Errorf("alice again: got %q", got)
+	}
+}
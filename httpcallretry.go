@@ -0,0 +1,185 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHttpCallBackoff is the default delay before the first retry of HttpCallComponent.
+const DefaultHttpCallBackoff = 100 * time.Millisecond
+
+// CircuitBreaker stops HttpCallComponent from calling a failing host for a while, so the pages
+// fail fast instead of waiting for the host. After Threshold consecutive failed calls (see
+// HttpCallArgs.Retries), the circuit of the host opens: the calls fail right away for Cooldown.
+// Then a single trial call is let through, which closes the circuit if it succeeds or opens it
+// again otherwise. The calls with the relative URLs share the circuit of the empty host.
+type CircuitBreaker struct {
+	// Threshold is the number of the consecutive failed calls opening the circuit. Default is 5.
+	Threshold int
+
+	// Cooldown is the time the circuit is open for. Default is 30 seconds.
+	Cooldown time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	openedAt time.Time // zero if the circuit is closed
+	trial    bool      // a trial call of the half-open circuit is in progress
+}
+
+// ErrCircuitOpen is the error of the calls to a host with the open circuit, see CircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// allow reports whether a call to the host may be made. It is safe to call on nil.
+func (b *CircuitBreaker) allow(host string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.hosts[host]
+	if c == nil || c.openedAt.IsZero() {
+		return true
+	}
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	if c.trial || time.Since(c.openedAt) < cooldown {
+		return false
+	}
+	c.trial = true
+	return true
+}
+
+// record records the result of a call to the host. It is safe to call on nil.
+func (b *CircuitBreaker) record(host string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.hosts == nil {
+		b.hosts = make(map[string]*circuit)
+	}
+	c := b.hosts[host]
+	if c == nil {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	if !failed {
+		*c = circuit{}
+		return
+	}
+
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+	c.failures++
+	if c.trial || c.failures >= threshold {
+		c.openedAt = time.Now()
+		c.trial = false
+	}
+}
+
+// release ends the trial call of the half-open circuit of the host without recording a result,
+// so another call can be the trial one. It is safe to call on nil.
+func (b *CircuitBreaker) release(host string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.hosts[host]; c != nil {
+		c.trial = false
+	}
+}
+
+// call makes an HTTP call with the retries and the circuit breaker.
+func (c *HttpCallComponent) call(ctx context.Context, parent *http.Request, args *HttpCallArgs) *HttpCallResponse {
+	host := ""
+	if u, err := url.Parse(args.URL); err == nil {
+		host = u.Host
+	}
+
+	retries := args.Retries
+	if !args.RetryUnsafe && !isIdempotent(args) {
+		retries = 0
+	}
+
+	var body []byte
+	if retries > 0 && args.Body != nil {
+		// the body is sent with each attempt
+		var err error
+		if body, err = io.ReadAll(args.Body); err != nil {
+			return c.makeResponse(nil, fmt.Errorf("read body: %w", err))
+		}
+	}
+
+	backoff := args.Backoff
+	if backoff <= 0 {
+		backoff = DefaultHttpCallBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !c.CircuitBreaker.allow(host) {
+			return c.makeResponse(nil, fmt.Errorf("%w for %q", ErrCircuitOpen, host))
+		}
+
+		a := *args
+		if body != nil {
+			a.Body = bytes.NewReader(body)
+		}
+		// the attempt is canceled before the next one, so an abandoned one doesn't keep running
+		attemptCtx, cancel := context.WithCancel(ctx)
+		resp := c.do(attemptCtx, parent, &a)
+		cancel()
+		if ctx.Err() != nil {
+			// the page request is canceled (e.g. the client has gone), it is not a failure of
+			// the host
+			c.CircuitBreaker.release(host)
+			return resp
+		}
+		failed := resp.Error != "" || resp.Code == http.StatusTooManyRequests || resp.Code >= 500
+		c.CircuitBreaker.record(host, failed)
+		if !failed || attempt >= retries {
+			return resp
+		}
+
+		select {
+		case <-time.After(backoff << attempt):
+		case <-ctx.Done():
+			return resp
+		}
+	}
+}
+
+// isIdempotent reports whether the call may be safely repeated: its method is idempotent or it
+// has the Idempotency-Key header.
+func isIdempotent(args *HttpCallArgs) bool {
+	switch strings.ToUpper(args.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for k := range args.Header {
+		if http.CanonicalHeaderKey(k) == "Idempotency-Key" {
+			return true
+		}
+	}
+	return false
+}
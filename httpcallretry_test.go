@@ -0,0 +1,171 @@
+package pages
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestHttpCallComponent_Retries(t *testing.T) {
+	var calls, failures atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/flaky", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/api/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	render := func(comp *HttpCallComponent, vars map[string]any) *HttpCallResponse {
+		t.Helper()
+		rr, err := comp.Render(chtml.NewBaseScope(vars))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr.(*HttpCallResponse)
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(2)
+		resp := render(NewHttpCallComponent(mux), map[string]any{
+			"url": "/api/flaky", "method": "PUT", "body": "x", "retries": 2, "backoff": "1ms",
+		})
+		if resp.Code != http.StatusOK || resp.Body != "ok" || calls.Load() != 3 {
+			t.Errorf("got %d %q after %d calls", resp.Code, resp.Body, calls.Load())
+		}
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			vars      map[string]any
+			wantCalls int32
+		}{
+			{"post", map[string]any{}, 1},
+			{"retry unsafe", map[string]any{"retry-unsafe": true}, 2},
+			{"idempotency key", map[string]any{"header": http.Header{"Idempotency-Key": {"k1"}}}, 2},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				calls.Store(0)
+				failures.Store(1)
+				vars := map[string]any{
+					"url": "/api/flaky", "method": "POST", "body": "x", "retries": 1, "backoff": "1ms",
+				}
+				for k, v := range tt.vars {
+					vars[k] = v
+				}
+				render(NewHttpCallComponent(mux), vars)
+				if calls.Load() != tt.wantCalls {
+					t.Errorf("got %d calls, want %d", calls.Load(), tt.wantCalls)
+				}
+			})
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(2)
+		resp := render(NewHttpCallComponent(mux), map[string]any{
+			"url": "/api/flaky", "retries": 1, "backoff": "1ms",
+		})
+		if resp.Code != http.StatusServiceUnavailable || calls.Load() != 2 {
+			t.Errorf("got %d after %d calls", resp.Code, calls.Load())
+		}
+	})
+
+	t.Run("abandoned attempts canceled", func(t *testing.T) {
+		var canceled atomic.Int32
+		hang := http.NewServeMux()
+		hang.HandleFunc("/api/hang", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			canceled.Add(1)
+		})
+		render(NewHttpCallComponent(hang), map[string]any{
+			"url": "/api/hang", "retries": 1, "backoff": "1ms", "timeout": "10ms",
+		})
+		deadline := time.Now().Add(5 * time.Second)
+		for canceled.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if canceled.Load() != 2 {
+			t.Errorf("got %d canceled attempts, want 2", canceled.Load())
+		}
+	})
+
+	t.Run("canceled page", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(0)
+		comp := NewHttpCallComponent(mux)
+		comp.CircuitBreaker = &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		page := httptest.NewRequest("GET", "/page", nil).WithContext(ctx)
+		for range 3 {
+			rr, err := comp.Render(newScope(map[string]any{"url": "http://backend/api/flaky"}, page, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := rr.(*HttpCallResponse); !strings.Contains(res.Error, "context canceled") {
+				t.Fatalf("Error = %q", res.Error)
+			}
+		}
+
+		resp := render(comp, map[string]any{"url": "http://backend/api/flaky"})
+		if resp.Body != "ok" || calls.Load() != 1 {
+			t.Errorf("the canceled calls tripped the breaker: got %q after %d calls", resp.Error, calls.Load())
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		resp := render(NewHttpCallComponent(mux), map[string]any{"url": "/api/slow", "timeout": "10ms"})
+		if !strings.Contains(resp.Error, "deadline exceeded") {
+			t.Errorf("want the timeout error, got %q (%d)", resp.Error, resp.Code)
+		}
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(100)
+		comp := NewHttpCallComponent(mux)
+		comp.CircuitBreaker = &CircuitBreaker{Threshold: 2, Cooldown: time.Hour}
+		vars := map[string]any{"url": "http://backend/api/flaky"}
+
+		render(comp, vars)
+		render(comp, vars)
+		resp := render(comp, vars)
+		if !strings.Contains(resp.Error, ErrCircuitOpen.Error()) || calls.Load() != 2 {
+			t.Errorf("want the open circuit, got %q after %d calls", resp.Error, calls.Load())
+		}
+
+		// the other hosts are not affected
+		if resp := render(comp, map[string]any{"url": "http://other/api/flaky"}); resp.Error != "" {
+			t.Errorf("other host: %q", resp.Error)
+		}
+
+		// after the cooldown, a successful trial call closes the circuit
+		failures.Store(0)
+		comp.CircuitBreaker.hosts["backend"].openedAt = time.Now().Add(-2 * time.Hour)
+		for range 3 {
+			if resp := render(comp, vars); resp.Body != "ok" {
+				t.Errorf("closed circuit: got %d %q", resp.Code, resp.Error)
+			}
+		}
+	})
+}
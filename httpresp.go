@@ -11,9 +11,10 @@ type HttpResponseComponent struct{}
 
 func (hc HttpResponseComponent) Render(s chtml.Scope) (any, error) {
 	var args struct {
-		Status   int
-		Location string
-		Cookies  []*http.Cookie
+		Status      int
+		Location    string
+		ContentType string
+		Cookies     []*http.Cookie
 	}
 	if err := chtml.UnmarshalScope(s, &args); err != nil {
 		return nil, fmt.Errorf("unmarshal scope: %w", err)
@@ -30,6 +31,9 @@ func (hc HttpResponseComponent) Render(s chtml.Scope) (any, error) {
 	if args.Location != "" {
 		ss.globals.header.Add("Location", args.Location)
 	}
+	if args.ContentType != "" {
+		ss.globals.header.Set("Content-Type", args.ContentType)
+	}
 	if len(args.Cookies) > 0 {
 		ss.globals.header.Add("Set-Cookie", args.Cookies[0].String())
 	}
@@ -0,0 +1,479 @@
+package pages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// defaultLocaleDir is the default directory of the message files in the catalog FileSystem.
+const defaultLocaleDir = "locales"
+
+// defaultLocaleCookie is the default name of the cookie selecting the locale.
+const defaultLocaleCookie = "pages_locale"
+
+// MessageCatalog holds the translated messages, one file per locale in the Dir directory of
+// the FileSystem: locales/en.json, locales/de.toml, locales/de-AT.json, etc. The nested JSON
+// objects and the TOML tables are flattened into the dotted keys, e.g. {"home": {"title": ""}}
+// defines the "home.title" message. The messages may contain the {name} placeholders replaced
+// with the arguments of TranslateComponent.
+//
+// The files are loaded on the first use, call Reload to load the changed files. The catalog
+// must be used by pointer.
+type MessageCatalog struct {
+	// FileSystem to load the message files from.
+	FileSystem fs.FS
+
+	// Dir is the directory of the message files. Default is "locales".
+	Dir string
+
+	// DefaultLocale is the locale used when the requested locale has no message. Default is "en".
+	DefaultLocale string
+
+	// CookieName is the name of the cookie overriding the Accept-Language header in
+	// SelectLocale. Default is "pages_locale".
+	CookieName string
+
+	mu       sync.Mutex
+	messages map[string]map[string]string // messages by locale and key, nil if not loaded
+}
+
+// Reload discards the loaded messages, so they are loaded again on the next use.
+func (mc *MessageCatalog) Reload() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.messages = nil
+}
+
+// Locales returns the sorted list of the locales with the message files.
+func (mc *MessageCatalog) Locales() ([]string, error) {
+	messages, err := mc.load()
+	if err != nil {
+		return nil, err
+	}
+	locales := make([]string, 0, len(messages))
+	for l := range messages {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales, nil
+}
+
+// Translate returns the message by key for the locale with the {name} placeholders replaced
+// with the params. The message is looked up for the locale, its parent locales (de-AT, de) and
+// the DefaultLocale. It returns false if there is no message.
+func (mc *MessageCatalog) Translate(locale, key string, params map[string]any) (string, bool, error) {
+	messages, err := mc.load()
+	if err != nil {
+		return "", false, err
+	}
+	for _, l := range append(localeChain(locale), localeChain(mc.defaultLocale())...) {
+		if msg, ok := messages[strings.ToLower(l)][key]; ok {
+			return formatMessage(msg, params), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// SelectLocale returns the locale for the request from the locale cookie or the Accept-Language
+// header, whichever has a catalog locale first, or the DefaultLocale. It is meant to be used as
+// the Handler.LocaleSelector:
+//
+//	handler.LocaleSelector = catalog.SelectLocale
+func (mc *MessageCatalog) SelectLocale(r *http.Request) string {
+	messages, err := mc.load()
+	if err != nil {
+		return mc.defaultLocale()
+	}
+	supported := func(lang string) string {
+		for _, l := range localeChain(lang) {
+			if _, ok := messages[strings.ToLower(l)]; ok {
+				return l
+			}
+		}
+		return ""
+	}
+
+	cookieName := mc.CookieName
+	if cookieName == "" {
+		cookieName = defaultLocaleCookie
+	}
+	if c, err := r.Cookie(cookieName); err == nil {
+		if l := supported(c.Value); l != "" {
+			return l
+		}
+	}
+	for _, lang := range acceptLanguages(r.Header.Get("Accept-Language")) {
+		if l := supported(lang); l != "" {
+			return l
+		}
+	}
+	return mc.defaultLocale()
+}
+
+func (mc *MessageCatalog) defaultLocale() string {
+	if mc.DefaultLocale != "" {
+		return mc.DefaultLocale
+	}
+	return "en"
+}
+
+// load loads the message files unless they are loaded already.
+func (mc *MessageCatalog) load() (map[string]map[string]string, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.messages != nil {
+		return mc.messages, nil
+	}
+	if mc.FileSystem == nil {
+		return nil, errors.New("message catalog has no file system")
+	}
+
+	dir := mc.Dir
+	if dir == "" {
+		dir = defaultLocaleDir
+	}
+	entries, err := fs.ReadDir(mc.FileSystem, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read message catalog: %w", err)
+	}
+
+	all := map[string]map[string]string{}
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".toml") {
+			continue
+		}
+		fname := path.Join(dir, e.Name())
+		data, err := fs.ReadFile(mc.FileSystem, fname)
+		if err != nil {
+			return nil, fmt.Errorf("read messages: %w", err)
+		}
+		var tree map[string]any
+		if ext == ".json" {
+			err = json.Unmarshal(data, &tree)
+		} else {
+			tree, err = parseTOML(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse messages %s: %w", fname, err)
+		}
+
+		locale := strings.ToLower(strings.TrimSuffix(e.Name(), ext))
+		if all[locale] == nil {
+			all[locale] = map[string]string{}
+		}
+		if err := flattenMessages(all[locale], "", tree); err != nil {
+			return nil, fmt.Errorf("parse messages %s: %w", fname, err)
+		}
+	}
+	mc.messages = all
+	return all, nil
+}
+
+// flattenMessages adds the messages from the nested tree to dst with the dotted keys.
+func flattenMessages(dst map[string]string, prefix string, tree map[string]any) error {
+	for k, v := range tree {
+		key := prefix + k
+		switch v := v.(type) {
+		case string:
+			dst[key] = v
+		case map[string]any:
+			if err := flattenMessages(dst, key+".", v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s is not a string: %T", key, v)
+		}
+	}
+	return nil
+}
+
+// formatMessage replaces the {name} placeholders in the message with the params. The unknown
+// placeholders are kept as is.
+func formatMessage(msg string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(msg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(msg[:start])
+		if v, ok := params[msg[start+1:end]]; ok {
+			sb.WriteString(fmt.Sprint(v))
+		} else {
+			sb.WriteString(msg[start : end+1])
+		}
+		msg = msg[end+1:]
+	}
+	sb.WriteString(msg)
+	return sb.String()
+}
+
+// localeChain returns the locale and its parent locales, e.g. de-AT, de.
+func localeChain(locale string) []string {
+	var chain []string
+	for l := locale; l != ""; {
+		chain = append(chain, l)
+		i := strings.LastIndexAny(l, "-_")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	return chain
+}
+
+// acceptLanguages returns the languages from the Accept-Language header value ordered by
+// the quality, the languages with q=0 are skipped.
+func acceptLanguages(v string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, part := range strings.Split(v, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if qv, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(qv, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			langs = append(langs, lang{tag, q})
+		}
+	}
+	slices.SortStableFunc(langs, func(a, b lang) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// parseTOML parses the subset of TOML used by the message files: the [table] headers, the
+// key = "value" pairs with the basic and literal strings, the dotted and quoted keys, and
+// the comments.
+func parseTOML(src string) (map[string]any, error) {
+	root := map[string]any{}
+	table := root
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", n+1, fmt.Sprintf(format, args...))
+		}
+
+		if line[0] == '[' {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fail("arrays of tables are not supported")
+			}
+			end := strings.IndexByte(line, ']')
+			if end < 0 || !isTOMLComment(line[end+1:]) {
+				return nil, fail("invalid table header")
+			}
+			keys, rest, err := parseTOMLKey(line[1:end])
+			if err != nil || strings.TrimSpace(rest) != "" {
+				return nil, fail("invalid table name")
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fail("%v", err)
+			}
+			continue
+		}
+
+		keys, rest, err := parseTOMLKey(line)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		rest, ok := strings.CutPrefix(strings.TrimSpace(rest), "=")
+		if !ok {
+			return nil, fail("expected =")
+		}
+		value, rest, err := parseTOMLString(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if !isTOMLComment(rest) {
+			return nil, fail("unexpected %q", rest)
+		}
+		t, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if _, ok := t[keys[len(keys)-1]]; ok {
+			return nil, fail("duplicate key %s", strings.Join(keys, "."))
+		}
+		t[keys[len(keys)-1]] = value
+	}
+	return root, nil
+}
+
+// parseTOMLKey parses the dotted key at the beginning of s and returns its parts and the rest
+// of s.
+func parseTOMLKey(s string) ([]string, string, error) {
+	var keys []string
+	for {
+		s = strings.TrimSpace(s)
+		var key string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			var err error
+			if key, s, err = parseTOMLString(s); err != nil {
+				return nil, "", err
+			}
+		} else {
+			i := strings.IndexFunc(s, func(r rune) bool {
+				return !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if i < 0 {
+				i = len(s)
+			}
+			if i == 0 {
+				return nil, "", errors.New("expected key")
+			}
+			key, s = s[:i], s[i:]
+		}
+		keys = append(keys, key)
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(s), "."); ok {
+			s = rest
+			continue
+		}
+		return keys, s, nil
+	}
+}
+
+// parseTOMLString parses the basic ("...") or literal ('...') string at the beginning of s and
+// returns its value and the rest of s.
+func parseTOMLString(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return "", "", errors.New("multi-line strings are not supported")
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	}
+	return "", "", errors.New("expected string")
+}
+
+// tomlTable returns the nested table of t by the keys, creating the missing tables.
+func tomlTable(t map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]any{}
+			t[k] = next
+			t = next
+		case map[string]any:
+			t = v
+		default:
+			return nil, fmt.Errorf("key %s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+func isTOMLComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// TranslateComponent renders the message from the Catalog for the locale of the request
+// (see Handler.LocaleSelector), e.g.:
+//
+//	<c:t key="home.greeting" name="${user.name}"></c:t>
+//
+// The arguments other than the key replace the {name} placeholders in the message. If there is
+// no message, the content of the element is rendered instead, or the key if there is no
+// content. The component is opt-in:
+//
+//	handler.BuiltinComponents["t"] = pages.TranslateComponent{Catalog: catalog}
+type TranslateComponent struct {
+	Catalog *MessageCatalog
+}
+
+var _ chtml.Component = TranslateComponent{}
+
+func (tc TranslateComponent) Render(s chtml.Scope) (any, error) {
+	vars := s.Vars()
+	key, _ := vars["key"].(string)
+	if key == "" {
+		if _, ok := s.(*scope); !ok {
+			return "", nil // the key is not known at parse time
+		}
+		return nil, errors.New("message key is required")
+	}
+
+	locale := ""
+	if ss, ok := s.(*scope); ok {
+		locale = ss.globals.locale
+	}
+	params := make(map[string]any, len(vars))
+	for k, v := range vars {
+		if k != "key" && k != "_" {
+			params[k] = v
+		}
+	}
+
+	msg, ok, err := tc.Catalog.Translate(locale, key, params)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return msg, nil
+	}
+	if content := vars["_"]; content != nil {
+		return content, nil
+	}
+	return key, nil
+}
@@ -0,0 +1,102 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPages_Translate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"home": {"title": "Home", "greeting": "Hello, {name}!"}, "bye": "Bye"}`)},
+		"locales/de.toml": {Data: []byte(`# German
+bye = 'Tschüss'
+
+[home]
+title = "Startseite"
+greeting = "Hallo, {name}!" # informal
+`)},
+		"locales/de-AT.json": {Data: []byte(`{"home.title": "Startseite (AT)"}`)},
+		"index.chtml": {Data: []byte(`<h1><c:t key="home.title"></c:t></h1>` +
+			`<p><c:t key="home.greeting" name="${'Ann'}"></c:t> <c:t key="bye"></c:t></p>` +
+			`<p><c:t key="missing">fallback</c:t> <c:t key="missing.key"></c:t></p>`)},
+	}
+	catalog := &MessageCatalog{FileSystem: fsys}
+	h := &Handler{
+		FileSystem:        fsys,
+		LocaleSelector:    catalog.SelectLocale,
+		BuiltinComponents: map[string]chtml.Component{"t": TranslateComponent{Catalog: catalog}},
+	}
+
+	tests := []struct {
+		name   string
+		lang   string
+		cookie string
+		want   string
+	}{
+		{"default", "", "", `<h1>Home</h1><p>Hello, Ann! Bye</p><p>fallback missing.key</p>`},
+		{"accept-language", "fr, de;q=0.8, en;q=0.5", "", `<h1>Startseite</h1><p>Hallo, Ann! Tschüss</p><p>fallback missing.key</p>`},
+		{"regional", "de-AT", "", `<h1>Startseite (AT)</h1><p>Hallo, Ann! Tschüss</p><p>fallback missing.key</p>`},
+		{"unsupported", "fr", "", `<h1>Home</h1><p>Hello, Ann! Bye</p><p>fallback missing.key</p>`},
+		{"cookie", "de", "en", `<h1>Home</h1><p>Hello, Ann! Bye</p><p>fallback missing.key</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.lang != "" {
+				req.Header.Set("Accept-Language", tt.lang)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "pages_locale", Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d", rec.Code)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	locales, err := catalog.Locales()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"de", "de-at", "en"}; !reflect.DeepEqual(locales, want) {
+		t.Errorf("locales = %v, want %v", locales, want)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(`
+a = "x\ty" # comment
+"b.c" = 'raw\n'
+d.e = "nested"
+[f . g]
+h = ""
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"a":   "x\ty",
+		"b.c": `raw\n`,
+		"d":   map[string]any{"e": "nested"},
+		"f":   map[string]any{"g": map[string]any{"h": ""}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, src := range []string{`a = 1`, `a = "x" b`, `a = "x"` + "\n" + `a = "y"`, `[[t]]`, `a = """x"""`, `= "x"`} {
+		if _, err := parseTOML(src); err == nil {
+			t.Errorf("parseTOML(%q): no error", src)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package pages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// IncludeComponent embeds a static file, e.g. a legacy HTML snippet that should not become
+// a component:
+//
+//	<c:include path="snippets/footer.html" raw="true"></c:include>
+//
+// By default, the file content is embedded as text, so it is escaped. With raw="true", the file
+// is parsed as an HTML fragment. The path is relative to the FileSystem root. The .chtml files,
+// the hidden files (named with a leading dot) and the paths leading outside the FileSystem are
+// not allowed.
+type IncludeComponent struct {
+	// FileSystem to read the files from. If not set, the Handler's FileSystem is used.
+	FileSystem fs.FS
+}
+
+var _ chtml.Component = (*IncludeComponent)(nil)
+
+// includeArgs are the arguments of IncludeComponent.
+type includeArgs struct {
+	Path string
+	Raw  bool
+}
+
+func (ic *IncludeComponent) Render(s chtml.Scope) (any, error) {
+	var args includeArgs
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+
+	name, err := includePath(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := ic.FileSystem
+	if v, ok := s.(*scope); ok && fsys == nil {
+		fsys = v.globals.fsys
+	}
+	if fsys == nil {
+		return nil, nil // outside of a page request (e.g. at parse time)
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", args.Path, err)
+	}
+
+	if !args.Raw {
+		return string(data), nil
+	}
+
+	nodes, err := html.ParseFragment(bytes.NewReader(data), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", args.Path, err)
+	}
+	doc := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		doc.AppendChild(n)
+	}
+	return doc, nil
+}
+
+// includePath validates the path of an included file and returns it relative to the file system
+// root.
+func includePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("include path is required")
+	}
+	name := strings.TrimPrefix(p, "/")
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid include path %q", p)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return "", fmt.Errorf("include path %q refers to a hidden file", p)
+		}
+	}
+	if path.Ext(name) == chtmlExt {
+		return "", fmt.Errorf("include path %q refers to a component, import it instead", p)
+	}
+	return name, nil
+}
@@ -0,0 +1,53 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestIncludeComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"snippets/footer.html": {Data: []byte(`<footer>&copy; <b>ACME</b></footer>`)},
+		"snippets/.secret":     {Data: []byte(`secret`)},
+		"raw.chtml":            {Data: []byte(`<div><c:include path="snippets/footer.html" raw="true"></c:include></div>`)},
+		"text.chtml":           {Data: []byte(`<pre><c:include path="/snippets/footer.html"></c:include></pre>`)},
+		"up.chtml":             {Data: []byte(`<c:include path="../etc/passwd"></c:include>`)},
+		"hidden.chtml":         {Data: []byte(`<c:include path="snippets/.secret"></c:include>`)},
+		"comp.chtml":           {Data: []byte(`<c:include path="raw.chtml"></c:include>`)},
+		"missing.chtml":        {Data: []byte(`<c:include path="snippets/none.html"></c:include>`)},
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"include": &IncludeComponent{}},
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		want   string
+	}{
+		{"/raw", 200, `<div><footer>© <b>ACME</b></footer></div>`},
+		{"/text", 200, `<pre>&lt;footer&gt;&amp;copy; &lt;b&gt;ACME&lt;/b&gt;&lt;/footer&gt;</pre>`},
+		{"/up", 500, ""},
+		{"/hidden", 500, ""},
+		{"/comp", 500, ""},
+		{"/missing", 500, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d, want %d", rr.Code, tt.status)
+			}
+			if tt.want != "" && rr.Body.String() != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package pages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/html"
+)
+
+// jsonPatchProtocol is the WebSocket subprotocol for receiving the data pages as JSON patches.
+const jsonPatchProtocol = "json-patch"
+
+// patchOp is an operation of a JSON patch (RFC 6902). Only the add, remove and replace
+// operations are produced.
+type patchOp struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// MarshalJSON omits the value of the remove operations and keeps the null values of others.
+func (op patchOp) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+// toJSONValue converts v to the generic JSON representation (maps, slices, strings, float64,
+// bools and nil), so the values can be compared regardless of the Go types they were
+// rendered from.
+func toJSONValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// diffJSON returns the patch transforming the generic JSON value a into b.
+func diffJSON(a, b any) []patchOp {
+	return appendDiff(nil, "", a, b)
+}
+
+func appendDiff(ops []patchOp, path string, a, b any) []patchOp {
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			return appendObjectDiff(ops, path, a, b)
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			return appendArrayDiff(ops, path, a, b)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return ops
+	}
+	return append(ops, patchOp{Op: "replace", Path: path, Value: b})
+}
+
+func appendObjectDiff(ops []patchOp, path string, a, b map[string]any) []patchOp {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		p := path + "/" + escapeJSONPointer(k)
+		av, inA := a[k]
+		bv, inB := b[k]
+		switch {
+		case !inB:
+			ops = append(ops, patchOp{Op: "remove", Path: p})
+		case !inA:
+			ops = append(ops, patchOp{Op: "add", Path: p, Value: bv})
+		default:
+			ops = appendDiff(ops, p, av, bv)
+		}
+	}
+	return ops
+}
+
+// appendArrayDiff compares the common items by index, then appends the new items or removes
+// the extra ones from the end.
+func appendArrayDiff(ops []patchOp, path string, a, b []any) []patchOp {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		ops = appendDiff(ops, path+"/"+strconv.Itoa(i), a[i], b[i])
+	}
+	for i := n; i < len(b); i++ {
+		ops = append(ops, patchOp{Op: "add", Path: path + "/-", Value: b[i]})
+	}
+	for i := len(a) - 1; i >= n; i-- {
+		ops = append(ops, patchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+	}
+	return ops
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapeJSONPointer escapes a reference token of a JSON pointer (RFC 6901).
+func escapeJSONPointer(s string) string {
+	return jsonPointerEscaper.Replace(s)
+}
+
+// patchState is the last data sent to a WebSocket client receiving the JSON patches.
+type patchState struct {
+	prev any
+	sent bool
+}
+
+// renderWS renders the component into a WebSocket message. If patches is not nil, a data result
+// is sent as a JSON patch to the previously sent one. The first patch replaces the whole document.
+// No message is sent if the data has not changed. Likewise, if htmlPatches is not nil, an HTML
+// result is sent as an HTML patch (see htmlPatchOp). Other HTML and text results are sent as is.
+// If the page fails to render (or sets a 5xx status code, or a BeforeRender hook fails), an error
+// frame is sent instead (see wsErrorFrame).
+func (h *Handler) renderWS(
+	ws *websocket.Conn, comp chtml.Component, s *scope, patches *patchState, htmlPatches *htmlPatchState,
+) error {
+	s.globals.statusCode = 0 // the status code of the previous render is not relevant
+
+	if err := h.beforeRender(s, comp); err != nil {
+		return writeWSError(ws, h.hookStatus(err))
+	}
+	defer h.afterRender(s, comp)
+
+	rr, err := h.renderResult(comp, s)
+	if err != nil {
+		return err
+	}
+	if s.globals.statusCode >= http.StatusInternalServerError {
+		return writeWSError(ws, s.globals.statusCode)
+	}
+
+	switch rr.(type) {
+	case *html.Node, string:
+		if patches != nil {
+			patches.sent = false
+		}
+	default:
+		if patches != nil {
+			return patches.write(ws, rr)
+		}
+	}
+	if _, ok := rr.(*html.Node); ok && htmlPatches != nil {
+		var buf bytes.Buffer
+		if err := h.writeResult(&buf, rr, s); err != nil {
+			return err
+		}
+		return htmlPatches.write(ws, buf.Bytes())
+	} else if htmlPatches != nil {
+		htmlPatches.sent = false
+	}
+
+	w, err := ws.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return fmt.Errorf("get websocket writer: %w", err)
+	}
+	if err := h.writeResult(w, rr, s); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close websocket writer: %w", err)
+	}
+	return nil
+}
+
+func (p *patchState) write(ws *websocket.Conn, rr any) error {
+	v, err := toJSONValue(rr)
+	if err != nil {
+		return fmt.Errorf("render JSON: %w", err)
+	}
+
+	var ops []patchOp
+	if p.sent {
+		ops = diffJSON(p.prev, v)
+	} else {
+		ops = []patchOp{{Op: "replace", Path: "", Value: v}}
+	}
+	p.prev, p.sent = v, true
+
+	if len(ops) == 0 {
+		return nil
+	}
+	msg, err := json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("render JSON patch: %w", err)
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("write websocket message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package pages
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", `{"a":[1,{"b":2}]}`, `{"a":[1,{"b":2}]}`, `null`},
+		{"replace scalar", `{"a":1}`, `{"a":2}`, `[{"op":"replace","path":"/a","value":2}]`},
+		{"replace type", `{"a":{"b":1}}`, `{"a":[1]}`, `[{"op":"replace","path":"/a","value":[1]}]`},
+		{"add and remove keys", `{"a":1,"b":2}`, `{"b":2,"c":null}`,
+			`[{"op":"remove","path":"/a"},{"op":"add","path":"/c","value":null}]`},
+		{"nested", `{"user":{"name":"x","tags":["a"]}}`, `{"user":{"name":"y","tags":["a"]}}`,
+			`[{"op":"replace","path":"/user/name","value":"y"}]`},
+		{"append items", `[1]`, `[1,2,3]`,
+			`[{"op":"add","path":"/-","value":2},{"op":"add","path":"/-","value":3}]`},
+		{"remove items", `[1,2,3]`, `[0]`,
+			`[{"op":"replace","path":"/0","value":0},{"op":"remove","path":"/2"},{"op":"remove","path":"/1"}]`},
+		{"escaped keys", `{"a/b":1,"c~d":1}`, `{"a/b":2,"c~d":2}`,
+			`[{"op":"replace","path":"/a~1b","value":2},{"op":"replace","path":"/c~0d","value":2}]`},
+		{"root", `1`, `"x"`, `[{"op":"replace","path":"","value":"x"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a, b any
+			if err := json.Unmarshal([]byte(tt.a), &a); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.b), &b); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(diffJSON(a, b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPages_WebSocketJSONPatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"stats.chtml": {Data: []byte(`<c:attr name="n">${0}</c:attr>${ {"n": n, "items": [1, 2]} }`)},
+		"page.chtml":  {Data: []byte(`<c:attr name="n">${0}</c:attr><p>${n}</p>`)},
+	}
+
+	srv := httptest.NewServer(&Handler{FileSystem: fsys})
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"json-patch"}}
+	dial := func(path string) *websocket.Conn {
+		ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ws.Subprotocol() != "json-patch" {
+			t.Fatalf("subprotocol = %q", ws.Subprotocol())
+		}
+		return ws
+	}
+	exchange := func(ws *websocket.Conn, vars map[string]any) string {
+		t.Helper()
+		if err := ws.WriteJSON(vars); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(msg))
+	}
+
+	ws := dial("/stats")
+	defer ws.Close()
+
+	if got, want := exchange(ws, map[string]any{"n": 1}),
+		`[{"op":"replace","path":"","value":{"items":[1,2],"n":1}}]`; got != want {
+		t.Errorf("first message:\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := exchange(ws, map[string]any{"n": 2}),
+		`[{"op":"replace","path":"/n","value":2}]`; got != want {
+		t.Errorf("second message:\ngot  %s\nwant %s", got, want)
+	}
+
+	// HTML pages are sent as is
+	ws2 := dial("/page")
+	defer ws2.Close()
+
+	if got, want := exchange(ws2, map[string]any{"n": 1}), `<p>1</p>`; got != want {
+		t.Errorf("HTML message: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,241 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// layoutFile is the name of the layout component file wrapping the pages in its directory and
+// the subdirectories. The layout files are not routable.
+const layoutFile = "_layout" + chtmlExt
+
+// maxLayoutDepth limits the number of layouts wrapping a page, e.g. to stop the layouts
+// selecting each other.
+const maxLayoutDepth = 16
+
+// layoutComponent renders the page and composes its output into the layouts: the layout selected
+// by the page with LayoutComponent, or the _layout.chtml files found in the directory of the page
+// and its parents, from the nearest one to the root. The output of the page (or the inner layout)
+// is passed to the layout as the "_" variable, and the content of the slots filled with
+// SlotComponent as the variables named after the slots. A layout receives only the slots it
+// declares with <c:attr>.
+type layoutComponent struct {
+	h    *Handler
+	page chtml.Component
+	dir  string // directory of the page
+
+	// layouts are the imported layouts by the file path or the name, reused between renders.
+	layouts map[string]chtml.Component
+}
+
+var _ chtml.Component = (*layoutComponent)(nil)
+var _ chtml.Disposable = (*layoutComponent)(nil)
+var _ chtml.InputDeclarer = (*layoutComponent)(nil)
+var _ chtml.StreamRenderer = (*layoutComponent)(nil)
+
+// withLayouts wraps the page component from the directory dir to compose it into the layouts.
+func (h *Handler) withLayouts(page chtml.Component, dir string) chtml.Component {
+	if page == nil {
+		return nil
+	}
+	return &layoutComponent{h: h, page: page, dir: dir, layouts: map[string]chtml.Component{}}
+}
+
+func (lc *layoutComponent) Render(s chtml.Scope) (any, error) {
+	ss, ok := s.(*scope)
+	if !ok {
+		return lc.page.Render(s)
+	}
+
+	ss.globals.slots, ss.globals.layout = nil, nil // filled by the page on each render
+	rr, err := lc.page.Render(s)
+	if err != nil {
+		return rr, err
+	}
+
+	compDir := lc.dir   // directory of the last rendered component to import the named layouts from
+	searchDir := lc.dir // directory to search the next _layout.chtml file from, empty to stop
+	for depth := 0; ; depth++ {
+		var layout chtml.Component
+		if name := ss.globals.layout; name != nil {
+			// the layout selected by the rendered component replaces the _layout.chtml files
+			ss.globals.layout = nil
+			searchDir = ""
+			if *name == "" {
+				return rr, nil
+			}
+			layout, err = lc.importNamed(*name, compDir)
+		} else if searchDir != "" {
+			layout, compDir, err = lc.importNearest(searchDir)
+			if compDir == "." {
+				searchDir = ""
+			} else {
+				searchDir = path.Dir(compDir)
+			}
+		}
+		if err != nil || layout == nil {
+			return rr, err
+		}
+		if depth == maxLayoutDepth {
+			return nil, fmt.Errorf("more than %d layouts wrap the page", maxLayoutDepth)
+		}
+
+		vars := map[string]any{"_": rr}
+		for name, content := range ss.globals.slots {
+			if d, ok := layout.(chtml.InputDeclarer); ok {
+				if _, declared := d.Inputs()[name]; !declared {
+					continue // the slot is filled for another layout
+				}
+			}
+			vars[name] = content
+		}
+		if rr, err = layout.Render(s.Spawn(vars)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// importNamed imports the layout selected with LayoutComponent relative to the directory dir.
+func (lc *layoutComponent) importNamed(name, dir string) (chtml.Component, error) {
+	key := dir + ":" + name
+	if comp, ok := lc.layouts[key]; ok {
+		return comp, nil
+	}
+	comp, err := lc.h.importer(dir).Import(name)
+	if err != nil {
+		return nil, fmt.Errorf("import layout %q: %w", name, err)
+	}
+	lc.layouts[key] = comp
+	return comp, nil
+}
+
+// importNearest imports the _layout.chtml file from the directory dir or its nearest parent.
+// It returns the directory of the layout file, or nil if there is no layout file.
+func (lc *layoutComponent) importNearest(dir string) (chtml.Component, string, error) {
+	for {
+		p := path.Join(dir, layoutFile)
+		if comp, ok := lc.layouts[p]; ok {
+			return comp, dir, nil
+		}
+		if _, err := fs.Stat(lc.h.FileSystem, p); err == nil {
+			comp, err := lc.h.importer(dir).(*pagesImporter).load(p)
+			if err != nil {
+				return nil, "", fmt.Errorf("import layout %s: %w", p, err)
+			}
+			lc.layouts[p] = comp
+			return comp, dir, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("stat layout %s: %w", p, err)
+		}
+		if dir == "." {
+			return nil, "", nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// RenderTo streams the page if no layout can wrap it: there is no _layout.chtml file for the page
+// and the LayoutComponent is not registered. Otherwise, the page is rendered as a whole.
+func (lc *layoutComponent) RenderTo(w io.Writer, s chtml.Scope) error {
+	sr, ok := lc.page.(chtml.StreamRenderer)
+	if !ok {
+		return chtml.ErrNotStreamable
+	}
+	for _, comp := range lc.h.BuiltinComponents {
+		if _, ok := comp.(LayoutComponent); ok {
+			return chtml.ErrNotStreamable
+		}
+	}
+	if layout, _, err := lc.importNearest(lc.dir); err != nil || layout != nil {
+		return chtml.ErrNotStreamable
+	}
+	return sr.RenderTo(w, s)
+}
+
+func (lc *layoutComponent) Dispose() error {
+	var errs []error
+	for _, comp := range append([]chtml.Component{lc.page}, slices.Collect(maps.Values(lc.layouts))...) {
+		if d, ok := comp.(chtml.Disposable); ok {
+			errs = append(errs, d.Dispose())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Inputs returns the arguments declared by the page.
+func (lc *layoutComponent) Inputs() map[string]any {
+	if d, ok := lc.page.(chtml.InputDeclarer); ok {
+		return d.Inputs()
+	}
+	return nil
+}
+
+// LayoutComponent selects the layout of the page instead of the _layout.chtml files, e.g.:
+//
+//	<c:layout name="base"></c:layout>
+//
+// The layout is imported like other components, relative to the page. An empty name renders
+// the page without a layout. A layout can select the layout wrapping it the same way. The
+// component renders nothing and is opt-in, so it does not shadow the user components named
+// "layout":
+//
+//	handler.BuiltinComponents["layout"] = pages.LayoutComponent{}
+type LayoutComponent struct{}
+
+var _ chtml.Component = LayoutComponent{}
+
+func (LayoutComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		Name string
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+	if ss, ok := s.(*scope); ok {
+		ss.globals.layout = &args.Name
+	}
+	return nil, nil
+}
+
+// SlotComponent fills the named slot of the layouts with its content, e.g. the page can add
+// the elements to the <head> of the layout:
+//
+//	<c:slot name="head"><link rel="stylesheet" href="/blog.css"></c:slot>
+//
+// The layouts receive the content of the slot as the variable with the slot name, e.g. ${head}.
+// The content of the slots with the same name is concatenated. The <c:slot> children of
+// an import fill the named slots of the imported component instead (see package chtml).
+// The component renders nothing and is opt-in:
+//
+//	handler.BuiltinComponents["slot"] = pages.SlotComponent{}
+type SlotComponent struct{}
+
+var _ chtml.Component = SlotComponent{}
+
+func (SlotComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		Name string
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+	ss, ok := s.(*scope)
+	if !ok {
+		return nil, nil
+	}
+	if args.Name == "" || args.Name == "_" {
+		return nil, fmt.Errorf("invalid slot name %q", args.Name)
+	}
+	if ss.globals.slots == nil {
+		ss.globals.slots = map[string]any{}
+	}
+	ss.globals.slots[args.Name] = chtml.AnyPlusAny(ss.globals.slots[args.Name], s.Vars()["_"])
+	return nil, nil
+}
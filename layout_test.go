@@ -0,0 +1,62 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPages_Layouts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_layout.chtml": {Data: []byte(`<c:attr name="head"></c:attr>` +
+			`<html><head>${head}</head><body>${_}</body></html>`)},
+		"index.chtml": {Data: []byte(`<p>home</p>`)},
+		"blog/_layout.chtml": {Data: []byte(`<c:attr name="nav"></c:attr>` +
+			`<c:slot name="head"><meta name="section" content="blog"></c:slot>` +
+			`<nav>${nav}</nav><article>${_}</article>`)},
+		"blog/post.chtml": {Data: []byte(`<c:slot name="head"><title>Post</title></c:slot>` +
+			`<c:slot name="nav"><a href="/blog">Blog</a></c:slot><p>post</p>`)},
+		"blog/raw.chtml":       {Data: []byte(`<c:layout name=""></c:layout><p>raw</p>`)},
+		"blog/print.chtml":     {Data: []byte(`<c:layout name="printable"></c:layout><p>printable</p>`)},
+		".lib/printable.chtml": {Data: []byte(`<div class="print">${_}</div>`)},
+		"loop/index.chtml":     {Data: []byte(`<c:layout name="a"></c:layout>x`)},
+		"loop/a.chtml":         {Data: []byte(`<c:layout name="a"></c:layout>${_}`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"layout": LayoutComponent{},
+			"slot":   SlotComponent{},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/", 200, `<html><head></head><body><p>home</p></body></html>`},
+		{"/blog/post", 200, `<html><head><title>Post</title><meta name="section" content="blog"/></head>` +
+			`<body><nav><a href="/blog">Blog</a></nav><article><p>post</p></article></body></html>`},
+		{"/blog/raw", 200, `<p>raw</p>`},
+		{"/blog/print", 200, `<div class="print"><p>printable</p></div>`},
+		{"/_layout", 404, "Not Found\n"},
+		{"/blog/_layout", 404, "Not Found\n"},
+		{"/loop/", 500, "null\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body:\n%s\nwant:\n%s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package pages
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// liveThrottle limits the rate of the renders of a live page pushed over WebSocket or Server-Sent
+// Events (see Handler.LiveUpdateInterval): the updates arriving within the interval after
+// a render are coalesced into a single render at the end of the interval.
+type liveThrottle struct {
+	interval time.Duration
+	last     time.Time   // time of the last render
+	timer    *time.Timer // fires when the deferred update is due, nil if there is none
+}
+
+// ready reports whether the page can be rendered for an update right away. Otherwise, the render
+// is deferred until the channel returned by C fires.
+func (t *liveThrottle) ready() bool {
+	if t.timer != nil {
+		return false // coalesced with the deferred update
+	}
+	wait := t.interval - time.Since(t.last)
+	if wait <= 0 {
+		return true
+	}
+	t.timer = time.NewTimer(wait)
+	return false
+}
+
+// C returns the channel firing when the deferred update is due, or nil if there is none.
+func (t *liveThrottle) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// rendered records the render of the page, it includes the deferred update if any.
+func (t *liveThrottle) rendered() {
+	t.last = time.Now()
+	t.stop()
+}
+
+// stop cancels the deferred update.
+func (t *liveThrottle) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+// liveThrottle returns the throttle of the live updates of the page, see LiveUpdateInterval.
+func (h *Handler) liveThrottle(fsPath string) *liveThrottle {
+	interval := h.LiveUpdateInterval
+	if d, ok := dirValue(h.LiveUpdateIntervals, fsPath); ok {
+		interval = d
+	}
+	return &liveThrottle{interval: interval}
+}
+
+// dirValue returns the value of the most specific directory of the file in the map by directory,
+// e.g. of "/docs" for "docs/intro.chtml" in {"/": a, "/docs": b}.
+func dirValue[T any](m map[string]T, fsPath string) (T, bool) {
+	dir := path.Join("/", path.Dir(fsPath))
+	var res T
+	best := -1
+	for d, v := range m {
+		d = path.Join("/", d) // e.g. "docs/" is "/docs"
+		if d != "/" && d != dir && !strings.HasPrefix(dir, d+"/") || len(d) <= best {
+			continue
+		}
+		res, best = v, len(d)
+	}
+	return res, best >= 0
+}
@@ -0,0 +1,121 @@
+package pages
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// burstComponent renders the number of its renders and touches the scope several times in
+// a burst after the first one.
+type burstComponent struct {
+	n *atomic.Int32
+}
+
+func (c burstComponent) Render(s chtml.Scope) (any, error) {
+	if _, ok := s.(*scope); !ok {
+		return nil, nil
+	}
+	n := c.n.Add(1)
+	if n == 1 {
+		go func() {
+			for range 5 {
+				time.Sleep(2 * time.Millisecond)
+				s.Touch()
+			}
+		}()
+	}
+	return strconv.Itoa(int(n)), nil
+}
+
+func TestPages_LiveUpdateInterval(t *testing.T) {
+	n := new(atomic.Int32)
+	h := &Handler{
+		FileSystem:          fstest.MapFS{"chat/feed.chtml": {Data: []byte(`<c:burst></c:burst>`)}},
+		BuiltinComponents:   map[string]chtml.Component{"burst": burstComponent{n: n}},
+		LiveUpdateIntervals: map[string]time.Duration{"/chat": 100 * time.Millisecond},
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/chat/feed", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data []string
+	sc := bufio.NewScanner(resp.Body)
+	for len(data) < 2 && sc.Scan() {
+		if line, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			data = append(data, line)
+		}
+	}
+	if len(data) < 2 || data[0] != "1" || data[1] != "2" {
+		t.Fatalf("events = %q, want [1 2]: %v", data, sc.Err())
+	}
+
+	time.Sleep(150 * time.Millisecond) // the touches of the burst are coalesced into one render
+	if got := n.Load(); got != 2 {
+		t.Errorf("renders = %d, want 2", got)
+	}
+}
+
+func TestLiveThrottle(t *testing.T) {
+	th := &liveThrottle{}
+	if !th.ready() || th.C() != nil {
+		t.Error("zero interval: update is deferred")
+	}
+
+	th = &liveThrottle{interval: 20 * time.Millisecond}
+	if !th.ready() {
+		t.Error("first update is deferred")
+	}
+	th.rendered()
+	if th.ready() || th.ready() {
+		t.Error("update within the interval is not deferred")
+	}
+	select {
+	case <-th.C():
+	case <-time.After(time.Second):
+		t.Fatal("deferred update is not fired")
+	}
+	th.rendered()
+	if th.C() != nil {
+		t.Error("deferred update is pending after the render")
+	}
+}
+
+func TestDirValue(t *testing.T) {
+	m := map[string]int{"/": 1, "/docs": 2, "docs/api/": 3}
+	tests := []struct {
+		fsPath string
+		want   int
+	}{
+		{"index.chtml", 1},
+		{"docs/index.chtml", 2},
+		{"docs/api/v1/users.chtml", 3},
+		{"docsy/index.chtml", 1},
+	}
+	for _, tt := range tests {
+		if got, ok := dirValue(m, tt.fsPath); !ok || got != tt.want {
+			t.Errorf("dirValue(%q) = %d, %v, want %d", tt.fsPath, got, ok, tt.want)
+		}
+	}
+	if _, ok := dirValue(map[string]int{"/docs": 2}, "index.chtml"); ok {
+		t.Error("dirValue matched a sibling directory")
+	}
+}
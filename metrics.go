@@ -0,0 +1,186 @@
+package pages
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDurationSamples is the number of the most recent durations per route the percentiles
+// are computed from.
+const maxDurationSamples = 1024
+
+// RouteMetrics is a snapshot of the metrics of a route template, e.g. "users/_id[int].chtml".
+// The requests to the dynamic routes are aggregated by the template they matched, not by URL.
+type RouteMetrics struct {
+	// Route is the path of the matched file in the FileSystem.
+	Route string `json:"route"`
+
+	// Requests is the number of the served requests.
+	Requests uint64 `json:"requests"`
+
+	// Errors is the number of the responses with 5xx status codes.
+	Errors uint64 `json:"errors"`
+
+	// ErrorRate is Errors divided by Requests.
+	ErrorRate float64 `json:"error_rate"`
+
+	// Bytes is the total size of the response bodies.
+	Bytes int64 `json:"bytes"`
+
+	// StatusCodes is the number of the responses by status code.
+	StatusCodes map[int]uint64 `json:"status_codes"`
+
+	// P50 and P95 are the percentiles of the time to serve the recent requests.
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+}
+
+// Metrics returns the metrics of the served routes sorted by route. The metrics are collected
+// only if CollectMetrics is set.
+func (h *Handler) Metrics() []RouteMetrics {
+	return h.metrics.snapshot()
+}
+
+// MetricsHandler returns an http.Handler responding with the route metrics in JSON, e.g. to be
+// mounted at an internal "/metrics" endpoint.
+func (h *Handler) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Metrics())
+	})
+}
+
+// routeMetrics collects the metrics of the routes.
+type routeMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*routeStats
+}
+
+type routeStats struct {
+	requests    uint64
+	errors      uint64
+	bytes       int64
+	statusCodes map[int]uint64
+
+	// durations is a ring buffer of the recent durations, next is the index to write to.
+	durations []time.Duration
+	next      int
+}
+
+func (m *routeMetrics) record(route string, statusCode int, bytes int64, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.routes == nil {
+		m.routes = make(map[string]*routeStats)
+	}
+	st, ok := m.routes[route]
+	if !ok {
+		st = &routeStats{statusCodes: make(map[int]uint64)}
+		m.routes[route] = st
+	}
+
+	st.requests++
+	if statusCode >= http.StatusInternalServerError {
+		st.errors++
+	}
+	st.bytes += bytes
+	st.statusCodes[statusCode]++
+
+	if len(st.durations) < maxDurationSamples {
+		st.durations = append(st.durations, d)
+	} else {
+		st.durations[st.next] = d
+		st.next = (st.next + 1) % maxDurationSamples
+	}
+}
+
+// rank returns the number of the routes requested more times than the route, i.e. 0 for the most
+// requested one. It returns false if the route has not been requested yet.
+func (m *routeMetrics) rank(route string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.routes[route]
+	if !ok {
+		return 0, false
+	}
+	rank := 0
+	for _, other := range m.routes {
+		if other.requests > st.requests {
+			rank++
+		}
+	}
+	return rank, true
+}
+
+func (m *routeMetrics) snapshot() []RouteMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]RouteMetrics, 0, len(m.routes))
+	for route, st := range m.routes {
+		codes := make(map[int]uint64, len(st.statusCodes))
+		for k, v := range st.statusCodes {
+			codes[k] = v
+		}
+		durations := slices.Clone(st.durations)
+		slices.Sort(durations)
+
+		res = append(res, RouteMetrics{
+			Route:       route,
+			Requests:    st.requests,
+			Errors:      st.errors,
+			ErrorRate:   float64(st.errors) / float64(st.requests),
+			Bytes:       st.bytes,
+			StatusCodes: codes,
+			P50:         percentile(durations, 0.50),
+			P95:         percentile(durations, 0.95),
+		})
+	}
+	slices.SortFunc(res, func(a, b RouteMetrics) int { return strings.Compare(a.Route, b.Route) })
+	return res
+}
+
+// percentile returns the p-th percentile of the sorted durations (nearest-rank method).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(float64(len(sorted))*p)) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// metricsWriter is an http.ResponseWriter that counts the status code and the size of the
+// response.
+type metricsWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+func (w *metricsWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController.
+func (w *metricsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,76 @@
+package pages
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestHandlerMetrics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users/_id[int].chtml": {Data: []byte(`<c:route as="r" /><p>user ${r.id}</p>`)},
+		"broken.chtml":         {Data: []byte(`<c:fail></c:fail>`)},
+		"app.js":               {Data: []byte(`console.log(1)`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"route": RouteComponent{},
+			"fail":  failingComponent{},
+		},
+		CollectMetrics: true,
+	}
+
+	for _, u := range []string{"/users/1", "/users/2", "/users/3", "/broken", "/app.js", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", u, nil))
+	}
+
+	got := h.Metrics()
+	if len(got) != 3 {
+		t.Fatalf("got %d routes, want 3: %+v", len(got), got)
+	}
+
+	if m := got[0]; m.Route != "app.js" || m.Requests != 1 || m.Bytes != 14 || m.StatusCodes[200] != 1 {
+		t.Errorf("app.js metrics: %+v", m)
+	}
+	if m := got[1]; m.Route != "broken.chtml" || m.Errors != 1 || m.ErrorRate != 1 || m.StatusCodes[500] != 1 {
+		t.Errorf("broken.chtml metrics: %+v", m)
+	}
+	m := got[2]
+	if m.Route != "users/_id[int].chtml" || m.Requests != 3 || m.Errors != 0 || m.StatusCodes[200] != 3 {
+		t.Errorf("users metrics: %+v", m)
+	}
+	if m.Bytes != int64(3*len("<p>user 1</p>")) {
+		t.Errorf("users bytes = %d", m.Bytes)
+	}
+	if m.P50 <= 0 || m.P95 < m.P50 {
+		t.Errorf("users percentiles: p50=%v p95=%v", m.P50, m.P95)
+	}
+
+	rr := httptest.NewRecorder()
+	h.MetricsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var decoded []RouteMetrics
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil || len(decoded) != 3 {
+		t.Errorf("metrics endpoint: %v, %s", err, rr.Body.String())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i))
+	}
+	if got := percentile(d, 0.5); got != 50 {
+		t.Errorf("p50 = %d, want 50", got)
+	}
+	if got := percentile(d, 0.95); got != 95 {
+		t.Errorf("p95 = %d, want 95", got)
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("p50 of none = %d", got)
+	}
+}
@@ -0,0 +1,242 @@
+package pages
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MinifyCSS is an AssetTransformer removing the comments and the insignificant whitespace from
+// a stylesheet. The strings, the url() values and the source map annotations
+// (/*# sourceMappingURL=... */) are kept as is. It does not rewrite the values or the rules.
+func MinifyCSS(content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(content))
+
+	// the whitespace can be dropped next to these characters, but not before ":" (it separates
+	// the descendant selectors, e.g. "a :hover") or around "+" and "-" (calc(1px + 2px))
+	const tight = "{};,>~"
+	space := false // a pending whitespace
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(content)
+				break
+			}
+			if isSourceMapComment(content[i+2 : i+2+end]) {
+				// the comment links the stylesheet to its source map, e.g. of a preprocessor
+				if out.Len() > 0 {
+					out.WriteByte('\n')
+				}
+				out.Write(content[i : i+end+4])
+				out.WriteByte('\n')
+			}
+			i += end + 3
+			space = true
+		case c == '"' || c == '\'':
+			writeCSSSpace(&out, space, c, tight)
+			space = false
+			i = copyQuoted(&out, content, i)
+		case isCSSSpace(c):
+			space = true
+		case hasPrefixFold(content[i:], "url("):
+			end := bytes.IndexByte(content[i:], ')')
+			if end < 0 {
+				end = len(content) - i - 1
+			}
+			writeCSSSpace(&out, space, c, tight)
+			space = false
+			out.Write(content[i : i+end+1])
+			i += end
+		default:
+			if c == '}' && out.Len() > 0 && out.Bytes()[out.Len()-1] == ';' {
+				out.Truncate(out.Len() - 1) // the last declaration needs no semicolon
+			}
+			writeCSSSpace(&out, space, c, tight)
+			space = false
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// writeCSSSpace writes the pending whitespace before c unless it is insignificant.
+func writeCSSSpace(out *bytes.Buffer, space bool, c byte, tight string) {
+	if !space || out.Len() == 0 || strings.IndexByte(tight, c) >= 0 {
+		return
+	}
+	prev := out.Bytes()[out.Len()-1]
+	if strings.IndexByte(tight, prev) >= 0 || prev == ':' || prev == '\n' {
+		return
+	}
+	out.WriteByte(' ')
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func hasPrefixFold(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && strings.EqualFold(string(b[:len(prefix)]), prefix)
+}
+
+// MinifyJS is an AssetTransformer removing the comments, the indentation, the blank lines and
+// the whitespace around the punctuation from a script. The line breaks are kept, so the automatic
+// semicolon insertion works as in the original script. The strings, the template literals and
+// the regular expression literals are kept as is, as well as the source map annotations
+// (//# sourceMappingURL=...) on their own lines. It does not rename or rewrite the code.
+func MinifyJS(content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(content))
+
+	space, newline := false, false // a pending whitespace or line break
+	flush := func(next byte) {
+		switch {
+		case newline && out.Len() > 0:
+			out.WriteByte('\n')
+		case space && out.Len() > 0:
+			prev := out.Bytes()[out.Len()-1]
+			// the spaces between words, and in "a + +b" or "a - -b", are significant
+			if isIdentChar(prev) && isIdentChar(next) || (prev == '+' || prev == '-') && prev == next {
+				out.WriteByte(' ')
+			}
+		}
+		space, newline = false, false
+	}
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			end := bytes.IndexByte(content[i:], '\n')
+			if end < 0 {
+				end = len(content) - i
+			}
+			if isSourceMapComment(content[i+2 : i+end]) {
+				// the comment links the script to its source map, e.g. of a bundler
+				if out.Len() > 0 {
+					out.WriteByte('\n')
+				}
+				out.Write(bytes.TrimRight(content[i:i+end], " \t\r"))
+				space, newline = false, true
+			}
+			i += end - 1 // the line break is handled as whitespace
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(content)
+			} else {
+				if bytes.IndexByte(content[i:i+end+4], '\n') >= 0 {
+					newline = true
+				}
+				i += end + 3
+			}
+			space = true
+		case c == '\n':
+			newline = true
+		case c == ' ' || c == '\t' || c == '\r':
+			space = true
+		case c == '"' || c == '\'' || c == '`':
+			flush(c)
+			i = copyQuoted(&out, content, i)
+		case c == '/' && regexAllowed(out.Bytes()):
+			flush(c)
+			i = copyRegexp(&out, content, i)
+		default:
+			flush(c)
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// regexAllowed reports whether a "/" following the output starts a regular expression literal
+// rather than a division.
+func regexAllowed(out []byte) bool {
+	out = bytes.TrimRight(out, " \n")
+	if len(out) == 0 {
+		return true
+	}
+	prev := out[len(out)-1]
+	if prev == ')' || prev == ']' || prev == '}' {
+		return false
+	}
+	if !isIdentChar(prev) {
+		return true
+	}
+	start := len(out)
+	for start > 0 && isIdentChar(out[start-1]) {
+		start--
+	}
+	switch string(out[start:]) {
+	case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw",
+		"case", "do", "else", "yield", "await":
+		return true
+	}
+	return false
+}
+
+// copyQuoted copies the string (or the template literal) starting at i and returns the index of
+// its closing quote.
+func copyQuoted(out *bytes.Buffer, content []byte, i int) int {
+	quote := content[i]
+	start := i
+	for i++; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case quote:
+			out.Write(content[start : i+1])
+			return i
+		}
+	}
+	out.Write(content[start:])
+	return len(content)
+}
+
+// copyRegexp copies the regular expression literal starting at i and returns the index of its
+// last character (the closing slash or the last flag).
+func copyRegexp(out *bytes.Buffer, content []byte, i int) int {
+	start := i
+	class := false // inside [...], where "/" does not end the literal
+	for i++; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '/' && !class:
+			for i+1 < len(content) && isIdentChar(content[i+1]) {
+				i++ // the flags
+			}
+			out.Write(content[start : i+1])
+			return i
+		case c == '\n':
+			// not a regular expression after all, copy the rest of the line as is
+			out.Write(content[start:i])
+			return i - 1
+		}
+	}
+	out.Write(content[start:])
+	return len(content)
+}
+
+// isSourceMapComment reports whether the text of a comment is a source map annotation, e.g.
+// "# sourceMappingURL=app.js.map". The annotations are kept by the minifiers.
+func isSourceMapComment(text []byte) bool {
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 || text[0] != '#' && text[0] != '@' {
+		return false
+	}
+	text = bytes.TrimSpace(text[1:])
+	return bytes.HasPrefix(text, []byte("sourceMappingURL=")) || bytes.HasPrefix(text, []byte("sourceURL="))
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c >= 0x80
+}
@@ -0,0 +1,62 @@
+package pages
+
+import (
+	"testing"
+)
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"rules", "a {\n  color: red;\n  margin: 0 auto;\n}\n", "a{color:red;margin:0 auto}"},
+		{"comments", "/* header */\nh1 { font-weight: bold } /* done */", "h1{font-weight:bold}"},
+		{"selectors", "ul > li,\nol ~ p , a :hover { x: y }", "ul>li,ol~p,a :hover{x:y}"},
+		{"strings", `a::before { content: "  a  ;  b  " }`, `a::before{content:"  a  ;  b  "}`},
+		{"url", "a { background: url( 'x y.png' ) no-repeat }", "a{background:url( 'x y.png' ) no-repeat}"},
+		{"calc", "a { width: calc(100% - 2 * 1px) }", "a{width:calc(100% - 2 * 1px)}"},
+		{"media", "@media screen and (max-width: 600px) {\n  a { b: c; }\n}", "@media screen and (max-width:600px){a{b:c}}"},
+		{"source map", "a { b: c }\n/*# sourceMappingURL=style.css.map */\n", "a{b:c}\n/*# sourceMappingURL=style.css.map */\n"},
+		{"source map between rules", "a { b: c }\n/*# sourceMappingURL=x.map */\nd { e: f }", "a{b:c}\n/*# sourceMappingURL=x.map */\nd{e:f}"},
+		{"grid areas", `a { grid-template-areas: "a b"  "c d"; }`, `a{grid-template-areas:"a b" "c d"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MinifyCSS([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"whitespace", "function add(a, b) {\n    return a + b;\n}\n", "function add(a,b){\nreturn a+b;\n}"},
+		{"comments", "// header\nlet x = 1; /* inline */ let y = 2;\n/*\n block\n*/\nz()", "let x=1;let y=2;\nz()"},
+		{"line breaks", "let a = b\n\n\n(c)", "let a=b\n(c)"},
+		{"strings", `s = "a // b /* c */" + 'd  e' + ` + "`f  ${g}  h`", `s="a // b /* c */"+'d  e'+` + "`f  ${g}  h`"},
+		{"regexp", "x = s.replace(/ +\\/\\/ [/]/g, '') / 2", "x=s.replace(/ +\\/\\/ [/]/g,'')/2"},
+		{"regexp after return", "return /a b/.test(s)", "return/a b/.test(s)"},
+		{"division", "a = b / c / d", "a=b/c/d"},
+		{"unary", "a = b + +c - -d", "a=b+ +c- -d"},
+		{"source map", "f();\n//# sourceMappingURL=app.js.map  \n", "f();\n//# sourceMappingURL=app.js.map"},
+		{"source url", "f() //@ sourceURL=app.js\ng()", "f()\n//@ sourceURL=app.js\ng()"},
+		{"words", "const  x = typeof  y", "const x=typeof y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MinifyJS([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package pages
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Encoder writes the data rendered by a page (anything but HTML and text) in a media type, see
+// Handler.Encoders.
+type Encoder func(w io.Writer, v any) error
+
+// defaultMediaType is the media type of the data pages if the client accepts any type, or none
+// of the types the Handler can encode.
+const defaultMediaType = "application/json"
+
+// DefaultEncoders are the encoders of the data pages available to the content negotiation:
+//   - application/json: the data as JSON;
+//   - application/xml: the data as an XML document with the <data> root element, the map keys
+//     as the element names and the slice items as the <item> elements;
+//   - text/plain: the strings, the numbers and the booleans as text, other data as indented JSON.
+var DefaultEncoders = map[string]Encoder{
+	"application/json": encodeJSON,
+	"application/xml":  encodeXML,
+	"text/plain":       encodeText,
+}
+
+// encoder returns the media type and the encoder of the data rendered by the page. The type set
+// by the page itself (the Content-Type header, e.g. with <c:http-response content-type="...">)
+// takes precedence over the Accept header of the request. The negotiated bool reports whether
+// the type is selected by the Accept header.
+func (h *Handler) encoder(scope *scope) (mediaType string, enc Encoder, negotiated bool) {
+	encoders := DefaultEncoders
+	if len(h.Encoders) > 0 {
+		encoders = maps.Clone(DefaultEncoders)
+		for mt, enc := range h.Encoders {
+			if enc == nil {
+				delete(encoders, strings.ToLower(mt))
+			} else {
+				encoders[strings.ToLower(mt)] = enc
+			}
+		}
+	}
+
+	if ct := scope.globals.header.Get("Content-Type"); ct != "" {
+		mt, _, _ := mime.ParseMediaType(ct)
+		if enc := encoders[mt]; enc != nil {
+			return mt, enc, false
+		}
+		return mt, encodeJSON, false
+	}
+
+	var accept string
+	if r := scope.globals.req; r != nil {
+		accept = r.Header.Get("Accept")
+	}
+	mt := negotiate(accept, encoders)
+	if enc := encoders[mt]; enc != nil {
+		return mt, enc, true
+	}
+	return defaultMediaType, encodeJSON, true
+}
+
+// negotiate returns the media type of the encoders preferred by the Accept header (RFC 9110,
+// Section 12.5.1). The quality of a type is given by the most specific media range matching it.
+// The ties are resolved in favor of the default type, then alphabetically. If the header is
+// empty or no type is acceptable, the default type is returned.
+func negotiate(accept string, encoders map[string]Encoder) string {
+	if strings.TrimSpace(accept) == "" {
+		return defaultMediaType
+	}
+
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+	var ranges []mediaRange
+	for _, v := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mt, "/")
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ, subtype, q})
+	}
+
+	types := slices.Sorted(maps.Keys(encoders))
+	if i := slices.Index(types, defaultMediaType); i > 0 {
+		types = append(append([]string{defaultMediaType}, types[:i]...), types[i+1:]...)
+	}
+
+	best, bestQ := defaultMediaType, 0.0
+	for _, mt := range types {
+		typ, subtype, _ := strings.Cut(mt, "/")
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+	return best
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeText(w io.Writer, v any) error {
+	jv, err := toJSONValue(v)
+	if err != nil {
+		return err
+	}
+	if s, ok := scalarText(jv); ok {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jv)
+}
+
+// xmlNameRegex matches the map keys written as the XML element names, other keys are written
+// as <entry key="...">.
+var xmlNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func encodeXML(w io.Writer, v any) error {
+	jv, err := toJSONValue(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "data"}}, jv); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, start xml.StartElement, v any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			el := xml.StartElement{Name: xml.Name{Local: k}}
+			if !xmlNameRegex.MatchString(k) || strings.HasPrefix(strings.ToLower(k), "xml") {
+				el = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			if err := encodeXMLElement(enc, el, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if s, ok := scalarText(v); ok && s != "" {
+			if err := enc.EncodeToken(xml.CharData(s)); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// scalarText returns the text of a generic JSON scalar, the empty string for null.
+func scalarText(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// isDataResult reports whether the render result is data rather than HTML or text.
+func isDataResult(rr any) bool {
+	switch rr.(type) {
+	case *html.Node, string, []byte, io.Reader:
+		return false
+	}
+	return true
+}
+
+// encodeData encodes the data rendered by the page for an HTTP response and sets the Content-Type
+// header. The encoded data is returned as text to be written as is.
+func (h *Handler) encodeData(rr any, scope *scope) (string, error) {
+	mt, enc, negotiated := h.encoder(scope)
+
+	var buf strings.Builder
+	if err := enc(&buf, rr); err != nil {
+		return "", fmt.Errorf("render %s: %w", mt, err)
+	}
+
+	if negotiated {
+		scope.globals.header.Add("Vary", "Accept")
+		ct := mt
+		if strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "xml") {
+			ct += "; charset=utf-8"
+		}
+		scope.globals.header.Set("Content-Type", ct)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,123 @@
+package pages
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/xml"},
+		{"text/*", "text/plain"},
+		{"text/plain;q=0.5, application/json;q=0.4", "text/plain"},
+		{"application/xml;q=0, */*", "application/json"},
+		{"text/csv", "application/json"},
+		{"application/*;q=0.9, text/plain", "text/plain"},
+		{"invalid;;, application/xml", "application/xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiate(tt.accept, DefaultEncoders); got != tt.want {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	data := map[string]any{
+		"name":  "a < b",
+		"items": []any{1, true, nil},
+		"a b":   map[string]any{"n": 1.5},
+	}
+	tests := []struct {
+		enc  Encoder
+		v    any
+		want string
+	}{
+		{encodeJSON, data, `{"a b":{"n":1.5},"items":[1,true,null],"name":"a \u003c b"}` + "\n"},
+		{encodeXML, data, `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<data><entry key="a b"><n>1.5</n></entry><items><item>1</item><item>true</item><item></item></items>` +
+			`<name>a &lt; b</name></data>`},
+		{encodeXML, 42, `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<data>42</data>`},
+		{encodeText, 42, `42`},
+		{encodeText, []any{"x"}, "[\n  \"x\"\n]\n"},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		if err := tt.enc(&buf, tt.v); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("got  %q\nwant %q", buf.String(), tt.want)
+		}
+	}
+}
+
+func TestPages_ContentNegotiation(t *testing.T) {
+	fsys := fstest.MapFS{
+		"stats.chtml": {Data: []byte(`${ {"n": 1} }`)},
+		"feed.chtml":  {Data: []byte(`<c:http-response content-type="application/xml"></c:http-response>${ {"n": 1} }`)},
+		"page.chtml":  {Data: []byte(`<p>1</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"http-response": HttpResponseComponent{},
+		},
+		Encoders: map[string]Encoder{
+			"text/csv": func(w io.Writer, v any) error {
+				_, err := io.WriteString(w, "n\n1\n")
+				return err
+			},
+			"text/plain": nil,
+		},
+	}
+
+	tests := []struct {
+		url, accept string
+		wantType    string
+		wantVary    string
+		wantBody    string
+	}{
+		{"/stats", "", "application/json", "Accept", `{"n":1}` + "\n"},
+		{"/stats", "application/xml", "application/xml; charset=utf-8", "Accept",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<data><n>1</n></data>`},
+		{"/stats", "text/csv", "text/csv; charset=utf-8", "Accept", "n\n1\n"},
+		{"/stats", "text/plain", "application/json", "Accept", `{"n":1}` + "\n"},
+		{"/feed", "application/json", "application/xml", "",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<data><n>1</n></data>`},
+		{"/page", "application/json", "text/html; charset=utf-8", "", `<p>1</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type: got %q, want %q", got, tt.wantType)
+			}
+			if got := rr.Header().Get("Vary"); got != tt.wantVary {
+				t.Errorf("Vary: got %q, want %q", got, tt.wantVary)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
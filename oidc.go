@@ -0,0 +1,718 @@
+package pages
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+const (
+	// oidcFlowCookie is the cookie keeping the state of a login flow between the login page and
+	// the callback page.
+	oidcFlowCookie = "pages_oidc_flow"
+
+	// oidcFlowTTL is the time a user has to complete the login at the provider.
+	oidcFlowTTL = 10 * time.Minute
+
+	// oidcClockSkew is the allowed difference between the clocks of the provider and the server.
+	oidcClockSkew = time.Minute
+)
+
+// OIDC is an OpenID Connect client backing the login flow components: OIDCLoginComponent,
+// OIDCCallbackComponent, OIDCUserComponent and OIDCLogoutComponent. The signed-in user is kept
+// in a session cookie signed with the SessionKey, so no server-side storage is needed.
+//
+// Example:
+//
+//	auth := &pages.OIDC{
+//	    Providers: map[string]*pages.OIDCProvider{
+//	        "google": {
+//	            Issuer:       "https://accounts.google.com",
+//	            ClientID:     "...",
+//	            ClientSecret: "...",
+//	            RedirectURL:  "https://example.com/auth/callback",
+//	        },
+//	    },
+//	    SessionKey: key, // at least 32 random bytes
+//	}
+//	handler := &pages.Handler{
+//	    FileSystem: fsys,
+//	    BuiltinComponents: map[string]chtml.Component{
+//	        "oidc-login":    pages.OIDCLoginComponent{OIDC: auth},
+//	        "oidc-callback": pages.OIDCCallbackComponent{OIDC: auth},
+//	        "oidc-user":     pages.OIDCUserComponent{OIDC: auth},
+//	        "oidc-logout":   pages.OIDCLogoutComponent{OIDC: auth},
+//	    },
+//	}
+type OIDC struct {
+	// Providers are the OpenID providers by name, e.g. "google".
+	Providers map[string]*OIDCProvider
+
+	// SessionKey is the secret key signing the cookies. It must be at least 32 bytes long.
+	SessionKey []byte
+
+	// SessionTTL is the lifetime of the session cookie. Default is 24 hours.
+	SessionTTL time.Duration
+
+	// CookieName is the name of the session cookie. Default is "pages_session".
+	CookieName string
+
+	// HTTPClient is the client for the requests to the providers. Default is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// OIDCProvider is the configuration of an OpenID provider. The endpoints and the signing keys
+// of the provider are discovered from the Issuer on the first use.
+type OIDCProvider struct {
+	// Issuer is the URL of the provider, e.g. "https://accounts.google.com".
+	Issuer string
+
+	// ClientID and ClientSecret are the credentials of the application registered with
+	// the provider. ClientSecret is empty for the public clients.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the absolute URL of the page rendering the OIDCCallbackComponent.
+	RedirectURL string
+
+	// Scopes are the requested scopes. Default is "openid", "email" and "profile".
+	Scopes []string
+
+	mu   sync.Mutex
+	meta *oidcMetadata
+	keys map[string]crypto.PublicKey
+}
+
+// oidcMetadata is the part of the provider metadata (OpenID Connect Discovery 1.0) used by
+// the login flow.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcFlow is the state of a login flow kept in the oidcFlowCookie.
+type oidcFlow struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r"`
+	Expires  int64  `json:"e"`
+}
+
+// oidcSession is the signed-in user kept in the session cookie.
+type oidcSession struct {
+	Provider string         `json:"p"`
+	Claims   map[string]any `json:"c"`
+	Expires  int64          `json:"e"`
+}
+
+// OIDCLoginComponent starts the login flow: it redirects the user to the provider and keeps
+// the state of the flow in a cookie. The following arguments are accepted:
+//   - provider - the name of the provider, may be omitted if there is only one;
+//   - return-to - the local path to redirect to after the login, "/" by default.
+//
+// Example:
+//
+//	<c:oidc-login provider="google" return-to="${req.url.query.next?.[0] ?? '/'}"></c:oidc-login>
+type OIDCLoginComponent struct {
+	OIDC *OIDC
+}
+
+var _ chtml.Component = OIDCLoginComponent{}
+
+func (lc OIDCLoginComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		Provider string
+		ReturnTo string
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+
+	ss, ok := s.(*scope)
+	if !ok || ss.globals.req == nil {
+		return nil, nil // not rendered for a request, e.g. at parse time
+	}
+	r := ss.globals.req
+
+	if err := lc.OIDC.check(); err != nil {
+		return nil, err
+	}
+	name, p, err := lc.OIDC.provider(args.Provider)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := p.metadata(r.Context(), lc.OIDC.client())
+	if err != nil {
+		return nil, err
+	}
+
+	flow := oidcFlow{
+		Provider: name,
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		ReturnTo: localPath(args.ReturnTo),
+		Expires:  time.Now().Add(oidcFlowTTL).Unix(),
+	}
+	value, err := signValue(lc.OIDC.SessionKey, purposeOIDCFlow, flow)
+	if err != nil {
+		return nil, err
+	}
+	ss.setCookie(oidcFlowCookie, value, int(oidcFlowTTL.Seconds()))
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := meta.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + q.Encode()
+	} else {
+		authURL += "?" + q.Encode()
+	}
+
+	ss.globals.header.Set("Location", authURL)
+	ss.globals.statusCode = http.StatusFound
+	return nil, nil
+}
+
+// OIDCCallbackComponent completes the login flow on the page the provider redirects back to
+// (see OIDCProvider.RedirectURL). It exchanges the authorization code for the ID token, verifies
+// the token, starts the session and redirects the user to the return-to path of the login.
+// The claims of the ID token are returned, e.g. for the pages rendering a welcome message instead
+// of the redirect. The failures (e.g. an expired flow or a denied consent) are returned as errors,
+// so they are handled like other render errors (see Handler.OnErrorComponent).
+type OIDCCallbackComponent struct {
+	OIDC *OIDC
+}
+
+var _ chtml.Component = OIDCCallbackComponent{}
+
+func (cc OIDCCallbackComponent) Render(s chtml.Scope) (any, error) {
+	ss, ok := s.(*scope)
+	if !ok || ss.globals.req == nil {
+		return nil, nil
+	}
+	r := ss.globals.req
+
+	if err := cc.OIDC.check(); err != nil {
+		return nil, err
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return nil, fmt.Errorf("oidc: login failed: %s %s", e, q.Get("error_description"))
+	}
+
+	var flow oidcFlow
+	c, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, errors.New("oidc: no login in progress")
+	}
+	if err := verifyValue(cc.OIDC.SessionKey, purposeOIDCFlow, c.Value, &flow); err != nil {
+		return nil, fmt.Errorf("oidc: login flow: %w", err)
+	}
+	if time.Now().Unix() > flow.Expires {
+		return nil, errors.New("oidc: login flow expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(flow.State)) != 1 {
+		return nil, errors.New("oidc: state mismatch")
+	}
+	ss.setCookie(oidcFlowCookie, "", -1)
+
+	p, ok := cc.OIDC.Providers[flow.Provider]
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown provider %q", flow.Provider)
+	}
+	client := cc.OIDC.client()
+	rawIDToken, err := p.exchange(r.Context(), client, q.Get("code"), flow.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.verify(r.Context(), client, rawIDToken, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := cc.OIDC.SessionTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	value, err := signValue(cc.OIDC.SessionKey, purposeOIDCSession, oidcSession{
+		Provider: flow.Provider,
+		Claims:   claims,
+		Expires:  time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ss.setCookie(cc.OIDC.cookieName(), value, int(ttl.Seconds()))
+
+	ss.globals.header.Set("Location", flow.ReturnTo)
+	ss.globals.statusCode = http.StatusSeeOther
+	return userClaims(flow.Provider, claims), nil
+}
+
+// OIDCUserComponent returns the signed-in user: the claims of the ID token (e.g. "sub", "email"
+// and "name") and the name of the provider in the "provider" key. It returns nil if no one is
+// signed in or the session has expired.
+//
+// Example:
+//
+//	<c:oidc-user as="user"></c:oidc-user>
+//	<p c:if="user != nil">Hello, ${user.name}!</p>
+type OIDCUserComponent struct {
+	OIDC *OIDC
+}
+
+var _ chtml.Component = OIDCUserComponent{}
+
+func (uc OIDCUserComponent) Render(s chtml.Scope) (any, error) {
+	ss, ok := s.(*scope)
+	if !ok || ss.globals.req == nil {
+		return nil, nil
+	}
+	if err := uc.OIDC.check(); err != nil {
+		return nil, err
+	}
+
+	c, err := ss.globals.req.Cookie(uc.OIDC.cookieName())
+	if err != nil {
+		return nil, nil
+	}
+	var sess oidcSession
+	if err := verifyValue(uc.OIDC.SessionKey, purposeOIDCSession, c.Value, &sess); err != nil || time.Now().Unix() > sess.Expires {
+		return nil, nil
+	}
+	if sub, _ := sess.Claims["sub"].(string); sub == "" {
+		return nil, nil // not a session of a signed-in user
+	}
+	return userClaims(sess.Provider, sess.Claims), nil
+}
+
+// OIDCLogoutComponent ends the session and redirects the user to the return-to path, "/" by
+// default. The session at the provider is not ended.
+type OIDCLogoutComponent struct {
+	OIDC *OIDC
+}
+
+var _ chtml.Component = OIDCLogoutComponent{}
+
+func (lc OIDCLogoutComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		ReturnTo string
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, err
+	}
+
+	ss, ok := s.(*scope)
+	if !ok || ss.globals.req == nil {
+		return nil, nil
+	}
+	ss.setCookie(lc.OIDC.cookieName(), "", -1)
+	ss.globals.header.Set("Location", localPath(args.ReturnTo))
+	ss.globals.statusCode = http.StatusSeeOther
+	return nil, nil
+}
+
+func (o *OIDC) check() error {
+	if o == nil {
+		return errors.New("oidc: client is not configured")
+	}
+	if len(o.SessionKey) < 32 {
+		return errors.New("oidc: session key must be at least 32 bytes long")
+	}
+	return nil
+}
+
+// provider returns the provider by name. The name may be empty if there is only one provider.
+func (o *OIDC) provider(name string) (string, *OIDCProvider, error) {
+	if name == "" && len(o.Providers) == 1 {
+		for name, p := range o.Providers {
+			return name, p, nil
+		}
+	}
+	p, ok := o.Providers[name]
+	if !ok {
+		return "", nil, fmt.Errorf("oidc: unknown provider %q", name)
+	}
+	return name, p, nil
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (o *OIDC) cookieName() string {
+	if o.CookieName != "" {
+		return o.CookieName
+	}
+	return "pages_session"
+}
+
+func (p *OIDCProvider) scopes() []string {
+	if len(p.Scopes) > 0 {
+		return p.Scopes
+	}
+	return []string{"openid", "email", "profile"}
+}
+
+// metadata returns the provider metadata, discovering it on the first call.
+func (p *OIDCProvider) metadata(ctx context.Context, client *http.Client) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta oidcMetadata
+	u := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, client, u, &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery: issuer %q does not match %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery: missing endpoints")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// exchange exchanges the authorization code for the raw ID token.
+func (p *OIDCProvider) exchange(ctx context.Context, client *http.Client, code, verifier string) (string, error) {
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		return "", fmt.Errorf("oidc: token request failed with status %d: %s %s",
+			resp.StatusCode, tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+	return tok.IDToken, nil
+}
+
+// verify checks the signature and the claims of the ID token and returns the claims.
+func (p *OIDCProvider) verify(ctx context.Context, client *http.Client, raw, nonce string) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed id_token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("oidc: id_token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("oidc: id_token signature: %w", err)
+	}
+	key, err := p.key(ctx, client, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("oidc: id_token claims: %w", err)
+	}
+
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if claims["iss"] != meta.Issuer {
+		return nil, fmt.Errorf("oidc: id_token issued by %v, want %q", claims["iss"], meta.Issuer)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, errors.New("oidc: id_token is issued for another client")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("oidc: id_token expired")
+	}
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+
+	// the technical claims are not needed in the session, the cookie size is limited
+	for _, k := range []string{"aud", "exp", "iat", "nbf", "nonce", "at_hash", "c_hash", "azp", "jti"} {
+		delete(claims, k)
+	}
+	return claims, nil
+}
+
+// key returns the signing key of the provider by ID. The keys are fetched again if the key is
+// not known, e.g. after the provider has rotated the keys.
+func (p *OIDCProvider) key(ctx context.Context, client *http.Client, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, meta.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("oidc: fetch keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// jsonWebKey is a public key in the JWK format (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature checks the JWS signature of the signed content with the key.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var h crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h = crypto.SHA256
+	case "RS384", "ES384":
+		h = crypto.SHA384
+	case "RS512", "ES512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("oidc: unsupported signing algorithm %q", alg)
+	}
+	hasher := h.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(key, h, digest, sig); err != nil {
+			return errors.New("oidc: invalid id_token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("oidc: invalid id_token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("oidc: the signing key does not match algorithm %q", alg)
+}
+
+func audienceContains(aud any, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []any:
+		return slices.Contains(aud, any(clientID))
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// userClaims returns the claims of the signed-in user with the name of the provider.
+func userClaims(provider string, claims map[string]any) map[string]any {
+	user := make(map[string]any, len(claims)+1)
+	for k, v := range claims {
+		user[k] = v
+	}
+	user["provider"] = provider
+	return user
+}
+
+// localPath returns p if it is a local path, "/" otherwise, so the return-to argument can't
+// redirect the user to another site.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,297 @@
+package pages
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// fakeOIDCProvider is an OpenID provider issuing the ID tokens for a single authorization code.
+type fakeOIDCProvider struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string // nonce of the last authorization request
+	challenge string // PKCE challenge of the last authorization request
+	claims    map[string]any
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDCProvider{key: key}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/authorize",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   b64(key.N.Bytes()),
+				"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		switch {
+		case id != "client" || secret != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":"invalid_client"}`)
+			return
+		case r.FormValue("code") != "code1" || b64(verifier[:]) != p.challenge:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+
+		claims := map[string]any{
+			"iss":   p.srv.URL,
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": p.nonce,
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, claims)})
+	})
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) sign(t *testing.T, claims map[string]any) string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestPages_OIDC(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	provider.claims = map[string]any{"sub": "42", "email": "user@example.com"}
+
+	auth := &OIDC{
+		Providers: map[string]*OIDCProvider{
+			"test": {
+				Issuer:       provider.srv.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURL:  "http://example.com/callback",
+			},
+		},
+		SessionKey: []byte(strings.Repeat("k", 32)),
+	}
+	fsys := fstest.MapFS{
+		"login.chtml":    {Data: []byte(`<c:oidc-login provider="test" return-to="/account"></c:oidc-login>`)},
+		"callback.chtml": {Data: []byte(`<c:oidc-callback></c:oidc-callback>`)},
+		"logout.chtml":   {Data: []byte(`<c:oidc-logout></c:oidc-logout>`)},
+		"account.chtml": {Data: []byte(`<c:oidc-user as="user"></c:oidc-user>` +
+			`<p c:if="user != nil">${user.email} (${user.provider})</p><p c:else>anonymous</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"oidc-login":    OIDCLoginComponent{OIDC: auth},
+			"oidc-callback": OIDCCallbackComponent{OIDC: auth},
+			"oidc-user":     OIDCUserComponent{OIDC: auth},
+			"oidc-logout":   OIDCLogoutComponent{OIDC: auth},
+		},
+	}
+
+	get := func(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	cookie := func(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("no cookie %q in %v", name, rec.Header()["Set-Cookie"])
+		return nil
+	}
+
+	// login starts the flow and returns the flow cookie and the state
+	login := func(t *testing.T) (*http.Cookie, string) {
+		rec := get("/login")
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login: status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		loc, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := loc.Scheme+"://"+loc.Host+loc.Path, provider.srv.URL+"/authorize"; got != want {
+			t.Errorf("login: redirected to %s, want %s", got, want)
+		}
+		q := loc.Query()
+		if q.Get("client_id") != "client" || q.Get("redirect_uri") != "http://example.com/callback" ||
+			q.Get("scope") != "openid email profile" || q.Get("code_challenge_method") != "S256" {
+			t.Errorf("login: authorization request %v", q)
+		}
+		provider.nonce = q.Get("nonce")
+		provider.challenge = q.Get("code_challenge")
+
+		flow := cookie(t, rec, oidcFlowCookie)
+		if !flow.HttpOnly || flow.SameSite != http.SameSiteLaxMode {
+			t.Errorf("login: flow cookie %v", flow)
+		}
+		return flow, q.Get("state")
+	}
+
+	t.Run("login", func(t *testing.T) {
+		flow, state := login(t)
+
+		rec := get("/callback?code=code1&state="+url.QueryEscape(state), flow)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account" {
+			t.Fatalf("callback: status = %d, location = %q, body = %s",
+				rec.Code, rec.Header().Get("Location"), rec.Body.String())
+		}
+		if c := cookie(t, rec, oidcFlowCookie); c.MaxAge >= 0 {
+			t.Errorf("callback: flow cookie is not cleared: %v", c)
+		}
+		session := cookie(t, rec, "pages_session")
+
+		if got, want := get("/account", session).Body.String(), "<p>user@example.com (test)</p>"; got != want {
+			t.Errorf("account = %q, want %q", got, want)
+		}
+		if got, want := get("/account").Body.String(), "<p>anonymous</p>"; got != want {
+			t.Errorf("account without session = %q, want %q", got, want)
+		}
+
+		tampered := *session
+		tampered.Value = "x" + tampered.Value
+		if got, want := get("/account", &tampered).Body.String(), "<p>anonymous</p>"; got != want {
+			t.Errorf("account with tampered session = %q, want %q", got, want)
+		}
+
+		rec = get("/logout", session)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+			t.Errorf("logout: status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+		}
+		if c := cookie(t, rec, "pages_session"); c.MaxAge >= 0 {
+			t.Errorf("logout: session cookie is not cleared: %v", c)
+		}
+	})
+
+	t.Run("replayed cookies", func(t *testing.T) {
+		flow, _ := login(t)
+		replayed := &http.Cookie{Name: "pages_session", Value: flow.Value}
+		if got, want := get("/account", replayed).Body.String(), "<p>anonymous</p>"; got != want {
+			t.Errorf("account with the flow cookie = %q, want %q", got, want)
+		}
+
+		h := http.Header{}
+		store := &CookieSessionStore{Key: auth.SessionKey}
+		if err := store.Save(h, httptest.NewRequest(http.MethodGet, "/", nil), map[string]any{"sub": "42"}); err != nil {
+			t.Fatal(err)
+		}
+		c, err := http.ParseSetCookie(h.Get("Set-Cookie"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed.Value = c.Value
+		if got, want := get("/account", replayed).Body.String(), "<p>anonymous</p>"; got != want {
+			t.Errorf("account with the cookie session = %q, want %q", got, want)
+		}
+
+		value, err := signValue(auth.SessionKey, purposeOIDCSession, oidcSession{
+			Provider: "test", Expires: time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed.Value = value
+		if got, want := get("/account", replayed).Body.String(), "<p>anonymous</p>"; got != want {
+			t.Errorf("account with no claims = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("callback errors", func(t *testing.T) {
+		flow, state := login(t)
+
+		tests := []struct {
+			name    string
+			target  string
+			cookies []*http.Cookie
+		}{
+			{"no flow", "/callback?code=code1&state=" + state, nil},
+			{"state mismatch", "/callback?code=code1&state=other", []*http.Cookie{flow}},
+			{"invalid code", "/callback?code=code2&state=" + state, []*http.Cookie{flow}},
+			{"provider error", "/callback?error=access_denied&state=" + state, []*http.Cookie{flow}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rec := get(tt.target, tt.cookies...)
+				if rec.Code != http.StatusInternalServerError {
+					t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+				}
+				for _, c := range rec.Result().Cookies() {
+					if c.Name == "pages_session" {
+						t.Errorf("session cookie is set: %v", c)
+					}
+				}
+			})
+		}
+
+		provider.nonce = "other"
+		if rec := get("/callback?code=code1&state="+state, flow); rec.Code != http.StatusInternalServerError {
+			t.Errorf("nonce mismatch: status = %d", rec.Code)
+		}
+	})
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]string{
+		"":                    "/",
+		"/account?tab=1":      "/account?tab=1",
+		"//evil.example.com":  "/",
+		"/\\evil.example.com": "/",
+		"https://example.com": "/",
+	}
+	for in, want := range tests {
+		if got := localPath(in); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
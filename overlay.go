@@ -0,0 +1,159 @@
+package pages
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"strings"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// overlayContextLines is the number of the source lines shown around the failed node.
+const overlayContextLines = 3
+
+// overlayError is a render error shown in the error overlay.
+type overlayError struct {
+	Message string
+
+	// Frames are the components from the page to the failed one, following the imports.
+	Frames []overlayFrame
+}
+
+// overlayFrame is a location in a component source shown in the error overlay.
+type overlayFrame struct {
+	Component string
+	Line, Col int
+	Lines     []overlayLine
+	Context   string // rendered HTML context of the node if the source is not available
+}
+
+type overlayLine struct {
+	N     int
+	Text  string
+	Hit   bool   // the line is in the span of the failed node
+	Caret bool   // the line has the start of the failed node
+	Space string // the indentation of the caret
+}
+
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Render error</title>
+<style>
+body { margin: 0; padding: 2rem; font: 14px/1.5 system-ui, sans-serif; background: #1e1e1e; color: #ddd; }
+h1 { color: #ff6b6b; font-size: 1.4rem; margin-top: 0; }
+h2 { font-size: 1.1rem; color: #fff; white-space: pre-wrap; }
+.chain { color: #999; }
+.loc { color: #8ab4f8; font-family: monospace; margin-top: 1rem; }
+pre { background: #111; padding: .75rem; overflow-x: auto; border-radius: 4px; }
+.ln { display: inline-block; width: 3em; color: #666; user-select: none; }
+.hit { color: #fff; background: #4a1f1f; display: block; }
+.caret { color: #ff6b6b; display: block; }
+</style>
+</head>
+<body>
+<h1>Failed to render {{.Page}}</h1>
+{{range .Errors}}<section>
+<h2>{{.Message}}</h2>
+{{if gt (len .Frames) 1}}<p class="chain">{{range $i, $f := .Frames}}{{if $i}} → {{end}}{{$f.Component}}{{end}}</p>
+{{end}}{{range .Frames}}<div class="loc">{{.Component}}{{if .Line}}:{{.Line}}:{{.Col}}{{end}}</div>
+{{if .Lines}}<pre>{{range .Lines}}<span{{if .Hit}} class="hit"{{end}}><span class="ln">{{.N}}</span>{{.Text}}</span>{{if not .Hit}}
+{{end}}{{if .Caret}}<span class="caret"><span class="ln"></span>{{.Space}}^</span>{{end}}{{end}}</pre>
+{{else if .Context}}<pre>{{.Context}}</pre>
+{{end}}{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+// errorOverlay returns the HTML page describing the render error of the page for the development
+// (see Handler.ErrorOverlay): the messages, the source excerpts of the failed nodes and
+// the import chains.
+func (h *Handler) errorOverlay(page string, err error) string {
+	errs := []error{err}
+	if multierr, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = multierr.Unwrap()
+	}
+
+	var data struct {
+		Page   string
+		Errors []overlayError
+	}
+	data.Page = page
+	for _, err := range errs {
+		if err != nil {
+			data.Errors = append(data.Errors, h.overlayError(err))
+		}
+	}
+
+	var sb strings.Builder
+	if err := overlayTemplate.Execute(&sb, data); err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return sb.String()
+}
+
+// overlayError follows the chain of the component errors from the page to the failed import.
+func (h *Handler) overlayError(err error) overlayError {
+	oe := overlayError{Message: err.Error()}
+	for {
+		var ce *chtml.ComponentError
+		if !errors.As(err, &ce) {
+			break
+		}
+		oe.Frames = append(oe.Frames, h.overlayFrame(ce))
+		oe.Message = ce.Unwrap().Error()
+		err = ce.Unwrap()
+	}
+	return oe
+}
+
+func (h *Handler) overlayFrame(ce *chtml.ComponentError) overlayFrame {
+	f := overlayFrame{Component: ce.Component()}
+	if f.Component == "" {
+		f.Component = "unknown component"
+	}
+	span := ce.Source()
+	if span.IsZero() || ce.Component() == "" {
+		f.Context = ce.HTMLContext()
+		return f
+	}
+	f.Line, f.Col = span.Start.Line, span.Start.Col
+
+	src, err := fs.ReadFile(h.FileSystem, ce.Component())
+	if err != nil {
+		f.Context = ce.HTMLContext()
+		return f
+	}
+	lines := strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+	end := max(span.End.Line, span.Start.Line)
+	first := max(span.Start.Line-overlayContextLines, 1)
+	last := min(end+overlayContextLines, len(lines))
+	for n := first; n <= last; n++ {
+		l := overlayLine{N: n, Text: strings.TrimRight(lines[n-1], "\r")}
+		l.Hit = n >= span.Start.Line && n <= end
+		if n == span.Start.Line {
+			l.Caret, l.Space = true, caretIndent(l.Text, span.Start.Col)
+		}
+		f.Lines = append(f.Lines, l)
+	}
+	return f
+}
+
+// caretIndent returns the whitespace to put a caret under the column col (in runes) of the line.
+// The tabs are kept, so the caret is aligned with the line.
+func caretIndent(line string, col int) string {
+	var sb strings.Builder
+	for i, r := range []rune(line) {
+		if i >= col-1 {
+			break
+		}
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,53 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPages_ErrorOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte("<h1>Orders</h1>\n<c:order-list></c:order-list>\n")},
+		"order-list.chtml": {Data: []byte("<ul>\n" +
+			"\t<li>${orders[0].id}</li>\n" +
+			"</ul>\n")},
+		"broken.chtml": {Data: []byte("<p>${1 +}</p>\n")},
+		"error.chtml":  {Data: []byte(`<p>custom error page</p>`)},
+	}
+	h := &Handler{FileSystem: fsys, ErrorOverlay: true, OnErrorComponent: "error"}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("content type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"Failed to render /",
+		`<p class="chain">index.chtml → order-list.chtml</p>`,
+		`<div class="loc">index.chtml:2:1</div>`,
+		`<div class="loc">order-list.chtml:2:2</div>`,
+		`<span class="hit"><span class="ln">2</span>	&lt;li&gt;${orders[0].id}&lt;/li&gt;</span>`,
+		`<span class="caret"><span class="ln"></span>	^</span>`,
+		`unknown name orders`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("overlay has no %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "custom error page") {
+		t.Error("the error component is rendered instead of the overlay")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broken", nil))
+	if body := rec.Body.String(); rec.Code != http.StatusInternalServerError || !strings.Contains(body, `<div class="loc">broken.chtml:1:`) {
+		t.Errorf("parse error: status = %d, body:\n%s", rec.Code, body)
+	}
+}
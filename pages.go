@@ -3,19 +3,27 @@
 package pages
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"mime"
 	"net/http"
 	"net/url"
 	"path"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dpotapov/go-pages/chtml"
 
@@ -30,12 +38,18 @@ const chtmlExt = ".chtml"
 // defaultSearchPath is the default list of directories to search for components when importing.
 var defaultSearchPath = []string{".", ".lib", "/", "/.lib"}
 
+// defaultStaticPaths is the default list of conventional static file paths served from
+// the static file systems before the page matching.
+var defaultStaticPaths = []string{"/favicon.ico", "/robots.txt", "/.well-known/"}
+
 // validIdentifierRegex is a regular expression that matches valid keywords for dynamic
 // matching purposes.
 var validIdentifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
 // wsUpgrader is a Gorilla WebSocket instance, used to respond HTTP requests with WebSocket.
-var wsUpgrader = websocket.Upgrader{}
+var wsUpgrader = websocket.Upgrader{
+	Subprotocols: []string{jsonPatchProtocol, htmlPatchProtocol},
+}
 
 type Handler struct {
 	// FileSystem to serve HTML components and other web assets from.
@@ -56,9 +70,150 @@ type Handler struct {
 	// If CustomImporter returns chtml.ErrComponentNotFound, the default import process is used.
 	CustomImporter chtml.Importer
 
+	// StaticFileSystems is an ordered fallback chain of file systems to serve conventional static
+	// files (see StaticPaths) from. The chain is checked before the page matching, the FileSystem
+	// is always checked last. The first file system containing the requested file wins.
+	StaticFileSystems []fs.FS
+
+	// StaticPaths is a list of URL paths served from the StaticFileSystems. Paths ending with a
+	// slash match all files under that path.
+	//
+	// If not set, the following default paths are used:
+	// 1. "/favicon.ico"
+	// 2. "/robots.txt"
+	// 3. "/.well-known/"
+	StaticPaths []string
+
 	// BuiltinComponents is a map of built-in components that can be used in CHTML files.
 	BuiltinComponents map[string]chtml.Component
 
+	// Watch enables the development mode, in which the changes of the component files are picked
+	// up without restarting the server. The pages and the components they import are parsed on
+	// each request anyway, but the OnErrorComponent is imported once and the prewarmed pages (see
+	// Handler.Prewarm and PrewarmTop) are parsed once unless Watch is set.
+	Watch bool
+
+	// StrictCoercion makes the ambiguous conversions of the rendered values render errors, e.g.
+	// a map rendered as an attribute value (see chtml.ComponentOptions). It is useful in
+	// development to catch the values rendered as "map[...]" or "[...]".
+	StrictCoercion bool
+
+	// KeepComment reports whether an HTML comment of the components is rendered, the comments
+	// are stripped by default. It receives the source text of the comment, e.g.
+	// chtml.DirectiveComment keeps the conditional comments (<!--[if IE]>...<![endif]-->),
+	// the server side includes (<!--#include ...-->) and the comments starting with "!".
+	KeepComment func(text string) bool
+
+	// Sanitize filters the HTML produced by the expressions of the components, e.g. the untrusted
+	// content rendered with unsafeHtml, see chtml.ComponentOptions.Sanitize and
+	// chtml.SanitizePolicy. The markup of the components is not sanitized.
+	Sanitize func(n *html.Node) error
+
+	// TemplateFuncs are the functions available in the expressions of all the components in
+	// addition to the builtin ones and urlFor (see URLFor), e.g. {"money": formatMoney} for
+	// ${money(price, 'EUR')}. The calls are type checked against the Go signatures when
+	// the components are parsed (see chtml.ParseOptions.Functions). The names setStatus and
+	// setHeader are reserved for the functions changing the response (see RedirectComponent).
+	// The map must not be changed after the Handler is used.
+	TemplateFuncs map[string]any
+
+	// ErrorOverlay makes the Handler respond to the failed page renders with an HTML page showing
+	// the errors, the source excerpts of the failed nodes and the import chains, instead of
+	// the OnErrorComponent or a bare "Internal Server Error". It exposes the source code, so
+	// it must be enabled in development only, e.g. together with Watch. The overlay is not shown
+	// for the streamed pages (see StreamPages).
+	ErrorOverlay bool
+
+	// ShowDrafts makes the draft pages (the files named NAME.draft.chtml) routable, e.g. in
+	// development. Otherwise, the drafts are hidden unless the request carries the PreviewToken.
+	ShowDrafts bool
+
+	// PreviewToken is a secret making the draft pages routable for the requests having it in
+	// the "preview" query parameter or in the X-Preview-Token header.
+	PreviewToken string
+
+	// LocaleSelector returns the locale (e.g. "de" or "de-AT") for the request. The locale is
+	// used to select the locale variants of the assets (see AssetComponent). If not set, the
+	// first language of the Accept-Language header is used.
+	LocaleSelector func(*http.Request) string
+
+	// SecurityHeaders are the security-related headers sent with the pages and the files, e.g.
+	// &pages.DefaultSecurityHeaders. The pages can override them with SecurityHeadersComponent.
+	// If not set, no security headers are sent.
+	SecurityHeaders *SecurityHeaders
+
+	// WebSocketMaxMessageSize is the maximum size in bytes of a message received from
+	// a WebSocket client. The connection is closed if a client sends a larger message.
+	// Default is 64 KiB, a negative value means no limit.
+	WebSocketMaxMessageSize int64
+
+	// WebSocketStrictVars makes the Handler close the WebSocket connection if a client sends
+	// a variable not declared by the page component (with <c:attr> at the top level) or a value
+	// of a wrong type. By default, such variables are dropped.
+	WebSocketStrictVars bool
+
+	// LiveUpdateInterval is the minimum interval between the renders of a page pushed to
+	// the WebSocket and Server-Sent Events clients when the components update in the background
+	// (e.g. HttpCallComponent polling). The updates arriving within the interval after a render
+	// are coalesced into a single render at the end of the interval, e.g. a burst of chat messages
+	// is pushed at once. The messages of the WebSocket clients are rendered right away. Zero means
+	// a render for each update.
+	LiveUpdateInterval time.Duration
+
+	// LiveUpdateIntervals are the LiveUpdateInterval values of the pages by directory, e.g.
+	// {"/chat": 250 * time.Millisecond}. The value of the most specific directory applies to
+	// the pages in the directory and its subdirectories.
+	LiveUpdateIntervals map[string]time.Duration
+
+	// Compression enables the gzip compression of the pages and the static files for the clients
+	// accepting it (the Accept-Encoding header). Only the compressible content types (text, JSON,
+	// JavaScript, XML, SVG, etc.) of at least 1 KiB are compressed. The static files are
+	// compressed once and cached in memory, or served from the precompressed variants next to
+	// them in the file system (e.g. app.js.br or app.js.gz for app.js), which is the only way
+	// to serve brotli. WebSocket and Server-Sent Events responses are not compressed.
+	Compression bool
+
+	// AssetTransformers are the transformations of the static files served from the file systems
+	// by extension, e.g. {".css": {pages.MinifyCSS}, ".js": {pages.MinifyJS}}. The transformers
+	// are applied in order, and the results are cached in memory until the file changes. If
+	// a transformer fails, the file is served as is. The precompressed variants (see
+	// Compression) of the transformed files are not used.
+	AssetTransformers map[string][]AssetTransformer
+
+	// OutputETags makes the Handler send the pages with a strong ETag, the hash of the rendered
+	// output, and respond with 304 Not Modified to the requests having the matching
+	// If-None-Match header. The page is still rendered, but not sent. The ETag of the data
+	// versions (see VersionCollector) takes precedence. The streamed pages (see StreamPages) have
+	// no output ETags. The ETags of the pages compressed with gzip (see Compression) have
+	// the "-gzip" suffix.
+	OutputETags bool
+
+	// CachePolicies are the default caching policies of the pages by directory, e.g.
+	// {"/": {NoCache: true}, "/docs": {Public: true, MaxAge: 300}}. The policy of the most
+	// specific directory applies to the pages in the directory and its subdirectories. It is
+	// merged with the policies declared by the page components (see CacheControlComponent),
+	// the most restrictive directives win.
+	CachePolicies map[string]CacheControl
+
+	// Encoders are the encoders of the data rendered by the pages, by media type, in addition to
+	// DefaultEncoders (a nil encoder removes a default one). The type is selected by the Accept
+	// header of the request, JSON is sent if the client accepts any type or none of them. A page
+	// can choose the type itself by setting the Content-Type header, e.g. with
+	// <c:http-response content-type="application/xml">. HTML and text are always sent as is.
+	Encoders map[string]Encoder
+
+	// BeforeRender are the hooks called before each render of a page, e.g. to check the access,
+	// to start a timer or to add variables to the scope (scope.Vars()). A page requested over
+	// WebSocket or as Server-Sent Events calls the hooks before each message. If a hook returns
+	// an error, the page is not rendered and the rest of the hooks are not called: the client
+	// gets the status code of a StatusError (e.g. 403 Forbidden), or 500 Internal Server Error
+	// for other errors.
+	BeforeRender []RenderHook
+
+	// AfterRender are the hooks called after the output of a page render has been sent, e.g. to
+	// record the render time. The errors of the hooks are logged and reported to OnError.
+	AfterRender []RenderHook
+
 	// OnError is a callback that is called when an error occurs while serving a page.
 	OnError func(*http.Request, error)
 
@@ -69,42 +224,132 @@ type Handler struct {
 	// If not set, a standard "Internal Server Error" will be sent back to the client.
 	OnErrorComponent string
 
+	// StreamPages makes the Handler write the HTML pages to the client while they are rendered,
+	// instead of building the whole page in memory first (see chtml.StreamRenderer). The pages
+	// rendering data objects are sent as usual. The streamed pages have the following limitations:
+	//  - the headers and the status code set by the components after the first byte of the page
+	//    has been written are ignored;
+	//  - the asset dependencies (see AssetDepComponent) are not injected into the <head>;
+	//  - the render errors are logged, but the OnErrorComponent is not rendered;
+	//  - the pages wrapped in layouts (see LayoutComponent) are not streamed.
+	StreamPages bool
+
+	// Sessions is an optional store of the per-user state carried between requests, e.g.
+	// &pages.CookieSessionStore{Key: key}. The pages read the session values with the ${session}
+	// variable and change them with SessionComponent. The changes made after the response
+	// headers are sent (e.g. in WebSocket renders) are not saved.
+	Sessions SessionStore
+
+	// Cache is an optional cache of the rendered pages and components (see RenderCache).
+	Cache *RenderCache
+
+	// CollectMetrics enables collecting the per-route metrics (see Handler.Metrics).
+	CollectMetrics bool
+
+	// PrewarmTop is the number of the most requested routes (according to the metrics, so
+	// CollectMetrics must be set) whose pages are kept parsed across the requests, like the pages
+	// prewarmed with Handler.Prewarm. Zero disables the adaptive prewarming.
+	PrewarmTop int
+
 	// Logger configures logging for internal events.
 	Logger *slog.Logger
 
+	// RenderArena enables pooling of render-time temporary structures (e.g. loop environments).
+	// The structures are released wholesale at the end of each request and reused by subsequent
+	// requests, reducing GC pressure in high-throughput deployments.
+	RenderArena bool
+
+	// RenderBudget is the maximum approximate number of bytes a page render may allocate.
+	// Renders exceeding the budget are aborted with an "Internal Server Error" response.
+	// Zero means no limit.
+	RenderBudget int64
+
+	// RenderTimeout limits the time of rendering each component imported by the pages, e.g.
+	// a component waiting for a slow HTTP call. The page fails to render if an import exceeds it
+	// (see chtml.ComponentOptions.RenderTimeout). Zero means no limit.
+	RenderTimeout time.Duration
+
+	// MaxUploadSize is the maximum size in bytes of a multipart/form-data request body, e.g. with
+	// the files uploaded to UploadComponent. The larger requests are not parsed, the components
+	// get the error instead. Default is DefaultMaxUploadSize, a negative value means no limit.
+	MaxUploadSize int64
+
+	// ShadowFileSystem is an alternate FileSystem (e.g. a new template tree) to render mirrored
+	// requests against. Shadow responses are never sent to the client. Instead, they are compared
+	// with the primary responses and mismatches are reported to OnShadowDiff.
+	ShadowFileSystem fs.FS
+
+	// ShadowRate is the fraction of GET requests (from 0 to 1) mirrored to the ShadowFileSystem.
+	ShadowRate float64
+
+	// OnShadowDiff is a callback that is called when a shadow response differs from the primary
+	// response. If not set, mismatches are logged as warnings.
+	OnShadowDiff func(*http.Request, *ShadowDiff)
+
+	// ShadowMaxRenders is the maximum number of shadow responses rendered at the same time.
+	// The requests mirrored above the limit are dropped and logged. Default is
+	// DefaultShadowMaxRenders.
+	ShadowMaxRenders int
+
 	// init is used to initialize the handler only once.
 	init sync.Once
 
 	// logger is a private logger instance that is used to log internal events.
 	logger *slog.Logger
 
-	// errComp is an imported error component instance if OnErrorComponent is set.
-	errComp chtml.Component
+	// config is the runtime configuration, initialized from the Handler fields.
+	config atomic.Pointer[handlerConfig]
+
+	// configMu serializes the configuration updates.
+	configMu sync.Mutex
+
+	// shadow is a handler for the ShadowFileSystem if it is set.
+	shadow *Handler
+
+	// shadowSem limits the number of the shadow renders in flight.
+	shadowSem chan struct{}
+
+	// shadowDropped is the number of the mirrored requests dropped over ShadowMaxRenders.
+	shadowDropped atomic.Int64
+
+	// pageAssets are the assets added to every rendered page, e.g. the live reload client of
+	// the DevServer.
+	pageAssets []AssetDep
+
+	// metrics is the per-route metrics collected if CollectMetrics is set.
+	metrics routeMetrics
+
+	// compressed and transformed are the caches of the compressed static files (see
+	// Compression) and the transformed ones (see AssetTransformers).
+	compressed  contentCache
+	transformed contentCache
+
+	// assetHashes are the content hashes of the static files requested with a version, see
+	// cacheVersionedAsset.
+	assetHashes assetHashes
+
+	// etagSeed is a random value mixed into the ETags of the pages (see VersionCollector).
+	etagSeed string
+
+	// funcs are the functions available in the expressions, see TemplateFuncs.
+	funcs map[string]any
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.init.Do(func() {
-		// initialize the logger:
-		// TODO: replace with DiscardHandler in the future - https://go-review.googlesource.com/c/go/+/548335
-		h.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
-		if h.Logger != nil {
-			h.logger = h.Logger
-		}
-
-		// initialize the error component:
-		if h.OnErrorComponent != "" {
-			imp := h.importer(".")
-			ec, err := imp.Import(h.OnErrorComponent)
-			if err != nil {
-				h.logger.Error("Import error component", "error", err)
-			}
-			h.errComp = ec
+	h.init.Do(h.setup)
+
+	if h.SecurityHeaders != nil {
+		for k, vv := range h.SecurityHeaders.header(r) {
+			w.Header()[k] = vv
 		}
-	})
+	}
 
 	if err := h.handleRequest(w, r); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		var sent *responseSentError
+		if !errors.As(err, &sent) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
 
 		h.logger.Error("Serve HTTP request", "url", r.URL.Redacted(), "error", err)
 
@@ -114,12 +359,78 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) error {
+// setup initializes the handler. It is called only once.
+func (h *Handler) setup() {
+	// initialize the logger:
+	// TODO: replace with DiscardHandler in the future - https://go-review.googlesource.com/c/go/+/548335
+	h.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if h.Logger != nil {
+		h.logger = h.Logger
+	}
+
+	// initialize the runtime configuration and the error component:
+	cfg := &handlerConfig{
+		Config: Config{
+			ComponentSearchPath: slices.Clone(h.ComponentSearchPath),
+			StaticPaths:         slices.Clone(h.StaticPaths),
+			OnErrorComponent:    h.OnErrorComponent,
+			RenderArena:         h.RenderArena,
+			RenderBudget:        h.RenderBudget,
+			RenderTimeout:       h.RenderTimeout,
+			ShadowRate:          h.ShadowRate,
+		},
+	}
+	if !h.Watch {
+		cfg.parsed = newParseCache()
+	}
+	if err := h.importErrorComponent(cfg); err != nil {
+		h.logger.Error("Import error component", "error", err)
+	}
+	h.config.Store(cfg)
+
+	h.etagSeed = randomToken()
+
+	// the functions of the expressions: the TemplateFuncs, the builtin urlFor and the functions
+	// bound to the page scopes (see responseFuncs)
+	h.funcs = map[string]any{"urlFor": h.URLFor}
+	maps.Copy(h.funcs, h.TemplateFuncs)
+	maps.Copy(h.funcs, responseFuncs{}.functions())
+
+	// initialize the shadow handler:
+	if h.ShadowFileSystem != nil {
+		h.shadow = h.newShadowHandler()
+		h.shadowSem = make(chan struct{}, h.shadowMaxRenders())
+	}
+}
+
+func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) (err error) {
 	urlPath := cleanPath(r.URL.EscapedPath())
 
-	params := map[string]string{}
+	if h.Compression && !isWebSocketRequest(r) && !isEventStreamRequest(r) {
+		gw := newGzipResponseWriter(w, r)
+		defer func() {
+			if cerr := gw.Close(); cerr != nil && err == nil {
+				err = &responseSentError{err: fmt.Errorf("compress response: %w", cerr)}
+			}
+		}()
+		w = gw
+	}
+
+	// the primary response is captured before the compression, the shadow one is not compressed
+	if h.shouldMirror(r) {
+		sw := &shadowWriter{ResponseWriter: w}
+		defer func() { h.mirror(r, sw, err) }()
+		w = sw
+	}
 
-	fsPath, err := h.matchFS(urlPath, ".", params)
+	if fsys, fsPath := h.matchStatic(urlPath); fsys != nil {
+		return h.serveFile(w, r, fsys, fsPath)
+	}
+
+	params := map[string]any{}
+	drafts := h.allowDrafts(r)
+
+	fsPath, err := h.matchFS(urlPath, ".", params, drafts)
 	if err != nil {
 		return err
 	}
@@ -129,36 +440,133 @@ func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	if strings.HasSuffix(fsPath, chtmlExt) {
+		var allowed []string
+		fsPath, allowed, err = h.matchMethod(fsPath, r.Method, drafts)
+		if err != nil {
+			return err
+		}
+		if fsPath == "" {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return nil
+		}
+	}
+
+	if isMultipartRequest(r) {
+		if limit := h.maxUploadSize(); limit >= 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		defer func() {
+			if r.MultipartForm != nil {
+				_ = r.MultipartForm.RemoveAll() // the temporary files of the uploads
+			}
+		}()
+	}
+
+	if h.CollectMetrics && !isWebSocketRequest(r) && !isEventStreamRequest(r) {
+		mw := &metricsWriter{ResponseWriter: w}
+		w = mw
+		start := time.Now()
+		defer func() {
+			statusCode := mw.statusCode
+			if err != nil {
+				statusCode = http.StatusInternalServerError // responded by ServeHTTP
+			} else if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+			h.metrics.record(fsPath, statusCode, mw.bytes, time.Since(start))
+		}()
+	}
+
+	if _, draft := pageName(path.Base(fsPath)); draft {
+		// the previews must not be cached or indexed
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+
 	if strings.HasSuffix(fsPath, chtmlExt) {
 		return h.servePage(w, r, fsPath, params)
 	}
 
-	return h.serveFile(w, r, fsPath)
+	return h.serveFile(w, r, h.FileSystem, fsPath)
 }
 
 func (h *Handler) servePage(
 	w http.ResponseWriter,
 	r *http.Request,
 	fsPath string,
-	route map[string]string,
+	route map[string]any,
 ) error {
+	// the arena must be released after the component is disposed
+	cfg := h.cfg()
+
+	var arena *chtml.Arena
+	if cfg.RenderArena || cfg.RenderBudget > 0 {
+		arena = chtml.NewArena(cfg.RenderBudget)
+		defer arena.Release()
+	}
+
 	imp := h.importer(path.Dir(fsPath))
 
 	compName := path.Base(strings.TrimSuffix(fsPath, chtmlExt))
 
-	comp := NewErrorHandlerComponent(compName, imp, h.errComp)
+	errComp := cfg.errComp
+	if h.Watch && cfg.OnErrorComponent != "" {
+		// the error component is imported once, re-import it to pick up the changes
+		wcfg := &handlerConfig{Config: cfg.Config}
+		if err := h.importErrorComponent(wcfg); err != nil {
+			h.logger.Error("Import error component", "error", err)
+		}
+		errComp = wcfg.errComp
+	}
+	if h.ErrorOverlay {
+		errComp = nil // the render errors are shown in the overlay instead
+	}
+
+	comp := NewErrorHandlerComponent(compName, imp, errComp)
+	comp.comp = h.withLayouts(comp.comp, path.Dir(fsPath))
 	defer func() {
 		if err := comp.Dispose(); err != nil {
 			h.logger.Warn("Dispose component", "error", err)
 		}
 	}()
 
-	mainScope := newScope(nil, r, route)
+	// the background updaters must be stopped before the component is disposed
+	renderCtx := chtml.NewRenderContext()
+	defer renderCtx.Close()
+
+	// the context of the components is canceled before waiting for the background updaters, as
+	// the request context is canceled only after ServeHTTP returns
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	mainScope := newScope(map[string]any{}, r, route) // the BeforeRender hooks may add variables
+	mainScope.globals.ctx = ctx
+	mainScope.globals.cacheCtl.base = h.cachePolicy(fsPath)
+	mainScope.globals.catchAll = catchAllParam(fsPath)
+	mainScope.globals.arena = arena
+	mainScope.globals.renderCtx = renderCtx
+	mainScope.globals.fsys = h.FileSystem
+	mainScope.globals.transform = h.transformAsset
+	mainScope.globals.locale = h.locale(r)
+	if !h.Watch {
+		// the pages change without a restart in the development mode, so the ETags would be stale
+		mainScope.globals.versions = &dataVersions{seed: h.etagSeed + "\x00" + mainScope.globals.locale}
+	}
+	if h.Sessions != nil {
+		values, err := h.Sessions.Load(r)
+		if err != nil {
+			h.logger.Warn("Load session", "error", err)
+		}
+		mainScope.globals.session = &Session{values: values, store: h.Sessions, logger: h.logger}
+	}
 
-	if websocket.IsWebSocketUpgrade(r) {
+	if isWebSocketRequest(r) {
 		ws, err := wsUpgrader.Upgrade(w, r, nil)
 		if err != nil {
-			return err
+			// the upgrader has responded with the handshake error
+			return &responseSentError{err: err}
 		}
 		defer ws.Close()
 
@@ -171,6 +579,26 @@ func (h *Handler) servePage(
 		done := make(chan error)           // channel to communicate the completion of the rendering loop
 		varsC := make(chan map[string]any) // channel to receive new variables from the websocket
 
+		maxSize := h.WebSocketMaxMessageSize
+		if maxSize == 0 {
+			maxSize = defaultWebSocketMaxMessageSize
+		}
+		if maxSize > 0 {
+			ws.SetReadLimit(maxSize)
+		}
+		inputs := comp.Inputs()
+
+		// the clients negotiating the json-patch (html-patch) subprotocol receive the changes of
+		// the data (HTML) pages
+		var patches *patchState
+		var htmlPatches *htmlPatchState
+		switch ws.Subprotocol() {
+		case jsonPatchProtocol:
+			patches = &patchState{}
+		case htmlPatchProtocol:
+			htmlPatches = &htmlPatchState{}
+		}
+
 		go func() {
 			for {
 				var newVars map[string]any
@@ -184,6 +612,14 @@ func (h *Handler) servePage(
 					return
 				}
 
+				newVars, err := validateWSVars(newVars, inputs, h.WebSocketStrictVars)
+				if err != nil {
+					msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+					_ = ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+					done <- fmt.Errorf("invalid websocket message: %w", err)
+					return
+				}
+
 				// apply route
 				for k, v := range route {
 					newVars[k] = v
@@ -203,6 +639,22 @@ func (h *Handler) servePage(
 
 		s := mainScope.Spawn(vars).(*scope) // create a new isolated scope for rendering
 
+		throttle := h.liveThrottle(fsPath)
+		defer throttle.stop()
+
+		render := func() error {
+			if err := h.renderWS(ws, comp, s, patches, htmlPatches); err != nil {
+				closeWSWithError(ws, http.StatusInternalServerError)
+				return &responseSentError{err: err}
+			}
+			throttle.rendered()
+
+			renderCtx.Flush()
+
+			s = mainScope.Spawn(vars).(*scope) // reset the scope
+			return nil
+		}
+
 		for {
 			select {
 			case wsvars := <-varsC:
@@ -211,39 +663,87 @@ func (h *Handler) servePage(
 					wsvars[k] = v
 				}
 
-				// remove HTMX specific vars
-				// TODO: process HEADERS to make them available in the request's data
-				delete(wsvars, "HEADERS")
-
 				s = mainScope.Spawn(wsvars).(*scope)
-				s.Touch()
+				if err := render(); err != nil {
+					return err
+				}
 			case <-mainScope.Touched():
-				// render the component
-				w, err := ws.NextWriter(websocket.TextMessage)
-				if err != nil {
-					return fmt.Errorf("get websocket writer: %w", err)
+				if !throttle.ready() {
+					continue // rendered when the throttle fires
 				}
-
-				if err := h.render(w, comp, s); err != nil {
+				if err := render(); err != nil {
 					return err
 				}
-
-				if err := w.Close(); err != nil {
-					return fmt.Errorf("close websocket writer: %w", err)
+			case <-throttle.C():
+				if err := render(); err != nil {
+					return err
 				}
-
-				s = mainScope.Spawn(vars).(*scope) // reset the scope
-			case err = <-done:
-				return err
+			case err := <-done:
+				if err != nil {
+					return &responseSentError{err: err}
+				}
+				return nil
 			}
 		}
+	} else if isEventStreamRequest(r) {
+		vars := make(map[string]any, len(route))
+		for k, v := range route {
+			vars[k] = v
+		}
+		return h.serveSSE(w, r, comp, mainScope, renderCtx, vars, h.liveThrottle(fsPath))
 	} else {
-		return h.render(w, comp, mainScope)
+		if err := h.beforeRender(mainScope, comp); err != nil {
+			var se *StatusError
+			if errors.As(err, &se) {
+				http.Error(w, http.StatusText(se.Code), se.Code)
+				return nil
+			}
+			return fmt.Errorf("before render hook: %w", err)
+		}
+		defer h.afterRender(mainScope, comp)
+
+		if err := h.render(w, comp, mainScope); err != nil {
+			return err
+		}
+		renderCtx.Flush()
+		return nil
 	}
 }
 
 func (h *Handler) render(w io.Writer, comp chtml.Component, scope *scope) error {
+	if sr, ok := comp.(chtml.StreamRenderer); ok && h.StreamPages {
+		if err := h.renderStream(w, sr, scope); !errors.Is(err, chtml.ErrNotStreamable) {
+			return err
+		}
+	}
+
+	rr, err := h.renderResult(comp, scope)
+	if err != nil {
+		return err
+	}
+	return h.writeResult(w, rr, scope)
+}
+
+// renderResult renders the component. The render errors are logged and reported to the client
+// with the status code only, the budget errors are returned.
+func (h *Handler) renderResult(comp chtml.Component, scope *scope) (any, error) {
+	// the budget is per render, the live pages (WebSocket and Server-Sent Events) are rendered
+	// many times with the arena of the request
+	scope.globals.arena.Reset()
+	scope.globals.assets.reset()
+	scope.globals.cacheCtl.reset()
+	scope.globals.secHeaders.reset()
+	scope.globals.versions.reset()
+	if r := scope.globals.req; r != nil && !isWebSocketRequest(r) && !isEventStreamRequest(r) {
+		for _, dep := range h.pageAssets {
+			scope.globals.assets.add(dep)
+		}
+	}
+
 	rr, err := comp.Render(scope)
+	if errors.Is(err, chtml.ErrBudgetExceeded) {
+		return nil, fmt.Errorf("render component: %w", err)
+	}
 	if err != nil {
 		scope.globals.statusCode = http.StatusInternalServerError
 		// unwrap err into []error if it's a multierr
@@ -252,50 +752,134 @@ func (h *Handler) render(w io.Writer, comp chtml.Component, scope *scope) error
 				h.logger.Error("Render component", "error", e)
 			}
 		}
+		if r := scope.globals.req; h.ErrorOverlay && r != nil && !isWebSocketRequest(r) && !isEventStreamRequest(r) {
+			scope.globals.header.Set("Content-Type", "text/html; charset=utf-8")
+			rr = h.errorOverlay(r.URL.Path, err)
+		}
 
 		// w.WriteHeader(http.StatusInternalServerError)
 		// return fmt.Errorf("render component: %w", err)
 	}
+	return rr, nil
+}
 
-	if rw, ok := w.(http.ResponseWriter); ok {
-		if len(scope.globals.header) > 0 {
-			for k, vv := range scope.globals.header {
-				for _, v := range vv {
-					rw.Header().Add(k, v)
-				}
-			}
+// writeResult writes the render result as HTML, text or JSON (see chtml.WriteResult). If w is
+// an http.ResponseWriter, the data is encoded in the media type negotiated with the client (see
+// Handler.Encoders), and the headers and the status code set by the components are sent before
+// the output, so nothing is sent if the result can't be encoded.
+func (h *Handler) writeResult(w io.Writer, rr any, scope *scope) error {
+	if doc, ok := rr.(*html.Node); ok {
+		rr = scope.globals.assets.inject(doc)
+	} else if _, ok := w.(http.ResponseWriter); ok && isDataResult(rr) {
+		// the data is sent over WebSocket and Server-Sent Events as JSON
+		s, err := h.encodeData(rr, scope)
+		if err != nil {
+			return err
 		}
+		rr = s
+	}
 
-		if scope.globals.statusCode != 0 {
-			rw.WriteHeader(scope.globals.statusCode)
+	sw := &streamWriter{w: w, scope: scope}
+	if _, ok := w.(http.ResponseWriter); ok && h.OutputETags {
+		// the output is hashed before the headers are sent
+		var buf bytes.Buffer
+		if err := chtml.WriteResult(&buf, rr, nil); err != nil {
+			return err
 		}
+		scope.globals.outputETag = outputETag(buf.Bytes())
+		rr = buf.String()
 	}
+	if err := chtml.WriteResult(sw, rr, nil); err != nil {
+		return err
+	}
+	sw.start() // the output may be empty
+	return nil
+}
 
-	// TODO: check the Accept header and return the appropriate content type
-	if doc, ok := rr.(*html.Node); ok {
-		if err := html.Render(w, doc); err != nil {
-			return fmt.Errorf("render HTML: %w", err)
-		}
-	} else if s, ok := rr.(string); ok {
-		if _, err := io.WriteString(w, s); err != nil {
-			return fmt.Errorf("write string: %w", err)
-		}
-	} else {
-		if err := json.NewEncoder(w).Encode(rr); err != nil {
-			return fmt.Errorf("render JSON: %w", err)
+// writeHeader sends the headers and the status code set by the components.
+func writeHeader(rw http.ResponseWriter, scope *scope) {
+	if sess := scope.globals.session; sess != nil {
+		sess.save(scope.globals.header, scope.globals.req)
+	}
+
+	if len(scope.globals.header) > 0 {
+		for k, vv := range scope.globals.header {
+			for _, v := range vv {
+				rw.Header().Add(k, v)
+			}
 		}
 	}
 
-	return nil
+	scope.globals.secHeaders.apply(rw.Header())
+	scope.globals.cacheCtl.apply(rw.Header(), scope.globals.statusCode)
+	if scope.globals.versions.apply(rw.Header(), scope.globals.req, scope.globals.statusCode) ||
+		applyETag(rw.Header(), scope.globals.req, scope.globals.statusCode, scope.globals.outputETag) {
+		scope.globals.statusCode = http.StatusNotModified
+	}
+
+	if scope.globals.statusCode != 0 {
+		rw.WriteHeader(scope.globals.statusCode)
+	}
 }
 
-func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, fsPath string) error {
+// locale returns the locale for the request.
+func (h *Handler) locale(r *http.Request) string {
+	if h.LocaleSelector != nil {
+		return h.LocaleSelector(r)
+	}
+	return acceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// acceptLanguage returns the preferred language from the Accept-Language header value.
+func acceptLanguage(v string) string {
+	if langs := acceptLanguages(v); len(langs) > 0 {
+		return langs[0]
+	}
+	return ""
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, fsPath string) error {
+	h.cacheVersionedAsset(w, r, fsys, fsPath)
+	setAssetType(w, fsPath)
+	if h.serveStatic(w, r, fsys, fsPath) {
+		return nil
+	}
 	r.URL.Path = fsPath
 	r.URL.RawPath = fsPath
-	http.FileServerFS(h.FileSystem).ServeHTTP(w, r)
+	http.FileServerFS(fsys).ServeHTTP(w, r)
 	return nil
 }
 
+// matchStatic checks if the urlPath is one of StaticPaths and looks for the file in the static
+// file systems chain. It returns the first file system containing the file and the path to the
+// file in it, or nil if there is no match.
+func (h *Handler) matchStatic(urlPath string) (fs.FS, string) {
+	staticPaths := h.cfg().StaticPaths
+	if len(staticPaths) == 0 {
+		staticPaths = defaultStaticPaths
+	}
+
+	matched := false
+	for _, sp := range staticPaths {
+		if urlPath == sp || (strings.HasSuffix(sp, "/") && strings.HasPrefix(urlPath, sp)) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil, ""
+	}
+
+	fsPath := strings.TrimPrefix(urlPath, "/")
+	for _, fsys := range slices.Concat(h.StaticFileSystems, []fs.FS{h.FileSystem}) {
+		if fi, err := fs.Stat(fsys, fsPath); err == nil && !fi.IsDir() {
+			return fsys, fsPath
+		}
+	}
+
+	return nil, ""
+}
+
 // match examples:
 // - /foo/bar -> /foo/bar.chtml
 // - /foo -> /foo/index.chtml
@@ -304,7 +888,7 @@ func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, fsPath strin
 // - /foo/bar/baz -> /foo/bar/baz.chtml
 // - /foo/bar/baz/ -> /foo/bar/baz/index.chtml
 // - /foo/file.txt -> /foo/file.txt
-func (h *Handler) matchFS(urlPath, dir string, params map[string]string) (string, error) {
+func (h *Handler) matchFS(urlPath, dir string, params map[string]any, drafts bool) (string, error) {
 	if urlPath == "" {
 		return "", nil
 	}
@@ -324,37 +908,45 @@ func (h *Handler) matchFS(urlPath, dir string, params map[string]string) (string
 	var m string
 
 	if rest != "" {
-		dir, err = h.matchDir(seg, dir, entries, params)
+		// params captured in the nested directories are discarded if there is no match there
+		saved := maps.Clone(params)
+
+		var subdir string
+		subdir, err = h.matchDir(seg, dir, entries, params)
 		if err != nil {
 			return "", err
 		}
-		if dir != "" {
-			m, err = h.matchFS(rest, dir, params)
+		if subdir != "" {
+			m, err = h.matchFS(rest, subdir, params, drafts)
+		}
+		if m == "" && err == nil {
+			clear(params)
+			maps.Copy(params, saved)
 		}
 	} else {
-		m, err = h.matchFile(seg, dir, entries, params)
+		m, err = h.matchFile(seg, dir, entries, params, drafts)
 	}
 	if m != "" || err != nil {
 		return m, err
 	}
 
 	// no match, try catch-all
-	catchAllFile, err := findCatchAllFile(entries)
+	catchAllFile, err := findCatchAllFile(entries, drafts)
 	if err != nil {
 		return "", err
 	}
 
 	if catchAllFile != "" {
-		argName := catchAllFile[2 : len(catchAllFile)-len(chtmlExt)]
+		argName := catchAllParam(catchAllFile)
 		params[argName] = urlPath
 
-		return catchAllFile, nil
+		return path.Join(dir, catchAllFile), nil
 	}
 
 	return "", nil // no match
 }
 
-func (h *Handler) matchDir(seg, dir string, entries []fs.DirEntry, params map[string]string) (string, error) {
+func (h *Handler) matchDir(seg, dir string, entries []fs.DirEntry, params map[string]any) (string, error) {
 	dynamicMatch := ""
 
 	for _, entry := range entries {
@@ -369,29 +961,31 @@ func (h *Handler) matchDir(seg, dir string, entries []fs.DirEntry, params map[st
 		}
 
 		if name[0] == '_' {
-			if !validIdentifierRegex.MatchString(name[1:]) {
-				return "", fmt.Errorf("invalid dynamic match in %s", dir)
-			}
 			if dynamicMatch != "" {
 				return "", fmt.Errorf("multiple dynamic matches in %s", dir)
 			}
-			if params[name[1:]] != "" {
-				return "", fmt.Errorf("duplicate dynamic match in %s", dir)
-			}
 			dynamicMatch = name
 		}
 	}
 
 	// if no exact match, use the dynamic match
 	if dynamicMatch != "" {
-		params[dynamicMatch[1:]] = seg
+		ok, err := matchParam(dynamicMatch[1:], seg, dir, params)
+		if !ok || err != nil {
+			return "", err
+		}
 		return path.Join(dir, dynamicMatch), nil
 	}
 
 	return "", nil // no match
 }
 
-func (h *Handler) matchFile(seg, dir string, entries []fs.DirEntry, params map[string]string) (string, error) {
+func (h *Handler) matchFile(
+	seg, dir string,
+	entries []fs.DirEntry,
+	params map[string]any,
+	drafts bool,
+) (string, error) {
 	dynamicMatch := ""
 
 	if seg == "/" {
@@ -402,26 +996,30 @@ func (h *Handler) matchFile(seg, dir string, entries []fs.DirEntry, params map[s
 		if entry.IsDir() {
 			continue
 		}
-		entry.Type()
 		name := entry.Name()
 
 		if path.Ext(name) == chtmlExt {
+			base, draft := pageName(name)
+			if draft && !drafts {
+				continue
+			}
+
+			if name == layoutFile {
+				continue // layouts are not routable
+			}
+
 			// match component by base name
-			if strings.TrimSuffix(name, chtmlExt) == seg {
+			if base == seg {
 				return path.Join(dir, name), nil
 			}
 
-			if name[0] == '_' && len(name) > len(chtmlExt)+1 && !strings.HasPrefix(name, "__") {
-				pn := name[1 : len(name)-len(chtmlExt)]
-				if !validIdentifierRegex.MatchString(pn) {
-					return "", fmt.Errorf("invalid dynamic match in %s", dir)
-				}
+			if name[0] == '_' && len(base) > 1 && !strings.HasPrefix(name, "__") {
 				if dynamicMatch != "" {
+					if b, _ := pageName(dynamicMatch); b == base {
+						continue // another page of the route, see matchMethod
+					}
 					return "", fmt.Errorf("multiple dynamic matches in %s", dir)
 				}
-				if params[pn] != "" {
-					return "", fmt.Errorf("duplicate dynamic match in %s", dir)
-				}
 				dynamicMatch = name
 			}
 		} else {
@@ -434,8 +1032,11 @@ func (h *Handler) matchFile(seg, dir string, entries []fs.DirEntry, params map[s
 
 	// if no exact match, use the dynamic match
 	if dynamicMatch != "" {
-		pn := dynamicMatch[1 : len(dynamicMatch)-len(chtmlExt)]
-		params[pn] = seg
+		base, _ := pageName(dynamicMatch)
+		ok, err := matchParam(base[1:], seg, dir, params)
+		if !ok || err != nil {
+			return "", err
+		}
 		return path.Join(dir, dynamicMatch), nil
 	}
 
@@ -446,7 +1047,15 @@ func (h *Handler) matchFile(seg, dir string, entries []fs.DirEntry, params map[s
 // provided dir path.
 // Components are resolved by searching the name + ".chtml" extension in ComponentSearchPath.
 func (h *Handler) importer(dir string) chtml.Importer {
-	searchPath := h.ComponentSearchPath
+	cfg := h.cfg()
+	imp := h.importerWithSearchPath(dir, cfg.ComponentSearchPath).(*pagesImporter)
+	imp.shared = cfg.parsed
+	imp.renderTimeout = cfg.RenderTimeout
+	return imp
+}
+
+// importerWithSearchPath is like importer, but uses the given component search path.
+func (h *Handler) importerWithSearchPath(dir string, searchPath []string) chtml.Importer {
 	if len(searchPath) == 0 {
 		searchPath = defaultSearchPath
 	}
@@ -511,7 +1120,130 @@ func pathUnescape(path string) string {
 	return u
 }
 
-func findCatchAllFile(entries []fs.DirEntry) (string, error) {
+// catchAllParam returns the name of the catch-all parameter for the given component path or an
+// empty string if the component is not a catch-all one.
+func catchAllParam(fsPath string) string {
+	name := path.Base(fsPath)
+	if !strings.HasPrefix(name, "__") || !strings.HasSuffix(name, chtmlExt) {
+		return ""
+	}
+	base, _ := pageName(name)
+	return base[2:]
+}
+
+// draftSuffix marks the draft pages, e.g. "about.draft.chtml".
+const draftSuffix = ".draft"
+
+// pageMethods are the HTTP methods of the method-specific pages, e.g. "index.post.chtml".
+var pageMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions,
+}
+
+// pageName returns the name of the page component file without the extension, the draft
+// suffix and the method suffix, and whether the page is a draft. The pages of a route, e.g.
+// "index.chtml" and "index.post.chtml", have the same name.
+func pageName(name string) (string, bool) {
+	base := strings.TrimSuffix(name, chtmlExt)
+	base, draft := strings.CutSuffix(base, draftSuffix)
+	if i := strings.LastIndexByte(base, '.'); i > 0 && pageMethod(name) != "" {
+		base = base[:i]
+	}
+	return base, draft
+}
+
+// pageMethod returns the HTTP method handled by the page component file, e.g. "POST" for
+// "index.post.chtml" or "index.post.draft.chtml", or the empty string if the page handles any
+// method.
+func pageMethod(name string) string {
+	base := strings.TrimSuffix(name, chtmlExt)
+	base = strings.TrimSuffix(base, draftSuffix)
+	i := strings.LastIndexByte(base, '.')
+	if i <= 0 {
+		return ""
+	}
+	m := strings.ToUpper(base[i+1:])
+	if base[i+1:] != strings.ToLower(m) || !slices.Contains(pageMethods, m) {
+		return ""
+	}
+	return m
+}
+
+// matchMethod selects the page handling the request method among the pages of the route matched
+// by fsPath: NAME.METHOD.chtml, or NAME.chtml handling the other methods. The HEAD requests are
+// handled by the GET pages too. If none of the pages handles the method, it returns the empty
+// path and the methods allowed by the route.
+func (h *Handler) matchMethod(fsPath, method string, drafts bool) (string, []string, error) {
+	dir := path.Dir(fsPath)
+	base, _ := pageName(path.Base(fsPath))
+
+	entries, err := fs.ReadDir(h.FileSystem, dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("read directory %s: %w", dir, err)
+	}
+
+	var generic, get string
+	var allowed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != chtmlExt || name == layoutFile {
+			continue
+		}
+		if b, draft := pageName(name); b != base || draft && !drafts {
+			continue
+		}
+		switch m := pageMethod(name); {
+		case m == method:
+			return path.Join(dir, name), nil, nil
+		case m == "":
+			generic = cmp.Or(generic, name)
+		case m == http.MethodGet:
+			get = cmp.Or(get, name)
+			allowed = append(allowed, m, http.MethodHead)
+		default:
+			allowed = append(allowed, m)
+		}
+	}
+
+	switch {
+	case method == http.MethodHead && get != "":
+		return path.Join(dir, get), nil, nil
+	case generic != "":
+		return path.Join(dir, generic), nil, nil
+	}
+	slices.Sort(allowed)
+	return "", slices.Compact(allowed), nil
+}
+
+// allowDrafts reports whether the draft pages are routable for the request.
+func (h *Handler) allowDrafts(r *http.Request) bool {
+	if h.ShowDrafts {
+		return true
+	}
+	if h.PreviewToken == "" {
+		return false
+	}
+	token := r.URL.Query().Get("preview")
+	if token == "" {
+		token = r.Header.Get("X-Preview-Token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.PreviewToken)) == 1
+}
+
+// splitSegments splits the value of a catch-all parameter into unescaped path segments.
+func splitSegments(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return []string{}
+	}
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = pathUnescape(seg)
+	}
+	return segs
+}
+
+func findCatchAllFile(entries []fs.DirEntry, drafts bool) (string, error) {
 	catchAll := ""
 
 	for _, entry := range entries {
@@ -522,7 +1254,13 @@ func findCatchAllFile(entries []fs.DirEntry) (string, error) {
 		if !strings.HasSuffix(name, chtmlExt) || len(name) < 3 || name[:2] != "__" {
 			continue
 		}
+		if _, draft := pageName(name); draft && !drafts {
+			continue
+		}
 		if catchAll != "" {
+			if catchAllParam(catchAll) == catchAllParam(name) {
+				continue // another page of the route, see matchMethod
+			}
 			return "", fmt.Errorf("multiple catch-all files found")
 		}
 		catchAll = name
@@ -552,6 +1290,13 @@ type RequestArg struct {
 	// RawBody is the Body field of the http.Request. If the content type is parseable as JSON or
 	// form data, the RawBody will be closed.
 	RawBody io.ReadCloser `expr:"raw_body"`
+
+	// Files are the files uploaded with a multipart/form-data request by field name. The other
+	// fields of the form are in the Body.
+	Files map[string][]*UploadedFile `expr:"files"`
+
+	// bodyErr is the error of parsing the multipart/form-data body, e.g. *http.MaxBytesError.
+	bodyErr error
 }
 
 func NewRequestArg(r *http.Request) *RequestArg {
@@ -587,6 +1332,25 @@ func NewRequestArg(r *http.Request) *RequestArg {
 				}
 			}
 		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(uploadMaxMemory); err != nil {
+			model.bodyErr = err
+			break
+		}
+		if len(r.MultipartForm.Value) > 0 {
+			model.Body = map[string]any{}
+			for k, v := range r.MultipartForm.Value {
+				model.Body[k] = v
+			}
+		}
+		if len(r.MultipartForm.File) > 0 {
+			model.Files = map[string][]*UploadedFile{}
+			for k, fhs := range r.MultipartForm.File {
+				for _, fh := range fhs {
+					model.Files[k] = append(model.Files[k], newUploadedFile(fh))
+				}
+			}
+		}
 	}
 
 	return model
@@ -597,6 +1361,18 @@ type pagesImporter struct {
 	h          *Handler
 	searchPath []string
 	parsed     map[string]*chtml.Node // TODO: change to sync.Map
+
+	// shared keeps the parsed trees across the requests (see Handler.Prewarm). The trees parsed
+	// with keep set, or of the popular routes, are added to it.
+	shared *parseCache
+	keep   bool
+
+	// renderTimeout limits the renders of the imports of the components, see RenderTimeout.
+	renderTimeout time.Duration
+
+	// loading is the files being parsed, the outermost first. A component importing one of them
+	// at parse time is an import cycle, which would never finish parsing.
+	loading []string
 }
 
 func (imp *pagesImporter) Import(name string) (chtml.Component, error) {
@@ -624,36 +1400,122 @@ func (imp *pagesImporter) Import(name string) (chtml.Component, error) {
 				p = path.Join(imp.dir, sp, p)
 			}
 
-			parsed, ok := imp.parsed[p]
-			if !ok {
-				var err error
-				parsed, err = parseFile(imp.h.FileSystem, p, &pagesImporter{
-					dir:        path.Dir(p),
-					h:          imp.h,
-					searchPath: imp.searchPath,
-					parsed:     imp.parsed,
-				})
-				if err == chtml.ErrComponentNotFound {
-					continue
-				}
-				if err != nil {
-					return nil, err
+			if imp.h.Cache.caches(p) {
+				// the component is parsed and rendered only if its output is not cached
+				if _, err := fs.Stat(imp.h.FileSystem, strings.TrimPrefix(p, "/")); err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						continue
+					}
+					return nil, fmt.Errorf("stat component %s: %w", p, err)
 				}
-				imp.parsed[p] = parsed
+				return imp.h.Cache.component(p, func() (chtml.Component, error) {
+					return imp.load(p)
+				}), nil
 			}
-			return chtml.NewComponent(parsed, &chtml.ComponentOptions{
-				Importer: imp,
-			}), nil
+
+			comp, err := imp.load(p)
+			if err == chtml.ErrComponentNotFound {
+				continue
+			}
+			return comp, err
 		}
 	}
 
 	return nil, chtml.ErrComponentNotFound
 }
 
+// load creates an instance of the component from the file p, which is parsed once per importer,
+// or once per handler if it is prewarmed.
+func (imp *pagesImporter) load(p string) (chtml.Component, error) {
+	parsed, ok := imp.parsed[p]
+	if ok && imp.keep {
+		imp.shared.put(p, parsed) // parsed earlier in the request, e.g. by another import
+	} else if !ok {
+		parsed, ok = imp.shared.get(p)
+	}
+	if !ok {
+		if i := slices.Index(imp.loading, p); i >= 0 {
+			cycle := append(slices.Clone(imp.loading[i:]), p)
+			for i := range cycle {
+				cycle[i] = strings.TrimPrefix(cycle[i], "/")
+			}
+			return nil, &chtml.ImportCycleError{Cycle: cycle}
+		}
+
+		// the components imported by a kept page are kept too
+		keep := imp.shared != nil && (imp.keep || imp.h.popular(p))
+		var err error
+		parsed, err = parseFile(imp.h.FileSystem, p, imp.h.logger, imp.h.parseOptions(), &pagesImporter{
+			dir:        path.Dir(p),
+			h:          imp.h,
+			searchPath: imp.searchPath,
+			parsed:     imp.parsed,
+			shared:     imp.shared,
+			keep:       keep,
+			loading:    append(slices.Clip(imp.loading), p),
+		})
+		if err != nil {
+			return nil, err
+		}
+		imp.parsed[p] = parsed
+		if keep {
+			imp.shared.put(p, parsed)
+		}
+	}
+	return chtml.NewComponent(parsed, &chtml.ComponentOptions{
+		Name:           strings.TrimPrefix(p, "/"),
+		Importer:       imp,
+		StrictCoercion: imp.h.StrictCoercion,
+		KeepComment:    imp.h.KeepComment,
+		Sanitize:       imp.h.Sanitize,
+		Functions:      imp.h.funcs,
+		RenderTimeout:  imp.renderTimeout,
+	}), nil
+}
+
+// parseOptions returns the options to parse the components: the variables provided by the page
+// scopes and the template functions are declared.
+func (h *Handler) parseOptions() *chtml.ParseOptions {
+	opts := &chtml.ParseOptions{Functions: h.funcs}
+	if h.Sessions != nil {
+		opts.EnvProvider = envNames{"session"}
+	}
+	return opts
+}
+
+// envNames declares the variables provided by the page scopes (see scope.EnvNames) to the parser.
+type envNames []string
+
+var _ chtml.EnvShaper = envNames(nil)
+
+func (e envNames) EnvNames() []string { return e }
+
+func (e envNames) LookupEnv(string) (any, bool, error) { return nil, false, nil }
+
+// EnvShape declares the session values as a map (see Session.Values).
+func (e envNames) EnvShape(name string) (any, bool) {
+	if name == "session" {
+		return map[string]any{}, true
+	}
+	return nil, false
+}
+
 // ParseFile parses the CHTML component from the given file. Unlike Parse, it may also watch
 // for changes in the file and trigger a re-parse when necessary.
-func parseFile(fsys fs.FS, fname string, imp chtml.Importer) (*chtml.Node, error) {
+// The parser warnings are logged with the given logger.
+func parseFile(
+	fsys fs.FS,
+	fname string,
+	logger *slog.Logger,
+	opts *chtml.ParseOptions,
+	imp chtml.Importer,
+) (*chtml.Node, error) {
 	fname = strings.TrimPrefix(fname, "/")
+	var o chtml.ParseOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.Name = fname // reported by the errors, e.g. in the ErrorOverlay
 	f, err := fsys.Open(fname)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -663,5 +1525,9 @@ func parseFile(fsys fs.FS, fname string, imp chtml.Importer) (*chtml.Node, error
 	}
 	defer func() { _ = f.Close() }()
 
-	return chtml.Parse(f, imp)
+	doc, diags, err := chtml.ParseWithDiagnostics(f, imp, &o)
+	for _, d := range diags {
+		logger.Warn("Component warning", "file", fname, "diagnostic", d)
+	}
+	return doc, err
 }
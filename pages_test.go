@@ -1,12 +1,18 @@
 package pages
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
 )
 
 func TestPages_Handler(t *testing.T) {
@@ -61,3 +67,475 @@ func TestPages_Handler(t *testing.T) {
 		})
 	}
 }
+
+func TestPages_CatchAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":                {Data: []byte(`index`)},
+		"__path.chtml":               {Data: []byte(`<c:route as="r" />root:${r.path}:${join(r.path_segments, ",")}`)},
+		"docs/intro.chtml":           {Data: []byte(`intro`)},
+		"docs/_section/index.chtml":  {Data: []byte(`<c:route as="r" />section:${r.section}`)},
+		"docs/_section/_page.chtml":  {Data: []byte(`<c:route as="r" />page:${r.section}:${r.page}`)},
+		"docs/__rest.chtml":          {Data: []byte(`<c:route as="r" />docs:${r.rest}:${join(r.rest_segments, ",")}:${r.section ?? "-"}`)},
+		"docs/_section/img/logo.png": {Data: []byte(`png`)},
+	}
+
+	tests := []struct {
+		url      string
+		wantBody string
+	}{
+		{"/", "index"},
+		{"/docs/intro", "intro"},
+		{"/docs/guide/", "section:guide"},
+		{"/docs/guide/install", "page:guide:install"},
+		{"/docs/guide/img/logo.png", "png"},
+		{"/docs/guide/install/linux", "docs:/guide/install/linux:guide,install,linux:-"},
+		{"/docs/a%20b/c/d", "docs:/a%20b/c/d:a b,c,d:-"},
+		{"/docs", "root:/docs:docs"},
+		{"/blog/2024/post", "root:/blog/2024/post:blog,2024,post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			var err error
+
+			h := &Handler{
+				FileSystem:        fsys,
+				BuiltinComponents: map[string]chtml.Component{"route": RouteComponent{}},
+				OnError:           func(r *http.Request, pagesErr error) { err = pagesErr },
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if err != nil {
+				t.Errorf("Handler() err = %v", err)
+			}
+			if rr.Code != http.StatusOK {
+				t.Errorf("status code: got %v, want %v", rr.Code, http.StatusOK)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPages_TypedParams(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users/_id[int].chtml":           {Data: []byte(`<c:route as="r" />user:${type(r.id)}:${r.id + 1}`)},
+		"prices/_amount[number]/x.chtml": {Data: []byte(`<c:route as="r" />price:${type(r.amount)}:${r.amount}`)},
+		"flags/_on[bool].chtml":          {Data: []byte(`<c:route as="r" />flag:${type(r.on)}:${r.on}`)},
+		"tags/_tag[string].chtml":        {Data: []byte(`<c:route as="r" />tag:${r.tag}`)},
+		"bad/_x[date].chtml":             {Data: []byte(`bad`)},
+	}
+
+	tests := []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"/users/42", http.StatusOK, "user:int:43"},
+		{"/users/joe", http.StatusNotFound, "Not Found\n"},
+		{"/prices/1.5/x", http.StatusOK, "price:float:1.5"},
+		{"/prices/cheap/x", http.StatusNotFound, "Not Found\n"},
+		{"/flags/true", http.StatusOK, "flag:bool:true"},
+		{"/tags/go", http.StatusOK, "tag:go"},
+		{"/bad/1", http.StatusInternalServerError, "Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			h := &Handler{
+				FileSystem:        fsys,
+				BuiltinComponents: map[string]chtml.Component{"route": RouteComponent{}},
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPages_Drafts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":               {Data: []byte(`index`)},
+		"about.draft.chtml":         {Data: []byte(`about`)},
+		"posts/_slug.draft.chtml":   {Data: []byte(`<c:route as="r" />post:${r.slug}`)},
+		"docs/__path.draft.chtml":   {Data: []byte(`docs`)},
+		"blog/index.chtml":          {Data: []byte(`blog`)},
+		"blog/new-post.draft.chtml": {Data: []byte(`new post`)},
+	}
+
+	tests := []struct {
+		name     string
+		h        *Handler
+		url      string
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{"published", &Handler{}, "/", "", http.StatusOK, "index"},
+		{"hidden", &Handler{}, "/about", "", http.StatusNotFound, "Not Found\n"},
+		{"hidden dynamic", &Handler{}, "/posts/hello", "", http.StatusNotFound, "Not Found\n"},
+		{"hidden catch-all", &Handler{}, "/docs/a/b", "", http.StatusNotFound, "Not Found\n"},
+		{"show drafts", &Handler{ShowDrafts: true}, "/about", "", http.StatusOK, "about"},
+		{"show dynamic", &Handler{ShowDrafts: true}, "/posts/hello", "", http.StatusOK, "post:hello"},
+		{"show catch-all", &Handler{ShowDrafts: true}, "/docs/a/b", "", http.StatusOK, "docs"},
+		{"preview query", &Handler{PreviewToken: "s3cret"}, "/blog/new-post?preview=s3cret", "", http.StatusOK, "new post"},
+		{"preview header", &Handler{PreviewToken: "s3cret"}, "/blog/new-post", "s3cret", http.StatusOK, "new post"},
+		{"wrong token", &Handler{PreviewToken: "s3cret"}, "/blog/new-post?preview=guess", "", http.StatusNotFound, "Not Found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.h.FileSystem = fsys
+			tt.h.BuiltinComponents = map[string]chtml.Component{"route": RouteComponent{}}
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Preview-Token", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			tt.h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+			if rr.Code == http.StatusOK && tt.url != "/" && rr.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("draft response is cacheable: %v", rr.Header())
+			}
+		})
+	}
+}
+
+func TestPages_Methods(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":                 {Data: []byte(`index`)},
+		"index.post.chtml":            {Data: []byte(`index post`)},
+		"contact.get.chtml":           {Data: []byte(`contact form`)},
+		"contact.post.chtml":          {Data: []byte(`contact sent`)},
+		"users/_id.delete.chtml":      {Data: []byte(`<c:route as="r" />deleted:${r.id}`)},
+		"users/_id.chtml":             {Data: []byte(`<c:route as="r" />user:${r.id}`)},
+		"docs/__path.put.chtml":       {Data: []byte(`<c:route as="r" />put:${r.path}`)},
+		"docs/__path.patch.chtml":     {Data: []byte(`patch`)},
+		"notes.post.draft.chtml":      {Data: []byte(`draft note`)},
+		"notes.get.chtml":             {Data: []byte(`notes`)},
+		"release.candidate.chtml":     {Data: []byte(`rc`)},
+		"report.POST.chtml":           {Data: []byte(`not a method suffix`)},
+		"uploads/index.options.chtml": {Data: []byte(`options`)},
+	}
+
+	tests := []struct {
+		method    string
+		url       string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{"GET", "/", http.StatusOK, "index", ""},
+		{"POST", "/", http.StatusOK, "index post", ""},
+		{"DELETE", "/", http.StatusOK, "index", ""},
+		{"GET", "/contact", http.StatusOK, "contact form", ""},
+		{"HEAD", "/contact", http.StatusOK, "contact form", ""},
+		{"POST", "/contact", http.StatusOK, "contact sent", ""},
+		{"PUT", "/contact", http.StatusMethodNotAllowed, "Method Not Allowed\n", "GET, HEAD, POST"},
+		{"GET", "/users/5", http.StatusOK, "user:5", ""},
+		{"DELETE", "/users/5", http.StatusOK, "deleted:5", ""},
+		{"PUT", "/docs/a/b", http.StatusOK, "put:/a/b", ""},
+		{"GET", "/docs/a/b", http.StatusMethodNotAllowed, "Method Not Allowed\n", "PATCH, PUT"},
+		{"POST", "/notes", http.StatusMethodNotAllowed, "Method Not Allowed\n", "GET, HEAD"},
+		{"GET", "/release.candidate", http.StatusOK, "rc", ""},
+		{"GET", "/report.POST", http.StatusOK, "not a method suffix", ""},
+		{"GET", "/report", http.StatusNotFound, "Not Found\n", ""},
+		{"GET", "/uploads/", http.StatusMethodNotAllowed, "Method Not Allowed\n", "OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			h := &Handler{
+				FileSystem:        fsys,
+				BuiltinComponents: map[string]chtml.Component{"route": RouteComponent{}},
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow: got %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestPages_Static(t *testing.T) {
+	pagesFS := fstest.MapFS{
+		"index.chtml":             {Data: []byte(`index`)},
+		"robots.txt":              {Data: []byte(`pages-robots`)},
+		".well-known/change-pass": {Data: []byte(`pages-change-pass`)},
+		"__path.chtml":            {Data: []byte(`not-found`)},
+	}
+	staticFS := fstest.MapFS{
+		"favicon.ico":                   {Data: []byte(`static-favicon`)},
+		".well-known/security.txt":      {Data: []byte(`static-security`)},
+		".well-known/change-pass/other": {Data: []byte(`other`)},
+	}
+	defaultsFS := fstest.MapFS{
+		"favicon.ico": {Data: []byte(`default-favicon`)},
+		"robots.txt":  {Data: []byte(`default-robots`)},
+		"other.txt":   {Data: []byte(`other`)},
+	}
+
+	tests := []struct {
+		url      string
+		wantBody string
+	}{
+		{"/favicon.ico", "static-favicon"},
+		{"/robots.txt", "default-robots"},
+		{"/.well-known/security.txt", "static-security"},
+		{"/.well-known/change-pass", "pages-change-pass"},
+		{"/.well-known/missing", "Not Found\n"},
+		{"/other.txt", "not-found"},
+		{"/", "index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			h := &Handler{
+				FileSystem:        pagesFS,
+				StaticFileSystems: []fs.FS{staticFS, defaultsFS},
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPages_RenderBudget(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<p c:for="i in 1..1000">${i}</p>`)},
+	}
+
+	tests := []struct {
+		budget     int64
+		wantStatus int
+	}{
+		{0, http.StatusOK},
+		{1 << 20, http.StatusOK},
+		{1 << 10, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.budget), func(t *testing.T) {
+			h := &Handler{
+				FileSystem:   fsys,
+				RenderArena:  true,
+				RenderBudget: tt.budget,
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPages_ImportCycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		fsys       fstest.MapFS
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "cycle",
+			fsys: fstest.MapFS{
+				"index.chtml": {Data: []byte(`<c:a></c:a>`)},
+				"a.chtml":     {Data: []byte(`<div><c:b></c:b></div>`)},
+				"b.chtml":     {Data: []byte(`<p><c:a></c:a></p>`)},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "import cycle: a.chtml -&gt; b.chtml -&gt; a.chtml",
+		},
+		{
+			name: "shared import",
+			fsys: fstest.MapFS{
+				"index.chtml": {Data: []byte(`<c:a></c:a><c:b></c:b>`)},
+				"a.chtml":     {Data: []byte(`<div><c:c></c:c></div>`)},
+				"b.chtml":     {Data: []byte(`<p><c:c></c:c></p>`)},
+				"c.chtml":     {Data: []byte(`<b>c</b>`)},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "<div><b>c</b></div><p><b>c</b></p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{FileSystem: tt.fsys, ErrorOverlay: true}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body: got %q, want it to contain %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// blockingComponent blocks its renders until the context of the page is canceled. The renders
+// at parse time have no request and return immediately.
+type blockingComponent struct {
+	returned chan struct{}
+}
+
+func (c blockingComponent) Render(s chtml.Scope) (any, error) {
+	ctx := chtml.ContextOf(s)
+	if ctx.Done() == nil {
+		return nil, nil
+	}
+	<-ctx.Done()
+	close(c.returned)
+	return nil, ctx.Err()
+}
+
+func TestPages_RenderTimeout(t *testing.T) {
+	comp := blockingComponent{returned: make(chan struct{})}
+	h := &Handler{
+		FileSystem:        fstest.MapFS{"index.chtml": {Data: []byte(`<p><c:blocking></c:blocking></p>`)}},
+		BuiltinComponents: map[string]chtml.Component{"blocking": comp},
+		RenderTimeout:     20 * time.Millisecond,
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status code: got %v, want %v", rr.Code, http.StatusInternalServerError)
+	}
+
+	// the abandoned render is canceled with the page
+	select {
+	case <-comp.returned:
+	case <-time.After(time.Second):
+		t.Error("abandoned render is not canceled")
+	}
+}
+
+func TestPages_KeepComment(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":  {Data: []byte(`<!--[if IE]><p>IE</p><![endif]--><!-- note --><c:footer></c:footer>`)},
+		"footer.chtml": {Data: []byte(`<footer><!--#include virtual="/ad.html" --><!-- todo --></footer>`)},
+	}
+
+	tests := []struct {
+		name        string
+		keepComment func(string) bool
+		want        string
+	}{
+		{"default", nil, "<footer></footer>"},
+		{"directives", chtml.DirectiveComment, `<!--[if IE]><p>IE</p><![endif]--><footer><!--#include virtual="/ad.html" --></footer>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{FileSystem: fsys, KeepComment: tt.keepComment}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			if got := rr.Body.String(); !strings.Contains(got, tt.want) || strings.Contains(got, "note") {
+				t.Errorf("body: got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPages_Sanitize(t *testing.T) {
+	policy := &chtml.SanitizePolicy{Elements: []string{"p", "b"}}
+	h := &Handler{
+		FileSystem: fstest.MapFS{
+			"index.chtml": {Data: []byte(`<main><c:post body="<p><b>x</b><script>alert(1)</script></p>"></c:post></main>`)},
+			"post.chtml":  {Data: []byte(`<c:attr name="body"></c:attr><article>${unsafeHtml(body)}</article>`)},
+		},
+		Sanitize: policy.Sanitize,
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("status code: got %v, want %v", rr.Code, http.StatusOK)
+	}
+	if want := "<main><article><p><b>x</b></p></article></main>"; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("body: got %q, want it to contain %q", rr.Body.String(), want)
+	}
+}
+
+func TestPages_TemplateFuncs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<c:price amount="${1999}"></c:price>`)},
+		"price.chtml": {Data: []byte(`<c:attr name="amount">${0}</c:attr><p>${money(amount)}</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		TemplateFuncs: map[string]any{
+			"money": func(cents int) string { return fmt.Sprintf("$%d.%02d", cents/100, cents%100) },
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if got, want := rr.Body.String(), "<p>$19.99</p>"; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
+
+type contextComponent struct {
+	ctx *context.Context
+}
+
+func (c contextComponent) Render(s chtml.Scope) (any, error) {
+	*c.ctx = chtml.ContextOf(s)
+	return nil, nil
+}
+
+func TestPages_Context(t *testing.T) {
+	type ctxKey struct{}
+
+	var ctx context.Context
+	h := &Handler{
+		FileSystem:        fstest.MapFS{"index.chtml": {Data: []byte(`<c:ctx></c:ctx>`)}},
+		BuiltinComponents: map[string]chtml.Component{"ctx": contextComponent{ctx: &ctx}},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if ctx == nil {
+		t.Fatal("component is not rendered")
+	}
+	if ctx.Value(ctxKey{}) != "request" {
+		t.Error("request context is not inherited")
+	}
+	if ctx.Err() == nil {
+		t.Error("context is not canceled after the request is served")
+	}
+}
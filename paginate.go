@@ -0,0 +1,137 @@
+package pages
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// DefaultPageSize is the default number of items per page of PaginateComponent.
+const DefaultPageSize = 20
+
+// PaginateComponent computes the pagination of a listing page from the total number of items and
+// the current page number in the request query. The following arguments are accepted:
+//   - total - the total number of items, required;
+//   - size - the number of items per page, PageSize by default;
+//   - param - the name of the query parameter with the page number, "page" by default;
+//   - window - the number of the page links around the current page, 2 by default.
+//
+// The component returns a Pagination. The page number out of range is clamped to the first or
+// the last page. The links point to the path of the request with the same query, except for
+// the page number, which is omitted for the first page.
+//
+// Example:
+//
+//	<c:paginate as="p" total="${count}" size="10"></c:paginate>
+//	<ul><li c:for="item in items[p.offset:p.offset+p.limit]">${item.title}</li></ul>
+//	<nav>
+//	  <a c:if="p.has_prev" href="${p.prev}">Previous</a>
+//	  <a c:for="l in p.links" href="${l.url}" class="${l.current ? 'current' : ''}">${l.gap ? '…' : l.page}</a>
+//	  <a c:if="p.has_next" href="${p.next}">Next</a>
+//	</nav>
+type PaginateComponent struct {
+	// PageSize is the default number of items per page. Default is DefaultPageSize.
+	PageSize int
+}
+
+var _ chtml.Component = PaginateComponent{}
+
+// Pagination is the result of PaginateComponent.
+type Pagination struct {
+	Page    int        `expr:"page"`   // the current page, starting from 1
+	Pages   int        `expr:"pages"`  // the number of pages, at least 1
+	Size    int        `expr:"size"`   // the number of items per page
+	Total   int        `expr:"total"`  // the total number of items
+	Offset  int        `expr:"offset"` // the number of items before the current page
+	Limit   int        `expr:"limit"`  // the number of items on the current page
+	HasPrev bool       `expr:"has_prev"`
+	HasNext bool       `expr:"has_next"`
+	First   string     `expr:"first"` // the URL of the first page
+	Last    string     `expr:"last"`  // the URL of the last page
+	Prev    string     `expr:"prev"`  // the URL of the previous page, empty on the first page
+	Next    string     `expr:"next"`  // the URL of the next page, empty on the last page
+	Links   []PageLink `expr:"links"`
+}
+
+// PageLink is a link of the pagination: the first and the last pages, and the pages around the
+// current one. The skipped pages are replaced with a gap.
+type PageLink struct {
+	Page    int    `expr:"page"`
+	URL     string `expr:"url"`
+	Current bool   `expr:"current"`
+	Gap     bool   `expr:"gap"`
+}
+
+func (pc PaginateComponent) Render(s chtml.Scope) (any, error) {
+	args := struct {
+		Total  int
+		Size   int
+		Param  string
+		Window int
+	}{Window: 2}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, fmt.Errorf("unmarshal scope: %w", err)
+	}
+	if args.Total < 0 {
+		return nil, fmt.Errorf("invalid total %d", args.Total)
+	}
+	if args.Size == 0 {
+		args.Size = pc.PageSize
+		if args.Size == 0 {
+			args.Size = DefaultPageSize
+		}
+	}
+	if args.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d", args.Size)
+	}
+	if args.Param == "" {
+		args.Param = "page"
+	}
+
+	var u url.URL
+	if ss, ok := s.(*scope); ok && ss.globals.req != nil {
+		u = *ss.globals.req.URL
+	}
+	query := u.Query()
+
+	p := &Pagination{Size: args.Size, Total: args.Total}
+	p.Pages = max(1, (args.Total+args.Size-1)/args.Size)
+	p.Page, _ = strconv.Atoi(query.Get(args.Param))
+	p.Page = min(max(p.Page, 1), p.Pages)
+	p.Offset = (p.Page - 1) * args.Size
+	p.Limit = min(args.Size, max(args.Total-p.Offset, 0))
+	p.HasPrev = p.Page > 1
+	p.HasNext = p.Page < p.Pages
+
+	link := func(page int) string {
+		if page == 1 {
+			query.Del(args.Param)
+		} else {
+			query.Set(args.Param, strconv.Itoa(page))
+		}
+		lu := url.URL{Path: u.Path, RawQuery: query.Encode()}
+		return lu.String()
+	}
+	p.First = link(1)
+	p.Last = link(p.Pages)
+	if p.HasPrev {
+		p.Prev = link(p.Page - 1)
+	}
+	if p.HasNext {
+		p.Next = link(p.Page + 1)
+	}
+
+	p.Links = []PageLink{}
+	for page := 1; page <= p.Pages; page++ {
+		if page != 1 && page != p.Pages && (page < p.Page-args.Window || page > p.Page+args.Window) {
+			if last := len(p.Links) - 1; !p.Links[last].Gap {
+				p.Links = append(p.Links, PageLink{Gap: true})
+			}
+			continue
+		}
+		p.Links = append(p.Links, PageLink{Page: page, URL: link(page), Current: page == p.Page})
+	}
+	return p, nil
+}
@@ -0,0 +1,60 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPaginateComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"items.chtml": {Data: []byte(
+			`<c:paginate as="p" total="${95}" size="${10}" window="${1}"></c:paginate>` +
+				`<p>${p.page}/${p.pages} ${p.offset}+${p.limit}</p>` +
+				`<a c:if="p.has_prev" href="${p.prev}">prev</a>` +
+				`<a c:for="l in p.links" href="${l.url}" class="${l.current ? 'current' : ''}">${l.gap ? '…' : l.page}</a>` +
+				`<a c:if="p.has_next" href="${p.next}">next</a>`)},
+	}
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"paginate": PaginateComponent{}},
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{
+			url: "/items",
+			want: `<p>1/10 0+10</p>` +
+				`<a href="/items" class="current">1</a><a href="/items?page=2" class="">2</a>` +
+				`<a href="" class="">…</a><a href="/items?page=10" class="">10</a>` +
+				`<a href="/items?page=2">next</a>`,
+		},
+		{
+			url: "/items?q=go&page=5",
+			want: `<p>5/10 40+10</p><a href="/items?page=4&amp;q=go">prev</a>` +
+				`<a href="/items?q=go" class="">1</a><a href="" class="">…</a>` +
+				`<a href="/items?page=4&amp;q=go" class="">4</a><a href="/items?page=5&amp;q=go" class="current">5</a>` +
+				`<a href="/items?page=6&amp;q=go" class="">6</a><a href="" class="">…</a>` +
+				`<a href="/items?page=10&amp;q=go" class="">10</a><a href="/items?page=6&amp;q=go">next</a>`,
+		},
+		{
+			url: "/items?page=99",
+			want: `<p>10/10 90+5</p><a href="/items?page=9">prev</a>` +
+				`<a href="/items" class="">1</a><a href="" class="">…</a>` +
+				`<a href="/items?page=9" class="">9</a><a href="/items?page=10" class="current">10</a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Body.String() != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// Prewarm parses the pages at the given paths in the FileSystem (e.g. "index.chtml" or
+// "users/_id[int].chtml") and the components they import, so the first requests to the pages
+// don't pay for the parsing, the type checking and the compilation of the expressions.
+// It is meant to be called at startup, before the server accepts the connections:
+//
+//	if err := handler.Prewarm([]string{"index.chtml", "docs/_slug.chtml"}); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// The parsed trees are kept until the ComponentSearchPath is changed with UpdateConfig, so the
+// changes of the prewarmed files are not picked up without a restart. In the Watch mode, the
+// pages are parsed on each request anyway, and Prewarm only fills the expression cache.
+//
+// The errors of all the pages are returned joined, the pages parsed without errors are kept.
+func (h *Handler) Prewarm(paths []string) error {
+	h.init.Do(h.setup)
+
+	var errs []error
+	for _, p := range paths {
+		if err := h.prewarm(strings.TrimPrefix(p, "/")); err != nil {
+			errs = append(errs, fmt.Errorf("prewarm %s: %w", p, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *Handler) prewarm(fsPath string) error {
+	if !strings.HasSuffix(fsPath, chtmlExt) {
+		return fmt.Errorf("not a page")
+	}
+	imp := h.importer(path.Dir(fsPath)).(*pagesImporter)
+	imp.keep = true
+	comp, err := imp.Import(path.Base(strings.TrimSuffix(fsPath, chtmlExt)))
+	if err != nil {
+		return err
+	}
+	if d, ok := comp.(chtml.Disposable); ok {
+		return d.Dispose()
+	}
+	return nil
+}
+
+// popular reports whether the route is one of the PrewarmTop most requested routes, so its
+// parsed tree is kept.
+func (h *Handler) popular(route string) bool {
+	if h.PrewarmTop <= 0 || !h.CollectMetrics {
+		return false
+	}
+	rank, ok := h.metrics.rank(route)
+	return ok && rank < h.PrewarmTop
+}
+
+// parseCache keeps the parsed trees of the prewarmed pages and of the components they import
+// across the requests. The trees are not changed by the rendering, so they are shared by
+// the concurrent requests. A nil cache keeps nothing.
+type parseCache struct {
+	mu    sync.RWMutex
+	trees map[string]*chtml.Node
+}
+
+func newParseCache() *parseCache {
+	return &parseCache{trees: make(map[string]*chtml.Node)}
+}
+
+func (c *parseCache) get(p string) (*chtml.Node, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, ok := c.trees[p]
+	return n, ok
+}
+
+func (c *parseCache) put(p string, n *chtml.Node) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trees[p] = n
+}
+
+// len returns the number of the kept trees.
+func (c *parseCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.trees)
+}
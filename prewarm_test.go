@@ -0,0 +1,88 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPages_Prewarm(t *testing.T) {
+	get := func(h *Handler, target string) string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	t.Run("paths", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"index.chtml":      {Data: []byte(`<c:greeting name="Ann"></c:greeting>`)},
+			"greeting.chtml":   {Data: []byte(`<c:attr name="name"></c:attr><p>Hello, ${name}</p>`)},
+			"other.chtml":      {Data: []byte(`<p>other</p>`)},
+			"components.chtml": {Data: []byte(`<c:missing></c:missing>`)},
+		}
+		h := &Handler{FileSystem: fsys}
+
+		err := h.Prewarm([]string{"index.chtml", "/missing.chtml", "components.chtml"})
+		if err == nil || !strings.Contains(err.Error(), "prewarm /missing.chtml") ||
+			!strings.Contains(err.Error(), "prewarm components.chtml") {
+			t.Fatalf("Prewarm() error = %v, want the errors of the missing and the broken pages", err)
+		}
+		if n := h.cfg().parsed.len(); n != 2 {
+			t.Errorf("kept %d trees, want the page and its import", n)
+		}
+
+		// the prewarmed trees are not parsed again, the other pages are
+		fsys["index.chtml"].Data = []byte(`<p>changed</p>`)
+		fsys["greeting.chtml"].Data = []byte(`<p>changed</p>`)
+		fsys["other.chtml"].Data = []byte(`<p>other changed</p>`)
+		if got := get(h, "/"); got != "<p>Hello, Ann</p>" {
+			t.Errorf("prewarmed page = %q", got)
+		}
+		if got := get(h, "/other"); got != "<p>other changed</p>" {
+			t.Errorf("other page = %q", got)
+		}
+
+		// changing the search path drops the trees
+		if err := h.UpdateConfig(func(c *Config) { c.ComponentSearchPath = []string{"."} }); err != nil {
+			t.Fatal(err)
+		}
+		if got := get(h, "/"); got != "<p>changed</p>" {
+			t.Errorf("page after the config update = %q", got)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		fsys := fstest.MapFS{"index.chtml": {Data: []byte(`<p>one</p>`)}}
+		h := &Handler{FileSystem: fsys, Watch: true}
+		if err := h.Prewarm([]string{"index.chtml"}); err != nil {
+			t.Fatal(err)
+		}
+		fsys["index.chtml"].Data = []byte(`<p>two</p>`)
+		if got := get(h, "/"); got != "<p>two</p>" {
+			t.Errorf("page = %q, want the changes picked up", got)
+		}
+	})
+
+	t.Run("popular", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"hot.chtml":  {Data: []byte(`<p>hot</p>`)},
+			"cold.chtml": {Data: []byte(`<p>cold</p>`)},
+		}
+		h := &Handler{FileSystem: fsys, CollectMetrics: true, PrewarmTop: 1}
+
+		get(h, "/hot")
+		get(h, "/hot") // kept: the most requested route
+		get(h, "/cold")
+		get(h, "/cold") // not kept: second to /hot
+
+		fsys["hot.chtml"].Data = []byte(`<p>hot changed</p>`)
+		fsys["cold.chtml"].Data = []byte(`<p>cold changed</p>`)
+		if got := get(h, "/hot"); got != "<p>hot</p>" {
+			t.Errorf("popular page = %q, want the kept tree", got)
+		}
+		if got := get(h, "/cold"); got != "<p>cold changed</p>" {
+			t.Errorf("other page = %q, want reparsed", got)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// RedirectComponent redirects the client to another URL, e.g. after a form submission. The
+// following arguments are accepted:
+//   - url - the URL to redirect to, required;
+//   - status - the redirect status code, 303 See Other by default.
+//
+// The page is still rendered, its output is sent as the body of the redirect response.
+//
+// Example:
+//
+//	<c:redirect url="${urlFor('contact/thanks', {})}"></c:redirect>
+type RedirectComponent struct{}
+
+var _ chtml.Component = RedirectComponent{}
+
+func (rc RedirectComponent) Render(s chtml.Scope) (any, error) {
+	var args struct {
+		URL    string
+		Status int
+	}
+	if err := chtml.UnmarshalScope(s, &args); err != nil {
+		return nil, fmt.Errorf("unmarshal scope: %w", err)
+	}
+	if args.Status == 0 {
+		args.Status = http.StatusSeeOther
+	}
+	if args.Status < 300 || args.Status > 399 {
+		return nil, fmt.Errorf("invalid redirect status %d", args.Status)
+	}
+
+	ss, ok := s.(*scope)
+	if !ok || ss.globals.req == nil {
+		return nil, nil // not rendered for a request, e.g. at parse time
+	}
+	if args.URL == "" {
+		return nil, errors.New("redirect url is required")
+	}
+
+	ss.globals.header.Set("Location", args.URL)
+	ss.globals.statusCode = args.Status
+	return nil, nil
+}
+
+// responseFuncs are the functions of the expressions changing the response of the page:
+//   - setStatus(code) sets the status code of the response;
+//   - setHeader(name, value) sets the response header, an empty value deletes it.
+//
+// The functions return an empty string, so they can be called in the text of the page:
+//
+//	${setStatus(201)}${setHeader('X-Item-Id', item.id)}
+//
+// They are bound to the page scopes (see scope.LookupFunction), and do nothing in other scopes.
+type responseFuncs struct {
+	globals *scopeGlobals
+}
+
+// functions returns the functions by name.
+func (rf responseFuncs) functions() map[string]any {
+	return map[string]any{"setStatus": rf.setStatus, "setHeader": rf.setHeader}
+}
+
+func (rf responseFuncs) setStatus(code int) (string, error) {
+	if code < 100 || code > 599 {
+		return "", fmt.Errorf("setStatus: invalid status code %d", code)
+	}
+	if rf.globals != nil {
+		rf.globals.statusCode = code
+	}
+	return "", nil
+}
+
+func (rf responseFuncs) setHeader(name string, value any) (string, error) {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, " :\r\n") {
+		return "", fmt.Errorf("setHeader: invalid header name %q", name)
+	}
+	v := ""
+	if value != nil {
+		v = fmt.Sprint(value)
+	}
+	if strings.ContainsAny(v, "\r\n") {
+		return "", fmt.Errorf("setHeader: invalid value of header %s", name)
+	}
+	if rf.globals == nil {
+		return "", nil
+	}
+	if v == "" {
+		rf.globals.header.Del(name)
+	} else {
+		rf.globals.header.Set(name, v)
+	}
+	return "", nil
+}
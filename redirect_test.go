@@ -0,0 +1,66 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestRedirectComponent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"contact.post.chtml":  {Data: []byte(`<c:redirect url="${urlFor('thanks', {'from': 'contact'})}"></c:redirect>sent`)},
+		"moved.chtml":         {Data: []byte(`<c:redirect url="/new" status="301"></c:redirect>moved`)},
+		"bad-status.chtml":    {Data: []byte(`<c:redirect url="/new" status="200"></c:redirect>`)},
+		"no-url.chtml":        {Data: []byte(`<c:redirect></c:redirect>`)},
+		"thanks.chtml":        {Data: []byte(`thanks`)},
+		"items.post.chtml":    {Data: []byte(`${setStatus(201)}${setHeader('X-Item-Id', 42)}created`)},
+		"teapot.chtml":        {Data: []byte(`${setStatus(1000)}`)},
+		"header-crlf.chtml":   {Data: []byte(`${setHeader('X-A', 'a\r\nX-B: b')}`)},
+		"header-delete.chtml": {Data: []byte(`${setHeader('Cache-Control', 'no-store')}${setHeader('Cache-Control', '')}ok`)},
+		"gone.chtml":          {Data: []byte(`<p c:if="setStatus(410) == ''">gone</p>`)},
+	}
+
+	tests := []struct {
+		method     string
+		url        string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{"POST", "/contact", http.StatusSeeOther, "sent", map[string]string{"Location": "/thanks?from=contact"}},
+		{"GET", "/moved", http.StatusMovedPermanently, "moved", map[string]string{"Location": "/new"}},
+		{"GET", "/bad-status", http.StatusInternalServerError, "", nil},
+		{"GET", "/no-url", http.StatusInternalServerError, "", nil},
+		{"POST", "/items", http.StatusCreated, "created", map[string]string{"X-Item-Id": "42"}},
+		{"GET", "/teapot", http.StatusInternalServerError, "", nil},
+		{"GET", "/header-crlf", http.StatusInternalServerError, "", nil},
+		{"GET", "/header-delete", http.StatusOK, "ok", map[string]string{"Cache-Control": ""}},
+		{"GET", "/gone", http.StatusGone, "<p>gone</p>", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			h := &Handler{
+				FileSystem:        fsys,
+				BuiltinComponents: map[string]chtml.Component{"redirect": RedirectComponent{}},
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, strings.NewReader("")))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("status code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if tt.wantCode < 500 && rr.Body.String() != tt.wantBody {
+				t.Errorf("body: got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+			for k, v := range tt.wantHeader {
+				if got := rr.Header().Get(k); got != v {
+					t.Errorf("header %s: got %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
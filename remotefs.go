@@ -0,0 +1,183 @@
+package pages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNotModified is returned by ObjectStore.Get when the object has not changed.
+var ErrNotModified = errors.New("not modified")
+
+// ObjectInfo describes an object in the ObjectStore.
+type ObjectInfo struct {
+	// Name is the slash-separated path of the object, e.g. "posts/_slug.chtml".
+	Name string
+
+	// ETag is an opaque version of the object content.
+	ETag string
+
+	Size    int64
+	ModTime time.Time
+}
+
+// ObjectStore is a minimal interface of a remote object storage (e.g. S3) to serve the components
+// and assets from with RemoteFS.
+type ObjectStore interface {
+	// List returns all objects in the store.
+	List(ctx context.Context) ([]ObjectInfo, error)
+
+	// Get returns the content of the object. If etag is not empty and the object has the same
+	// ETag, Get returns ErrNotModified.
+	Get(ctx context.Context, name, etag string) ([]byte, ObjectInfo, error)
+}
+
+// RemoteFS is an fs.FS serving the files from an ObjectStore through a local cache directory.
+// It allows updating the templates and assets in the object storage without redeploying
+// the application.
+//
+// The cache is refreshed by Sync: the changed objects are downloaded with conditional requests,
+// the deleted ones are removed. Call Sync once before serving the requests, and then either
+// periodically with Run, or on demand (e.g. on a webhook from the storage).
+type RemoteFS struct {
+	// Store is the remote object storage.
+	Store ObjectStore
+
+	// CacheDir is the local directory to cache the objects in. It must be dedicated to the
+	// RemoteFS, as the cached files are overwritten and removed by Sync.
+	CacheDir string
+
+	// RefreshInterval is the interval between the Sync calls in Run. Default is 1 minute.
+	RefreshInterval time.Duration
+
+	// Logger configures logging of the background synchronization errors in Run.
+	Logger *slog.Logger
+
+	// mu serializes Sync calls and protects etags.
+	mu sync.Mutex
+
+	// etags is the ETags of the cached objects by name.
+	etags map[string]string
+}
+
+var _ fs.FS = (*RemoteFS)(nil)
+
+// Open opens the cached file.
+func (r *RemoteFS) Open(name string) (fs.File, error) {
+	return os.DirFS(r.CacheDir).Open(name)
+}
+
+// Run calls Sync every RefreshInterval until the context is canceled. The errors are logged,
+// the stale cache is served until the next successful Sync.
+func (r *RemoteFS) Run(ctx context.Context) {
+	interval := r.RefreshInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Sync(ctx); err != nil && r.Logger != nil {
+				r.Logger.Error("Sync remote file system", "error", err)
+			}
+		}
+	}
+}
+
+// Sync updates the local cache from the Store.
+func (r *RemoteFS) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.etags == nil {
+		r.etags = make(map[string]string)
+	}
+
+	objects, err := r.Store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list objects: %w", err)
+	}
+
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		if !fs.ValidPath(obj.Name) || obj.Name == "." {
+			continue // directory markers and unsafe names
+		}
+		seen[obj.Name] = true
+
+		if etag, ok := r.etags[obj.Name]; ok && obj.ETag != "" && etag == obj.ETag {
+			continue
+		}
+		if err := r.fetch(ctx, obj.Name); err != nil {
+			return err
+		}
+	}
+
+	for name := range r.etags {
+		if seen[name] {
+			continue
+		}
+		if err := os.Remove(r.localPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", name, err)
+		}
+		delete(r.etags, name)
+	}
+	return nil
+}
+
+// fetch downloads the object into the cache unless it has not changed.
+func (r *RemoteFS) fetch(ctx context.Context, name string) error {
+	data, info, err := r.Store.Get(ctx, name, r.etags[name])
+	if errors.Is(err, ErrNotModified) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s: %w", name, err)
+	}
+
+	dst := r.localPath(name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so the requests never see a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+path.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if !info.ModTime.IsZero() {
+		_ = os.Chtimes(tmp.Name(), info.ModTime, info.ModTime)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	r.etags[name] = info.ETag
+	return nil
+}
+
+func (r *RemoteFS) localPath(name string) string {
+	return filepath.Join(r.CacheDir, filepath.FromSlash(name))
+}
@@ -0,0 +1,109 @@
+package pages
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 serves a bucket from memory, answering ListObjectsV2 and conditional GetObject calls.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	gets    int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	etag := func(data string) string { return fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(data))) }
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	if key == "" {
+		fmt.Fprint(w, `<ListBucketResult>`)
+		for k, v := range f.objects {
+			if !strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				continue
+			}
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>%s</ETag><Size>%d</Size></Contents>`, k, etag(v), len(v))
+		}
+		fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListBucketResult>`)
+		return
+	}
+
+	data, ok := f.objects[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f.gets++
+	if r.Header.Get("If-None-Match") == etag(data) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag(data))
+	fmt.Fprint(w, data)
+}
+
+func TestRemoteFS(t *testing.T) {
+	s3 := &fakeS3{objects: map[string]string{
+		"site/index.chtml":       `<c:widget></c:widget>`,
+		"site/.lib/widget.chtml": `widget v1`,
+		"site/css/app.css":       `body {}`,
+		"other/secret.txt":       `secret`,
+	}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	rfs := &RemoteFS{
+		Store:    &S3Store{BucketURL: srv.URL + "/bucket", Prefix: "site/"},
+		CacheDir: t.TempDir(),
+	}
+	if err := rfs.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{FileSystem: rfs}
+	get := func(url string) string {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		return rr.Body.String()
+	}
+
+	if got := get("/"); got != "widget v1" {
+		t.Errorf("got %q, want %q", got, "widget v1")
+	}
+	if got := get("/other/secret.txt"); got != "Not Found\n" {
+		t.Errorf("got %q, want %q", got, "Not Found\n")
+	}
+	if got := get("/css/app.css"); got != "body {}" {
+		t.Errorf("got %q, want %q", got, "body {}")
+	}
+
+	// update the template and delete the stylesheet
+	s3.mu.Lock()
+	s3.objects["site/.lib/widget.chtml"] = `widget v2`
+	delete(s3.objects, "site/css/app.css")
+	s3.gets = 0
+	s3.mu.Unlock()
+
+	if err := rfs.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := get("/"); got != "widget v2" {
+		t.Errorf("got %q, want %q", got, "widget v2")
+	}
+	if got := get("/css/app.css"); got != "Not Found\n" {
+		t.Errorf("got %q, want %q", got, "Not Found\n")
+	}
+	if s3.gets != 1 {
+		t.Errorf("got %d object downloads, want only the changed one", s3.gets)
+	}
+}
@@ -0,0 +1,282 @@
+package pages
+
+import (
+	"encoding/json"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"golang.org/x/net/html"
+)
+
+// RenderCache caches the output of the pages and the components, so the mostly static ones
+// (e.g. a header or a documentation page) are not parsed and rendered on every request.
+//
+// The output is cached per component and the arguments it is rendered with, the route parameters
+// and the locale of the request. The components depending on other request data (e.g. cookies)
+// must not be cached. The asset dependencies (see AssetDepComponent) of the cached components are
+// replayed on the cache hits, other side effects (e.g. the headers and the status code set by
+// the component) are not. The outputs rendered with errors are not cached.
+type RenderCache struct {
+	// Components is a list of path.Match patterns of the component files to cache, relative to
+	// the FileSystem root and without the .chtml extension, e.g. "components/header" or "docs/*".
+	Components []string
+
+	// TTL is the time the rendered output is cached for. Default is 1 minute.
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of the cached outputs. When the cache is full, the expired
+	// entries are removed, and then the oldest ones. Default is 1000.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*renderCacheEntry
+}
+
+type renderCacheEntry struct {
+	name    string // component name, for invalidation
+	result  any
+	assets  []AssetDep
+	expires time.Time
+}
+
+// Invalidate removes the cached outputs of the component, e.g. "components/header". If name is
+// a directory, e.g. "docs", the outputs of all components in it are removed.
+func (c *RenderCache) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name = strings.Trim(name, "/")
+	for k, e := range c.entries {
+		if e.name == name || strings.HasPrefix(e.name, name+"/") {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// InvalidateAll removes all cached outputs.
+func (c *RenderCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// caches reports whether the output of the component file p is cached. It is safe to call on nil.
+func (c *RenderCache) caches(p string) bool {
+	if c == nil {
+		return false
+	}
+	name := cacheName(p)
+	for _, pattern := range c.Components {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// component returns a component rendering the output of the component file p from the cache.
+// The load function creates the actual component on a cache miss.
+func (c *RenderCache) component(p string, load func() (chtml.Component, error)) chtml.Component {
+	return &cachedComponent{cache: c, name: cacheName(p), load: load}
+}
+
+func (c *RenderCache) get(key string) (*renderCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *RenderCache) put(key string, e *renderCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+
+	now := time.Now()
+	e.expires = now.Add(ttl)
+
+	if c.entries == nil {
+		c.entries = make(map[string]*renderCacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxEntries {
+		c.evict(now, maxEntries)
+	}
+	c.entries[key] = e
+}
+
+// evict removes the expired entries and then the entries expiring first until there is a room
+// for a new entry.
+func (c *RenderCache) evict(now time.Time, maxEntries int) {
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if len(c.entries) < maxEntries {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return c.entries[a].expires.Compare(c.entries[b].expires)
+	})
+	for _, k := range keys[:len(keys)-maxEntries+1] {
+		delete(c.entries, k)
+	}
+}
+
+// cacheName returns the name of the component file p used in the RenderCache, e.g.
+// "components/header" for "/components/header.chtml".
+func cacheName(p string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(p, "/"), chtmlExt)
+}
+
+// cachedComponent renders the component output from the RenderCache. The actual component is
+// created on the first cache miss.
+type cachedComponent struct {
+	cache *RenderCache
+	name  string
+	load  func() (chtml.Component, error)
+	comp  chtml.Component
+}
+
+var _ chtml.Component = (*cachedComponent)(nil)
+var _ chtml.Disposable = (*cachedComponent)(nil)
+
+func (cc *cachedComponent) Render(s chtml.Scope) (any, error) {
+	// the components are also rendered while parsing the importing components, such renders are
+	// not cached
+	ss, isPage := s.(*scope)
+
+	key, ok := cc.key(s)
+	ok = ok && isPage
+	if ok {
+		if e, hit := cc.cache.get(key); hit {
+			for _, dep := range e.assets {
+				ss.globals.assets.add(dep)
+			}
+			return cloneResult(e.result), nil
+		}
+	}
+
+	if cc.comp == nil {
+		comp, err := cc.load()
+		if err != nil {
+			return nil, err
+		}
+		cc.comp = comp
+	}
+
+	// capture the asset dependencies declared by the component to replay them on the cache hits
+	stop := func() []AssetDep { return nil }
+	if isPage {
+		stop = ss.globals.assets.record()
+	}
+	rr, err := cc.comp.Render(s)
+	deps := stop()
+
+	if err == nil && ok {
+		cc.cache.put(key, &renderCacheEntry{name: cc.name, result: cloneResult(rr), assets: deps})
+	}
+	return rr, err
+}
+
+func (cc *cachedComponent) Dispose() error {
+	if d, ok := cc.comp.(chtml.Disposable); ok {
+		return d.Dispose()
+	}
+	return nil
+}
+
+// key returns the cache key of the component output for the scope. It returns false if
+// the arguments can't be serialized.
+func (cc *cachedComponent) key(s chtml.Scope) (string, bool) {
+	var sb strings.Builder
+	sb.WriteString(cc.name)
+
+	writeVars := func(vars map[string]any) bool {
+		keys := make([]string, 0, len(vars))
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			sb.WriteByte(0)
+			sb.WriteString(k)
+			sb.WriteByte('=')
+			if n, ok := vars[k].(*html.Node); ok {
+				if err := html.Render(&sb, n); err != nil {
+					return false
+				}
+				continue
+			}
+			b, err := json.Marshal(vars[k])
+			if err != nil {
+				return false
+			}
+			sb.Write(b)
+		}
+		return true
+	}
+
+	if !writeVars(s.Vars()) {
+		return "", false
+	}
+	if ss, ok := s.(*scope); ok {
+		sb.WriteString("\x00\x00")
+		if !writeVars(ss.globals.route) {
+			return "", false
+		}
+		sb.WriteString("\x00\x00")
+		sb.WriteString(ss.globals.locale)
+	}
+	return sb.String(), true
+}
+
+// cloneResult returns a deep copy of the HTML output, as the nodes are modified when they are
+// added to the page. Other outputs are returned as is.
+func cloneResult(v any) any {
+	n, ok := v.(*html.Node)
+	if !ok {
+		return v
+	}
+	return cloneHTML(n)
+}
+
+func cloneHTML(n *html.Node) *html.Node {
+	c := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      slices.Clone(n.Attr),
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(cloneHTML(child))
+	}
+	return c
+}
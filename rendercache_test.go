@@ -0,0 +1,88 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// countingComponent renders the number of its renders while serving the requests.
+type countingComponent struct{ n *atomic.Int32 }
+
+func (c countingComponent) Render(s chtml.Scope) (any, error) {
+	if _, ok := s.(*scope); !ok {
+		return 0, nil // parse time
+	}
+	return c.n.Add(1), nil
+}
+
+func TestRenderCache(t *testing.T) {
+	var renders atomic.Int32
+
+	fsys := fstest.MapFS{
+		"components/header.chtml": {Data: []byte(
+			`<c:attr name="title"></c:attr><c:asset-dep href="/header.css"></c:asset-dep>` +
+				`<header>${title}:<c:count></c:count></header>`)},
+		"docs/_page.chtml": {Data: []byte(`<c:route as="r" /><p>${r.page}:<c:count></c:count></p>`)},
+		"index.chtml": {Data: []byte(
+			`<html><head></head><body><c:header title="Home"></c:header>` +
+				`<c:header title="Home"></c:header><main><c:count></c:count></main></body></html>`)},
+	}
+
+	cache := &RenderCache{Components: []string{"components/*", "docs/*"}}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"count":     countingComponent{&renders},
+			"route":     RouteComponent{},
+			"asset-dep": AssetDepComponent{},
+		},
+		ComponentSearchPath: []string{".", "/components"},
+		Cache:               cache,
+	}
+
+	get := func(url string) string {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		return rr.Body.String()
+	}
+
+	want := `<html><head><link rel="stylesheet" href="/header.css"/></head><body>` +
+		`<header>Home:1</header><header>Home:1</header><main>2</main></body></html>`
+	if got := get("/"); got != want {
+		t.Fatalf("first render:\ngot  %s\nwant %s", got, want)
+	}
+
+	want = strings.ReplaceAll(want, "<main>2</main>", "<main>3</main>")
+	if got := get("/"); got != want {
+		t.Errorf("cached render:\ngot  %s\nwant %s", got, want)
+	}
+
+	cache.Invalidate("components")
+	want = strings.ReplaceAll(want, "Home:1", "Home:4")
+	want = strings.ReplaceAll(want, "<main>3</main>", "<main>5</main>")
+	if got := get("/"); got != want {
+		t.Errorf("invalidated render:\ngot  %s\nwant %s", got, want)
+	}
+
+	// pages are cached by the route parameters
+	renders.Store(0)
+	for _, tt := range []struct{ url, want string }{
+		{"/docs/a", "<p>a:1</p>"},
+		{"/docs/b", "<p>b:2</p>"},
+		{"/docs/a", "<p>a:1</p>"},
+	} {
+		if got := get(tt.url); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.url, got, tt.want)
+		}
+	}
+
+	cache.InvalidateAll()
+	if got := get("/docs/a"); got != "<p>a:3</p>" {
+		t.Errorf("after InvalidateAll: got %s", got)
+	}
+}
@@ -7,7 +7,7 @@ type RequestComponent struct{}
 func (rc RequestComponent) Render(s chtml.Scope) (any, error) {
 	rr := &RequestArg{}
 	if v, ok := s.(*scope); ok {
-		rr = NewRequestArg(v.globals.req)
+		rr = v.requestArg()
 	}
 	return rr, nil
 }
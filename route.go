@@ -1,13 +1,293 @@
 package pages
 
-import "github.com/dpotapov/go-pages/chtml"
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// RouteComponent returns the parameters of the matched route. The typed parameters (see
+// dynamicParam) are converted to the declared types. For catch-all routes, the remaining
+// path is available both as a raw string (NAME) and as an array of segments (NAME_segments).
 type RouteComponent struct{}
 
 func (rc RouteComponent) Render(s chtml.Scope) (any, error) {
-	rr := map[string]string{}
+	rr := map[string]any{}
 	if v, ok := s.(*scope); ok {
-		rr = v.globals.route
+		for k, p := range v.globals.route {
+			rr[k] = p
+		}
+		if ca := v.globals.catchAll; ca != "" {
+			p, _ := v.globals.route[ca].(string)
+			rr[ca+"_segments"] = splitSegments(p)
+		}
 	}
 	return rr, nil
 }
+
+// routeParamTypes is a set of the types supported in the dynamic route names.
+var routeParamTypes = map[string]func(string) (any, error){
+	"string": func(s string) (any, error) { return s, nil },
+	"int": func(s string) (any, error) {
+		return strconv.Atoi(s)
+	},
+	"number": func(s string) (any, error) {
+		return strconv.ParseFloat(s, 64)
+	},
+	"bool": func(s string) (any, error) {
+		return strconv.ParseBool(s)
+	},
+}
+
+// dynamicParam parses the name of a dynamic route file or directory (without the leading
+// underscore and the extension) into the parameter name and type. The type is optional and
+// given in square brackets, e.g. "id[int]". The default type is "string".
+func dynamicParam(name string) (param, typ string, err error) {
+	param, typ = name, "string"
+	if i := strings.IndexByte(name, '['); i >= 0 && strings.HasSuffix(name, "]") {
+		param, typ = name[:i], name[i+1:len(name)-1]
+	}
+	if !validIdentifierRegex.MatchString(param) {
+		return "", "", fmt.Errorf("invalid parameter name %q", param)
+	}
+	if _, ok := routeParamTypes[typ]; !ok {
+		return "", "", fmt.Errorf("unknown type %q of parameter %s", typ, param)
+	}
+	return param, typ, nil
+}
+
+// matchParam converts the URL segment to the type of the dynamic route parameter and stores it
+// in params. It returns false if the segment is not a valid value of the type.
+func matchParam(name, seg, dir string, params map[string]any) (bool, error) {
+	param, typ, err := dynamicParam(name)
+	if err != nil {
+		return false, fmt.Errorf("invalid dynamic match in %s: %w", dir, err)
+	}
+	if _, ok := params[param]; ok {
+		return false, fmt.Errorf("duplicate dynamic match in %s", dir)
+	}
+	v, err := routeParamTypes[typ](seg)
+	if err != nil {
+		return false, nil
+	}
+	params[param] = v
+	return true, nil
+}
+
+// Route is a page route of the Handler, see Handler.Routes.
+type Route struct {
+	// Page is the path to the page in the FileSystem, e.g. "users/_id[int]/profile.chtml".
+	Page string
+
+	// Pattern is the URL path pattern of the route in the syntax of http.ServeMux, e.g.
+	// "/users/{id}/profile". A catch-all parameter is matched by "{NAME...}", the index pages by
+	// the patterns with the trailing slash, e.g. "/users/{id}/".
+	Pattern string
+
+	// Params are the names of the route parameters in the order of the URL segments.
+	Params []string
+
+	// Method is the HTTP method handled by a method-specific page, e.g. "POST" for
+	// "contact.post.chtml", or the empty string if the page handles any method.
+	Method string
+}
+
+// Routes returns the routes of the pages in the FileSystem sorted by the path to the page.
+// The hidden files and directories (e.g. .lib with the components), the layouts and the drafts
+// (unless ShowDrafts is set) are not routable.
+func (h *Handler) Routes() ([]Route, error) {
+	pages, _, err := h.pageFiles()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]Route, 0, len(pages))
+	for _, p := range pages {
+		routes = append(routes, newRoute(p))
+	}
+	return routes, nil
+}
+
+func newRoute(page string) Route {
+	r := Route{Page: page, Method: pageMethod(path.Base(page))}
+	segs := strings.Split(page, "/")
+	last := len(segs) - 1
+	for i, seg := range segs {
+		name, _, catchAll, ok := routeParam(seg, i == last)
+		switch {
+		case catchAll:
+			segs[i] = "{" + name + "...}"
+		case ok:
+			segs[i] = "{" + name + "}"
+		case i == last:
+			segs[i] = indexSegment(seg)
+		}
+		if ok {
+			r.Params = append(r.Params, name)
+		}
+	}
+	r.Pattern = "/" + strings.Join(segs, "/")
+	return r
+}
+
+// URLFor returns the URL path of the page with the route parameters, e.g. "/users/5/profile"
+// for "users/_id[int]/profile" and {"id": 5}. The page is the path to the page in the FileSystem,
+// the extension and the method suffix are optional, e.g. "contact" for "contact.post.chtml".
+// The parameters are formatted with fmt.Sprint, and the parameters
+// other than the route ones are added to the query string. An error is returned if the page
+// does not exist or a route parameter is missing or invalid.
+//
+// The function is available in the expressions of the components as urlFor, unless
+// TemplateFuncs declares another function with this name:
+//
+//	<a href="${urlFor('users/_id[int]/profile', {'id': user.id})}">Profile</a>
+func (h *Handler) URLFor(page string, params map[string]any) (string, error) {
+	page = strings.TrimPrefix(path.Clean("/"+page), "/")
+	if !strings.HasSuffix(page, chtmlExt) {
+		page += chtmlExt
+	}
+	if path.Base(page) == layoutFile || strings.HasPrefix(page, ".") || strings.Contains(page, "/.") {
+		return "", fmt.Errorf("url for %s: not a page", page)
+	}
+	if _, err := fs.Stat(h.FileSystem, page); err != nil {
+		if !h.hasPage(page) {
+			return "", fmt.Errorf("url for %s: %w", page, err)
+		}
+	}
+
+	values := make(map[string]string, len(params))
+	for k, v := range params {
+		values[k] = fmt.Sprint(v)
+	}
+	if err := checkRouteParams(page, values); err != nil {
+		return "", fmt.Errorf("url for %s: %w", page, err)
+	}
+
+	u := routeURL(page, values)
+	segs := strings.Split(page, "/")
+	for i, seg := range segs {
+		if name, _, _, ok := routeParam(seg, i == len(segs)-1); ok {
+			delete(values, name)
+		}
+	}
+	if len(values) > 0 {
+		q := url.Values{}
+		for k, v := range values {
+			q.Set(k, v)
+		}
+		u += "?" + q.Encode()
+	}
+	return u, nil
+}
+
+// hasPage reports whether the FileSystem has a page of the route of the page file, i.e. a draft
+// (if ShowDrafts is set) or a method-specific page with the same name.
+func (h *Handler) hasPage(page string) bool {
+	entries, err := fs.ReadDir(h.FileSystem, path.Dir(page))
+	if err != nil {
+		return false
+	}
+	base, _ := pageName(path.Base(page))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != chtmlExt {
+			continue
+		}
+		if b, draft := pageName(name); b == base && (!draft || h.ShowDrafts) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDynamicRoute reports whether the path to the page has dynamic or catch-all segments.
+func isDynamicRoute(route string) bool {
+	segs := strings.Split(route, "/")
+	for i, seg := range segs {
+		if _, _, _, ok := routeParam(seg, i == len(segs)-1); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// routeParam parses a segment of the path to a page, the file name if file is set, or
+// a directory name. It returns the name and the type of the route parameter of a dynamic or
+// catch-all segment, and false for a static one.
+func routeParam(seg string, file bool) (name, typ string, catchAll, ok bool) {
+	if file {
+		seg, _ = pageName(seg)
+		if strings.HasPrefix(seg, "__") && len(seg) > 2 {
+			return seg[2:], "string", true, true
+		}
+	}
+	if len(seg) < 2 || seg[0] != '_' {
+		return "", "", false, false
+	}
+	name, typ, err := dynamicParam(seg[1:])
+	if err != nil {
+		return "", "", false, false // never matched
+	}
+	return name, typ, false, true
+}
+
+// checkRouteParams checks that the parameters of the dynamic route are set and valid.
+func checkRouteParams(route string, params map[string]string) error {
+	segs := strings.Split(route, "/")
+	for i, seg := range segs {
+		name, typ, catchAll, ok := routeParam(seg, i == len(segs)-1)
+		if !ok {
+			continue
+		}
+		v, ok := params[name]
+		if !ok {
+			return fmt.Errorf("missing route parameter %s", name)
+		}
+		if catchAll {
+			continue
+		}
+		if v == "" || strings.Contains(v, "/") {
+			return fmt.Errorf("invalid value %q of route parameter %s", v, name)
+		}
+		if _, err := routeParamTypes[typ](v); err != nil {
+			return fmt.Errorf("invalid value %q of route parameter %s: %w", v, name, err)
+		}
+	}
+	return nil
+}
+
+// routeURL returns the URL path of the page with the route parameters, e.g. "/posts/hello" for
+// "posts/_slug.chtml" and {"slug": "hello"}. The index pages have the trailing slash.
+func routeURL(route string, params map[string]string) string {
+	segs := strings.Split(route, "/")
+	last := len(segs) - 1
+	for i, seg := range segs {
+		name, _, catchAll, ok := routeParam(seg, i == last)
+		switch {
+		case catchAll:
+			parts := strings.Split(params[name], "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segs[i] = strings.Join(parts, "/")
+		case ok:
+			segs[i] = url.PathEscape(params[name])
+		case i == last:
+			segs[i] = indexSegment(seg)
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// indexSegment returns the last URL segment of the static page file, empty for the index pages.
+func indexSegment(file string) string {
+	name, _ := pageName(file)
+	if name == "index" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPages_Routes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":                  {Data: []byte(``)},
+		"about.draft.chtml":            {Data: []byte(``)},
+		"_layout.chtml":                {Data: []byte(``)},
+		"_user/index.chtml":            {Data: []byte(``)},
+		"users/_id[int]/profile.chtml": {Data: []byte(``)},
+		"docs/__path.chtml":            {Data: []byte(``)},
+		"css/app.css":                  {Data: []byte(``)},
+		".lib/card.chtml":              {Data: []byte(``)},
+		"contact.post.chtml":           {Data: []byte(``)},
+	}
+	h := &Handler{FileSystem: fsys}
+
+	routes, err := h.Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Route{
+		{Page: "_user/index.chtml", Pattern: "/{user}/", Params: []string{"user"}},
+		{Page: "contact.post.chtml", Pattern: "/contact", Method: "POST"},
+		{Page: "docs/__path.chtml", Pattern: "/docs/{path...}", Params: []string{"path"}},
+		{Page: "index.chtml", Pattern: "/"},
+		{Page: "users/_id[int]/profile.chtml", Pattern: "/users/{id}/profile", Params: []string{"id"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("routes:\ngot  %+v\nwant %+v", routes, want)
+	}
+
+	h = &Handler{FileSystem: fsys, ShowDrafts: true}
+	routes, err = h.Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 6 || routes[1].Pattern != "/about" {
+		t.Errorf("routes with drafts: %+v", routes)
+	}
+}
+
+func TestPages_URLFor(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml":                  {Data: []byte(`<a href="${urlFor('users/_id[int]/profile', {'id': 5})}"></a>`)},
+		"_layout.chtml":                {Data: []byte(`${_}`)},
+		"users/_id[int]/profile.chtml": {Data: []byte(``)},
+		"docs/__path.chtml":            {Data: []byte(``)},
+		"blog/index.chtml":             {Data: []byte(``)},
+		"contact.post.chtml":           {Data: []byte(``)},
+	}
+	h := &Handler{FileSystem: fsys}
+
+	tests := []struct {
+		page    string
+		params  map[string]any
+		want    string
+		wantErr string
+	}{
+		{"index", nil, "/", ""},
+		{"/blog/index.chtml", nil, "/blog/", ""},
+		{"contact", nil, "/contact", ""},
+		{"users/_id[int]/profile", map[string]any{"id": 5, "tab": "a b"}, "/users/5/profile?tab=a+b", ""},
+		{"docs/__path", map[string]any{"path": "guide/intro"}, "/docs/guide/intro", ""},
+		{"users/_id[int]/profile", nil, "", "missing route parameter id"},
+		{"users/_id[int]/profile", map[string]any{"id": "joe"}, "", `invalid value "joe"`},
+		{"missing", nil, "", "file does not exist"},
+		{"_layout", nil, "", "not a page"},
+	}
+	for _, tt := range tests {
+		got, err := h.URLFor(tt.page, tt.params)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("URLFor(%q): got error %v, want %q", tt.page, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("URLFor(%q) = %q, %v, want %q", tt.page, got, err, tt.want)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if got, want := rr.Body.String(), `<a href="/users/5/profile"></a>`; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
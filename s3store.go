@@ -0,0 +1,141 @@
+package pages
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Store is an ObjectStore for S3-compatible storages (AWS S3, MinIO, R2, etc.) using
+// the ListObjectsV2 and GetObject REST API calls.
+//
+// The requests are not signed. To access a private bucket, set the Client with a transport
+// signing the requests (e.g. with AWS Signature Version 4).
+type S3Store struct {
+	// BucketURL is the URL of the bucket in the path-style (https://s3.REGION.amazonaws.com/BUCKET)
+	// or virtual-hosted-style (https://BUCKET.s3.REGION.amazonaws.com) form.
+	BucketURL string
+
+	// Prefix is an optional key prefix (e.g. "site/") of the objects to serve. The prefix is
+	// removed from the object names.
+	Prefix string
+
+	// Client is the HTTP client to make the requests with. Default is http.DefaultClient.
+	Client *http.Client
+}
+
+var _ ObjectStore = (*S3Store)(nil)
+
+// listBucketResult is the response of the ListObjectsV2 call.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns all objects under the Prefix.
+func (s *S3Store) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}}
+		if s.Prefix != "" {
+			q.Set("prefix", s.Prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, strings.TrimSuffix(s.BucketURL, "/")+"/?"+q.Encode(), "")
+		if err != nil {
+			return nil, err
+		}
+		var res listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode list response: %w", err)
+		}
+
+		for _, c := range res.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue // directory marker
+			}
+			objects = append(objects, ObjectInfo{
+				Name:    strings.TrimPrefix(c.Key, s.Prefix),
+				ETag:    c.ETag,
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// Get downloads the object. The etag is sent in the If-None-Match header.
+func (s *S3Store) Get(ctx context.Context, name, etag string) ([]byte, ObjectInfo, error) {
+	info := ObjectInfo{Name: name}
+
+	u := strings.TrimSuffix(s.BucketURL, "/") + "/" + (&url.URL{Path: s.Prefix + name}).EscapedPath()
+	resp, err := s.do(ctx, u, etag)
+	if err != nil {
+		return nil, info, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, info, ErrNotModified
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, info, fmt.Errorf("read object: %w", err)
+	}
+
+	info.ETag = resp.Header.Get("ETag")
+	info.Size = int64(len(data))
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return data, info, nil
+}
+
+// do sends a GET request and checks the response status.
+func (s *S3Store) do(ctx context.Context, u, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("make request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
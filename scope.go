@@ -1,7 +1,10 @@
 package pages
 
 import (
+	"context"
+	"io/fs"
 	"net/http"
+	"sync"
 
 	"github.com/dpotapov/go-pages/chtml"
 )
@@ -14,14 +17,43 @@ type scope struct {
 
 type scopeGlobals struct {
 	req        *http.Request
-	route      map[string]string
+	ctx        context.Context // canceled when the page is not rendered anymore, nil for req.Context()
+	route      map[string]any
+	catchAll   string // name of the catch-all route parameter, if any
 	statusCode int
 	header     http.Header
+	arena      *chtml.Arena
+	renderCtx  *chtml.RenderContext
+	assets     *assetRegistry
+	cacheCtl   *cachePolicy
+	secHeaders *secHeaderOverrides
+	fsys       fs.FS  // file system of the page
+	locale     string // locale of the request, see Handler.LocaleSelector
+	errCtx     *ErrorContext
+	layout     *string        // layout selected by the page, see LayoutComponent
+	slots      map[string]any // content of the layout slots, see SlotComponent
+	session    *Session       // nil if the Handler has no SessionStore
+	versions   *dataVersions  // nil if the data versions are not collected, see VersionCollector
+	outputETag string         // ETag of the rendered output, see Handler.OutputETags
+
+	// transform returns the content of a static file as it is served, see Handler.AssetTransformers.
+	transform func(name string, data []byte) []byte
+
+	// reqArg is the request model, created on demand as the request body can be read only once.
+	reqArg     *RequestArg
+	reqArgOnce sync.Once
 }
 
 var _ chtml.Scope = (*scope)(nil)
+var _ chtml.ArenaScope = (*scope)(nil)
+var _ chtml.RenderContextScope = (*scope)(nil)
+var _ chtml.ScopeWithContext = (*scope)(nil)
+var _ AssetCollector = (*scope)(nil)
+var _ VersionCollector = (*scope)(nil)
+var _ chtml.EnvProvider = (*scope)(nil)
+var _ chtml.FunctionProvider = (*scope)(nil)
 
-func newScope(vars map[string]any, req *http.Request, route map[string]string) *scope {
+func newScope(vars map[string]any, req *http.Request, route map[string]any) *scope {
 	return &scope{
 		BaseScope: chtml.NewBaseScope(vars),
 		globals: &scopeGlobals{
@@ -29,6 +61,9 @@ func newScope(vars map[string]any, req *http.Request, route map[string]string) *
 			route:      route,
 			statusCode: 0,
 			header:     make(http.Header),
+			assets:     &assetRegistry{},
+			cacheCtl:   &cachePolicy{},
+			secHeaders: &secHeaderOverrides{},
 		},
 	}
 }
@@ -39,3 +74,68 @@ func (s *scope) Spawn(vars map[string]any) chtml.Scope {
 		globals:   s.globals,
 	}
 }
+
+// Arena returns the per-request arena or nil if it is not enabled.
+func (s *scope) Arena() *chtml.Arena {
+	return s.globals.arena
+}
+
+// RenderContext returns the render context of the page or nil if the scope is not created for
+// a page request.
+func (s *scope) RenderContext() *chtml.RenderContext {
+	return s.globals.renderCtx
+}
+
+// Context returns the context of the page request. It is canceled when the client disconnects or
+// the page is not going to be rendered anymore, e.g. the WebSocket connection is closed.
+func (s *scope) Context() context.Context {
+	if s.globals.ctx != nil {
+		return s.globals.ctx
+	}
+	if s.globals.req != nil {
+		return s.globals.req.Context()
+	}
+	return context.Background()
+}
+
+// EnvNames returns the names of the variables provided to the pages: "session" if the Handler
+// has a SessionStore.
+func (s *scope) EnvNames() []string {
+	if s.globals.session != nil {
+		return []string{"session"}
+	}
+	return nil
+}
+
+// LookupEnv returns the values of the variables listed by EnvNames.
+func (s *scope) LookupEnv(name string) (any, bool, error) {
+	if name == "session" && s.globals.session != nil {
+		return s.globals.session.Values(), true, nil
+	}
+	return nil, false, nil
+}
+
+// LookupFunction returns the functions of the expressions bound to the page, see responseFuncs.
+func (s *scope) LookupFunction(name string) (any, bool) {
+	rf := responseFuncs{globals: s.globals}
+	switch name {
+	case "setStatus":
+		return rf.setStatus, true
+	case "setHeader":
+		return rf.setHeader, true
+	}
+	return nil, false
+}
+
+// AddAsset adds the asset dependency to the page, see AssetDepComponent.
+func (s *scope) AddAsset(dep AssetDep) {
+	s.globals.assets.add(dep)
+}
+
+// requestArg returns the model of the page request. The request body is parsed only once.
+func (s *scope) requestArg() *RequestArg {
+	s.globals.reqArgOnce.Do(func() {
+		s.globals.reqArg = NewRequestArg(s.globals.req)
+	})
+	return s.globals.reqArg
+}
@@ -0,0 +1,153 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// SecurityHeaders is a set of security-related response headers sent with the pages and
+// the files served by the Handler. Empty fields are not sent.
+type SecurityHeaders struct {
+	// ContentTypeOptions is the X-Content-Type-Options header, e.g. "nosniff".
+	ContentTypeOptions string
+
+	// ReferrerPolicy is the Referrer-Policy header, e.g. "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+
+	// FrameOptions is the X-Frame-Options header, e.g. "DENY" or "SAMEORIGIN".
+	FrameOptions string
+
+	// FrameAncestors is the value of the frame-ancestors directive sent in
+	// the Content-Security-Policy header, e.g. "'self'" or "'self' https://partner.example.com".
+	FrameAncestors string
+
+	// PermissionsPolicy is the Permissions-Policy header, e.g. "camera=(), microphone=()".
+	PermissionsPolicy string
+
+	// HSTS is the Strict-Transport-Security header, e.g. "max-age=63072000; includeSubDomains".
+	// It is sent only with the responses to the HTTPS requests (including the requests
+	// forwarded by a proxy with "X-Forwarded-Proto: https").
+	HSTS string
+}
+
+// DefaultSecurityHeaders is a conservative set of the security headers suitable for most sites.
+var DefaultSecurityHeaders = SecurityHeaders{
+	ContentTypeOptions: "nosniff",
+	ReferrerPolicy:     "strict-origin-when-cross-origin",
+	FrameOptions:       "SAMEORIGIN",
+	FrameAncestors:     "'self'",
+	HSTS:               "max-age=63072000; includeSubDomains",
+}
+
+// securityHeaderNames maps the arguments of SecurityHeadersComponent to the header names.
+var securityHeaderNames = map[string]string{
+	"content_type_options": "X-Content-Type-Options",
+	"referrer_policy":      "Referrer-Policy",
+	"frame_options":        "X-Frame-Options",
+	"frame_ancestors":      "Content-Security-Policy",
+	"permissions_policy":   "Permissions-Policy",
+	"hsts":                 "Strict-Transport-Security",
+}
+
+// header returns the headers to send with the response to r.
+func (sh *SecurityHeaders) header(r *http.Request) http.Header {
+	h := make(http.Header)
+	set := func(name, v string) {
+		if v != "" {
+			h.Set(name, v)
+		}
+	}
+	set("X-Content-Type-Options", sh.ContentTypeOptions)
+	set("Referrer-Policy", sh.ReferrerPolicy)
+	set("X-Frame-Options", sh.FrameOptions)
+	if sh.FrameAncestors != "" {
+		h.Set("Content-Security-Policy", "frame-ancestors "+sh.FrameAncestors)
+	}
+	set("Permissions-Policy", sh.PermissionsPolicy)
+	if isHTTPS(r) {
+		set("Strict-Transport-Security", sh.HSTS)
+	}
+	return h
+}
+
+// isHTTPS reports whether the request was made over HTTPS, directly or through a proxy.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// SecurityHeadersComponent overrides the security headers (see Handler.SecurityHeaders) for
+// the page it is rendered in, e.g. to allow embedding a widget page into the partner sites:
+//
+//	<c:security-headers frame-options="" frame-ancestors="https://partner.example.com"></c:security-headers>
+//
+// The arguments have the names of the SecurityHeaders fields in kebab-case. An empty value
+// removes the header. The component renders nothing.
+type SecurityHeadersComponent struct{}
+
+var _ chtml.Component = SecurityHeadersComponent{}
+
+func (sc SecurityHeadersComponent) Render(s chtml.Scope) (any, error) {
+	overrides := make(map[string]string)
+	for k, v := range s.Vars() {
+		name, ok := securityHeaderNames[strings.ReplaceAll(strings.ToLower(k), "-", "_")]
+		if !ok {
+			return nil, &chtml.UnrecognizedArgumentError{Name: k}
+		}
+		str, ok := v.(string)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("argument %q must be a string, got %T", k, v)
+		}
+		if name == "Content-Security-Policy" && str != "" {
+			str = "frame-ancestors " + str
+		}
+		overrides[name] = str
+	}
+
+	if ss, ok := s.(*scope); ok {
+		ss.globals.secHeaders.add(overrides)
+	}
+	return nil, nil
+}
+
+// secHeaderOverrides collects the security header overrides declared during a render pass.
+type secHeaderOverrides struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (o *secHeaderOverrides) add(overrides map[string]string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.m == nil {
+		o.m = make(map[string]string)
+	}
+	for k, v := range overrides {
+		o.m[k] = v
+	}
+}
+
+// reset clears the overrides before a new render pass.
+func (o *secHeaderOverrides) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.m = nil
+}
+
+// apply replaces the headers with the overrides.
+func (o *secHeaderOverrides) apply(h http.Header) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for k, v := range o.m {
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<p>index</p>`)},
+		"widget.chtml": {Data: []byte(
+			`<c:security-headers frame-options="" frame-ancestors="https://partner.example.com"></c:security-headers><p>widget</p>`)},
+		"app.js": {Data: []byte(`console.log(1)`)},
+	}
+
+	h := &Handler{
+		FileSystem:        fsys,
+		BuiltinComponents: map[string]chtml.Component{"security-headers": SecurityHeadersComponent{}},
+		SecurityHeaders:   &DefaultSecurityHeaders,
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		https bool
+		want  map[string]string
+	}{
+		{
+			name: "page",
+			url:  "/",
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Content-Security-Policy":   "frame-ancestors 'self'",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name:  "https",
+			url:   "/",
+			https: true,
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+			},
+		},
+		{
+			name: "asset",
+			url:  "/app.js",
+			want: map[string]string{
+				"X-Content-Type-Options": "nosniff",
+				"X-Frame-Options":        "SAMEORIGIN",
+			},
+		},
+		{
+			name: "override",
+			url:  "/widget",
+			want: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "",
+				"Content-Security-Policy": "frame-ancestors https://partner.example.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.https {
+				req.Header.Set("X-Forwarded-Proto", "https")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			for k, want := range tt.want {
+				if got := rr.Header().Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		(&Handler{FileSystem: fsys}).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if got := rr.Header().Get("X-Content-Type-Options"); got != "" {
+			t.Errorf("X-Content-Type-Options = %q, want none", got)
+		}
+	})
+}
@@ -0,0 +1,417 @@
+package pages
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// defaultSessionTTL is the default lifetime of a session since the last change.
+const defaultSessionTTL = 24 * time.Hour
+
+// defaultSessionCookie is the default name of the session cookie.
+const defaultSessionCookie = "pages_sid"
+
+// maxCookieSize is the maximum size of a cookie value supported by the browsers.
+const maxCookieSize = 4096
+
+// SessionStore loads and saves the per-user state carried between requests (see
+// Handler.Sessions). The values must be JSON-encodable.
+type SessionStore interface {
+	// Load returns the session values of the request, or nil if there is no session.
+	Load(r *http.Request) (map[string]any, error)
+
+	// Save stores the session values and adds the headers (e.g. Set-Cookie) to the response
+	// header h. Empty values end the session.
+	Save(h http.Header, r *http.Request, values map[string]any) error
+}
+
+// SessionRegenerator is implemented by the SessionStore which can move a session to a new ID,
+// see Session.Regenerate.
+type SessionRegenerator interface {
+	// Regenerate is like Save, but stores the values under a new session ID and ends the session
+	// of the request.
+	Regenerate(h http.Header, r *http.Request, values map[string]any) error
+}
+
+// Session is the session of a page request. The pages read the session values with the
+// ${session} variable, and change them with SessionComponent. The components written in Go
+// use SessionFromScope. The changes are saved before the response headers are sent.
+type Session struct {
+	mu         sync.Mutex
+	values     map[string]any
+	changed    bool
+	regenerate bool
+
+	store  SessionStore
+	logger *slog.Logger
+}
+
+// SessionFromScope returns the session of the page request, or nil if the Handler has no
+// SessionStore or the scope is not a page request scope (e.g. when the component is rendered
+// at parse time).
+func SessionFromScope(s chtml.Scope) *Session {
+	if ss, ok := s.(*scope); ok {
+		return ss.globals.session
+	}
+	return nil
+}
+
+// Get returns the session value by key or nil.
+func (s *Session) Get(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set sets the session value. A nil value deletes the key.
+func (s *Session) Set(key string, v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v == nil {
+		delete(s.values, key)
+	} else {
+		if s.values == nil {
+			s.values = map[string]any{}
+		}
+		s.values[key] = v
+	}
+	s.changed = true
+}
+
+// Clear deletes all session values, ending the session.
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = nil
+	s.changed = true
+}
+
+// Regenerate moves the session to a new ID when it is saved, if the SessionStore implements
+// SessionRegenerator. Call it when the privileges of the user change, e.g. on login, so a
+// session ID planted by an attacker before (session fixation) is not authenticated.
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regenerate = true
+	s.changed = true
+}
+
+// Values returns a copy of the session values.
+func (s *Session) Values() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := maps.Clone(s.values)
+	if v == nil {
+		v = map[string]any{}
+	}
+	return v
+}
+
+// save saves the changed session to the store. The errors are logged, as the page has been
+// rendered already.
+func (s *Session) save(h http.Header, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.changed {
+		return
+	}
+	s.changed = false
+
+	var err error
+	if rs, ok := s.store.(SessionRegenerator); ok && s.regenerate {
+		err = rs.Regenerate(h, r, s.values)
+	} else {
+		err = s.store.Save(h, r, s.values)
+	}
+	s.regenerate = false
+	if err != nil {
+		s.logger.Error("Save session", "error", err)
+	}
+}
+
+// SessionComponent sets the session values from its arguments, e.g.:
+//
+//	<c:session user_id="${user.sub}" cart="${nil}"></c:session>
+//
+// A nil value deletes the key. The component returns the session values, so it can be used
+// with "as" to read the session too. The component is opt-in:
+//
+//	handler.BuiltinComponents["session"] = pages.SessionComponent{RegenerateOn: []string{"user_id"}}
+type SessionComponent struct {
+	// RegenerateOn is the list of the keys (e.g. the ID of the signed-in user) whose change
+	// regenerates the session ID, see Session.Regenerate.
+	RegenerateOn []string
+}
+
+var _ chtml.Component = SessionComponent{}
+
+func (c SessionComponent) Render(s chtml.Scope) (any, error) {
+	sess := SessionFromScope(s)
+	if sess == nil {
+		if _, ok := s.(*scope); ok {
+			return nil, errors.New("session store is not configured")
+		}
+		return map[string]any{}, nil
+	}
+	for k, v := range s.Vars() {
+		if k == "_" {
+			continue
+		}
+		if slices.Contains(c.RegenerateOn, k) && !reflect.DeepEqual(sess.Get(k), v) {
+			sess.Regenerate()
+		}
+		sess.Set(k, v)
+	}
+	return sess.Values(), nil
+}
+
+// CookieSessionStore keeps the session values in a signed cookie. The values are not encrypted,
+// so they are readable by the client, and the size of the encoded values is limited to 4 KiB.
+// The values are decoded from JSON, i.e. the numbers are float64.
+type CookieSessionStore struct {
+	// Key is the secret key signing the cookie. It must be at least 32 bytes long.
+	Key []byte
+
+	// CookieName is the name of the cookie. Default is "pages_sid".
+	CookieName string
+
+	// TTL is the lifetime of the session since the last change. Default is 24 hours.
+	TTL time.Duration
+}
+
+var _ SessionStore = (*CookieSessionStore)(nil)
+var _ SessionRegenerator = (*CookieSessionStore)(nil)
+
+type cookieSession struct {
+	Values  map[string]any `json:"v"`
+	Expires int64          `json:"e"`
+}
+
+func (cs *CookieSessionStore) Load(r *http.Request) (map[string]any, error) {
+	if len(cs.Key) < 32 {
+		return nil, errors.New("session key must be at least 32 bytes long")
+	}
+	c, err := r.Cookie(cookieName(cs.CookieName))
+	if err != nil {
+		return nil, nil
+	}
+	var sess cookieSession
+	if err := verifyValue(cs.Key, purposeCookieSession, c.Value, &sess); err != nil || time.Now().Unix() > sess.Expires {
+		return nil, nil // a forged or expired session is no session
+	}
+	return sess.Values, nil
+}
+
+func (cs *CookieSessionStore) Save(h http.Header, r *http.Request, values map[string]any) error {
+	if len(cs.Key) < 32 {
+		return errors.New("session key must be at least 32 bytes long")
+	}
+	name := cookieName(cs.CookieName)
+	if len(values) == 0 {
+		h.Add("Set-Cookie", newCookie(r, name, "", -1).String())
+		return nil
+	}
+
+	ttl := sessionTTL(cs.TTL)
+	value, err := signValue(cs.Key, purposeCookieSession, cookieSession{Values: values, Expires: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	if len(value) > maxCookieSize {
+		return fmt.Errorf("session is too large for a cookie: %d bytes", len(value))
+	}
+	h.Add("Set-Cookie", newCookie(r, name, value, int(ttl.Seconds())).String())
+	return nil
+}
+
+// Regenerate saves the values. The cookie sessions have no ID to fix: the values are kept in the
+// cookie, so a cookie planted by an attacker is replaced by the one with the new values.
+func (cs *CookieSessionStore) Regenerate(h http.Header, r *http.Request, values map[string]any) error {
+	return cs.Save(h, r, values)
+}
+
+// MemorySessionStore keeps the session values in memory, identified by a random ID in a cookie.
+// The sessions are lost when the process exits and are not shared between the instances of
+// the application, so it is mostly useful for development and single-instance deployments.
+type MemorySessionStore struct {
+	// CookieName is the name of the cookie. Default is "pages_sid".
+	CookieName string
+
+	// TTL is the lifetime of the session since the last change. Default is 24 hours.
+	TTL time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+var _ SessionRegenerator = (*MemorySessionStore)(nil)
+
+type memorySession struct {
+	values  map[string]any
+	expires time.Time
+}
+
+func (ms *MemorySessionStore) Load(r *http.Request) (map[string]any, error) {
+	c, err := r.Cookie(cookieName(ms.CookieName))
+	if err != nil {
+		return nil, nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sess, ok := ms.sessions[c.Value]
+	if !ok || time.Now().After(sess.expires) {
+		return nil, nil
+	}
+	return maps.Clone(sess.values), nil
+}
+
+func (ms *MemorySessionStore) Save(h http.Header, r *http.Request, values map[string]any) error {
+	return ms.save(h, r, values, false)
+}
+
+// Regenerate saves the values under a new random ID, deleting the session of the request.
+func (ms *MemorySessionStore) Regenerate(h http.Header, r *http.Request, values map[string]any) error {
+	return ms.save(h, r, values, true)
+}
+
+func (ms *MemorySessionStore) save(h http.Header, r *http.Request, values map[string]any, regenerate bool) error {
+	name := cookieName(ms.CookieName)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id := ""
+	if c, err := r.Cookie(name); err == nil {
+		if _, ok := ms.sessions[c.Value]; ok {
+			id = c.Value
+		}
+	}
+
+	if len(values) == 0 {
+		delete(ms.sessions, id)
+		h.Add("Set-Cookie", newCookie(r, name, "", -1).String())
+		return nil
+	}
+	if regenerate {
+		delete(ms.sessions, id)
+		id = ""
+	}
+
+	now := time.Now()
+	if ms.sessions == nil {
+		ms.sessions = map[string]memorySession{}
+	}
+	maps.DeleteFunc(ms.sessions, func(_ string, s memorySession) bool { return now.After(s.expires) })
+
+	if id == "" {
+		id = randomToken()
+	}
+	ttl := sessionTTL(ms.TTL)
+	ms.sessions[id] = memorySession{values: maps.Clone(values), expires: now.Add(ttl)}
+	h.Add("Set-Cookie", newCookie(r, name, id, int(ttl.Seconds())).String())
+	return nil
+}
+
+func cookieName(name string) string {
+	if name != "" {
+		return name
+	}
+	return defaultSessionCookie
+}
+
+func sessionTTL(ttl time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	return defaultSessionTTL
+}
+
+// newCookie returns a cookie for the state kept between the requests. The cookie is not
+// available to scripts and is sent only over HTTPS if the page is requested over HTTPS.
+func newCookie(r *http.Request, name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   isHTTPS(r),
+	}
+}
+
+// setCookie adds the cookie with the attributes of newCookie to the response.
+func (s *scope) setCookie(name, value string, maxAge int) {
+	s.globals.header.Add("Set-Cookie", newCookie(s.globals.req, name, value, maxAge).String())
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on the supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// The purposes of the signed values. A value signed for one purpose is not valid for another,
+// e.g. the OIDC flow cookie can't be used as the session cookie, though they share the key.
+const (
+	purposeCookieSession = "cookie-session"
+	purposeOIDCFlow      = "oidc-flow"
+	purposeOIDCSession   = "oidc-session"
+)
+
+// signValue encodes v as JSON and signs it with the key for the purpose:
+// base64(JSON) + "." + base64(HMAC(purpose + "\x00" + base64(JSON))).
+func signValue(key []byte, purpose string, v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(valueMAC(key, purpose, payload)), nil
+}
+
+// valueMAC returns the signature of the payload for the purpose.
+func valueMAC(key []byte, purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// verifyValue checks the signature of the value produced by signValue for the purpose and
+// decodes it into v.
+func verifyValue(key []byte, purpose, value string, v any) error {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed value")
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return errors.New("malformed value")
+	}
+	if !hmac.Equal(got, valueMAC(key, purpose, payload)) {
+		return errors.New("invalid signature")
+	}
+	return decodeSegment(payload, v)
+}
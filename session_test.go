@@ -0,0 +1,155 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestPages_Sessions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"visit.chtml":  {Data: []byte(`<c:session visits="${(session.visits ?? 0) + 1}" as="s"></c:session><p>${s.visits}</p>`)},
+		"read.chtml":   {Data: []byte(`<p>${session.visits ?? "none"}</p>`)},
+		"logout.chtml": {Data: []byte(`<c:session visits="${nil}"></c:session><p>bye</p>`)},
+	}
+
+	stores := map[string]SessionStore{
+		"cookie": &CookieSessionStore{Key: []byte(strings.Repeat("k", 32))},
+		"memory": &MemorySessionStore{},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			h := &Handler{
+				FileSystem:        fsys,
+				Sessions:          store,
+				BuiltinComponents: map[string]chtml.Component{"session": SessionComponent{}},
+			}
+
+			var cookie *http.Cookie
+			get := func(target string) string {
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				if cookie != nil {
+					req.AddCookie(cookie)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d, body = %s", target, rec.Code, rec.Body.String())
+				}
+				for _, c := range rec.Result().Cookies() {
+					if c.Name == "pages_sid" {
+						cookie = c
+						if !c.HttpOnly || c.Path != "/" {
+							t.Errorf("%s: cookie attributes %v", target, c)
+						}
+					}
+				}
+				return rec.Body.String()
+			}
+
+			if got, want := get("/read"), "<p>none</p>"; got != want {
+				t.Errorf("read without session = %q, want %q", got, want)
+			}
+			if cookie != nil {
+				t.Errorf("the unchanged session is saved: %v", cookie)
+			}
+			for _, want := range []string{"<p>1</p>", "<p>2</p>"} {
+				if got := get("/visit"); got != want {
+					t.Errorf("visit = %q, want %q", got, want)
+				}
+			}
+			if got, want := get("/read"), "<p>2</p>"; got != want {
+				t.Errorf("read = %q, want %q", got, want)
+			}
+
+			get("/logout")
+			if cookie.MaxAge >= 0 {
+				t.Errorf("logout: the cookie is not deleted: %v", cookie)
+			}
+			cookie.MaxAge = 0
+			if got, want := get("/read"), "<p>none</p>"; got != want {
+				t.Errorf("read after logout = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPages_SessionRegenerate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"visit.chtml": {Data: []byte(`<c:session visits="${(session.visits ?? 0) + 1}"></c:session>`)},
+		"login.chtml": {Data: []byte(`<c:session user_id="${'alice'}"></c:session>`)},
+		"read.chtml":  {Data: []byte(`<p>${session.user_id ?? "none"} ${session.visits ?? 0}</p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		Sessions:   &MemorySessionStore{},
+		BuiltinComponents: map[string]chtml.Component{
+			"session": SessionComponent{RegenerateOn: []string{"user_id"}},
+		},
+	}
+
+	get := func(target string, cookie *http.Cookie) (string, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "pages_sid" {
+				return rec.Body.String(), c
+			}
+		}
+		return rec.Body.String(), nil
+	}
+
+	// the session ID is known to an attacker before the login
+	_, fixed := get("/visit", nil)
+	_, visited := get("/visit", fixed)
+	if visited == nil || visited.Value != fixed.Value {
+		t.Fatalf("the session ID changed without a login: %v, %v", fixed, visited)
+	}
+
+	_, login := get("/login", fixed)
+	if login == nil || login.Value == fixed.Value {
+		t.Fatalf("the session ID is not regenerated on login: %v", login)
+	}
+	if got, _ := get("/read", login); got != "<p>alice 2</p>" {
+		t.Errorf("read with the new ID = %q, want %q", got, "<p>alice 2</p>")
+	}
+	if got, _ := get("/read", fixed); got != "<p>none 0</p>" {
+		t.Errorf("read with the fixed ID = %q, want no session", got)
+	}
+
+	// the same user keeps the ID
+	if _, again := get("/login", login); again == nil || again.Value != login.Value {
+		t.Errorf("the session ID changed without a change of the user: %v", again)
+	}
+}
+
+func TestCookieSessionStore_Forged(t *testing.T) {
+	store := &CookieSessionStore{Key: []byte(strings.Repeat("k", 32))}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	h := http.Header{}
+	if err := store.Save(h, r, map[string]any{"user_id": "42"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := http.ParseSetCookie(h.Get("Set-Cookie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &CookieSessionStore{Key: []byte(strings.Repeat("x", 32))}
+	r.AddCookie(c)
+	if values, err := other.Load(r); err != nil || values != nil {
+		t.Errorf("Load() with another key = %v, %v, want no session", values, err)
+	}
+	if values, err := store.Load(r); err != nil || values["user_id"] != "42" {
+		t.Errorf("Load() = %v, %v", values, err)
+	}
+}
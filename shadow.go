@@ -0,0 +1,197 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultShadowMaxRenders is the default limit of the shadow renders in flight, see
+// Handler.ShadowMaxRenders.
+const DefaultShadowMaxRenders = 16
+
+func (h *Handler) shadowMaxRenders() int {
+	if h.ShadowMaxRenders <= 0 {
+		return DefaultShadowMaxRenders
+	}
+	return h.ShadowMaxRenders
+}
+
+// ShadowResult is a response captured while mirroring a request.
+type ShadowResult struct {
+	StatusCode int
+	Body       []byte
+}
+
+// ShadowDiff describes a mismatch between the response served from the Handler's FileSystem
+// (Primary) and the response rendered from the ShadowFileSystem (Shadow) for the same request.
+type ShadowDiff struct {
+	Primary ShadowResult
+	Shadow  ShadowResult
+}
+
+// shadowWriter is an http.ResponseWriter that captures the status code and the body of the
+// primary response while passing them through to the client.
+type shadowWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *shadowWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *shadowWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// newShadowHandler creates a Handler that serves the ShadowFileSystem with the same
+// configuration as h: the options affecting the responses and the current runtime configuration.
+// The options with side effects outside the response are not copied (the metrics, the render
+// cache, the AfterRender hooks and the error callbacks), and the sessions are not saved. The
+// shadow responses are not compressed, they are compared with the uncompressed primary ones.
+func (h *Handler) newShadowHandler() *Handler {
+	cfg := h.cfg()
+	sh := &Handler{
+		FileSystem:              h.ShadowFileSystem,
+		ComponentSearchPath:     cfg.ComponentSearchPath,
+		CustomImporter:          h.CustomImporter,
+		StaticFileSystems:       h.StaticFileSystems,
+		StaticPaths:             cfg.StaticPaths,
+		BuiltinComponents:       h.BuiltinComponents,
+		Watch:                   h.Watch,
+		StrictCoercion:          h.StrictCoercion,
+		KeepComment:             h.KeepComment,
+		Sanitize:                h.Sanitize,
+		TemplateFuncs:           h.TemplateFuncs,
+		ErrorOverlay:            h.ErrorOverlay,
+		ShowDrafts:              h.ShowDrafts,
+		PreviewToken:            h.PreviewToken,
+		LocaleSelector:          h.LocaleSelector,
+		SecurityHeaders:         h.SecurityHeaders,
+		WebSocketMaxMessageSize: h.WebSocketMaxMessageSize,
+		WebSocketStrictVars:     h.WebSocketStrictVars,
+		LiveUpdateInterval:      h.LiveUpdateInterval,
+		LiveUpdateIntervals:     h.LiveUpdateIntervals,
+		AssetTransformers:       h.AssetTransformers,
+		OutputETags:             h.OutputETags,
+		CachePolicies:           h.CachePolicies,
+		Encoders:                h.Encoders,
+		BeforeRender:            h.BeforeRender,
+		OnErrorComponent:        cfg.OnErrorComponent,
+		StreamPages:             h.StreamPages,
+		Logger:                  h.logger,
+		RenderArena:             cfg.RenderArena,
+		RenderBudget:            cfg.RenderBudget,
+		RenderTimeout:           cfg.RenderTimeout,
+		MaxUploadSize:           h.MaxUploadSize,
+		pageAssets:              h.pageAssets,
+	}
+	if h.Sessions != nil {
+		sh.Sessions = readOnlySessionStore{h.Sessions}
+	}
+	return sh
+}
+
+// shadowConfig applies the runtime configuration of the primary handler to the shadow one.
+func shadowConfig(cfg *Config) func(*Config) {
+	return func(sc *Config) {
+		sc.ComponentSearchPath = slices.Clone(cfg.ComponentSearchPath)
+		sc.StaticPaths = slices.Clone(cfg.StaticPaths)
+		sc.OnErrorComponent = cfg.OnErrorComponent
+		sc.RenderArena = cfg.RenderArena
+		sc.RenderBudget = cfg.RenderBudget
+		sc.RenderTimeout = cfg.RenderTimeout
+	}
+}
+
+// readOnlySessionStore loads the sessions of the shadow requests, but doesn't save the changes.
+type readOnlySessionStore struct {
+	SessionStore
+}
+
+func (readOnlySessionStore) Save(http.Header, *http.Request, map[string]any) error {
+	return nil
+}
+
+// shouldMirror reports whether the request should be mirrored to the shadow handler.
+// Only GET requests are mirrored as rendering non-idempotent requests twice may cause
+// side effects. WebSocket connections and event streams are never mirrored.
+func (h *Handler) shouldMirror(r *http.Request) bool {
+	rate := h.cfg().ShadowRate
+	if h.shadow == nil || rate <= 0 {
+		return false
+	}
+	if r.Method != http.MethodGet || websocket.IsWebSocketUpgrade(r) || isEventStreamRequest(r) {
+		return false
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// mirror renders the request against the shadow handler in the background and reports the
+// difference with the primary response captured by w. The request is dropped if
+// ShadowMaxRenders shadow renders are already in flight, the shadow traffic must not pile up
+// behind a slow ShadowFileSystem.
+// The err is the error of handleRequest, responded by ServeHTTP after the capture.
+func (h *Handler) mirror(r *http.Request, w *shadowWriter, err error) {
+	primary := ShadowResult{StatusCode: w.statusCode, Body: w.body.Bytes()}
+	var sent *responseSentError
+	if err != nil && !errors.As(err, &sent) {
+		primary = ShadowResult{
+			StatusCode: http.StatusInternalServerError,
+			Body:       []byte(http.StatusText(http.StatusInternalServerError) + "\n"),
+		}
+	}
+	if primary.StatusCode == 0 {
+		primary.StatusCode = http.StatusOK
+	}
+
+	select {
+	case h.shadowSem <- struct{}{}:
+	default:
+		h.logger.Warn("Shadow render dropped",
+			"url", r.URL.Redacted(),
+			"dropped", h.shadowDropped.Add(1))
+		return
+	}
+
+	// the original request must not be used after ServeHTTP returns
+	sr := r.Clone(context.WithoutCancel(r.Context()))
+
+	go func() {
+		defer func() { <-h.shadowSem }()
+
+		rr := httptest.NewRecorder()
+		h.shadow.ServeHTTP(rr, sr)
+
+		shadow := ShadowResult{StatusCode: rr.Code, Body: rr.Body.Bytes()}
+
+		if primary.StatusCode == shadow.StatusCode && bytes.Equal(primary.Body, shadow.Body) {
+			return
+		}
+
+		if h.OnShadowDiff != nil {
+			h.OnShadowDiff(sr, &ShadowDiff{Primary: primary, Shadow: shadow})
+			return
+		}
+
+		h.logger.Warn("Shadow response mismatch",
+			"url", sr.URL.Redacted(),
+			"status", primary.StatusCode,
+			"shadow_status", shadow.StatusCode)
+	}()
+}
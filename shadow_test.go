@@ -0,0 +1,149 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestHandler_Shadow(t *testing.T) {
+	diffs := make(chan *ShadowDiff, 1)
+
+	h := &Handler{
+		FileSystem: os.DirFS("testdata"),
+		ShadowFileSystem: fstest.MapFS{
+			"index.chtml":     {Data: []byte("<h1>New Index</h1>")},
+			"posts/new.chtml": {Data: []byte("new-post\n")},
+		},
+		ShadowRate:   1,
+		OnShadowDiff: func(r *http.Request, d *ShadowDiff) { diffs <- d },
+	}
+
+	// same output, no diff reported
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/posts/new", nil))
+	if rr.Body.String() != "new-post\n" {
+		t.Fatalf("body: got %q, want %q", rr.Body.String(), "new-post\n")
+	}
+	select {
+	case d := <-diffs:
+		t.Fatalf("unexpected diff: %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// different output, primary response is served, diff reported
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	want := "\n\n<h1>Index</h1>\n\n<div>index-content</div>\n\n"
+	if rr.Body.String() != want {
+		t.Fatalf("body: got %q, want %q", rr.Body.String(), want)
+	}
+	select {
+	case d := <-diffs:
+		if string(d.Primary.Body) != want {
+			t.Errorf("primary body: got %q, want %q", d.Primary.Body, want)
+		}
+		if string(d.Shadow.Body) != "<h1>New Index</h1>" {
+			t.Errorf("shadow body: got %q, want %q", d.Shadow.Body, "<h1>New Index</h1>")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("diff not reported")
+	}
+
+	// non-GET requests are not mirrored
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/", nil))
+	select {
+	case d := <-diffs:
+		t.Fatalf("unexpected diff: %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandler_ShadowConfig(t *testing.T) {
+	diffs := make(chan *ShadowDiff, 1)
+
+	fsys := fstest.MapFS{
+		"index.chtml": {Data: []byte(`<p>${money(1)}</p>` + strings.Repeat("<p>compressible</p>", 100))},
+	}
+	h := &Handler{
+		FileSystem:       fsys,
+		ShadowFileSystem: fsys,
+		ShadowRate:       1,
+		OnShadowDiff:     func(r *http.Request, d *ShadowDiff) { diffs <- d },
+		Compression:      true,
+		TemplateFuncs:    map[string]any{"money": func(v int) string { return fmt.Sprintf("$%d.00", v) }},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("want a compressed page, got %d %q", rr.Code, rr.Header().Get("Content-Encoding"))
+	}
+
+	select {
+	case d := <-diffs:
+		t.Fatalf("unexpected diff: %d %q, shadow %d %q",
+			d.Primary.StatusCode, d.Primary.Body, d.Shadow.StatusCode, d.Shadow.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandler_ShadowMaxRenders(t *testing.T) {
+	diffs := make(chan *ShadowDiff)
+
+	h := &Handler{
+		FileSystem: fstest.MapFS{
+			"index.chtml": {Data: []byte("old")},
+		},
+		ShadowFileSystem: fstest.MapFS{
+			"index.chtml": {Data: []byte("new")},
+		},
+		ShadowRate:       1,
+		ShadowMaxRenders: 1,
+		OnShadowDiff:     func(r *http.Request, d *ShadowDiff) { diffs <- d },
+	}
+
+	// the first shadow render blocks in OnShadowDiff, the second one is dropped
+	for range 2 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if n := h.shadowDropped.Load(); n != 1 {
+		t.Fatalf("dropped: got %d, want 1", n)
+	}
+
+	select {
+	case <-diffs:
+	case <-time.After(time.Second):
+		t.Fatal("diff not reported")
+	}
+	select {
+	case d := <-diffs:
+		t.Fatalf("unexpected diff: %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the slot is released after the render
+	for deadline := time.Now().Add(time.Second); len(h.shadowSem) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("shadow render slot not released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	select {
+	case <-diffs:
+	case <-time.After(time.Second):
+		t.Fatal("diff not reported")
+	}
+	if n := h.shadowDropped.Load(); n != 1 {
+		t.Errorf("dropped: got %d, want 1", n)
+	}
+}
@@ -0,0 +1,154 @@
+package pages
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// sseKeepAliveInterval is the interval of the comments sent to the idle event streams, so
+// the proxies don't close the connections.
+const sseKeepAliveInterval = 30 * time.Second
+
+// isEventStreamRequest reports whether the client requests the page as a stream of Server-Sent
+// Events, e.g. with the EventSource API.
+func isEventStreamRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(v)); err == nil && mt == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSSE sends the page as a stream of Server-Sent Events. The page is rendered once the stream
+// is opened and whenever the scope is touched (e.g. by HttpCallComponent polling, at most once
+// per the interval of the throttle), each render is sent as a "message" event. The render errors are sent as the "error" events with the same
+// payload as the WebSocket error frames (see wsErrorFrame). The stream lasts until the client
+// disconnects or the page can't be rendered anymore.
+func (h *Handler) serveSSE(
+	w http.ResponseWriter,
+	r *http.Request,
+	comp chtml.Component,
+	mainScope *scope,
+	renderCtx *chtml.RenderContext,
+	vars map[string]any,
+	throttle *liveThrottle,
+) error {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable the response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return &responseSentError{err: fmt.Errorf("flush event stream: %w", err)}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	// render the page right away, the following renders are triggered by the scope updates
+	render := func() error {
+		s := mainScope.Spawn(vars).(*scope)
+		if err := h.renderSSE(w, comp, s); err != nil {
+			_ = writeSSEError(w, http.StatusInternalServerError)
+			_ = rc.Flush()
+			return &responseSentError{err: err}
+		}
+		if err := rc.Flush(); err != nil {
+			return &responseSentError{err: fmt.Errorf("flush event stream: %w", err)}
+		}
+		throttle.rendered()
+		renderCtx.Flush()
+		return nil
+	}
+	defer throttle.stop()
+	if err := render(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-mainScope.Touched():
+			if !throttle.ready() {
+				continue // rendered when the throttle fires
+			}
+			if err := render(); err != nil {
+				return err
+			}
+		case <-throttle.C():
+			if err := render(); err != nil {
+				return err
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return &responseSentError{err: fmt.Errorf("write event stream: %w", err)}
+			}
+			if err := rc.Flush(); err != nil {
+				return &responseSentError{err: fmt.Errorf("flush event stream: %w", err)}
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// renderSSE renders the component into a "message" event, or an "error" event if the page fails
+// to render (or sets a 5xx status code, or a BeforeRender hook fails).
+func (h *Handler) renderSSE(w io.Writer, comp chtml.Component, s *scope) error {
+	s.globals.statusCode = 0 // the status code of the previous render is not relevant
+
+	if err := h.beforeRender(s, comp); err != nil {
+		return writeSSEError(w, h.hookStatus(err))
+	}
+	defer h.afterRender(s, comp)
+
+	rr, err := h.renderResult(comp, s)
+	if err != nil {
+		return err
+	}
+	if s.globals.statusCode >= http.StatusInternalServerError {
+		return writeSSEError(w, s.globals.statusCode)
+	}
+
+	var buf bytes.Buffer
+	if err := h.writeResult(&buf, rr, s); err != nil {
+		return err
+	}
+	return writeSSEEvent(w, "message", buf.Bytes())
+}
+
+// writeSSEError sends the error event with the status code.
+func writeSSEError(w io.Writer, status int) error {
+	msg, err := errorFrame(status)
+	if err != nil {
+		return err
+	}
+	return writeSSEEvent(w, "error", msg)
+}
+
+// writeSSEEvent writes an event, the lines of data are sent as separate data fields.
+func writeSSEEvent(w io.Writer, event string, data []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString("event: " + event + "\n")
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write event stream: %w", err)
+	}
+	return nil
+}
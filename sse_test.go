@@ -0,0 +1,171 @@
+package pages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// touchingComponent renders the number of its renders and touches the scope after the first one,
+// like a component receiving an update in the background.
+type touchingComponent struct {
+	n *atomic.Int32
+}
+
+func (c touchingComponent) Render(s chtml.Scope) (any, error) {
+	if _, ok := s.(*scope); !ok {
+		return nil, nil
+	}
+	n := c.n.Add(1)
+	if n == 1 {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			s.Touch()
+		}()
+	}
+	return strconv.Itoa(int(n)), nil
+}
+
+func TestPages_ServerSentEvents(t *testing.T) {
+	fsys := fstest.MapFS{
+		"live.chtml":   {Data: []byte("<p><c:touching></c:touching></p>\n<p>line</p>")},
+		"broken.chtml": {Data: []byte(`<p><c:fail-on-request></c:fail-on-request></p>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"touching":        touchingComponent{n: new(atomic.Int32)},
+			"fail-on-request": requestFailingComponent{},
+		},
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	// events reads n events from the page stream
+	events := func(t *testing.T, path string, n int) []string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+
+		var res []string
+		var event strings.Builder
+		sc := bufio.NewScanner(resp.Body)
+		for len(res) < n && sc.Scan() {
+			if sc.Text() == "" {
+				res = append(res, event.String())
+				event.Reset()
+				continue
+			}
+			event.WriteString(sc.Text() + "\n")
+		}
+		if len(res) < n {
+			t.Fatalf("got %d events, want %d: %v", len(res), n, sc.Err())
+		}
+		return res
+	}
+
+	got := events(t, "/live", 2)
+	want := []string{
+		"event: message\ndata: <p>1</p>\ndata: <p>line</p>\n",
+		"event: message\ndata: <p>2</p>\ndata: <p>line</p>\n",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	got = events(t, "/broken", 1)
+	if want := "event: error\ndata: {\"error\":{\"status\":500,\"message\":\"Internal Server Error\"}}\n"; got[0] != want {
+		t.Errorf("error event = %q, want %q", got[0], want)
+	}
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSSEEvent(&buf, "message", []byte("a\r\nb\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "event: message\ndata: a\ndata: b\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// retouchingComponent touches the scope after each of its first max renders.
+type retouchingComponent struct {
+	n   *atomic.Int32
+	max int32
+}
+
+func (c retouchingComponent) Render(s chtml.Scope) (any, error) {
+	if _, ok := s.(*scope); !ok {
+		return nil, nil
+	}
+	if n := c.n.Add(1); n <= c.max {
+		go func() {
+			time.Sleep(time.Millisecond)
+			s.Touch()
+		}()
+	}
+	return nil, nil
+}
+
+func TestPages_ServerSentEventsRenderBudget(t *testing.T) {
+	const renders = 20
+	h := &Handler{
+		FileSystem: fstest.MapFS{
+			"live.chtml": {Data: []byte(`<c:retouching></c:retouching><p c:for="i in 1..100">${i}</p>`)},
+		},
+		BuiltinComponents: map[string]chtml.Component{
+			"retouching": retouchingComponent{n: new(atomic.Int32), max: renders - 1},
+		},
+		RenderBudget: 1 << 16, // a few renders of the page, the budget is per render
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/live", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	messages := 0
+	sc := bufio.NewScanner(resp.Body)
+	for messages < renders && sc.Scan() {
+		switch sc.Text() {
+		case "event: message":
+			messages++
+		case "event: error":
+			t.Fatalf("error event after %d messages", messages)
+		}
+	}
+	if messages < renders {
+		t.Errorf("got %d messages, want %d: %v", messages, renders, sc.Err())
+	}
+}
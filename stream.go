@@ -0,0 +1,74 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// renderStream writes the HTML output of the component to w while it is rendered (see
+// Handler.StreamPages). It returns chtml.ErrNotStreamable if nothing has been rendered, so
+// the component can be rendered as usual.
+func (h *Handler) renderStream(w io.Writer, comp chtml.StreamRenderer, scope *scope) error {
+	scope.globals.assets.reset()
+	scope.globals.cacheCtl.reset()
+	scope.globals.secHeaders.reset()
+	scope.globals.versions.reset()
+
+	sw := &streamWriter{w: w, scope: scope}
+	err := comp.RenderTo(sw, scope)
+	if errors.Is(err, chtml.ErrNotStreamable) {
+		return err
+	}
+	if err != nil {
+		// the status code can only be changed if nothing has been written yet
+		if !sw.started {
+			if errors.Is(err, chtml.ErrBudgetExceeded) {
+				return fmt.Errorf("render component: %w", err)
+			}
+			scope.globals.statusCode = http.StatusInternalServerError
+		}
+		errs := []error{err}
+		if multierr, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = multierr.Unwrap()
+		}
+		for _, e := range errs {
+			if e != nil {
+				h.logger.Error("Render component", "error", e)
+			}
+		}
+	}
+	sw.start()
+	return nil
+}
+
+// streamWriter sends the headers and the status code set by the components before the first
+// byte of the page. The page is discarded if the response is 304 Not Modified.
+type streamWriter struct {
+	w       io.Writer
+	scope   *scope
+	started bool
+	discard bool
+}
+
+func (sw *streamWriter) start() {
+	if sw.started {
+		return
+	}
+	sw.started = true
+	if rw, ok := sw.w.(http.ResponseWriter); ok {
+		writeHeader(rw, sw.scope)
+		sw.discard = sw.scope.globals.statusCode == http.StatusNotModified
+	}
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.start()
+	if sw.discard {
+		return len(b), nil
+	}
+	return sw.w.Write(b)
+}
@@ -0,0 +1,67 @@
+package pages
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestHandler_StreamPages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.chtml": {Data: []byte(`<html><head><title>T</title></head><body>${_}</body></html>`)},
+		"index.chtml": {Data: []byte(`<c:http-response status="201" location="/next"></c:http-response>` +
+			`<c:layout><ul><li c:for="x in [1, 2]">${x}</li></ul></c:layout>`)},
+		"data.chtml":   {Data: []byte(`${ {"a": 1} }`)},
+		"broken.chtml": {Data: []byte(`<div><p>before</p><c:fail-on-request></c:fail-on-request></div>`)},
+	}
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"http-response":   HttpResponseComponent{},
+			"fail-on-request": requestFailingComponent{},
+		},
+		StreamPages: true,
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/", 201, `<html><head><title>T</title></head><body><ul><li>1</li><li>2</li></ul></body></html>`},
+		{"/data", 200, "{\"a\":1}\n"},
+		{"/broken", 200, `<div><p>before</p></div>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Code != tt.status {
+				t.Errorf("status = %d, want %d", rr.Code, tt.status)
+			}
+			if got := rr.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if got := rr.Header().Get("Location"); got != "/next" {
+		t.Errorf("Location = %q, want %q", got, "/next")
+	}
+}
+
+// requestFailingComponent fails when rendered for a request, but not while the importing
+// component is parsed.
+type requestFailingComponent struct{}
+
+func (requestFailingComponent) Render(s chtml.Scope) (any, error) {
+	if _, ok := s.(*scope); ok {
+		return nil, errors.New("request failed")
+	}
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package pages
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// TestScope is a chtml.Scope for unit-testing the custom components without a Handler. It
+// records the asset dependencies added by the components (see AssetCollector), the data versions
+// (see VersionCollector) and the number of the Touch calls. The scopes spawned from a TestScope
+// share the records and the Touched channel.
+//
+//	s := pages.NewTestScope(map[string]any{"symbol": "GOOG"})
+//	rr, err := ChartComponent{}.Render(s)
+//	...
+//	if deps := s.Assets(); len(deps) != 1 {
+//	    t.Errorf("assets = %v", deps)
+//	}
+type TestScope struct {
+	*chtml.BaseScope
+	rec *testScopeRecords
+	ctx context.Context
+}
+
+type testScopeRecords struct {
+	mu       sync.Mutex
+	assets   []AssetDep
+	versions []string
+	touches  int
+}
+
+var _ chtml.Scope = (*TestScope)(nil)
+var _ AssetCollector = (*TestScope)(nil)
+var _ VersionCollector = (*TestScope)(nil)
+var _ chtml.ScopeWithContext = (*TestScope)(nil)
+
+// NewTestScope returns a new TestScope with the given variables.
+func NewTestScope(vars map[string]any) *TestScope {
+	return &TestScope{
+		BaseScope: chtml.NewBaseScope(vars),
+		rec:       &testScopeRecords{},
+	}
+}
+
+func (s *TestScope) Spawn(vars map[string]any) chtml.Scope {
+	return &TestScope{
+		BaseScope: s.BaseScope.Spawn(vars).(*chtml.BaseScope),
+		rec:       s.rec,
+		ctx:       s.ctx,
+	}
+}
+
+// WithContext returns a copy of the scope carrying the context, e.g. a canceled one to test
+// the cancellation of the component. The copy shares the variables and the records.
+func (s *TestScope) WithContext(ctx context.Context) *TestScope {
+	s2 := *s
+	s2.ctx = ctx
+	return &s2
+}
+
+// Context returns the context set with WithContext or context.Background().
+func (s *TestScope) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// Touch counts the call and notifies the Touched channel.
+func (s *TestScope) Touch() {
+	s.rec.mu.Lock()
+	s.rec.touches++
+	s.rec.mu.Unlock()
+
+	s.BaseScope.Touch()
+}
+
+// Touches returns the number of the Touch calls on the scope and the spawned scopes.
+func (s *TestScope) Touches() int {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	return s.rec.touches
+}
+
+// AddAsset records the asset dependency. The dependencies are deduplicated by Href.
+func (s *TestScope) AddAsset(dep AssetDep) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.rec.assets = appendAssetDep(s.rec.assets, dep)
+}
+
+// Assets returns the recorded asset dependencies.
+func (s *TestScope) Assets() []AssetDep {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	return slices.Clone(s.rec.assets)
+}
+
+// AddVersion records the data version.
+func (s *TestScope) AddVersion(version string) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.rec.versions = append(s.rec.versions, version)
+}
+
+// Versions returns the recorded data versions.
+func (s *TestScope) Versions() []string {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	return slices.Clone(s.rec.versions)
+}
@@ -0,0 +1,64 @@
+package pages
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTestScope(t *testing.T) {
+	s := NewTestScope(map[string]any{"href": "/chart.js"})
+
+	child := s.Spawn(map[string]any{"href": "/chart.js"})
+	for range 2 {
+		if _, err := (AssetDepComponent{}).Render(child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff([]AssetDep{{Href: "/chart.js"}}, s.Assets()); diff != "" {
+		t.Errorf("assets (-want +got):\n%s", diff)
+	}
+
+	if _, err := (DataVersionComponent{}).Render(s.Spawn(map[string]any{"value": 42})); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"42"}, s.Versions()); diff != "" {
+		t.Errorf("versions (-want +got):\n%s", diff)
+	}
+
+	child.Touch()
+	select {
+	case <-s.Touched():
+	case <-time.After(time.Second):
+		t.Fatal("the spawned scope touch is not notified")
+	}
+	if n := s.Touches(); n != 1 {
+		t.Errorf("Touches() = %d, want 1", n)
+	}
+
+	if _, ok := child.(AssetCollector); !ok {
+		t.Error("the spawned scope is not an AssetCollector")
+	}
+}
+
+func TestTestScope_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := NewTestScope(map[string]any{"url": "/api/data"}).WithContext(ctx)
+	if err := chtml.ContextOf(s.Spawn(nil)).Err(); err != context.Canceled {
+		t.Errorf("spawned scope context err = %v", err)
+	}
+
+	rr, err := NewHttpCallComponent(http.NotFoundHandler()).Render(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := rr.(*HttpCallResponse); res.Error != "make request: context canceled" {
+		t.Errorf("Error = %q", res.Error)
+	}
+}
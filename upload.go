@@ -0,0 +1,242 @@
+package pages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+// DefaultMaxUploadSize is the default limit of a multipart/form-data request body, see
+// Handler.MaxUploadSize.
+const DefaultMaxUploadSize = 32 << 20
+
+// uploadMaxMemory is the size of the uploaded files kept in memory, the rest is stored in
+// temporary files removed after the request.
+const uploadMaxMemory = 8 << 20
+
+func (h *Handler) maxUploadSize() int64 {
+	if h.MaxUploadSize == 0 {
+		return DefaultMaxUploadSize
+	}
+	return h.MaxUploadSize
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return ct == "multipart/form-data"
+}
+
+// UploadedFile is a file uploaded with a multipart/form-data request, see RequestArg.Files.
+type UploadedFile struct {
+	// Filename is the name of the file on the client. It must not be trusted as a file path.
+	Filename string `expr:"filename"`
+
+	// ContentType is the media type of the file declared by the client.
+	ContentType string `expr:"content_type"`
+
+	// Size is the size of the file in bytes.
+	Size int64 `expr:"size"`
+
+	header *multipart.FileHeader
+}
+
+func newUploadedFile(fh *multipart.FileHeader) *UploadedFile {
+	return &UploadedFile{
+		Filename:    fh.Filename,
+		ContentType: fh.Header.Get("Content-Type"),
+		Size:        fh.Size,
+		header:      fh,
+	}
+}
+
+// Open opens the content of the file. The content is available until the request is served.
+func (f *UploadedFile) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+// UploadComponent saves the files uploaded with a multipart/form-data request to the Dir
+// directory or with the Save callback. The following arguments are accepted:
+//   - field - the name of the form field with the files (required).
+//
+// The component returns an UploadResult with the saved files, or the error message if the
+// files are rejected, e.g. too large or of a type not allowed. Nothing is saved if any of the
+// files is rejected. If saving a file fails, the component fails, and the files saved before
+// are left in place. The requests without the files (e.g. GET) render an empty result.
+//
+// Example:
+//
+//	<c:upload as="up" field="avatar"></c:upload>
+//	<img c:if="len(up.files) > 0" src="/avatars/${up.files[0].name}">
+//	<p c:if="up.error != ''">${up.error}</p>
+type UploadComponent struct {
+	// Dir is the directory the files are saved to, under the random names with the extensions
+	// of the detected media types (see AllowedTypes), e.g. a PNG image named x.html is saved as
+	// upload-123.png. It is used if Save is not set.
+	Dir string
+
+	// Save saves the file and returns its name, e.g. the key of an object in a storage.
+	Save func(ctx context.Context, f *UploadedFile) (string, error)
+
+	// MaxFileSize is the maximum size of a file in bytes. Zero means no limit other than
+	// Handler.MaxUploadSize.
+	MaxFileSize int64
+
+	// AllowedTypes are the allowed media types of the files, detected from the content (see
+	// http.DetectContentType), e.g. "image/png" or "image/*". If empty, any type is allowed.
+	AllowedTypes []string
+}
+
+var _ chtml.Component = (*UploadComponent)(nil)
+
+// UploadResult is the result of UploadComponent.
+type UploadResult struct {
+	Files []*SavedFile `expr:"files"`
+	Error string       `expr:"error"`
+}
+
+// SavedFile is a file saved by UploadComponent.
+type SavedFile struct {
+	// Name is the name returned by UploadComponent.Save or the name of the file in the Dir.
+	Name        string `expr:"name"`
+	Filename    string `expr:"filename"`
+	ContentType string `expr:"content_type"`
+	Size        int64  `expr:"size"`
+}
+
+func (uc *UploadComponent) Render(s chtml.Scope) (any, error) {
+	field, _ := s.Vars()["field"].(string)
+	if field == "" {
+		return nil, fmt.Errorf("field is required")
+	}
+	if uc.Save == nil && uc.Dir == "" {
+		return nil, fmt.Errorf("upload: Dir or Save must be set")
+	}
+
+	v, ok := s.(*scope)
+	if !ok || v.globals.req == nil {
+		return &UploadResult{}, nil
+	}
+	ra := v.requestArg()
+
+	var mbe *http.MaxBytesError
+	if errors.As(ra.bodyErr, &mbe) {
+		return &UploadResult{Error: fmt.Sprintf("the upload exceeds %d bytes", mbe.Limit)}, nil
+	} else if ra.bodyErr != nil {
+		return nil, fmt.Errorf("parse multipart form: %w", ra.bodyErr)
+	}
+
+	files := ra.Files[field]
+	types := make([]string, len(files))
+	for i, f := range files {
+		if uc.MaxFileSize > 0 && f.Size > uc.MaxFileSize {
+			return &UploadResult{
+				Error: fmt.Sprintf("%s exceeds %d bytes", f.Filename, uc.MaxFileSize),
+			}, nil
+		}
+		ct, err := detectContentType(f)
+		if err != nil {
+			return nil, err
+		}
+		if !uc.allowType(ct) {
+			return &UploadResult{Error: fmt.Sprintf("%s: type %s is not allowed", f.Filename, ct)}, nil
+		}
+		types[i] = ct
+	}
+
+	res := &UploadResult{Files: []*SavedFile{}}
+	for i, f := range files {
+		name, err := uc.save(v.Context(), f, types[i])
+		if err != nil {
+			return nil, fmt.Errorf("save %s: %w", f.Filename, err)
+		}
+		res.Files = append(res.Files, &SavedFile{
+			Name:        name,
+			Filename:    f.Filename,
+			ContentType: types[i],
+			Size:        f.Size,
+		})
+	}
+	return res, nil
+}
+
+// detectContentType returns the media type of the file detected from its first 512 bytes.
+func detectContentType(f *UploadedFile) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", f.Filename, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read %s: %w", f.Filename, err)
+	}
+	ct, _, _ := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	return ct, nil
+}
+
+func (uc *UploadComponent) allowType(ct string) bool {
+	if len(uc.AllowedTypes) == 0 {
+		return true
+	}
+	for _, t := range uc.AllowedTypes {
+		if t == ct || strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (uc *UploadComponent) save(ctx context.Context, f *UploadedFile, ct string) (string, error) {
+	if uc.Save != nil {
+		return uc.Save(ctx, f)
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.CreateTemp(uc.Dir, "upload-*"+uploadExt(ct, f.Filename))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return filepath.Base(dst.Name()), nil
+}
+
+// uploadExt returns the extension of the saved file of the detected media type ct. The
+// extension of the client's file name is kept if it is one of the type, e.g. ".jpg" rather than
+// ".jpeg". The files of the types with no known extension are saved without one.
+func uploadExt(ct, filename string) string {
+	exts, _ := mime.ExtensionsByType(ct)
+	ext := strings.ToLower(path.Ext(strings.ReplaceAll(filename, "\\", "/")))
+	if slices.Contains(exts, ext) {
+		return ext
+	}
+	if len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package pages
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+)
+
+func TestUploadComponent(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+
+	fsys := fstest.MapFS{
+		"avatar.chtml": {Data: []byte(
+			`<c:upload as="up" field="avatar"></c:upload>` +
+				`<c:request as="req"></c:request>` +
+				`<ul><li c:for="f in up.files">${f.filename} ${f.content_type} ${f.size}</li></ul>` +
+				`<p>${up.error}</p>` +
+				`<p c:if="req.body != nil">${req.body.name[0]}</p>`)},
+	}
+
+	dir := t.TempDir()
+	h := &Handler{
+		FileSystem: fsys,
+		BuiltinComponents: map[string]chtml.Component{
+			"upload":  &UploadComponent{Dir: dir, MaxFileSize: 200, AllowedTypes: []string{"image/*"}},
+			"request": RequestComponent{},
+		},
+		MaxUploadSize: 1024,
+	}
+
+	upload := func(t *testing.T, files map[string][]byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("name", "alice")
+		for name, data := range files {
+			fw, err := mw.CreateFormFile("avatar", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = fw.Write(data)
+		}
+		_ = mw.Close()
+
+		req := httptest.NewRequest("POST", "/avatar", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status code: got %v, want %v: %s", rr.Code, http.StatusOK, rr.Body)
+		}
+		return rr
+	}
+
+	t.Run("saved", func(t *testing.T) {
+		rr := upload(t, map[string][]byte{"../me.PNG": png})
+		want := `<ul><li>me.PNG image/png 108</li></ul><p></p><p>alice</p>`
+		if rr.Body.String() != want {
+			t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), want)
+		}
+
+		saved, _ := filepath.Glob(filepath.Join(dir, "upload-*.png"))
+		if len(saved) != 1 {
+			t.Fatalf("want 1 saved file, got %v", saved)
+		}
+		data, _ := os.ReadFile(saved[0])
+		if !bytes.Equal(data, png) {
+			t.Errorf("saved content differs")
+		}
+	})
+
+	t.Run("extension of the content", func(t *testing.T) {
+		upload(t, map[string][]byte{"x.html": png})
+
+		if saved, _ := filepath.Glob(filepath.Join(dir, "upload-*.html")); len(saved) != 0 {
+			t.Errorf("the file is saved with the client's extension: %v", saved)
+		}
+		if saved, _ := filepath.Glob(filepath.Join(dir, "upload-*.png")); len(saved) != 2 {
+			t.Errorf("want 2 saved PNG files, got %v", saved)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			files map[string][]byte
+			want  string
+		}{
+			{"type", map[string][]byte{"a.png": []byte("<html></html>")}, "a.png: type text/html is not allowed"},
+			{"file size", map[string][]byte{"a.png": append(png, make([]byte, 200)...)}, "a.png exceeds 200 bytes"},
+			{"request size", map[string][]byte{"a.png": make([]byte, 2000)}, "the upload exceeds 1024 bytes"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := upload(t, tt.files)
+				if !strings.Contains(rr.Body.String(), "<ul></ul><p>"+tt.want+"</p>") {
+					t.Errorf("body: %s", rr.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("not submitted", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/avatar", nil))
+		if want := `<ul></ul><p></p>`; rr.Body.String() != want {
+			t.Errorf("body:\ngot  %s\nwant %s", rr.Body.String(), want)
+		}
+	})
+
+	t.Run("save callback", func(t *testing.T) {
+		var got []byte
+		uc := &UploadComponent{Save: func(_ context.Context, f *UploadedFile) (string, error) {
+			r, err := f.Open()
+			if err != nil {
+				return "", err
+			}
+			defer func() { _ = r.Close() }()
+			got, err = io.ReadAll(r)
+			return "key-1", err
+		}}
+		h := &Handler{
+			FileSystem: fstest.MapFS{"avatar.chtml": {Data: []byte(
+				`<c:upload as="up" field="avatar"></c:upload>${up.files[0].name}`)}},
+			BuiltinComponents: map[string]chtml.Component{"upload": uc},
+		}
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("avatar", "a.txt")
+		_, _ = fw.Write([]byte("hello"))
+		_ = mw.Close()
+		req := httptest.NewRequest("POST", "/avatar", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Body.String() != "key-1" || string(got) != "hello" {
+			t.Errorf("body %q, saved %q", rr.Body.String(), got)
+		}
+	})
+}
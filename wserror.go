@@ -0,0 +1,76 @@
+package pages
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// isWebSocketRequest reports whether the request is upgraded to a WebSocket connection. Only
+// the GET requests can be upgraded (RFC 6455), other requests with the upgrade headers (e.g.
+// HEAD) are served as regular HTTP requests.
+func isWebSocketRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && websocket.IsWebSocketUpgrade(r)
+}
+
+// wsErrorFrame is the message sent to a WebSocket client when the page fails to render, e.g.
+// {"error":{"status":500,"message":"Internal Server Error"}}. The details of the error are
+// logged, but not sent to the client.
+type wsErrorFrame struct {
+	Error wsErrorDetails `json:"error"`
+}
+
+type wsErrorDetails struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// errorFrame returns the JSON-encoded error frame with the status code.
+func errorFrame(status int) ([]byte, error) {
+	msg, err := json.Marshal(wsErrorFrame{Error: wsErrorDetails{
+		Status:  status,
+		Message: http.StatusText(status),
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("render error frame: %w", err)
+	}
+	return msg, nil
+}
+
+// writeWSError sends the error frame with the status code to the WebSocket client.
+func writeWSError(ws *websocket.Conn, status int) error {
+	msg, err := errorFrame(status)
+	if err != nil {
+		return err
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("write websocket message: %w", err)
+	}
+	return nil
+}
+
+// closeWSWithError sends the error frame and closes the WebSocket connection after an error the
+// rendering can't recover from, e.g. the exceeded render budget.
+func closeWSWithError(ws *websocket.Conn, status int) {
+	_ = writeWSError(ws, status)
+	msg := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, http.StatusText(status))
+	_ = ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// responseSentError is an error occurred after the response has been sent, e.g. after
+// the connection has been upgraded to WebSocket. It is logged and reported to Handler.OnError,
+// but no error response is written.
+type responseSentError struct {
+	err error
+}
+
+func (e *responseSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseSentError) Unwrap() error {
+	return e.err
+}
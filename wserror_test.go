@@ -0,0 +1,110 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpotapov/go-pages/chtml"
+	"github.com/gorilla/websocket"
+)
+
+func TestPages_WebSocketOutputs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.chtml":   {Data: []byte(`<p>page</p>`)},
+		"data.chtml":   {Data: []byte(`${ {"a": 1} }`)},
+		"text.chtml":   {Data: []byte(`plain`)},
+		"broken.chtml": {Data: []byte(`<p><c:fail-on-request></c:fail-on-request></p>`)},
+	}
+	newServer := func(t *testing.T, h *Handler) string {
+		h.FileSystem = fsys
+		h.BuiltinComponents = map[string]chtml.Component{"fail-on-request": requestFailingComponent{}}
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	// dial connects to the page and requests the first render
+	dial := func(t *testing.T, url string) (*websocket.Conn, *http.Response, error) {
+		ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+		if err != nil {
+			return nil, resp, err
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws, resp, ws.WriteJSON(map[string]any{})
+	}
+
+	url := newServer(t, &Handler{})
+
+	for _, tt := range []struct{ path, want string }{
+		{"/page", `<p>page</p>`},
+		{"/data", "{\"a\":1}\n"},
+		{"/text", `plain`},
+		{"/broken", `{"error":{"status":500,"message":"Internal Server Error"}}`},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			ws, _, err := dial(t, url+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(msg) != tt.want {
+				t.Errorf("got %q, want %q", msg, tt.want)
+			}
+		})
+	}
+
+	t.Run("render error keeps the connection", func(t *testing.T) {
+		ws, _, err := dial(t, url+"/broken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 2 {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ws.WriteJSON(map[string]any{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, resp, err := dial(t, url+"/missing")
+		if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 handshake failure, got %v", err)
+		}
+	})
+
+	t.Run("HEAD", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodHead, url+"/page", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("budget exceeded", func(t *testing.T) {
+		ws, _, err := dial(t, newServer(t, &Handler{RenderBudget: 1})+"/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := ws.ReadMessage()
+		if err != nil || !strings.Contains(string(msg), `"status":500`) {
+			t.Fatalf("got %q, %v", msg, err)
+		}
+		if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+			t.Errorf("expected internal error close, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package pages
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// defaultWebSocketMaxMessageSize is the default of Handler.WebSocketMaxMessageSize.
+const defaultWebSocketMaxMessageSize = 64 << 10
+
+// wsIgnoredVars are the variables sent by the client libraries along with the form values,
+// e.g. the request headers sent by the HTMX WebSocket extension. They are always dropped.
+var wsIgnoredVars = map[string]bool{"HEADERS": true}
+
+// validateWSVars checks the variables received from a WebSocket client against the arguments
+// declared by the page component (see chtml.InputDeclarer). The values are converted to the
+// types of the argument defaults, e.g. a JSON number to an int.
+//
+// The undeclared variables and the variables of a wrong type are dropped, or reported as an error
+// if strict is set. If inputs is nil (the component does not declare its arguments), the
+// variables are returned as is.
+func validateWSVars(vars, inputs map[string]any, strict bool) (map[string]any, error) {
+	for k := range wsIgnoredVars {
+		delete(vars, k)
+	}
+	if inputs == nil {
+		return vars, nil
+	}
+
+	res := make(map[string]any, len(vars))
+	for k, v := range vars {
+		def, ok := inputs[k]
+		if !ok {
+			if strict {
+				return nil, fmt.Errorf("unknown variable %q", k)
+			}
+			continue
+		}
+		cv, err := convertWSValue(v, def)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("variable %q: %w", k, err)
+			}
+			continue
+		}
+		res[k] = cv
+	}
+	return res, nil
+}
+
+// convertWSValue converts a value decoded from JSON to the type of the default value. Only the
+// scalar defaults (strings, numbers and booleans) are enforced, other values are passed as is.
+func convertWSValue(v, def any) (any, error) {
+	if v == nil || def == nil {
+		return v, nil
+	}
+
+	dt := reflect.TypeOf(def)
+	vv := reflect.ValueOf(v)
+
+	switch dt.Kind() {
+	case reflect.String, reflect.Bool:
+		if vv.Kind() != dt.Kind() {
+			return nil, fmt.Errorf("expected %s, got %T", dt, v)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("expected %s, got %v", dt, v)
+		}
+		cv := vv.Convert(dt)
+		if cv.Convert(vv.Type()).Float() != f {
+			return nil, fmt.Errorf("%v overflows %s", v, dt)
+		}
+		return cv.Interface(), nil
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(float64); !ok {
+			return nil, fmt.Errorf("expected %s, got %T", dt, v)
+		}
+	default:
+		return v, nil
+	}
+	return vv.Convert(dt).Interface(), nil
+}
@@ -0,0 +1,130 @@
+package pages
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestValidateWSVars(t *testing.T) {
+	inputs := map[string]any{"name": "", "n": 1, "ratio": 0.5, "on": false, "data": nil}
+
+	tests := []struct {
+		name    string
+		vars    map[string]any
+		strict  bool
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "converted",
+			vars: map[string]any{"name": "x", "n": float64(2), "ratio": float64(1), "on": true, "data": []any{1.0}},
+			want: map[string]any{"name": "x", "n": 2, "ratio": 1.0, "on": true, "data": []any{1.0}},
+		},
+		{
+			name: "unknown and mistyped dropped",
+			vars: map[string]any{"name": 1.0, "n": 1.5, "admin": true, "HEADERS": map[string]any{}},
+			want: map[string]any{},
+		},
+		{
+			name:    "unknown rejected",
+			vars:    map[string]any{"admin": true},
+			strict:  true,
+			wantErr: `unknown variable "admin"`,
+		},
+		{
+			name:    "mistyped rejected",
+			vars:    map[string]any{"n": "1"},
+			strict:  true,
+			wantErr: `variable "n": expected int, got 1`,
+		},
+		{
+			name:   "headers ignored",
+			vars:   map[string]any{"HEADERS": map[string]any{}},
+			strict: true,
+			want:   map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateWSVars(tt.vars, inputs, tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("undeclared inputs", func(t *testing.T) {
+		got, _ := validateWSVars(map[string]any{"any": 1.0}, nil, true)
+		if !reflect.DeepEqual(got, map[string]any{"any": 1.0}) {
+			t.Errorf("got %#v", got)
+		}
+	})
+}
+
+func TestPages_WebSocketVars(t *testing.T) {
+	fsys := fstest.MapFS{
+		"counter.chtml": {Data: []byte(`<c:attr name="n">${1}</c:attr><p>${n + 1}</p>`)},
+	}
+
+	dial := func(t *testing.T, h *Handler) *websocket.Conn {
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/counter", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	}
+
+	t.Run("dropped", func(t *testing.T) {
+		ws := dial(t, &Handler{FileSystem: fsys})
+		if err := ws.WriteJSON(map[string]any{"n": 41, "admin": true}); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != "<p>42</p>" {
+			t.Errorf("got %q", msg)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		ws := dial(t, &Handler{FileSystem: fsys, WebSocketStrictVars: true})
+		if err := ws.WriteJSON(map[string]any{"admin": true}); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := ws.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("expected policy violation, got %v", err)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		ws := dial(t, &Handler{FileSystem: fsys, WebSocketMaxMessageSize: 16})
+		if err := ws.WriteJSON(map[string]any{"n": 1, "padding": strings.Repeat("x", 64)}); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := ws.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("expected message too big, got %v", err)
+		}
+	})
+}